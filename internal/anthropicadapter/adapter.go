@@ -0,0 +1,207 @@
+// Package anthropicadapter defines the Anthropic Messages API as served to clients by
+// adapters for other providers, the reverse of package openaiadapter.
+//
+// Only the subset of the Messages API that can be mapped to other providers is modeled:
+// text, image and document content, tool use and thinking. Types follow the wire format,
+// so requests decode and responses encode with encoding/json directly.
+package anthropicadapter
+
+import (
+	"encoding/json"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+)
+
+// CreateMessageAdapter serves Anthropic Messages API requests from another provider.
+type CreateMessageAdapter = openaiadapter.Adapter[
+	CreateMessageRequest,
+	Message,
+	MessageStreamEvent,
+]
+
+// CreateMessageRequest is an Anthropic Messages API request.
+type CreateMessageRequest struct {
+	Model         string         `json:"model"`
+	MaxTokens     int64          `json:"max_tokens"`
+	Messages      []MessageParam `json:"messages"`
+	System        Content        `json:"system,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	TopP          *float64       `json:"top_p,omitempty"`
+	StopSequences []string       `json:"stop_sequences,omitempty"`
+	Tools         []Tool         `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice    `json:"tool_choice,omitempty"`
+}
+
+// MessageParam is a conversation turn of a request.
+type MessageParam struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// Content is message, system or tool result content, which the API accepts as a string
+// or as content blocks.
+type Content []ContentBlock
+
+// UnmarshalJSON decodes content blocks, or a string as a single text block.
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Content{{Type: "text", Text: text}}
+		return nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// ContentBlock is a content block of a request or response. Type selects the fields in use.
+type ContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image, document
+	Source *Source `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string  `json:"tool_use_id,omitempty"`
+	Content   Content `json:"content,omitempty"`
+	IsError   bool    `json:"is_error,omitempty"`
+
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// MarshalJSON encodes the fields of the block's type, including empty ones the API
+// always sends, such as the text of a text block starting a stream.
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	switch b.Type {
+	case "text":
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}{b.Type, b.Text})
+	case "thinking":
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			Thinking  string `json:"thinking"`
+			Signature string `json:"signature"`
+		}{b.Type, b.Thinking, b.Signature})
+	case "tool_use":
+		input := b.Input
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		return json.Marshal(struct {
+			Type  string          `json:"type"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		}{b.Type, b.ID, b.Name, input})
+	default:
+		type contentBlock ContentBlock // drops the MarshalJSON method
+		return json.Marshal(contentBlock(b))
+	}
+}
+
+// Source is the source of an image or document block.
+type Source struct {
+	// Type is base64, url or text.
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// Tool is a client tool the model may call.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice controls how the model uses tools.
+type ToolChoice struct {
+	// Type is auto, any, tool or none.
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// Message is a Messages API response.
+type Message struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+// Usage reports the tokens of a response.
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// MessageStreamEvent is an event of a streaming response. Type is also the SSE event name.
+type MessageStreamEvent struct {
+	Type         string        `json:"type"`
+	Message      *Message      `json:"message,omitempty"`
+	Index        *int64        `json:"index,omitempty"`
+	ContentBlock *ContentBlock `json:"content_block,omitempty"`
+	Delta        *Delta        `json:"delta,omitempty"`
+	Usage        *Usage        `json:"usage,omitempty"`
+}
+
+// Delta is the delta of a content_block_delta or message_delta event.
+type Delta struct {
+	// Type is text_delta, input_json_delta or thinking_delta; empty for message_delta.
+	Type        string `json:"type,omitempty"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+// ErrorResponse is a Messages API error. StatusCode is the HTTP status to respond with.
+type ErrorResponse struct {
+	Type       string `json:"type"`
+	Err        Error  `json:"error"`
+	StatusCode int    `json:"-"`
+}
+
+// Error describes an ErrorResponse.
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface, returning the error message.
+func (e *ErrorResponse) Error() string {
+	return e.Err.Message
+}
+
+// NewErrorResponse creates an error response of the given Anthropic error type.
+func NewErrorResponse(status int, errType, message string) *ErrorResponse {
+	return &ErrorResponse{
+		Type:       "error",
+		Err:        Error{Type: errType, Message: message},
+		StatusCode: status,
+	}
+}
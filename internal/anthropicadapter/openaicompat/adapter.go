@@ -0,0 +1,218 @@
+// Package openaicompat serves Anthropic Messages API requests from OpenAI-compatible chat
+// completion servers, such as llama.cpp or vLLM, so Anthropic SDK clients can use local
+// models without code changes.
+//
+// Requests are sent to the chat completions endpoint below the configured base URL.
+// Tool use maps to function calling, and reasoning_content returned by servers that
+// separate it maps to thinking blocks. Streaming responses are translated chunk by chunk.
+//
+// # Adapters
+//
+// CreateMessageAdapter: Anthropic Messages → OpenAI CreateChatCompletion
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter"
+)
+
+// maxErrorBodyBytes bounds the upstream error bodies read for their message.
+const maxErrorBodyBytes = 64 << 10
+
+// CreateMessageAdapter serves Messages API requests from an OpenAI-compatible server.
+type CreateMessageAdapter struct {
+	chatCompletionsURL string
+}
+
+// Compile-time interface implementation check.
+var _ anthropicadapter.CreateMessageAdapter = (*CreateMessageAdapter)(nil)
+
+// NewCreateMessageAdapter creates an adapter for the server at baseURL, e.g.
+// http://localhost:8080/v1.
+func NewCreateMessageAdapter(baseURL string) *CreateMessageAdapter {
+	return &CreateMessageAdapter{
+		chatCompletionsURL: strings.TrimSuffix(baseURL, "/") + "/chat/completions",
+	}
+}
+
+// ProcessRequest handles non-streaming Messages API requests.
+// Errors are returned in Anthropic-compatible format.
+func (a *CreateMessageAdapter) ProcessRequest(
+	ctx context.Context,
+	clientReq anthropicadapter.CreateMessageRequest,
+	transport http.RoundTripper,
+) (*anthropicadapter.Message, error) {
+	chatReq, err := toChatRequest(clientReq)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.send(ctx, chatReq, transport)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var chatResp chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("decode chat completion: %w", err)
+	}
+	return fromChatResponse(chatResp, clientReq.Model)
+}
+
+// ProcessStreamingRequest handles streaming Messages API requests.
+// Errors are returned in Anthropic-compatible format, both before and during the stream.
+func (a *CreateMessageAdapter) ProcessStreamingRequest(
+	ctx context.Context,
+	clientReq anthropicadapter.CreateMessageRequest,
+	transport http.RoundTripper,
+) (iter.Seq2[*anthropicadapter.MessageStreamEvent, error], error) {
+	chatReq, err := toChatRequest(clientReq)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Stream = true
+	chatReq.StreamOptions = &chatStreamOptions{IncludeUsage: true}
+
+	resp, err := a.send(ctx, chatReq, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(*anthropicadapter.MessageStreamEvent, error) bool) {
+		defer func() { _ = resp.Body.Close() }()
+
+		stream := newStreamState(clientReq.Model)
+		decoder := ssestream.NewDecoder(resp)
+		for decoder.Next() {
+			data := bytes.TrimSpace(decoder.Event().Data)
+			if len(data) == 0 {
+				continue
+			}
+			if string(data) == "[DONE]" {
+				break
+			}
+
+			var chunk chatChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				yield(nil, fmt.Errorf("decode chat completion chunk: %w", err))
+				return
+			}
+			if chunk.Error != nil {
+				yield(nil, anthropicadapter.NewErrorResponse(http.StatusInternalServerError, "api_error", chunk.Error.Message))
+				return
+			}
+
+			for _, event := range stream.events(chunk) {
+				if !yield(event, nil) {
+					return
+				}
+			}
+		}
+		if err := decoder.Err(); err != nil {
+			yield(nil, fmt.Errorf("read chat completion stream: %w", err))
+			return
+		}
+
+		for _, event := range stream.finish() {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}, nil
+}
+
+// send posts a chat completion request and returns the successful response.
+func (a *CreateMessageAdapter) send(
+	ctx context.Context,
+	chatReq *chatRequest,
+	transport http.RoundTripper,
+) (*http.Response, error) {
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal chat completion request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.chatCompletionsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create chat completion request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if chatReq.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send chat completion request: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, toErrorResponse(resp)
+	}
+	return resp, nil
+}
+
+// toErrorResponse converts an upstream error response, keeping its status and message.
+func toErrorResponse(resp *http.Response) *anthropicadapter.ErrorResponse {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+
+	// OpenAI uses {"error": {"message": ...}}; some servers return {"error": "..."} or plain text
+	var errBody struct {
+		Error json.RawMessage `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &errBody) == nil && errBody.Error != nil {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(errBody.Error, &detail) == nil && detail.Message != "" {
+			message = detail.Message
+		} else if json.Unmarshal(errBody.Error, &message) != nil {
+			message = string(errBody.Error)
+		}
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	return anthropicadapter.NewErrorResponse(resp.StatusCode, errorType(resp.StatusCode), message)
+}
+
+// errorType returns the Anthropic error type for an HTTP status.
+func errorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// newInvalidRequestError creates an Anthropic invalid_request_error.
+func newInvalidRequestError(format string, args ...any) *anthropicadapter.ErrorResponse {
+	return anthropicadapter.NewErrorResponse(http.StatusBadRequest, "invalid_request_error", fmt.Sprintf(format, args...))
+}
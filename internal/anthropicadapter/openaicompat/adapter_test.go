@@ -0,0 +1,193 @@
+package openaicompat_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter"
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter/openaicompat"
+)
+
+// fakeServer serves canned chat completion responses and records the last request body.
+type fakeServer struct {
+	*httptest.Server
+	request map[string]any
+}
+
+func newFakeServer(t *testing.T, status int, contentType, response string) *fakeServer {
+	t.Helper()
+	fake := &fakeServer{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path: got %s, want /v1/chat/completions", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &fake.request); err != nil {
+			t.Errorf("Failed to parse upstream request: %v", err)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, response)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// newMessageRequest parses a Messages API request.
+func newMessageRequest(t *testing.T, body string) anthropicadapter.CreateMessageRequest {
+	t.Helper()
+	var req anthropicadapter.CreateMessageRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("Failed to parse request: %v", err)
+	}
+	return req
+}
+
+// toolRequest is a Messages API conversation with a completed tool call.
+const toolRequest = `{"model":"llama-3","max_tokens":64,"system":"Be brief.","messages":[` +
+	`{"role":"user","content":"Weather in Berlin?"},` +
+	`{"role":"assistant","content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"call_1","name":"weather","input":{"city":"Berlin"}}]},` +
+	`{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"Sunny"},{"type":"text","text":"And tomorrow?"}]}],` +
+	`"tools":[{"name":"weather","description":"Get weather","input_schema":{"type":"object"}}],` +
+	`"tool_choice":{"type":"any"}}`
+
+func TestCreateMessageAdapter_ProcessRequest(t *testing.T) {
+	fake := newFakeServer(t, http.StatusOK, "application/json",
+		`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"Let me check.","tool_calls":[`+
+			`{"id":"call_2","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Berlin\",\"day\":1}"}}]},`+
+			`"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":42,"completion_tokens":7}}`)
+	adapter := openaicompat.NewCreateMessageAdapter(fake.URL + "/v1")
+
+	msg, err := adapter.ProcessRequest(context.Background(), newMessageRequest(t, toolRequest), http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("ProcessRequest failed: %v", err)
+	}
+
+	got, _ := json.Marshal(fake.request["messages"])
+	want := `[{"content":"Be brief.","role":"system"},` +
+		`{"content":"Weather in Berlin?","role":"user"},` +
+		`{"content":"Checking.","role":"assistant","tool_calls":[{"function":{"arguments":"{\"city\":\"Berlin\"}","name":"weather"},"id":"call_1","type":"function"}]},` +
+		`{"content":"Sunny","role":"tool","tool_call_id":"call_1"},` +
+		`{"content":"And tomorrow?","role":"user"}]`
+	if string(got) != want {
+		t.Errorf("messages:\n got %s\nwant %s", got, want)
+	}
+	if fake.request["tool_choice"] != "required" {
+		t.Errorf("tool_choice: got %v, want required", fake.request["tool_choice"])
+	}
+
+	if msg.ID != "msg_chatcmpl-1" || msg.Model != "llama-3" || msg.Role != "assistant" {
+		t.Errorf("Unexpected message metadata: %+v", msg)
+	}
+	if msg.StopReason == nil || *msg.StopReason != "tool_use" {
+		t.Errorf("stop_reason: got %v, want tool_use", msg.StopReason)
+	}
+	if msg.Usage.InputTokens != 42 || msg.Usage.OutputTokens != 7 {
+		t.Errorf("usage: got %+v", msg.Usage)
+	}
+	if len(msg.Content) != 2 || msg.Content[0].Text != "Let me check." ||
+		msg.Content[1].Type != "tool_use" || msg.Content[1].ID != "call_2" || string(msg.Content[1].Input) != `{"city":"Berlin","day":1}` {
+		content, _ := json.Marshal(msg.Content)
+		t.Errorf("Unexpected content: %s", content)
+	}
+}
+
+func TestCreateMessageAdapter_ProcessStreamingRequest(t *testing.T) {
+	fake := newFakeServer(t, http.StatusOK, "text/event-stream", strings.Join([]string{
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{"role":"assistant","reasoning_content":"Hmm."}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{"content":"Hel"}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{"content":"lo"}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Berlin\"}"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5}}`,
+		`data: [DONE]`,
+	}, "\n\n")+"\n\n")
+	adapter := openaicompat.NewCreateMessageAdapter(fake.URL + "/v1/")
+
+	req := newMessageRequest(t, `{"model":"llama-3","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+	stream, err := adapter.ProcessStreamingRequest(context.Background(), req, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("ProcessStreamingRequest failed: %v", err)
+	}
+
+	if fake.request["stream"] != true {
+		t.Errorf("Expected upstream streaming, got %v", fake.request["stream"])
+	}
+
+	var types []string
+	var text, input string
+	var last *anthropicadapter.MessageStreamEvent
+	for event, err := range stream {
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		types = append(types, event.Type)
+		if event.Type == "content_block_delta" {
+			text += event.Delta.Text
+			input += event.Delta.PartialJSON
+		}
+		if event.Type == "message_delta" {
+			last = event
+		}
+	}
+
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events:\n got %v\nwant %v", types, want)
+	}
+	if text != "Hello" || input != `{"city":"Berlin"}` {
+		t.Errorf("deltas: got text %q, input %q", text, input)
+	}
+	if last == nil || *last.Delta.StopReason != "tool_use" || last.Usage.OutputTokens != 5 {
+		t.Errorf("Unexpected message_delta: %+v", last)
+	}
+}
+
+func TestCreateMessageAdapter_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantStatus int
+		wantType   string
+		wantMsg    string
+	}{
+		{"openai error", http.StatusBadRequest, `{"error":{"message":"context too long","type":"invalid_request_error"}}`, http.StatusBadRequest, "invalid_request_error", "context too long"},
+		{"string error", http.StatusNotFound, `{"error":"model not found"}`, http.StatusNotFound, "not_found_error", "model not found"},
+		{"plain text", http.StatusServiceUnavailable, `loading model`, http.StatusServiceUnavailable, "overloaded_error", "loading model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeServer(t, tt.status, "application/json", tt.response)
+			adapter := openaicompat.NewCreateMessageAdapter(fake.URL + "/v1")
+
+			_, err := adapter.ProcessRequest(context.Background(),
+				newMessageRequest(t, `{"model":"llama-3","max_tokens":8,"messages":[{"role":"user","content":"Hi"}]}`),
+				http.DefaultTransport)
+
+			var errResp *anthropicadapter.ErrorResponse
+			if !errors.As(err, &errResp) {
+				t.Fatalf("Expected ErrorResponse, got %v", err)
+			}
+			if errResp.StatusCode != tt.wantStatus || errResp.Err.Type != tt.wantType || errResp.Err.Message != tt.wantMsg {
+				t.Errorf("got %d %s %q, want %d %s %q",
+					errResp.StatusCode, errResp.Err.Type, errResp.Err.Message, tt.wantStatus, tt.wantType, tt.wantMsg)
+			}
+		})
+	}
+}
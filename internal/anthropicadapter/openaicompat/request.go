@@ -0,0 +1,253 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter"
+)
+
+// chatRequest is the subset of an OpenAI chat completion request that OpenAI-compatible
+// servers commonly support.
+type chatRequest struct {
+	Model             string             `json:"model"`
+	Messages          []chatMessage      `json:"messages"`
+	MaxTokens         int64              `json:"max_tokens,omitempty"`
+	Temperature       *float64           `json:"temperature,omitempty"`
+	TopP              *float64           `json:"top_p,omitempty"`
+	Stop              []string           `json:"stop,omitempty"`
+	Tools             []chatTool         `json:"tools,omitempty"`
+	ToolChoice        any                `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool              `json:"parallel_tool_calls,omitempty"`
+	Stream            bool               `json:"stream,omitempty"`
+	StreamOptions     *chatStreamOptions `json:"stream_options,omitempty"`
+}
+
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatMessage is a chat completion message. Content is a string or content parts, and
+// omitted for assistant messages with tool calls only.
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    any            `json:"content,omitempty"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatContentPart struct {
+	Type     string             `json:"type"`
+	Text     string             `json:"text,omitempty"`
+	ImageURL *chatContentSource `json:"image_url,omitempty"`
+}
+
+type chatContentSource struct {
+	URL string `json:"url"`
+}
+
+type chatTool struct {
+	Type     string           `json:"type"`
+	Function chatToolFunction `json:"function"`
+}
+
+type chatToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// chatToolCall is a tool call of an assistant message or, with Index, a streamed delta of one.
+type chatToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function chatFunctionCall `json:"function"`
+}
+
+type chatFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// toChatRequest converts a Messages API request to a chat completion request. Thinking
+// blocks are dropped, as chat completions have no way to send them back.
+func toChatRequest(req anthropicadapter.CreateMessageRequest) (*chatRequest, error) {
+	chatReq := &chatRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+	}
+
+	if system := contentText(req.System); system != "" {
+		chatReq.Messages = append(chatReq.Messages, chatMessage{Role: "system", Content: system})
+	}
+
+	for i, msg := range req.Messages {
+		var messages []chatMessage
+		var err error
+		switch msg.Role {
+		case "user":
+			messages, err = fromUserMessage(msg)
+		case "assistant":
+			messages, err = fromAssistantMessage(msg)
+		default:
+			return nil, newInvalidRequestError("messages.%d: unsupported role %q", i, msg.Role)
+		}
+		if err != nil {
+			return nil, newInvalidRequestError("messages.%d: %s", i, err)
+		}
+		chatReq.Messages = append(chatReq.Messages, messages...)
+	}
+
+	for _, tool := range req.Tools {
+		chatReq.Tools = append(chatReq.Tools, chatTool{
+			Type: "function",
+			Function: chatToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "auto", "none":
+			chatReq.ToolChoice = choice.Type
+		case "any":
+			chatReq.ToolChoice = "required"
+		case "tool":
+			chatReq.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": choice.Name},
+			}
+		default:
+			return nil, newInvalidRequestError("tool_choice: unsupported type %q", choice.Type)
+		}
+		if choice.DisableParallelToolUse {
+			chatReq.ParallelToolCalls = new(bool)
+		}
+	}
+
+	return chatReq, nil
+}
+
+// fromUserMessage converts a user turn. Tool results become tool messages, which must
+// directly follow the assistant message with the tool calls, so they come first.
+func fromUserMessage(msg anthropicadapter.MessageParam) ([]chatMessage, error) {
+	var messages []chatMessage
+	var parts []chatContentPart
+
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, chatContentPart{Type: "text", Text: block.Text})
+		case "image":
+			url, err := imageURL(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, chatContentPart{Type: "image_url", ImageURL: &chatContentSource{URL: url}})
+		case "document":
+			if block.Source == nil || block.Source.Type != "text" {
+				return nil, errUnsupported("document blocks other than plain text")
+			}
+			parts = append(parts, chatContentPart{Type: "text", Text: block.Source.Data})
+		case "tool_result":
+			content := contentText(block.Content)
+			if block.IsError {
+				content = "Error: " + content
+			}
+			messages = append(messages, chatMessage{Role: "tool", ToolCallID: block.ToolUseID, Content: content})
+		default:
+			return nil, errUnsupported(block.Type + " blocks")
+		}
+	}
+
+	if len(parts) > 0 {
+		messages = append(messages, chatMessage{Role: "user", Content: userContent(parts)})
+	}
+	return messages, nil
+}
+
+// fromAssistantMessage converts an assistant turn, joining its text blocks.
+func fromAssistantMessage(msg anthropicadapter.MessageParam) ([]chatMessage, error) {
+	var text []string
+	var toolCalls []chatToolCall
+
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			arguments := "{}"
+			if len(block.Input) > 0 {
+				arguments = string(block.Input)
+			}
+			toolCalls = append(toolCalls, chatToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: chatFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		case "thinking", "redacted_thinking":
+			// Chat completions can't send reasoning back
+		default:
+			return nil, errUnsupported(block.Type + " blocks")
+		}
+	}
+
+	msgOut := chatMessage{Role: "assistant", ToolCalls: toolCalls}
+	if len(text) > 0 {
+		msgOut.Content = strings.Join(text, "")
+	}
+	if msgOut.Content == nil && len(toolCalls) == 0 {
+		return nil, nil
+	}
+	return []chatMessage{msgOut}, nil
+}
+
+// userContent returns parts as a plain string if they are a single text part, which
+// servers without content part support accept as well.
+func userContent(parts []chatContentPart) any {
+	if len(parts) == 1 && parts[0].Type == "text" {
+		return parts[0].Text
+	}
+	return parts
+}
+
+// imageURL returns the image of an image block as a URL, inlining base64 data.
+func imageURL(source *anthropicadapter.Source) (string, error) {
+	switch {
+	case source == nil:
+		return "", errUnsupported("image blocks without source")
+	case source.Type == "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case source.Type == "url":
+		return source.URL, nil
+	default:
+		return "", errUnsupported(source.Type + " image sources")
+	}
+}
+
+// contentText joins the text blocks of content.
+func contentText(content anthropicadapter.Content) string {
+	var b strings.Builder
+	for _, block := range content {
+		if block.Type == "text" {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+// errUnsupported reports content the upstream can't be sent.
+func errUnsupported(what string) error {
+	return anthropicadapter.NewErrorResponse(http.StatusBadRequest, "invalid_request_error", what+" are not supported by this model")
+}
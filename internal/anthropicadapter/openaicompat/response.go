@@ -0,0 +1,118 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter"
+)
+
+// chatResponse is the subset of a chat completion response the adapter reads.
+type chatResponse struct {
+	ID      string       `json:"id"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage"`
+}
+
+type chatChoice struct {
+	Message      chatResponseMessage `json:"message"`
+	FinishReason string              `json:"finish_reason"`
+}
+
+// chatResponseMessage is a response message or, in chunks, a delta of one.
+// ReasoningContent is returned by servers that separate reasoning from the answer.
+type chatResponseMessage struct {
+	Content          string         `json:"content"`
+	ReasoningContent string         `json:"reasoning_content"`
+	ToolCalls        []chatToolCall `json:"tool_calls"`
+}
+
+type chatUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// chatChunk is a streamed chat completion chunk. Servers report errors mid-stream as
+// chunks with an error object.
+type chatChunk struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Delta        chatResponseMessage `json:"delta"`
+		FinishReason string              `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// fromChatResponse converts a chat completion to a Messages API response for model.
+func fromChatResponse(resp chatResponse, model string) (*anthropicadapter.Message, error) {
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion %s has no choices", resp.ID)
+	}
+	choice := resp.Choices[0]
+
+	content := []anthropicadapter.ContentBlock{}
+	if choice.Message.ReasoningContent != "" {
+		content = append(content, anthropicadapter.ContentBlock{Type: "thinking", Thinking: choice.Message.ReasoningContent})
+	}
+	if choice.Message.Content != "" {
+		content = append(content, anthropicadapter.ContentBlock{Type: "text", Text: choice.Message.Content})
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		content = append(content, anthropicadapter.ContentBlock{
+			Type:  "tool_use",
+			ID:    toolCall.ID,
+			Name:  toolCall.Function.Name,
+			Input: toolInput(toolCall.Function.Arguments),
+		})
+	}
+
+	msg := newMessage(resp.ID, model)
+	msg.Content = content
+	msg.StopReason = stopReason(choice.FinishReason, len(choice.Message.ToolCalls) > 0)
+	if resp.Usage != nil {
+		msg.Usage = anthropicadapter.Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+		}
+	}
+	return msg, nil
+}
+
+// newMessage returns an empty assistant message for a chat completion.
+func newMessage(id, model string) *anthropicadapter.Message {
+	return &anthropicadapter.Message{
+		ID:      "msg_" + id,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []anthropicadapter.ContentBlock{},
+	}
+}
+
+// stopReason maps an OpenAI finish reason to an Anthropic stop reason. Some servers
+// finish tool calls with "stop", so tool calls take precedence.
+func stopReason(finishReason string, toolCalls bool) *string {
+	reason := "end_turn"
+	switch {
+	case toolCalls, finishReason == "tool_calls", finishReason == "function_call":
+		reason = "tool_use"
+	case finishReason == "length":
+		reason = "max_tokens"
+	case finishReason == "content_filter":
+		reason = "refusal"
+	}
+	return &reason
+}
+
+// toolInput returns tool call arguments as tool_use input, which must be a JSON object.
+// Servers may return empty or malformed arguments for calls without parameters.
+func toolInput(arguments string) json.RawMessage {
+	var input map[string]json.RawMessage
+	if json.Unmarshal([]byte(arguments), &input) != nil || input == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
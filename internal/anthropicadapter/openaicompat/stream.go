@@ -0,0 +1,148 @@
+package openaicompat
+
+import (
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter"
+)
+
+// streamState translates chat completion chunks to Messages API events. Chat completions
+// stream reasoning, text and tool call arguments as fields of one delta, while Anthropic
+// streams them as consecutive content blocks, so a block is opened whenever the kind of
+// content changes.
+type streamState struct {
+	model   string
+	started bool
+
+	// blockType is the type of the open content block, empty if none is open.
+	blockType string
+	// blockIndex is the index of the open content block, or of the next one if none is open.
+	blockIndex int64
+	// toolCallIndex is the OpenAI index of the tool call streamed in the open block.
+	toolCallIndex int
+
+	finishReason string
+	toolCalls    bool
+	usage        anthropicadapter.Usage
+}
+
+func newStreamState(model string) *streamState {
+	return &streamState{model: model}
+}
+
+// events returns the events for a chunk.
+func (s *streamState) events(chunk chatChunk) []*anthropicadapter.MessageStreamEvent {
+	var events []*anthropicadapter.MessageStreamEvent
+	if !s.started {
+		events = append(events, s.start(chunk.ID))
+	}
+	if chunk.Usage != nil {
+		s.usage = anthropicadapter.Usage{
+			InputTokens:  chunk.Usage.PromptTokens,
+			OutputTokens: chunk.Usage.CompletionTokens,
+		}
+	}
+	if len(chunk.Choices) == 0 {
+		return events
+	}
+
+	choice := chunk.Choices[0]
+	if choice.FinishReason != "" {
+		s.finishReason = choice.FinishReason
+	}
+
+	delta := choice.Delta
+	if delta.ReasoningContent != "" {
+		events = append(events, s.openBlock(anthropicadapter.ContentBlock{Type: "thinking"})...)
+		events = append(events, s.delta(&anthropicadapter.Delta{Type: "thinking_delta", Thinking: delta.ReasoningContent}))
+	}
+	if delta.Content != "" {
+		events = append(events, s.openBlock(anthropicadapter.ContentBlock{Type: "text"})...)
+		events = append(events, s.delta(&anthropicadapter.Delta{Type: "text_delta", Text: delta.Content}))
+	}
+	for _, toolCall := range delta.ToolCalls {
+		index := s.toolCallIndex
+		if toolCall.Index != nil {
+			index = *toolCall.Index
+		}
+		// A tool call starts with its ID; later deltas only carry arguments
+		if toolCall.ID != "" || s.blockType != "tool_use" || index != s.toolCallIndex {
+			s.toolCalls = true
+			s.toolCallIndex = index
+			events = append(events, s.closeBlock()...)
+			events = append(events, s.openBlock(anthropicadapter.ContentBlock{
+				Type: "tool_use",
+				ID:   toolCall.ID,
+				Name: toolCall.Function.Name,
+			})...)
+		}
+		if toolCall.Function.Arguments != "" {
+			events = append(events, s.delta(&anthropicadapter.Delta{Type: "input_json_delta", PartialJSON: toolCall.Function.Arguments}))
+		}
+	}
+	return events
+}
+
+// finish returns the events ending the message once the upstream stream is complete.
+func (s *streamState) finish() []*anthropicadapter.MessageStreamEvent {
+	var events []*anthropicadapter.MessageStreamEvent
+	if !s.started {
+		events = append(events, s.start(""))
+	}
+	events = append(events, s.closeBlock()...)
+
+	usage := s.usage
+	events = append(events,
+		&anthropicadapter.MessageStreamEvent{
+			Type:  "message_delta",
+			Delta: &anthropicadapter.Delta{StopReason: stopReason(s.finishReason, s.toolCalls)},
+			Usage: &usage,
+		},
+		&anthropicadapter.MessageStreamEvent{Type: "message_stop"},
+	)
+	return events
+}
+
+// start returns the message_start event.
+func (s *streamState) start(id string) *anthropicadapter.MessageStreamEvent {
+	s.started = true
+	return &anthropicadapter.MessageStreamEvent{
+		Type:    "message_start",
+		Message: newMessage(id, s.model),
+	}
+}
+
+// openBlock starts block unless a block of its type is already open. Tool use blocks are
+// always started, since every tool call is a block of its own.
+func (s *streamState) openBlock(block anthropicadapter.ContentBlock) []*anthropicadapter.MessageStreamEvent {
+	if s.blockType == block.Type && block.Type != "tool_use" {
+		return nil
+	}
+	events := s.closeBlock()
+	s.blockType = block.Type
+	index := s.blockIndex
+	return append(events, &anthropicadapter.MessageStreamEvent{
+		Type:         "content_block_start",
+		Index:        &index,
+		ContentBlock: &block,
+	})
+}
+
+// closeBlock stops the open block, if any.
+func (s *streamState) closeBlock() []*anthropicadapter.MessageStreamEvent {
+	if s.blockType == "" {
+		return nil
+	}
+	index := s.blockIndex
+	s.blockType = ""
+	s.blockIndex++
+	return []*anthropicadapter.MessageStreamEvent{{Type: "content_block_stop", Index: &index}}
+}
+
+// delta returns a content_block_delta event for the open block.
+func (s *streamState) delta(delta *anthropicadapter.Delta) *anthropicadapter.MessageStreamEvent {
+	index := s.blockIndex
+	return &anthropicadapter.MessageStreamEvent{
+		Type:  "content_block_delta",
+		Index: &index,
+		Delta: delta,
+	}
+}
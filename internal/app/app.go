@@ -1,16 +1,22 @@
 package app
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/florianilch/claudine-proxy/internal/bedrock"
 	"github.com/florianilch/claudine-proxy/internal/proxy"
 	anthropictokensource "github.com/florianilch/claudine-proxy/internal/tokensource"
 )
@@ -30,13 +36,105 @@ func New(cfg *Config) (*App, error) {
 
 	health := NewHealth()
 
+	transport, err := newUpstreamTransport(cfg.Upstream.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream transport: %w", err)
+	}
+
 	// I/O deferred to first Token() call
-	tokenSource, err := newTokenSource(cfg.Auth)
+	tokenSource, err := newTokenSource(cfg.Auth, transport)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token source: %w", err)
 	}
 
-	proxyServer, err := proxy.New(tokenSource, health, proxy.WithBaseURL(cfg.Upstream.BaseURL))
+	proxyOpts := []proxy.Option{
+		proxy.WithBaseURL(cfg.Upstream.BaseURL),
+		proxy.WithTransport(transport),
+	}
+
+	if cfg.Files.Enabled {
+		fileStore, err := cfg.Files.NewFileStore()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file store: %w", err)
+		}
+		proxyOpts = append(proxyOpts, proxy.WithFileStore(fileStore))
+	}
+
+	if cfg.Fetch.Enabled {
+		fetcher, err := cfg.Fetch.NewFetcher()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create url fetcher: %w", err)
+		}
+		proxyOpts = append(proxyOpts, proxy.WithURLFetcher(fetcher))
+		if cfg.Fetch.InlineMessages {
+			proxyOpts = append(proxyOpts, proxy.WithMessagesURLInlining())
+		}
+	}
+
+	if !cfg.Documents.Disabled {
+		proxyOpts = append(proxyOpts, proxy.WithDocumentConverter(cfg.Documents.NewConverter()))
+	}
+
+	if cfg.Continuation.MaxRounds > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithContinuation(cfg.Continuation.MaxRounds))
+	}
+
+	if cfg.Context.Strategy != "" {
+		proxyOpts = append(proxyOpts, proxy.WithContextManagement(proxy.ContextManagement{
+			Strategy:       cfg.Context.Strategy,
+			SummaryModel:   cfg.Context.SummaryModel,
+			CountTokens:    cfg.Context.CountTokens,
+			MaxInputTokens: cfg.Context.MaxInputTokens,
+		}))
+	}
+
+	proxyOpts = append(proxyOpts, proxy.WithHistoryMode(cfg.History.Mode))
+
+	if cfg.Auth.Method == AuthenticationMethodAPIKey {
+		proxyOpts = append(proxyOpts, proxy.WithAPIKeyAuth())
+	}
+
+	if cfg.Upstream.InternalStreaming.Enabled {
+		proxyOpts = append(proxyOpts, proxy.WithInternalStreaming(cfg.Upstream.InternalStreaming.Threshold))
+	}
+
+	if len(cfg.Upstreams) > 0 {
+		upstreams := make([]proxy.Upstream, 0, len(cfg.Upstreams))
+		for _, u := range cfg.Upstreams {
+			upstream := proxy.Upstream{
+				Name:    u.Name,
+				Type:    proxy.UpstreamType(u.Type),
+				BaseURL: u.BaseURL,
+				Models:  u.Models,
+			}
+			if u.Auth != nil {
+				ts, err := newTokenSource(*u.Auth, transport)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create token source for upstream %s: %w", u.Name, err)
+				}
+				upstream.TokenSource = ts
+			}
+			if u.Type == "bedrock" {
+				upstream.Region = cmp.Or(u.Region, bedrock.ResolveRegion(u.Profile))
+				if upstream.Region == "" {
+					return nil, fmt.Errorf("upstream %s: no AWS region configured", u.Name)
+				}
+				upstream.AWSCredentials = bedrock.NewDefaultCredentials(u.Profile)
+			}
+			upstreams = append(upstreams, upstream)
+		}
+		proxyOpts = append(proxyOpts, proxy.WithUpstreams(upstreams...))
+	}
+
+	if cfg.Server.TLS.Enabled() {
+		tlsConfig, err := newTLSConfig(cfg.Server.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TLS config: %w", err)
+		}
+		proxyOpts = append(proxyOpts, proxy.WithTLSConfig(tlsConfig))
+	}
+
+	proxyServer, err := proxy.New(tokenSource, health, proxyOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create proxy: %w", err)
 	}
@@ -57,7 +155,7 @@ func (a *App) Start(ctx context.Context) error {
 	var shutdownFuncs []func(context.Context) error
 
 	// Startup phase: Start services
-	slog.InfoContext(gCtx, "starting proxy server", "address", address)
+	slog.InfoContext(gCtx, "starting proxy server", "address", address, "tls", a.cfg.Server.TLS.Enabled())
 	proxyErrCh, err := a.proxy.Start(gCtx, address)
 	if err != nil {
 		return fmt.Errorf("proxy startup failed: %w", err)
@@ -111,9 +209,13 @@ func (a *App) Start(ctx context.Context) error {
 	return nil
 }
 
+// oauthEndpoint is where OAuth tokens are refreshed. Tests point it at a local server.
+var oauthEndpoint = anthropictokensource.Endpoint
+
 // newTokenSource creates a PersistentTokenSource from application configuration.
 // No I/O is performed - TokenSource creation is deferred to first Token() call.
-func newTokenSource(cfg AuthConfig) (*PersistentTokenSource, error) {
+// The transport is used for OAuth token refresh requests.
+func newTokenSource(cfg AuthConfig, transport http.RoundTripper) (*PersistentTokenSource, error) {
 	store, err := cfg.NewTokenStore()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token store: %w", err)
@@ -124,9 +226,11 @@ func newTokenSource(cfg AuthConfig) (*PersistentTokenSource, error) {
 	switch cfg.Method {
 	case AuthenticationMethodOAuth:
 		factory = func(token string) oauth2.TokenSource {
-			return anthropictokensource.NewTokenSource(token, anthropictokensource.Endpoint)
+			return anthropictokensource.NewTokenSource(token, oauthEndpoint,
+				anthropictokensource.WithTransport(transport),
+			)
 		}
-	case AuthenticationMethodStatic:
+	case AuthenticationMethodStatic, AuthenticationMethodAPIKey:
 		factory = func(token string) oauth2.TokenSource {
 			return oauth2.StaticTokenSource(&oauth2.Token{
 				AccessToken: token,
@@ -139,3 +243,38 @@ func newTokenSource(cfg AuthConfig) (*PersistentTokenSource, error) {
 
 	return NewPersistentTokenSource(factory, store)
 }
+
+// newTLSConfig creates the inbound TLS configuration from application configuration.
+// The certificate is served via a reloader so rotated files are picked up without restart.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	reloader, err := proxy.NewCertificateReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch cfg.MinVersion {
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	if cfg.ClientCAFile != "" {
+		caBundle, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("client CA bundle %s contains no valid certificates", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
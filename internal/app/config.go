@@ -4,12 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
 	"time"
 
+	"github.com/florianilch/claudine-proxy/internal/docconvert"
+	"github.com/florianilch/claudine-proxy/internal/filestore"
 	"github.com/florianilch/claudine-proxy/internal/tokenstore"
+	"github.com/florianilch/claudine-proxy/internal/urlfetch"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -36,6 +40,9 @@ type AuthenticationMethod string
 const (
 	AuthenticationMethodStatic AuthenticationMethod = "static"
 	AuthenticationMethodOAuth  AuthenticationMethod = "oauth"
+	// AuthenticationMethodAPIKey sends the stored token as a Console API key without
+	// impersonating Claude Code.
+	AuthenticationMethodAPIKey AuthenticationMethod = "apikey"
 )
 
 // Default configuration values
@@ -47,12 +54,37 @@ const (
 	DefaultConfigAuthStorage     = TokenStorageTypeKeyring
 	DefaultConfigAuthMethod      = AuthenticationMethodOAuth
 	DefaultConfigUpstreamBaseURL = "https://api.anthropic.com/v1"
+	DefaultConfigTLSMinVersion   = "1.2"
+	DefaultConfigFilesTTL        = 7 * 24 * time.Hour
+	DefaultConfigFilesQuota      = 1 << 30 // 1 GiB
+
+	DefaultConfigInternalStreamingThreshold = 16384
+	DefaultConfigHistoryMode                = "off"
 )
 
 // ServerConfig holds server-specific configuration.
 type ServerConfig struct {
-	Host string `json:"host" validate:"hostname_rfc1123|ip"`
-	Port uint16 `json:"port"` // Port range 0-65535 handled by uint16 type
+	Host string    `json:"host" validate:"hostname_rfc1123|ip"`
+	Port uint16    `json:"port"` // Port range 0-65535 handled by uint16 type
+	TLS  TLSConfig `json:"tls"`
+}
+
+// TLSConfig holds inbound TLS configuration. TLS is enabled when CertFile and KeyFile are set.
+type TLSConfig struct {
+	// Certificate and key files (PEM). Reloaded automatically when changed on disk.
+	CertFile string `json:"cert_file,omitempty" validate:"required_with=KeyFile"`
+	KeyFile  string `json:"key_file,omitempty" validate:"required_with=CertFile"`
+
+	// MinVersion is the minimum accepted TLS version.
+	MinVersion string `json:"min_version,omitempty" validate:"omitempty,oneof=1.2 1.3"`
+
+	// ClientCAFile enables mutual TLS: clients must present a certificate signed by a CA in this bundle.
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+}
+
+// Enabled reports whether TLS is configured.
+func (t *TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
 }
 
 // ShutdownConfig holds shutdown behavior configuration.
@@ -66,7 +98,208 @@ type ShutdownConfig struct {
 
 // UpstreamConfig holds upstream API configuration.
 type UpstreamConfig struct {
-	BaseURL string `json:"base_url" validate:"required,url"`
+	BaseURL           string                  `json:"base_url" validate:"required,url"`
+	Transport         TransportConfig         `json:"transport"`
+	InternalStreaming InternalStreamingConfig `json:"internal_streaming"`
+}
+
+// InternalStreamingConfig controls streaming of long non-streaming requests from upstream.
+// Responses are buffered and returned in the non-streaming shape, which avoids upstream
+// and response header timeouts on long generations.
+type InternalStreamingConfig struct {
+	// Enabled streams long non-streaming requests; otherwise they are sent as they are.
+	Enabled bool `json:"enabled"`
+
+	// Threshold is the max_tokens from which requests are streamed internally.
+	Threshold int `json:"threshold" validate:"gte=0"`
+}
+
+// TransportConfig holds outbound HTTP settings shared by upstream API calls and OAuth token refresh.
+// Zero values keep the defaults of proxy.DefaultTransport.
+type TransportConfig struct {
+	// ProxyURL routes outbound traffic through an egress proxy (http, https, socks5 or socks5h).
+	// Defaults to the HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment variables when unset.
+	ProxyURL string `json:"proxy_url,omitempty" validate:"omitempty,url"`
+
+	// CAFile is a PEM bundle trusted in addition to the system roots (e.g. TLS-inspecting proxies).
+	CAFile string `json:"ca_file,omitempty"`
+
+	// Timeouts for establishing connections and awaiting response headers.
+	ConnectTimeout        time.Duration `json:"connect_timeout"`
+	TLSHandshakeTimeout   time.Duration `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `json:"response_header_timeout"`
+
+	// Idle connection pool sizing.
+	MaxIdleConns        int           `json:"max_idle_conns" validate:"gte=0"`
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host" validate:"gte=0"`
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout"`
+
+	// DisableHTTP2 forces HTTP/1.1, e.g. for proxies that mishandle HTTP/2.
+	DisableHTTP2 bool `json:"disable_http2"`
+}
+
+// FilesConfig holds configuration of the local file store behind the OpenAI Files API.
+type FilesConfig struct {
+	// Enabled turns on the Files API and file_id references.
+	Enabled bool `json:"enabled"`
+
+	// Dir is where uploaded files are stored. Defaults to a directory in the user cache.
+	Dir string `json:"dir,omitempty"`
+
+	// TTL after which uploaded files expire.
+	TTL time.Duration `json:"ttl" validate:"gte=0"`
+
+	// Quota limits the total size of stored file contents in bytes.
+	Quota int64 `json:"quota" validate:"gte=0"`
+}
+
+// NewFileStore creates a file store from the files configuration.
+func (f *FilesConfig) NewFileStore() (*filestore.Store, error) {
+	return filestore.New(f.Dir,
+		filestore.WithTTL(f.TTL),
+		filestore.WithQuota(f.Quota),
+	)
+}
+
+// FetchConfig holds configuration for fetching remote images and documents, which are
+// inlined as base64 instead of being fetched by Anthropic (e.g. for intranet URLs).
+type FetchConfig struct {
+	// Enabled turns on fetching for URLs matching AllowedHosts or AllowedCIDRs.
+	Enabled bool `json:"enabled"`
+
+	// AllowedHosts are host names to fetch ("*.example.com" matches subdomains, "*" any host).
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+
+	// AllowedCIDRs are networks (or single addresses) to fetch from, e.g. 10.0.0.0/8.
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+
+	// MaxBytes limits the size of fetched resources. Defaults to urlfetch.DefaultMaxBytes.
+	MaxBytes int64 `json:"max_bytes" validate:"gte=0"`
+
+	// Timeout bounds each download. Defaults to urlfetch.DefaultTimeout.
+	Timeout time.Duration `json:"timeout" validate:"gte=0"`
+
+	// AllowedMIMETypes restricts fetched content types. Defaults to urlfetch.DefaultAllowedMIMETypes.
+	AllowedMIMETypes []string `json:"allowed_mime_types,omitempty"`
+
+	// CacheDir stores fetched resources for ETag revalidation. Defaults to a directory in the user cache.
+	CacheDir string `json:"cache_dir,omitempty"`
+
+	// CacheTTL after which unused cache entries are evicted.
+	CacheTTL time.Duration `json:"cache_ttl" validate:"gte=0"`
+
+	// InlineMessages also rewrites URL sources in native Messages API requests.
+	InlineMessages bool `json:"inline_messages"`
+}
+
+// NewFetcher creates a URL fetcher with on-disk cache from the fetch configuration.
+func (f *FetchConfig) NewFetcher() (*urlfetch.Fetcher, error) {
+	cidrs, err := urlfetch.ParseCIDRs(f.AllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := urlfetch.NewCache(f.CacheDir, f.CacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("create fetch cache: %w", err)
+	}
+	return urlfetch.New(urlfetch.Policy{
+		AllowedHosts:     f.AllowedHosts,
+		AllowedCIDRs:     cidrs,
+		MaxBytes:         f.MaxBytes,
+		Timeout:          f.Timeout,
+		AllowedMIMETypes: f.AllowedMIMETypes,
+	}, urlfetch.WithCache(cache)), nil
+}
+
+// DocumentsConfig holds configuration for converting documents Anthropic can't read, such
+// as Office or HTML files, to plain text documents.
+type DocumentsConfig struct {
+	// Disabled turns off conversion, so only PDF, text and image files are accepted.
+	Disabled bool `json:"disabled"`
+
+	// Formats are the formats to convert. Defaults to docconvert.DefaultFormats.
+	Formats []string `json:"formats,omitempty" validate:"dive,oneof=docx xlsx pptx html csv json"`
+
+	// MaxBytes limits the size of a document. Defaults to docconvert.DefaultMaxBytes.
+	MaxBytes int64 `json:"max_bytes" validate:"gte=0"`
+
+	// MaxTextBytes limits the size of the extracted text. Defaults to docconvert.DefaultMaxTextBytes.
+	MaxTextBytes int `json:"max_text_bytes" validate:"gte=0"`
+}
+
+// NewConverter creates a document converter from the documents configuration.
+func (d *DocumentsConfig) NewConverter() *docconvert.Converter {
+	formats := make([]docconvert.Format, 0, len(d.Formats))
+	for _, format := range d.Formats {
+		formats = append(formats, docconvert.Format(format))
+	}
+	return docconvert.New(docconvert.Policy{
+		Formats:      formats,
+		MaxBytes:     d.MaxBytes,
+		MaxTextBytes: d.MaxTextBytes,
+	})
+}
+
+// ContinuationConfig holds configuration for continuing chat completions that stop at the
+// output token limit instead of returning them with finish_reason "length".
+type ContinuationConfig struct {
+	// MaxRounds is the number of follow-up requests per response. Zero disables continuation.
+	MaxRounds int `json:"max_rounds" validate:"gte=0,lte=16"`
+}
+
+// ContextConfig holds configuration for trimming chat completion histories that exceed the
+// model's context window.
+type ContextConfig struct {
+	// Strategy is drop_oldest or summarize. Empty disables context management.
+	Strategy string `json:"strategy,omitempty" validate:"omitempty,oneof=drop_oldest summarize"`
+
+	// SummaryModel writes summaries for the summarize strategy. Defaults to a Haiku model.
+	SummaryModel string `json:"summary_model,omitempty"`
+
+	// CountTokens counts input tokens via Anthropic instead of estimating them.
+	CountTokens bool `json:"count_tokens"`
+
+	// MaxInputTokens overrides the input budget derived from the model's context window.
+	MaxInputTokens int `json:"max_input_tokens" validate:"gte=0"`
+}
+
+// UpstreamRouteConfig describes an additional upstream serving chat completions and
+// Messages API requests for the models it matches. Requests for other models go to the
+// default Anthropic upstream.
+type UpstreamRouteConfig struct {
+	// Name identifies the upstream in logs and errors.
+	Name string `json:"name"`
+
+	// Type is anthropic-oauth, anthropic-apikey, openai-compatible or bedrock.
+	Type string `json:"type" validate:"required,oneof=anthropic-oauth anthropic-apikey openai-compatible bedrock"`
+
+	// BaseURL is the API root, e.g. http://localhost:8080/v1. Required except for bedrock,
+	// where it optionally overrides the runtime endpoint of the region.
+	BaseURL string `json:"base_url" validate:"omitempty,url"`
+
+	// Region is the AWS region of bedrock upstreams. Defaults to AWS_REGION,
+	// AWS_DEFAULT_REGION or the region of the AWS profile.
+	Region string `json:"region"`
+
+	// Profile is the AWS profile of bedrock upstreams, used for shared credentials and
+	// region. Defaults to AWS_PROFILE or "default".
+	Profile string `json:"profile"`
+
+	// Models are glob patterns of the model IDs served, e.g. "llama-*".
+	Models []string `json:"models" validate:"required,min=1"`
+
+	// Auth locates the token. Required for Anthropic upstreams; openai-compatible upstreams
+	// without it send no credentials, and bedrock upstreams use the AWS credentials chain.
+	// The method follows from Type.
+	Auth *AuthConfig `json:"auth,omitempty"`
+}
+
+// HistoryConfig holds configuration for chat completion histories Anthropic would reject,
+// such as tool calls without results or consecutive user messages.
+type HistoryConfig struct {
+	// Mode is off (send the history as received), repair (normalize the history) or
+	// strict (reject the request).
+	Mode string `json:"mode" validate:"oneof=off repair strict"`
 }
 
 // AuthConfig represents the configuration for provider authentication.
@@ -81,7 +314,7 @@ type AuthConfig struct {
 	KeyringUser string `json:"keyring_user,omitempty"` // For keyring storage: user identifier
 
 	// Authentication method - how to convert stored_token to access_token
-	Method AuthenticationMethod `json:"method" validate:"required,oneof=oauth static"`
+	Method AuthenticationMethod `json:"method" validate:"required,oneof=oauth static apikey"`
 }
 
 // NewTokenStore creates a TokenStore from the authentication configuration.
@@ -101,12 +334,20 @@ func (a *AuthConfig) NewTokenStore() (tokenstore.TokenStore, error) {
 // Config holds the application's configuration.
 type Config struct {
 	// LogLevel for logging output (defaults to Info if unset).
-	LogLevel  slog.Level     `json:"log_level"`
-	LogFormat LogFormat      `json:"log_format" validate:"oneof=text json"`
-	Server    ServerConfig   `json:"server"`
-	Shutdown  ShutdownConfig `json:"shutdown"`
-	Upstream  UpstreamConfig `json:"upstream"`
-	Auth      AuthConfig     `json:"auth"`
+	LogLevel     slog.Level         `json:"log_level"`
+	LogFormat    LogFormat          `json:"log_format" validate:"oneof=text json"`
+	Server       ServerConfig       `json:"server"`
+	Shutdown     ShutdownConfig     `json:"shutdown"`
+	Upstream     UpstreamConfig     `json:"upstream"`
+	Auth         AuthConfig         `json:"auth"`
+	Files        FilesConfig        `json:"files"`
+	Fetch        FetchConfig        `json:"fetch"`
+	Documents    DocumentsConfig    `json:"documents"`
+	Continuation ContinuationConfig `json:"continuation"`
+	Context      ContextConfig      `json:"context"`
+	History      HistoryConfig      `json:"history"`
+
+	Upstreams []UpstreamRouteConfig `json:"upstreams" validate:"dive"`
 }
 
 // Default creates a new Config with default values applied.
@@ -129,18 +370,63 @@ func (c *Config) ApplyDefaults() error {
 	if c.Server.Port == 0 {
 		c.Server.Port = DefaultConfigServerPort
 	}
+	if c.Server.TLS.Enabled() && c.Server.TLS.MinVersion == "" {
+		c.Server.TLS.MinVersion = DefaultConfigTLSMinVersion
+	}
 	if c.Shutdown.Timeout == 0 {
 		c.Shutdown.Timeout = DefaultConfigShutdownTimeout
 	}
 	if c.Upstream.BaseURL == "" {
 		c.Upstream.BaseURL = DefaultConfigUpstreamBaseURL
 	}
+	if c.Upstream.InternalStreaming.Threshold == 0 {
+		c.Upstream.InternalStreaming.Threshold = DefaultConfigInternalStreamingThreshold
+	}
+	if c.History.Mode == "" {
+		c.History.Mode = DefaultConfigHistoryMode
+	}
 	if c.Auth.Storage == "" {
 		c.Auth.Storage = DefaultConfigAuthStorage
 	}
 	if c.Auth.Method == "" {
 		c.Auth.Method = DefaultConfigAuthMethod
 	}
+	if c.Files.TTL == 0 {
+		c.Files.TTL = DefaultConfigFilesTTL
+	}
+	if c.Files.Quota == 0 {
+		c.Files.Quota = DefaultConfigFilesQuota
+	}
+	if c.Files.Enabled && c.Files.Dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("files.dir required (auto-detect failed: %w)", err)
+		}
+		c.Files.Dir = filepath.Join(cacheDir, "claudine-proxy", "files")
+	}
+	if c.Fetch.CacheTTL == 0 {
+		c.Fetch.CacheTTL = urlfetch.DefaultCacheTTL
+	}
+	if c.Fetch.Enabled && c.Fetch.CacheDir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("fetch.cache_dir required (auto-detect failed: %w)", err)
+		}
+		c.Fetch.CacheDir = filepath.Join(cacheDir, "claudine-proxy", "fetch")
+	}
+
+	for i := range c.Upstreams {
+		if auth := c.Upstreams[i].Auth; auth != nil && auth.Method == "" {
+			switch c.Upstreams[i].Type {
+			case "anthropic-oauth":
+				auth.Method = AuthenticationMethodOAuth
+			case "anthropic-apikey":
+				auth.Method = AuthenticationMethodAPIKey
+			default:
+				auth.Method = AuthenticationMethodStatic
+			}
+		}
+	}
 
 	// Dynamic defaults based on storage type
 	switch c.Auth.Storage {
@@ -178,6 +464,47 @@ func (c *Config) Validate() error {
 		return errors.New("oauth authentication requires writable storage, env is read-only")
 	}
 
+	for _, u := range c.Upstreams {
+		if u.BaseURL == "" && u.Type != "bedrock" {
+			return fmt.Errorf("upstream %s: %s requires base_url", u.Name, u.Type)
+		}
+		if u.Type == "bedrock" && u.Auth != nil {
+			return fmt.Errorf("upstream %s: bedrock uses AWS credentials, auth is not supported", u.Name)
+		}
+		if u.Auth == nil && (u.Type == "anthropic-oauth" || u.Type == "anthropic-apikey") {
+			return fmt.Errorf("upstream %s: %s requires auth", u.Name, u.Type)
+		}
+		if u.Auth != nil && u.Auth.Method == AuthenticationMethodOAuth && u.Auth.Storage == TokenStorageTypeEnv {
+			return fmt.Errorf("upstream %s: oauth authentication requires writable storage, env is read-only", u.Name)
+		}
+	}
+
+	if proxyURL := c.Upstream.Transport.ProxyURL; proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid upstream.transport.proxy_url: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported upstream.transport.proxy_url scheme %q (expected: http, https, socks5, socks5h)", u.Scheme)
+		}
+	}
+
+	// mTLS requires a server certificate to terminate TLS
+	if c.Server.TLS.ClientCAFile != "" && !c.Server.TLS.Enabled() {
+		return errors.New("server.tls.client_ca_file requires server.tls.cert_file and server.tls.key_file")
+	}
+
+	if c.Fetch.Enabled {
+		if len(c.Fetch.AllowedHosts) == 0 && len(c.Fetch.AllowedCIDRs) == 0 {
+			return errors.New("fetch.enabled requires fetch.allowed_hosts or fetch.allowed_cidrs")
+		}
+		if _, err := urlfetch.ParseCIDRs(c.Fetch.AllowedCIDRs); err != nil {
+			return fmt.Errorf("invalid fetch.allowed_cidrs: %w", err)
+		}
+	}
+
 	switch c.Auth.Storage {
 	case TokenStorageTypeFile:
 		if c.Auth.File == "" {
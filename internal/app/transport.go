@@ -0,0 +1,93 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/florianilch/claudine-proxy/internal/proxy"
+)
+
+// proxySchemes are the egress proxy schemes supported by http.Transport.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// newUpstreamTransport creates the outbound transport from application configuration.
+// Starts from proxy.DefaultTransport and overrides only configured values, so a single
+// transport (and connection pool) serves both API calls and OAuth token refresh.
+func newUpstreamTransport(cfg TransportConfig) (*http.Transport, error) {
+	t := proxy.DefaultTransport()
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		// Without this check, a URL missing its scheme such as "proxy:3128" parses fine
+		// and only fails on the first request
+		if !slices.Contains(proxySchemes, proxyURL.Scheme) || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: expected scheme http, https, socks5 or socks5h and a host", cfg.ProxyURL)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+
+		// Extend rather than replace system roots: the upstream API still presents public certificates
+		// when no TLS-inspecting proxy is in the path.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s contains no valid certificates", cfg.CAFile)
+		}
+
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if cfg.ConnectTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   cfg.ConnectTimeout,
+			KeepAlive: 30 * time.Second, // Matches http.DefaultTransport
+		}
+		t.DialContext = dialer.DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	}
+
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	if cfg.DisableHTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		t.Protocols = protocols
+		t.ForceAttemptHTTP2 = false
+	}
+
+	return t, nil
+}
@@ -0,0 +1,363 @@
+package bedrock
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// expiryWindow is how long before expiry credentials are refreshed, so requests
+	// aren't signed with credentials expiring in flight.
+	expiryWindow = 5 * time.Minute
+
+	// metadataTimeout bounds requests to the container and instance metadata endpoints,
+	// which are unreachable outside AWS.
+	metadataTimeout = 2 * time.Second
+
+	containerCredentialsHost = "http://169.254.170.2"
+	instanceMetadataHost     = "http://169.254.169.254"
+)
+
+// ErrNoCredentials is returned when no provider of the credentials chain has credentials.
+var ErrNoCredentials = errors.New("no AWS credentials found")
+
+// Credentials are AWS credentials. Expires is zero for long-term credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// CredentialsProvider retrieves AWS credentials for signing requests.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials provides fixed credentials.
+type StaticCredentials Credentials
+
+// Retrieve implements CredentialsProvider.
+func (c StaticCredentials) Retrieve(context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// DefaultCredentials resolves credentials like the AWS SDKs' default chain, in order:
+//   - environment: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//   - shared files: the profile's keys in ~/.aws/credentials or ~/.aws/config
+//     (AWS_SHARED_CREDENTIALS_FILE, AWS_CONFIG_FILE)
+//   - container credentials of ECS and EKS Pod Identity
+//     (AWS_CONTAINER_CREDENTIALS_RELATIVE_URI, AWS_CONTAINER_CREDENTIALS_FULL_URI)
+//   - the EC2 instance role via IMDSv2, unless AWS_EC2_METADATA_DISABLED is true
+//
+// SSO, web identity and assume-role profiles aren't supported.
+//
+// Credentials are cached until shortly before they expire.
+type DefaultCredentials struct {
+	profile string
+	client  *http.Client
+
+	mu    sync.Mutex
+	creds *Credentials
+}
+
+// NewDefaultCredentials creates the default credentials chain for profile. An empty
+// profile uses AWS_PROFILE, falling back to "default".
+func NewDefaultCredentials(profile string) *DefaultCredentials {
+	return &DefaultCredentials{
+		profile: resolveProfile(profile),
+		client:  &http.Client{Timeout: metadataTimeout},
+	}
+}
+
+// Retrieve implements CredentialsProvider.
+func (d *DefaultCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.creds != nil && (d.creds.Expires.IsZero() || time.Until(d.creds.Expires) > expiryWindow) {
+		return *d.creds, nil
+	}
+
+	providers := []func(context.Context) (*Credentials, error){
+		envCredentials,
+		d.sharedCredentials,
+		d.containerCredentials,
+		d.instanceCredentials,
+	}
+	for _, provider := range providers {
+		creds, err := provider(ctx)
+		if err != nil {
+			return Credentials{}, err
+		}
+		if creds != nil {
+			d.creds = creds
+			return *creds, nil
+		}
+	}
+	return Credentials{}, ErrNoCredentials
+}
+
+// envCredentials reads credentials from the environment.
+func envCredentials(context.Context) (*Credentials, error) {
+	accessKeyID := firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY")
+	secretAccessKey := firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, nil
+	}
+	return &Credentials{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil
+}
+
+// sharedCredentials reads the profile's keys from the shared credentials file, then
+// from the shared config file.
+func (d *DefaultCredentials) sharedCredentials(context.Context) (*Credentials, error) {
+	for _, section := range []struct {
+		file, name string
+	}{
+		{sharedCredentialsFile(), d.profile},
+		{sharedConfigFile(), configSection(d.profile)},
+	} {
+		values, err := readProfile(section.file, section.name)
+		if err != nil {
+			return nil, err
+		}
+		if values["aws_access_key_id"] != "" && values["aws_secret_access_key"] != "" {
+			return &Credentials{
+				AccessKeyID:     values["aws_access_key_id"],
+				SecretAccessKey: values["aws_secret_access_key"],
+				SessionToken:    values["aws_session_token"],
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// containerCredentials fetches credentials from the ECS or EKS Pod Identity agent.
+func (d *DefaultCredentials) containerCredentials(ctx context.Context) (*Credentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = containerCredentialsHost + relative
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("container credentials: %w", err)
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("container credentials: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	creds, err := d.fetchMetadataCredentials(req)
+	if err != nil {
+		return nil, fmt.Errorf("container credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// instanceCredentials fetches the credentials of the EC2 instance role via IMDSv2.
+// Outside EC2 the metadata endpoint is unreachable, which ends the chain without error.
+func (d *DefaultCredentials) instanceCredentials(ctx context.Context) (*Credentials, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, nil
+	}
+	endpoint := instanceMetadataHost
+	if override := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"); override != "" {
+		endpoint = strings.TrimSuffix(override, "/")
+	}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, fmt.Errorf("instance credentials: %w", err)
+	}
+	tokenReq.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := d.fetchMetadata(tokenReq)
+	if err != nil {
+		// Not running on EC2
+		return nil, nil
+	}
+
+	roleReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("instance credentials: %w", err)
+	}
+	roleReq.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	roles, err := d.fetchMetadata(roleReq)
+	if err != nil {
+		return nil, fmt.Errorf("instance credentials: no instance role: %w", err)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(roles), "\n")
+
+	credsReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/"+role, nil)
+	if err != nil {
+		return nil, fmt.Errorf("instance credentials: %w", err)
+	}
+	credsReq.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	creds, err := d.fetchMetadataCredentials(credsReq)
+	if err != nil {
+		return nil, fmt.Errorf("instance credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// fetchMetadataCredentials requests credentials in the JSON format shared by the
+// container and instance metadata endpoints.
+func (d *DefaultCredentials) fetchMetadataCredentials(req *http.Request) (*Credentials, error) {
+	body, err := d.fetchMetadata(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil, fmt.Errorf("decode credentials: %w", err)
+	}
+	if resp.AccessKeyID == "" || resp.SecretAccessKey == "" {
+		return nil, errors.New("response has no credentials")
+	}
+	return &Credentials{
+		AccessKeyID:     resp.AccessKeyID,
+		SecretAccessKey: resp.SecretAccessKey,
+		SessionToken:    resp.Token,
+		Expires:         resp.Expiration,
+	}, nil
+}
+
+// fetchMetadata returns the body of a successful metadata response.
+func (d *DefaultCredentials) fetchMetadata(req *http.Request) (string, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", req.URL.Path, resp.Status)
+	}
+	return string(body), nil
+}
+
+// ResolveRegion returns the region from AWS_REGION, AWS_DEFAULT_REGION or the profile in
+// the shared config file, in that order. An empty profile uses AWS_PROFILE, falling back
+// to "default".
+func ResolveRegion(profile string) string {
+	if region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	values, err := readProfile(sharedConfigFile(), configSection(resolveProfile(profile)))
+	if err != nil {
+		return ""
+	}
+	return values["region"]
+}
+
+func resolveProfile(profile string) string {
+	if profile != "" {
+		return profile
+	}
+	return cmp.Or(firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE"), "default")
+}
+
+func sharedCredentialsFile() string {
+	return cmp.Or(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), awsHomeFile("credentials"))
+}
+
+func sharedConfigFile() string {
+	return cmp.Or(os.Getenv("AWS_CONFIG_FILE"), awsHomeFile("config"))
+}
+
+func awsHomeFile(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// configSection returns the section name of profile in the shared config file, which
+// prefixes profiles other than default with "profile ".
+func configSection(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+	return "profile " + profile
+}
+
+// readProfile returns the keys of section in an INI-style shared file. Missing files
+// have no sections.
+func readProfile(path, section string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	values := make(map[string]string)
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+		case inSection:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// firstEnv returns the first non-empty of the environment variables keys.
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package bedrock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isolateAWSEnv clears the AWS environment and points the shared files into a temporary
+// directory, returning the paths of the credentials and config files.
+func isolateAWSEnv(t *testing.T) (credentialsFile, configFile string) {
+	t.Helper()
+	for _, key := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY",
+		"AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	dir := t.TempDir()
+	credentialsFile = filepath.Join(dir, "credentials")
+	configFile = filepath.Join(dir, "config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	return credentialsFile, configFile
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+const (
+	testCredentialsFile = `
+[default]
+aws_access_key_id = FILEDEFAULT
+aws_secret_access_key = file-default-secret
+
+# Comments and unrelated keys are ignored
+[work]
+aws_access_key_id=FILEWORK
+aws_secret_access_key=file-work-secret
+aws_session_token=file-work-token
+`
+	testConfigFile = `
+[default]
+region = eu-central-1
+
+[profile work]
+region = us-west-2
+aws_access_key_id = CONFIGWORK
+aws_secret_access_key = config-work-secret
+
+[profile config-only]
+aws_access_key_id = CONFIGONLY
+aws_secret_access_key = config-only-secret
+`
+)
+
+func TestDefaultCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		profile string
+		want    Credentials
+	}{
+		{
+			name: "environment",
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "ENVKEY",
+				"AWS_SECRET_ACCESS_KEY": "env-secret",
+				"AWS_SESSION_TOKEN":     "env-token",
+			},
+			want: Credentials{AccessKeyID: "ENVKEY", SecretAccessKey: "env-secret", SessionToken: "env-token"},
+		},
+		{
+			name: "environment takes precedence over profile",
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "ENVKEY",
+				"AWS_SECRET_ACCESS_KEY": "env-secret",
+			},
+			profile: "work",
+			want:    Credentials{AccessKeyID: "ENVKEY", SecretAccessKey: "env-secret"},
+		},
+		{
+			name: "incomplete environment falls through",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "ENVKEY"},
+			want: Credentials{AccessKeyID: "FILEDEFAULT", SecretAccessKey: "file-default-secret"},
+		},
+		{
+			name: "default profile",
+			want: Credentials{AccessKeyID: "FILEDEFAULT", SecretAccessKey: "file-default-secret"},
+		},
+		{
+			name:    "credentials file takes precedence over config file",
+			profile: "work",
+			want:    Credentials{AccessKeyID: "FILEWORK", SecretAccessKey: "file-work-secret", SessionToken: "file-work-token"},
+		},
+		{
+			name: "profile from AWS_PROFILE",
+			env:  map[string]string{"AWS_PROFILE": "work"},
+			want: Credentials{AccessKeyID: "FILEWORK", SecretAccessKey: "file-work-secret", SessionToken: "file-work-token"},
+		},
+		{
+			name:    "config file profile",
+			profile: "config-only",
+			want:    Credentials{AccessKeyID: "CONFIGONLY", SecretAccessKey: "config-only-secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credentialsFile, configFile := isolateAWSEnv(t)
+			writeFile(t, credentialsFile, testCredentialsFile)
+			writeFile(t, configFile, testConfigFile)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			got, err := NewDefaultCredentials(tt.profile).Retrieve(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to retrieve credentials: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Retrieve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultCredentials_NoCredentials(t *testing.T) {
+	credentialsFile, _ := isolateAWSEnv(t)
+	writeFile(t, credentialsFile, testCredentialsFile)
+
+	// Unknown profile, missing config file and disabled instance metadata
+	_, err := NewDefaultCredentials("missing").Retrieve(context.Background())
+	if !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("Expected ErrNoCredentials, got: %v", err)
+	}
+}
+
+func TestResolveRegion(t *testing.T) {
+	_, configFile := isolateAWSEnv(t)
+	writeFile(t, configFile, testConfigFile)
+
+	if got := ResolveRegion(""); got != "eu-central-1" {
+		t.Errorf("Expected region of default profile, got %q", got)
+	}
+	if got := ResolveRegion("work"); got != "us-west-2" {
+		t.Errorf("Expected region of work profile, got %q", got)
+	}
+
+	t.Setenv("AWS_DEFAULT_REGION", "ap-southeast-2")
+	if got := ResolveRegion("work"); got != "ap-southeast-2" {
+		t.Errorf("Expected AWS_DEFAULT_REGION to take precedence over profile, got %q", got)
+	}
+	t.Setenv("AWS_REGION", "eu-west-1")
+	if got := ResolveRegion("work"); got != "eu-west-1" {
+		t.Errorf("Expected AWS_REGION to take precedence, got %q", got)
+	}
+}
@@ -0,0 +1,12 @@
+// Package bedrock serves Anthropic Messages API requests from Amazon Bedrock.
+//
+// Transport rewrites Messages requests to the InvokeModel and InvokeModelWithResponseStream
+// APIs and signs them with AWS Signature Version 4, without depending on the AWS SDK.
+// Streamed responses arrive in the binary AWS event stream encoding and are translated
+// back to Anthropic server-sent events, so clients, reverse proxies and the Anthropic SDK
+// handle them like responses of the Anthropic API.
+//
+// Credentials come from a CredentialsProvider: StaticCredentials, or DefaultCredentials,
+// which follows the AWS SDKs' default chain (environment, shared files, container and
+// instance roles).
+package bedrock
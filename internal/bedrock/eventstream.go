@@ -0,0 +1,112 @@
+package bedrock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// preludeLength is the size of the total length, headers length and prelude CRC.
+	preludeLength = 12
+	// maxMessageLength bounds event stream messages; Bedrock payloads are far smaller.
+	maxMessageLength = 24 << 20
+)
+
+// eventMessage is a message of the AWS event stream encoding
+// (application/vnd.amazon.eventstream). Only string headers are kept.
+type eventMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+// eventStreamDecoder reads messages of the AWS event stream encoding, a sequence of
+// binary frames:
+//
+//	total length (4) | headers length (4) | prelude CRC (4) | headers | payload | message CRC (4)
+//
+// Lengths are big-endian, and CRCs are CRC-32 (IEEE) of all preceding bytes of the frame.
+type eventStreamDecoder struct {
+	r io.Reader
+}
+
+func newEventStreamDecoder(r io.Reader) *eventStreamDecoder {
+	return &eventStreamDecoder{r: r}
+}
+
+// Next reads the next message. It returns io.EOF at the end of a well-formed stream.
+func (d *eventStreamDecoder) Next() (*eventMessage, error) {
+	prelude := make([]byte, preludeLength)
+	if _, err := io.ReadFull(d.r, prelude); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated event stream message: %w", err)
+		}
+		return nil, err
+	}
+
+	totalLength := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, errors.New("event stream prelude checksum mismatch")
+	}
+	if totalLength > maxMessageLength || uint64(totalLength) < preludeLength+uint64(headersLength)+4 {
+		return nil, fmt.Errorf("invalid event stream message length %d", totalLength)
+	}
+
+	frame := make([]byte, totalLength)
+	copy(frame, prelude)
+	if _, err := io.ReadFull(d.r, frame[preludeLength:]); err != nil {
+		return nil, fmt.Errorf("truncated event stream message: %w", err)
+	}
+	crcOffset := totalLength - 4
+	if crc32.ChecksumIEEE(frame[:crcOffset]) != binary.BigEndian.Uint32(frame[crcOffset:]) {
+		return nil, errors.New("event stream message checksum mismatch")
+	}
+
+	headersEnd := preludeLength + headersLength
+	headers, err := decodeHeaders(frame[preludeLength:headersEnd])
+	if err != nil {
+		return nil, err
+	}
+	return &eventMessage{Headers: headers, Payload: frame[headersEnd:crcOffset]}, nil
+}
+
+// headerValueLengths are the fixed value sizes of event stream header types; -1 marks
+// types prefixed with a 2-byte length (byte array 6, string 7).
+var headerValueLengths = [...]int{0, 0, 1, 2, 4, 8, -1, -1, 8, 16}
+
+// decodeHeaders parses header name/value pairs, keeping string values only.
+func decodeHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLength := int(b[0])
+		if len(b) < 1+nameLength+1 {
+			return nil, errors.New("truncated event stream header")
+		}
+		name := string(b[1 : 1+nameLength])
+		valueType := b[1+nameLength]
+		b = b[1+nameLength+1:]
+
+		if int(valueType) >= len(headerValueLengths) {
+			return nil, fmt.Errorf("unknown event stream header type %d", valueType)
+		}
+		valueLength := headerValueLengths[valueType]
+		if valueLength < 0 {
+			if len(b) < 2 {
+				return nil, errors.New("truncated event stream header")
+			}
+			valueLength = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		}
+		if len(b) < valueLength {
+			return nil, errors.New("truncated event stream header")
+		}
+		if valueType == 7 {
+			headers[name] = string(b[:valueLength])
+		}
+		b = b[valueLength:]
+	}
+	return headers, nil
+}
@@ -0,0 +1,157 @@
+package bedrock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+// encodeEventMessage encodes a message with string headers in the event stream encoding.
+func encodeEventMessage(headers [][2]string, payload []byte) []byte {
+	var encodedHeaders bytes.Buffer
+	for _, header := range headers {
+		encodedHeaders.WriteByte(byte(len(header[0])))
+		encodedHeaders.WriteString(header[0])
+		encodedHeaders.WriteByte(7)
+		_ = binary.Write(&encodedHeaders, binary.BigEndian, uint16(len(header[1])))
+		encodedHeaders.WriteString(header[1])
+	}
+
+	totalLength := preludeLength + encodedHeaders.Len() + len(payload) + 4
+	frame := binary.BigEndian.AppendUint32(nil, uint32(totalLength))
+	frame = binary.BigEndian.AppendUint32(frame, uint32(encodedHeaders.Len()))
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+	frame = append(frame, encodedHeaders.Bytes()...)
+	frame = append(frame, payload...)
+	return binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+}
+
+func TestEventStreamDecoder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty message", func(t *testing.T) {
+		t.Parallel()
+
+		// empty_message of the AWS event stream test suite
+		frame := []byte{0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x05, 0xc2, 0x48, 0xeb, 0x7d, 0x98, 0xc8, 0xff}
+		dec := newEventStreamDecoder(bytes.NewReader(frame))
+
+		msg, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		if len(msg.Headers) != 0 || len(msg.Payload) != 0 {
+			t.Errorf("Expected empty message, got %+v", msg)
+		}
+		if _, err := dec.Next(); !errors.Is(err, io.EOF) {
+			t.Errorf("Expected io.EOF at end of stream, got %v", err)
+		}
+	})
+
+	t.Run("headers and payload", func(t *testing.T) {
+		t.Parallel()
+
+		var stream bytes.Buffer
+		stream.Write(encodeEventMessage([][2]string{
+			{":message-type", "event"},
+			{":event-type", "chunk"},
+		}, []byte(`{"bytes":"e30="}`)))
+		stream.Write(encodeEventMessage([][2]string{{":message-type", "event"}}, []byte("second")))
+		dec := newEventStreamDecoder(&stream)
+
+		msg, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		if msg.Headers[":message-type"] != "event" || msg.Headers[":event-type"] != "chunk" {
+			t.Errorf("Unexpected headers: %v", msg.Headers)
+		}
+		if string(msg.Payload) != `{"bytes":"e30="}` {
+			t.Errorf("Unexpected payload: %s", msg.Payload)
+		}
+
+		msg, err = dec.Next()
+		if err != nil {
+			t.Fatalf("Failed to decode second message: %v", err)
+		}
+		if string(msg.Payload) != "second" {
+			t.Errorf("Unexpected payload of second message: %s", msg.Payload)
+		}
+	})
+
+	t.Run("non-string headers are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		// Header "n" of type int32 (4) followed by string header "s"
+		headers := []byte{1, 'n', 4, 0, 0, 0, 42, 1, 's', 7, 0, 1, 'v'}
+		frame := binary.BigEndian.AppendUint32(nil, uint32(preludeLength+len(headers)+4))
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(headers)))
+		frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+		frame = append(frame, headers...)
+		frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+
+		msg, err := newEventStreamDecoder(bytes.NewReader(frame)).Next()
+		if err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		if len(msg.Headers) != 1 || msg.Headers["s"] != "v" {
+			t.Errorf("Expected only string header s=v, got %v", msg.Headers)
+		}
+	})
+}
+
+func TestEventStreamDecoder_Errors(t *testing.T) {
+	t.Parallel()
+
+	valid := encodeEventMessage([][2]string{{":message-type", "event"}}, []byte("payload"))
+	corrupt := func(offset int) []byte {
+		frame := bytes.Clone(valid)
+		frame[offset] ^= 0xff
+		return frame
+	}
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		wantErr string
+	}{
+		{
+			name:    "message checksum mismatch",
+			stream:  corrupt(len(valid) - 5), // Last payload byte
+			wantErr: "message checksum mismatch",
+		},
+		{
+			name:    "prelude checksum mismatch",
+			stream:  corrupt(3), // Total length
+			wantErr: "prelude checksum mismatch",
+		},
+		{
+			name:    "truncated prelude",
+			stream:  valid[:preludeLength-2],
+			wantErr: "truncated",
+		},
+		{
+			name:    "truncated message",
+			stream:  valid[:len(valid)-3],
+			wantErr: "truncated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newEventStreamDecoder(bytes.NewReader(tt.stream)).Next()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			if errors.Is(err, io.EOF) {
+				t.Errorf("Expected truncation to be distinguishable from end of stream, got %v", err)
+			}
+		})
+	}
+}
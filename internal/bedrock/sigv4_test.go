@@ -0,0 +1,164 @@
+package bedrock
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Request signing of the AWS Signature Version 4 test suite
+// (https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html), which
+// signs for service "service" in us-east-1 at 2015-08-30T12:36:00Z.
+var (
+	testSuiteCredentials = Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	testSuiteTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSign_TestSuite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			target: "/",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: http.MethodGet,
+			target: "/?Param2=value2&Param1=value1",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "get-unreserved",
+			method: http.MethodGet,
+			target: "/-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=07ef7494c76fa4850883e2b006601f940f8a34d404d0cfa977f52a65bbf5f24f",
+		},
+		{
+			name:   "post-vanilla",
+			method: http.MethodPost,
+			target: "/",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:        "post-x-www-form-urlencoded",
+			method:      http.MethodPost,
+			target:      "/",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "Param1=value1",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(tt.method, "https://example.amazonaws.com"+tt.target, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			// Unsigned headers don't affect the signature
+			req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+			Sign(req, hashHex([]byte(tt.body)), testSuiteCredentials, "service", "us-east-1", testSuiteTime)
+
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization mismatch\ngot:  %s\nwant: %s", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("Expected X-Amz-Date 20150830T123600Z, got %s", got)
+			}
+		})
+	}
+}
+
+func TestSign_SessionToken(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	creds := testSuiteCredentials
+	creds.SessionToken = "session-token"
+	Sign(req, hashHex(nil), creds, "service", "us-east-1", testSuiteTime)
+
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "session-token" {
+		t.Errorf("Expected X-Amz-Security-Token to be set, got %q", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Expected session token to be signed, got %s", got)
+	}
+
+	// Re-signing with long-term credentials drops the stale token
+	Sign(req, hashHex(nil), testSuiteCredentials, "service", "us-east-1", testSuiteTime)
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "" {
+		t.Errorf("Expected X-Amz-Security-Token to be removed, got %q", got)
+	}
+	if got, want := req.Header.Get("Authorization"), "Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"; !strings.HasSuffix(got, want) {
+		t.Errorf("Expected re-signed request to match get-vanilla, got %s", got)
+	}
+}
+
+func TestCanonicalURI(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{
+			name:  "model ID with colon is double encoded",
+			model: "anthropic.claude-sonnet-4-20250514-v1:0",
+			want:  "/model/anthropic.claude-sonnet-4-20250514-v1%253A0/invoke",
+		},
+		{
+			name:  "inference profile ARN",
+			model: "arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.anthropic.claude",
+			want:  "/model/arn%253Aaws%253Abedrock%253Aus-east-1%253A123456789012%253Ainference-profile%252Fus.anthropic.claude/invoke",
+		},
+		{
+			name:  "unreserved characters",
+			model: "anthropic.claude-3-haiku_v1~x",
+			want:  "/model/anthropic.claude-3-haiku_v1~x/invoke",
+		},
+	}
+
+	transport := &Transport{Region: "us-east-1"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			u, err := transport.invokeURL(tt.model, false)
+			if err != nil {
+				t.Fatalf("Failed to build invoke URL: %v", err)
+			}
+			if got := canonicalURI(&http.Request{URL: u}); got != tt.want {
+				t.Errorf("canonicalURI() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package bedrock
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// anthropicVersion is the Anthropic API version Bedrock expects in request bodies.
+	anthropicVersion = "bedrock-2023-05-31"
+	// signingService is the SigV4 service name of the Bedrock runtime.
+	signingService = "bedrock"
+
+	eventStreamContentType = "application/vnd.amazon.eventstream"
+)
+
+// Transport is an http.RoundTripper that sends Anthropic Messages API requests to
+// Amazon Bedrock, so Anthropic clients and the SDK can use Bedrock unchanged.
+//
+// Requests to .../messages are rewritten to InvokeModel, or InvokeModelWithResponseStream
+// for streaming requests: model and stream move from the body to the URL, the
+// anthropic-beta header moves into the body, and the request is signed with SigV4.
+// Streamed responses are decoded from the event stream encoding and re-encoded as
+// Anthropic SSE, and Bedrock errors are returned as Anthropic error responses.
+// Other endpoints, such as token counting, answer 404.
+type Transport struct {
+	// Region is the AWS region, e.g. us-east-1.
+	Region string
+	// Endpoint overrides the Bedrock runtime endpoint of Region, e.g. for VPC endpoints.
+	Endpoint string
+	// Credentials sign requests.
+	Credentials CredentialsProvider
+	Base        http.RoundTripper
+}
+
+// Compile-time check that Transport implements http.RoundTripper.
+var _ http.RoundTripper = (*Transport)(nil)
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/messages") {
+		closeBody(req)
+		return newErrorResponse(req, http.StatusNotFound, "not_found_error",
+			fmt.Sprintf("%s %s is not supported by Amazon Bedrock", req.Method, req.URL.Path)), nil
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	invokeBody, model, stream, err := toInvokeBody(body, req.Header.Values("Anthropic-Beta"))
+	if err != nil {
+		return newErrorResponse(req, http.StatusBadRequest, "invalid_request_error", err.Error()), nil
+	}
+
+	invokeURL, err := t.invokeURL(model, stream)
+	if err != nil {
+		return nil, err
+	}
+	newReq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, invokeURL.String(), bytes.NewReader(invokeBody))
+	if err != nil {
+		return nil, err
+	}
+	newReq.URL = invokeURL
+	newReq.Header.Set("Content-Type", "application/json")
+	if stream {
+		newReq.Header.Set("Accept", eventStreamContentType)
+	} else {
+		newReq.Header.Set("Accept", "application/json")
+	}
+
+	creds, err := t.Credentials.Retrieve(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("retrieve AWS credentials: %w", err)
+	}
+	Sign(newReq, hashHex(invokeBody), creds, signingService, t.Region, time.Now())
+
+	resp, err := base.RoundTrip(newReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return toErrorResponse(req, resp), nil
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == eventStreamContentType {
+		resp.Body = &sseReader{
+			body: resp.Body,
+			dec:  newEventStreamDecoder(resp.Body),
+		}
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+// invokeURL returns the InvokeModel or InvokeModelWithResponseStream URL of model.
+// Model IDs may be ARNs, so the ID is escaped as a single path segment.
+func (t *Transport) invokeURL(model string, stream bool) (*url.URL, error) {
+	endpoint := t.Endpoint
+	if endpoint == "" {
+		endpoint = "https://bedrock-runtime." + t.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bedrock endpoint: %w", err)
+	}
+
+	action := "invoke"
+	if stream {
+		action = "invoke-with-response-stream"
+	}
+	basePath := strings.TrimSuffix(u.Path, "/")
+	u.Path = basePath + "/model/" + model + "/" + action
+	u.RawPath = basePath + "/model/" + strings.ReplaceAll(url.QueryEscape(model), "+", "%20") + "/" + action
+	return u, nil
+}
+
+// toInvokeBody converts a Messages API request body to an InvokeModel body, returning
+// the model and whether the response is streamed.
+func toInvokeBody(body []byte, betas []string) (invokeBody []byte, model string, stream bool, err error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, "", false, fmt.Errorf("invalid request body: %w", err)
+	}
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		return nil, "", false, errors.New("model: field required")
+	}
+	if raw, ok := fields["stream"]; ok {
+		if err := json.Unmarshal(raw, &stream); err != nil {
+			return nil, "", false, errors.New("stream: must be a boolean")
+		}
+	}
+
+	delete(fields, "model")
+	delete(fields, "stream")
+	if _, ok := fields["anthropic_version"]; !ok {
+		fields["anthropic_version"] = json.RawMessage(strconv.Quote(anthropicVersion))
+	}
+
+	var betaList []string
+	for _, value := range betas {
+		for beta := range strings.SplitSeq(value, ",") {
+			if beta = strings.TrimSpace(beta); beta != "" {
+				betaList = append(betaList, beta)
+			}
+		}
+	}
+	if _, ok := fields["anthropic_beta"]; !ok && len(betaList) > 0 {
+		raw, err := json.Marshal(betaList)
+		if err != nil {
+			return nil, "", false, err
+		}
+		fields["anthropic_beta"] = raw
+	}
+
+	invokeBody, err = json.Marshal(fields)
+	if err != nil {
+		return nil, "", false, err
+	}
+	return invokeBody, model, stream, nil
+}
+
+// sseReader re-encodes an event stream of InvokeModelWithResponseStream as Anthropic SSE.
+// Chunks carry the base64-encoded Anthropic events; exceptions end the stream with an
+// Anthropic error event.
+type sseReader struct {
+	body io.ReadCloser
+	dec  *eventStreamDecoder
+	buf  bytes.Buffer
+	done bool
+}
+
+// Read implements io.Reader.
+func (r *sseReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.fill(); err != nil {
+			if errors.Is(err, io.EOF) {
+				r.done = true
+				continue
+			}
+			return 0, err
+		}
+	}
+	return r.buf.Read(p)
+}
+
+// Close implements io.Closer.
+func (r *sseReader) Close() error {
+	return r.body.Close()
+}
+
+// fill decodes the next event stream message into buf.
+func (r *sseReader) fill() error {
+	msg, err := r.dec.Next()
+	if err != nil {
+		return err
+	}
+
+	switch msg.Headers[":message-type"] {
+	case "event":
+		if msg.Headers[":event-type"] != "chunk" {
+			return nil
+		}
+		var chunk struct {
+			Bytes string `json:"bytes"`
+		}
+		if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
+			return fmt.Errorf("decode Bedrock chunk: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk.Bytes)
+		if err != nil {
+			return fmt.Errorf("decode Bedrock chunk: %w", err)
+		}
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("decode Bedrock event: %w", err)
+		}
+		return r.writeEvent(event.Type, data)
+
+	case "exception":
+		var payload struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(msg.Payload, &payload)
+		r.done = true
+		return r.writeError(msg.Headers[":exception-type"], payload.Message)
+
+	case "error":
+		r.done = true
+		return r.writeError(msg.Headers[":error-code"], msg.Headers[":error-message"])
+	}
+	return nil
+}
+
+// writeEvent appends an SSE event with compacted data.
+func (r *sseReader) writeEvent(eventType string, data []byte) error {
+	r.buf.WriteString("event: " + eventType + "\ndata: ")
+	if err := json.Compact(&r.buf, data); err != nil {
+		return fmt.Errorf("decode Bedrock event: %w", err)
+	}
+	r.buf.WriteString("\n\n")
+	return nil
+}
+
+// writeError appends an Anthropic error event for a Bedrock exception.
+func (r *sseReader) writeError(code, message string) error {
+	data, err := json.Marshal(newErrorBody(errorType(code, 0), cmp.Or(message, code)))
+	if err != nil {
+		return err
+	}
+	return r.writeEvent("error", data)
+}
+
+// errorBody is an Anthropic error response.
+type errorBody struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newErrorBody(errType, message string) errorBody {
+	body := errorBody{Type: "error"}
+	body.Error.Type = errType
+	body.Error.Message = message
+	return body
+}
+
+// toErrorResponse converts a Bedrock error response to an Anthropic one with the same
+// status. Bedrock names the error in X-Amzn-ErrorType, e.g. "ValidationException:http://...".
+func toErrorResponse(req *http.Request, resp *http.Response) *http.Response {
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &payload) == nil {
+		message = payload.Message
+	}
+	code, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+
+	errResp := newErrorResponse(req, resp.StatusCode, errorType(code, resp.StatusCode), cmp.Or(message, http.StatusText(resp.StatusCode)))
+	if requestID := resp.Header.Get("X-Amzn-Requestid"); requestID != "" {
+		errResp.Header.Set("X-Amzn-Requestid", requestID)
+	}
+	return errResp
+}
+
+// newErrorResponse returns an Anthropic error response for req.
+func newErrorResponse(req *http.Request, status int, errType, message string) *http.Response {
+	data, _ := json.Marshal(newErrorBody(errType, message))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
+
+// errorType maps a Bedrock error code, or the HTTP status if the code is unknown, to an
+// Anthropic error type.
+func errorType(code string, status int) string {
+	switch strings.ToLower(code) {
+	case "validationexception":
+		return "invalid_request_error"
+	case "unrecognizedclientexception", "invalidsignatureexception", "incompletesignatureexception",
+		"expiredtokenexception", "missingauthenticationtokenexception":
+		return "authentication_error"
+	case "accessdeniedexception":
+		return "permission_error"
+	case "resourcenotfoundexception":
+		return "not_found_error"
+	case "throttlingexception", "servicequotaexceededexception":
+		return "rate_limit_error"
+	case "serviceunavailableexception", "modelnotreadyexception":
+		return "overloaded_error"
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// closeBody closes the request body; RoundTrip must close it, including on errors.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
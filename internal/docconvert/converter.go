@@ -0,0 +1,272 @@
+package docconvert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnsupported is returned for documents in unknown formats.
+	ErrUnsupported = errors.New("unsupported document format")
+
+	// ErrDisabled is returned for documents in formats the Policy doesn't enable.
+	ErrDisabled = errors.New("document format disabled")
+
+	// ErrTooLarge is returned when a document or its extracted text exceeds the size limits.
+	ErrTooLarge = errors.New("document exceeds maximum size")
+)
+
+// Format identifies a convertible document format.
+type Format string
+
+const (
+	FormatDOCX Format = "docx"
+	FormatXLSX Format = "xlsx"
+	FormatPPTX Format = "pptx"
+	FormatHTML Format = "html"
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// DefaultFormats are all supported formats, enabled unless a Policy restricts them.
+var DefaultFormats = []Format{FormatDOCX, FormatXLSX, FormatPPTX, FormatHTML, FormatCSV, FormatJSON}
+
+// Default policy values applied for zero fields.
+const (
+	DefaultMaxBytes     = 20 << 20 // 20MB, matching the fetch limit for remote documents
+	DefaultMaxTextBytes = 2 << 20  // 2MB, well beyond what fits into a context window
+)
+
+// maxExpansion bounds the decompressed size of Office documents relative to MaxBytes.
+// Spreadsheet XML compresses well, so this is generous while still stopping ZIP bombs.
+// maxDecompressedBytes caps it regardless of MaxBytes, as the ratio alone allows ~1GB
+// for the default limit.
+const (
+	maxExpansion         = 50
+	maxDecompressedBytes = 256 << 20
+)
+
+// Policy restricts what a Converter converts.
+type Policy struct {
+	// Formats are the enabled formats. Defaults to DefaultFormats.
+	Formats []Format
+
+	// MaxBytes limits the size of a document. Defaults to DefaultMaxBytes.
+	MaxBytes int64
+
+	// MaxTextBytes limits the size of the extracted text. Defaults to DefaultMaxTextBytes.
+	MaxTextBytes int
+}
+
+// Converter extracts text from documents according to its Policy. Safe for concurrent use.
+type Converter struct {
+	formats      []Format
+	maxBytes     int64
+	maxTextBytes int
+}
+
+// New creates a converter for the given policy.
+func New(policy Policy) *Converter {
+	c := &Converter{
+		formats:      policy.Formats,
+		maxBytes:     policy.MaxBytes,
+		maxTextBytes: policy.MaxTextBytes,
+	}
+	if len(c.formats) == 0 {
+		c.formats = DefaultFormats
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = DefaultMaxBytes
+	}
+	if c.maxTextBytes <= 0 {
+		c.maxTextBytes = DefaultMaxTextBytes
+	}
+	return c
+}
+
+// Convert extracts plain text or Markdown from data. The format is detected from the
+// media type, the filename and the content; either may be empty.
+// Returns ErrUnsupported for documents in unknown formats and ErrDisabled for disabled ones.
+func (c *Converter) Convert(data []byte, mediaType, filename string) (string, error) {
+	format, ok := DetectFormat(data, mediaType, filename)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, describeDocument(mediaType, filename))
+	}
+	if !slices.Contains(c.formats, format) {
+		return "", fmt.Errorf("%w: %s documents are not converted", ErrDisabled, format)
+	}
+	if int64(len(data)) > c.maxBytes {
+		return "", fmt.Errorf("%w: %s document has %d bytes, limit is %d", ErrTooLarge, format, len(data), c.maxBytes)
+	}
+
+	out := &textBuilder{limit: c.maxTextBytes}
+	var err error
+	switch format {
+	case FormatDOCX, FormatXLSX, FormatPPTX:
+		var pkg *ooxmlPackage
+		pkg, err = openOOXMLPackage(data, c.decompressionLimit())
+		if err != nil {
+			break
+		}
+		switch format {
+		case FormatDOCX:
+			err = convertDOCX(pkg, out)
+		case FormatXLSX:
+			err = convertXLSX(pkg, out)
+		case FormatPPTX:
+			err = convertPPTX(pkg, out)
+		}
+	case FormatHTML:
+		err = convertHTML(decodeText(data), out)
+	case FormatCSV:
+		err = convertCSV(decodeText(data), out)
+	case FormatJSON:
+		err = convertJSON(decodeText(data), out)
+	}
+	if err != nil {
+		return "", fmt.Errorf("convert %s document: %w", format, err)
+	}
+	if out.exceeded {
+		return "", fmt.Errorf("%w: text of %s document exceeds %d bytes", ErrTooLarge, format, c.maxTextBytes)
+	}
+	return strings.TrimSpace(out.String()) + "\n", nil
+}
+
+// decompressionLimit is the decompressed size all parts of an Office document may have.
+func (c *Converter) decompressionLimit() int64 {
+	return min(c.maxBytes*maxExpansion, maxDecompressedBytes)
+}
+
+// mediaTypeFormats maps media types to formats.
+var mediaTypeFormats = map[string]Format{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   FormatDOCX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         FormatXLSX,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": FormatPPTX,
+	"text/html":             FormatHTML,
+	"application/xhtml+xml": FormatHTML,
+	"text/csv":              FormatCSV,
+	"application/json":      FormatJSON,
+}
+
+// extensionFormats maps filename extensions to formats.
+var extensionFormats = map[string]Format{
+	".docx":  FormatDOCX,
+	".xlsx":  FormatXLSX,
+	".pptx":  FormatPPTX,
+	".html":  FormatHTML,
+	".htm":   FormatHTML,
+	".xhtml": FormatHTML,
+	".csv":   FormatCSV,
+	".json":  FormatJSON,
+}
+
+// DetectFormat determines the format of a document from its media type, its filename
+// extension or, for Office documents, the parts of its ZIP container.
+func DetectFormat(data []byte, mediaType, filename string) (Format, bool) {
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		if format, ok := mediaTypeFormats[parsed]; ok {
+			return format, true
+		}
+	}
+	if format, ok := extensionFormats[strings.ToLower(path.Ext(filename))]; ok {
+		return format, true
+	}
+	return detectOOXMLFormat(data)
+}
+
+// describeDocument names a document for error messages.
+func describeDocument(mediaType, filename string) string {
+	switch {
+	case filename != "" && mediaType != "":
+		return fmt.Sprintf("%s (%s)", filename, mediaType)
+	case filename != "":
+		return filename
+	case mediaType != "":
+		return mediaType
+	default:
+		return "unknown format"
+	}
+}
+
+// decodeText returns data as valid UTF-8 text without byte order mark.
+func decodeText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// textBuilder collects extracted text up to a limit. Writes beyond the limit are dropped
+// and mark the builder as exceeded, so extraction never holds more than the limit.
+type textBuilder struct {
+	strings.Builder
+	limit    int
+	exceeded bool
+}
+
+// WriteString appends s unless the limit would be exceeded.
+func (b *textBuilder) WriteString(s string) {
+	if b.exceeded {
+		return
+	}
+	if b.Len()+len(s) > b.limit {
+		b.exceeded = true
+		return
+	}
+	b.Builder.WriteString(s)
+}
+
+// writeBlock appends a block of Markdown separated from the previous one by a blank line.
+func (b *textBuilder) writeBlock(s string) {
+	if s == "" {
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n\n")
+	}
+	b.WriteString(s)
+}
+
+// writeTable appends rows as a Markdown table with the first row as header.
+func (b *textBuilder) writeTable(rows [][]string) {
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return
+	}
+
+	var table strings.Builder
+	writeRow := func(row []string) {
+		table.WriteString("|")
+		for i := range columns {
+			var cell string
+			if i < len(row) {
+				cell = escapeTableCell(row[i])
+			}
+			table.WriteString(" " + cell + " |")
+		}
+		table.WriteString("\n")
+	}
+
+	writeRow(rows[0])
+	table.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	b.writeBlock(strings.TrimSuffix(table.String(), "\n"))
+}
+
+// escapeTableCell keeps cell content on a single line without breaking the table.
+func escapeTableCell(cell string) string {
+	cell = strings.Join(strings.Fields(cell), " ")
+	return strings.ReplaceAll(cell, "|", `\|`)
+}
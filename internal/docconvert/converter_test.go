@@ -0,0 +1,251 @@
+package docconvert
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// zipPart is a file inside a test ZIP container.
+type zipPart struct {
+	name, content string
+}
+
+// zipDocument builds a ZIP container from parts, keeping their order.
+func zipDocument(t *testing.T, parts ...zipPart) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, part := range parts {
+		f, err := w.Create(part.name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", part.name, err)
+		}
+		if _, err := f.Write([]byte(part.content)); err != nil {
+			t.Fatalf("Failed to write %s: %v", part.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const (
+	wordNamespaces  = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	sheetNamespaces = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="` + relationshipsNamespace + `"`
+	slideNamespaces = `xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="` + relationshipsNamespace + `"`
+)
+
+// relationshipsPart returns a relationships part mapping IDs to targets.
+func relationshipsPart(name string, targets ...string) zipPart {
+	var b strings.Builder
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 0; i+1 < len(targets); i += 2 {
+		b.WriteString(`<Relationship Id="` + targets[i] + `" Target="` + targets[i+1] + `"/>`)
+	}
+	b.WriteString(`</Relationships>`)
+	return zipPart{name: name, content: b.String()}
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	docx := zipDocument(t, zipPart{"word/document.xml", `<w:document ` + wordNamespaces + `><w:body>
+		<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Report</w:t></w:r></w:p>
+		<w:p><w:r><w:t xml:space="preserve">Plain </w:t></w:r><w:r><w:t>text</w:t><w:tab/><w:t>tabbed</w:t></w:r></w:p>
+		<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/></w:numPr></w:pPr><w:r><w:t>Nested item</w:t></w:r></w:p>
+		<w:tbl>
+			<w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Value</w:t></w:r></w:p></w:tc></w:tr>
+			<w:tr><w:tc><w:p><w:r><w:t>a|b</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>1</w:t></w:r></w:p></w:tc></w:tr>
+		</w:tbl>
+	</w:body></w:document>`})
+
+	xlsx := zipDocument(t,
+		zipPart{"xl/workbook.xml", `<workbook ` + sheetNamespaces + `><sheets>
+			<sheet name="Totals" sheetId="2" r:id="rId2"/>
+			<sheet name="Data" sheetId="1" r:id="rId1"/>
+		</sheets></workbook>`},
+		relationshipsPart("xl/_rels/workbook.xml.rels", "rId1", "worksheets/sheet1.xml", "rId2", "/xl/worksheets/sheet2.xml"),
+		zipPart{"xl/sharedStrings.xml", `<sst ` + sheetNamespaces + `>
+			<si><t>Name</t></si>
+			<si><r><t>Rich </t></r><r><t>text</t></r><rPh><t>phonetic</t></rPh></si>
+		</sst>`},
+		zipPart{"xl/worksheets/sheet1.xml", `<worksheet ` + sheetNamespaces + `><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>Inline</t></is></c></row>
+			<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2"><v>4.5</v></c><c r="C2" t="b"><v>1</v></c></row>
+			<row r="3"></row>
+		</sheetData></worksheet>`},
+		zipPart{"xl/worksheets/sheet2.xml", `<worksheet ` + sheetNamespaces + `><sheetData>
+			<row r="1"><c r="A1"><v>42</v></c></row>
+		</sheetData></worksheet>`},
+	)
+
+	// Slides are listed out of part name order and the presentation order must win
+	pptx := zipDocument(t,
+		zipPart{"ppt/presentation.xml", `<p:presentation ` + slideNamespaces + `><p:sldIdLst>
+			<p:sldId id="256" r:id="rId3"/>
+			<p:sldId id="257" r:id="rId2"/>
+		</p:sldIdLst></p:presentation>`},
+		relationshipsPart("ppt/_rels/presentation.xml.rels", "rId2", "slides/slide1.xml", "rId3", "slides/slide2.xml"),
+		zipPart{"ppt/slides/slide1.xml", `<p:sld ` + slideNamespaces + `><p:cSld><p:spTree><p:sp><p:txBody>
+			<a:p><a:r><a:t>Second slide</a:t></a:r></a:p>
+		</p:txBody></p:sp></p:spTree></p:cSld></p:sld>`},
+		zipPart{"ppt/slides/slide2.xml", `<p:sld ` + slideNamespaces + `><p:cSld><p:spTree><p:sp><p:txBody>
+			<a:p><a:r><a:t>Title</a:t></a:r></a:p>
+			<a:p><a:r><a:t>First</a:t></a:r><a:br/><a:r><a:t>line break</a:t></a:r></a:p>
+		</p:txBody></p:sp></p:spTree></p:cSld></p:sld>`},
+	)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		mediaType string
+		filename  string
+		want      string
+	}{
+		{
+			name:     "docx",
+			data:     docx,
+			filename: "report.docx",
+			want: "# Report\n\nPlain text\ttabbed\n\n  - Nested item\n\n" +
+				"| Name | Value |\n| --- | --- |\n| a\\|b | 1 |\n",
+		},
+		{
+			name:     "xlsx",
+			data:     xlsx,
+			filename: "book.xlsx",
+			want: "## Totals\n\n| 42 |\n| --- |\n\n" +
+				"## Data\n\n| Name |  | Inline |\n| --- | --- | --- |\n| Rich text | 4.5 | true |\n",
+		},
+		{
+			name: "pptx detected from content",
+			data: pptx,
+			want: "## Slide 1\n\nTitle\n\nFirst\nline break\n\n## Slide 2\n\nSecond slide\n",
+		},
+		{
+			name:      "html",
+			mediaType: "text/html; charset=utf-8",
+			data: []byte(`<html><head><title>Ignored</title><style>p { color: red }</style></head><body>
+				<script>alert("ignored")</script>
+				<h2>Heading</h2>
+				<p>Some   <b>bold</b> and <a href="https://example.com">linked</a> text.</p>
+				<ol><li>One</li><li>Two<ul><li>Nested</li></ul></li></ol>
+				<noscript>Ignored</noscript>
+				<pre>code
+  block</pre>
+			</body></html>`),
+			want: "## Heading\n\nSome **bold** and [linked](https://example.com) text.\n\n1. One\n\n2. Two\n\n  - Nested\n\n" +
+				"```\ncode\n  block\n```\n",
+		},
+		{
+			name:     "csv with semicolons",
+			filename: "export.csv",
+			data:     []byte("\xef\xbb\xbfname;note\nalice;\"multi\nline\"\nbob\n"),
+			want:     "| name | note |\n| --- | --- |\n| alice | multi line |\n| bob |  |\n",
+		},
+		{
+			name:      "json",
+			mediaType: "application/json",
+			data:      []byte(`{"b":[1,2],"a":{}}`),
+			want:      "{\n  \"b\": [\n    1,\n    2\n  ],\n  \"a\": {}\n}\n",
+		},
+	}
+
+	converter := New(Policy{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := converter.Convert(tt.data, tt.mediaType, tt.filename)
+			if err != nil {
+				t.Fatalf("Failed to convert: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Convert() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert_Errors(t *testing.T) {
+	t.Parallel()
+
+	// A highly compressible part expanding far beyond the decompression budget
+	bomb := zipDocument(t, zipPart{"word/document.xml", `<w:document ` + wordNamespaces + `><!--` +
+		strings.Repeat(" ", 8<<20) + `--></w:document>`})
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		data      []byte
+		mediaType string
+		filename  string
+		wantErr   error
+	}{
+		{
+			name:     "zip bomb",
+			policy:   Policy{MaxBytes: 64 << 10},
+			data:     bomb,
+			filename: "bomb.docx",
+			wantErr:  ErrTooLarge,
+		},
+		{
+			name:     "document too large",
+			policy:   Policy{MaxBytes: 4},
+			data:     []byte("a,b,c"),
+			filename: "data.csv",
+			wantErr:  ErrTooLarge,
+		},
+		{
+			name:     "text too large",
+			policy:   Policy{MaxTextBytes: 8},
+			data:     []byte(`{"key":"value"}`),
+			filename: "data.json",
+			wantErr:  ErrTooLarge,
+		},
+		{
+			name:      "unknown format",
+			data:      []byte("%PDF-1.7"),
+			mediaType: "application/pdf",
+			wantErr:   ErrUnsupported,
+		},
+		{
+			name:     "disabled format",
+			policy:   Policy{Formats: []Format{FormatCSV}},
+			data:     []byte("{}"),
+			filename: "data.json",
+			wantErr:  ErrDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tt.policy).Convert(tt.data, tt.mediaType, tt.filename)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Broken documents fail without a size or format error
+	_, err := New(Policy{}).Convert([]byte(`{"unterminated":`), "", "data.json")
+	if err == nil || errors.Is(err, ErrUnsupported) || errors.Is(err, ErrDisabled) || errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected parse error, got: %v", err)
+	}
+}
+
+func TestConverter_DecompressionLimit(t *testing.T) {
+	t.Parallel()
+
+	if got, want := New(Policy{MaxBytes: 1 << 20}).decompressionLimit(), int64(maxExpansion<<20); got != want {
+		t.Errorf("Expected ratio limit %d for small documents, got %d", want, got)
+	}
+	if got := New(Policy{}).decompressionLimit(); got != maxDecompressedBytes {
+		t.Errorf("Expected absolute limit %d for the default policy, got %d", maxDecompressedBytes, got)
+	}
+}
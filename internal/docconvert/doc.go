@@ -0,0 +1,19 @@
+// Package docconvert extracts plain text or Markdown from documents the upstream API can't
+// read natively, so they can be sent as plain text documents instead of being rejected.
+//
+// Supported formats:
+//   - DOCX: paragraphs, headings, list items and tables as Markdown
+//   - XLSX: one Markdown table per sheet
+//   - PPTX: the text of each slide under a slide heading
+//   - HTML: headings, paragraphs, lists, links, code and tables as Markdown
+//   - CSV: a Markdown table
+//   - JSON: indented JSON
+//
+// Formats are detected from the media type, the filename extension and, for Office files
+// without either, the parts inside the ZIP container. Conversion is governed by a Policy
+// restricting the enabled formats and the size of input, decompressed parts and output,
+// so crafted documents (e.g. ZIP bombs) can't exhaust memory.
+//
+// Documents in other formats return ErrUnsupported so callers can handle them otherwise,
+// while documents in formats the Policy doesn't enable return ErrDisabled.
+package docconvert
@@ -0,0 +1,321 @@
+package docconvert
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// convertHTML renders the body of an HTML document as Markdown.
+func convertHTML(source string, out *textBuilder) error {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return fmt.Errorf("parse html: %w", err)
+	}
+	r := &htmlRenderer{out: out}
+	r.render(doc)
+	r.flush()
+	return nil
+}
+
+// skippedElements carry no readable content.
+var skippedElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Select:   true,
+	atom.Button:   true,
+}
+
+// blockElements start a new Markdown block.
+var blockElements = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Main:       true,
+	atom.Header:     true,
+	atom.Footer:     true,
+	atom.Aside:      true,
+	atom.Nav:        true,
+	atom.Figure:     true,
+	atom.Figcaption: true,
+	atom.Dl:         true,
+	atom.Dt:         true,
+	atom.Dd:         true,
+	atom.Address:    true,
+	atom.Details:    true,
+	atom.Summary:    true,
+}
+
+// htmlList tracks the numbering of an open list.
+type htmlList struct {
+	ordered bool
+	items   int
+}
+
+// htmlRenderer converts a parsed HTML tree to Markdown. Inline content is collected in
+// line until a block ends, so whitespace can be collapsed like a browser does.
+type htmlRenderer struct {
+	out    *textBuilder
+	line   bytes.Buffer
+	prefix string
+	lists  []htmlList
+	quotes int
+}
+
+func (r *htmlRenderer) render(n *html.Node) {
+	if r.out.exceeded {
+		return
+	}
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+
+	if skippedElements[n.DataAtom] {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.flush()
+		level, _ := strconv.Atoi(n.Data[1:])
+		r.prefix = strings.Repeat("#", level) + " "
+		r.children(n)
+		r.flush()
+
+	case atom.Ul, atom.Ol:
+		r.flush()
+		r.lists = append(r.lists, htmlList{ordered: n.DataAtom == atom.Ol})
+		r.children(n)
+		r.flush()
+		r.lists = r.lists[:len(r.lists)-1]
+
+	case atom.Li:
+		r.flush()
+		r.prefix = "- "
+		if len(r.lists) > 0 {
+			list := &r.lists[len(r.lists)-1]
+			list.items++
+			if list.ordered {
+				r.prefix = strconv.Itoa(list.items) + ". "
+			}
+			r.prefix = strings.Repeat("  ", len(r.lists)-1) + r.prefix
+		}
+		r.children(n)
+		r.flush()
+
+	case atom.Blockquote:
+		r.flush()
+		r.quotes++
+		r.children(n)
+		r.flush()
+		r.quotes--
+
+	case atom.Pre:
+		r.flush()
+		code := strings.Trim(textContent(n), "\n")
+		r.writeBlock("```\n" + code + "\n```")
+
+	case atom.Table:
+		r.flush()
+		r.out.writeTable(tableRows(n))
+
+	case atom.Hr:
+		r.flush()
+		r.writeBlock("---")
+
+	case atom.Br:
+		r.line.WriteString("\n")
+
+	case atom.Img:
+		if alt := strings.TrimSpace(attribute(n, "alt")); alt != "" {
+			r.text(alt)
+		}
+
+	case atom.A:
+		href := attribute(n, "href")
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+			r.children(n)
+			return
+		}
+		r.wrap(n, "[", "]("+href+")")
+
+	case atom.Strong, atom.B:
+		r.wrap(n, "**", "**")
+
+	case atom.Em, atom.I:
+		r.wrap(n, "*", "*")
+
+	case atom.Code:
+		r.wrap(n, "`", "`")
+
+	default:
+		if blockElements[n.DataAtom] {
+			r.flush()
+			r.children(n)
+			r.flush()
+			return
+		}
+		r.children(n)
+	}
+}
+
+func (r *htmlRenderer) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child)
+	}
+}
+
+// text appends inline text with whitespace collapsed.
+func (r *htmlRenderer) text(s string) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			r.space()
+		}
+		return
+	}
+	if isSpace(s[0]) {
+		r.space()
+	}
+	r.line.WriteString(strings.Join(fields, " "))
+	if isSpace(s[len(s)-1]) {
+		r.space()
+	}
+}
+
+// space appends a single separating space unless the line already ends with whitespace.
+func (r *htmlRenderer) space() {
+	line := r.line.Bytes()
+	if len(line) > 0 && !isSpace(line[len(line)-1]) {
+		r.line.WriteByte(' ')
+	}
+}
+
+// wrap renders the children of n enclosed in Markdown markup, omitting empty markup.
+func (r *htmlRenderer) wrap(n *html.Node, open, closing string) {
+	start := r.line.Len()
+	r.children(n)
+	inner := r.line.Bytes()[start:]
+	trimmed := strings.TrimSpace(string(inner))
+	if trimmed == "" {
+		return
+	}
+	leading := strings.HasPrefix(string(inner), " ")
+	trailing := strings.HasSuffix(string(inner), " ")
+	r.line.Truncate(start)
+	if leading {
+		r.space()
+	}
+	r.line.WriteString(open + trimmed + closing)
+	if trailing {
+		r.line.WriteByte(' ')
+	}
+}
+
+// flush ends the current block, writing the collected line with list, heading and quote prefixes.
+func (r *htmlRenderer) flush() {
+	prefix := r.prefix
+	r.prefix = ""
+	content := r.line.String()
+	r.line.Reset()
+
+	var lines []string
+	for line := range strings.SplitSeq(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	indent := strings.Repeat(" ", len(prefix))
+	r.writeBlock(prefix + strings.Join(lines, "\n"+indent))
+}
+
+// writeBlock writes a block, quoted if inside blockquotes.
+func (r *htmlRenderer) writeBlock(block string) {
+	if r.quotes > 0 {
+		quote := strings.Repeat("> ", r.quotes)
+		block = quote + strings.ReplaceAll(block, "\n", "\n"+quote)
+	}
+	r.out.writeBlock(block)
+}
+
+// tableRows collects the cell text of a table's rows, ignoring nested tables' structure.
+func tableRows(table *html.Node) [][]string {
+	var rows [][]string
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						row = append(row, strings.Join(strings.Fields(textContent(cell)), " "))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				visit(child)
+			}
+		}
+	}
+	visit(table)
+	return rows
+}
+
+// textContent returns the text of n and its descendants, except for skipped elements.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && skippedElements[n.DataAtom]:
+		case n.Type == html.ElementNode && n.DataAtom == atom.Br:
+			b.WriteString("\n")
+		default:
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				visit(child)
+			}
+		}
+	}
+	visit(n)
+	return b.String()
+}
+
+// attribute returns the value of the attribute with the given name.
+func attribute(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
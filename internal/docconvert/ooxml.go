@@ -0,0 +1,495 @@
+package docconvert
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ooxmlPackage gives bounded access to the parts of an Office Open XML document.
+type ooxmlPackage struct {
+	parts map[string]*zip.File
+
+	// remaining is the decompressed size all parts together may still have.
+	remaining int64
+}
+
+// openOOXMLPackage opens the ZIP container of an Office document.
+func openOOXMLPackage(data []byte, maxDecompressed int64) (*ooxmlPackage, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open zip container: %w", err)
+	}
+	pkg := &ooxmlPackage{
+		parts:     make(map[string]*zip.File, len(reader.File)),
+		remaining: maxDecompressed,
+	}
+	for _, file := range reader.File {
+		pkg.parts[file.Name] = file
+	}
+	return pkg, nil
+}
+
+// detectOOXMLFormat identifies Office documents by their main part.
+func detectOOXMLFormat(data []byte) (Format, bool) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return "", false
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", false
+	}
+	for _, file := range reader.File {
+		switch file.Name {
+		case "word/document.xml":
+			return FormatDOCX, true
+		case "xl/workbook.xml":
+			return FormatXLSX, true
+		case "ppt/presentation.xml":
+			return FormatPPTX, true
+		}
+	}
+	return "", false
+}
+
+// decoder opens a part for streaming XML decoding. Returns nil if the part doesn't exist.
+func (p *ooxmlPackage) decoder(name string) (*xml.Decoder, io.Closer, error) {
+	file, ok := p.parts[name]
+	if !ok {
+		return nil, nil, nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	return xml.NewDecoder(&budgetReader{r: rc, remaining: &p.remaining}), rc, nil
+}
+
+// budgetReader fails with ErrTooLarge once the package's decompression budget is used up.
+type budgetReader struct {
+	r         io.Reader
+	remaining *int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if *b.remaining <= 0 {
+		return 0, fmt.Errorf("%w: decompressed content too large", ErrTooLarge)
+	}
+	if int64(len(p)) > *b.remaining {
+		p = p[:*b.remaining]
+	}
+	n, err := b.r.Read(p)
+	*b.remaining -= int64(n)
+	return n, err
+}
+
+// walk decodes a part, calling start and end for elements and text for character data.
+// Missing parts are skipped.
+func (p *ooxmlPackage) walk(
+	name string,
+	start func(xml.StartElement),
+	end func(xml.EndElement),
+	text func(string),
+) error {
+	decoder, closer, err := p.decoder(name)
+	if err != nil || decoder == nil {
+		return err
+	}
+	defer func() { _ = closer.Close() }()
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", name, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if start != nil {
+				start(t)
+			}
+		case xml.EndElement:
+			if end != nil {
+				end(t)
+			}
+		case xml.CharData:
+			if text != nil {
+				text(string(t))
+			}
+		}
+	}
+}
+
+// relationships resolves the relationship IDs of a part to the part names they target.
+func (p *ooxmlPackage) relationships(partName string) (map[string]string, error) {
+	dir, file := path.Split(partName)
+	relsName := dir + "_rels/" + file + ".rels"
+
+	targets := make(map[string]string)
+	err := p.walk(relsName, func(el xml.StartElement) {
+		if el.Name.Local != "Relationship" || attr(el, "TargetMode") == "External" {
+			return
+		}
+		target := attr(el, "Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(dir, target)
+		}
+		targets[attr(el, "Id")] = target
+	}, nil, nil)
+	return targets, err
+}
+
+// relationshipsNamespace qualifies attributes referencing relationships (r:id).
+const relationshipsNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// relationshipID returns the r:id attribute, which must not be confused with plain id attributes.
+func relationshipID(el xml.StartElement) string {
+	for _, a := range el.Attr {
+		if a.Name.Space == relationshipsNamespace && a.Name.Local == "id" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// attr returns the value of the attribute with the given local name.
+func attr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// convertDOCX extracts paragraphs, headings, list items and tables of a Word document.
+func convertDOCX(pkg *ooxmlPackage, out *textBuilder) error {
+	var (
+		paragraph strings.Builder
+		inRun     bool
+		inText    bool
+		heading   int
+		listLevel = -1
+
+		// Tables may be nested; nested tables are flattened into their cell
+		tables [][][]string
+		cell   []string
+	)
+
+	return pkg.walk("word/document.xml", func(el xml.StartElement) {
+		switch el.Name.Local {
+		case "p":
+			paragraph.Reset()
+			heading, listLevel = 0, -1
+		case "pStyle":
+			heading = headingLevel(attr(el, "val"))
+		case "outlineLvl":
+			if level, err := strconv.Atoi(attr(el, "val")); err == nil && level < 6 {
+				heading = level + 1
+			}
+		case "ilvl":
+			if level, err := strconv.Atoi(attr(el, "val")); err == nil {
+				listLevel = level
+			}
+		case "numPr":
+			listLevel = max(listLevel, 0)
+		case "r":
+			inRun = true
+		case "t":
+			inText = true
+		case "tab":
+			// Tab stops of the paragraph properties are no content
+			if inRun {
+				paragraph.WriteString("\t")
+			}
+		case "br", "cr":
+			if inRun {
+				paragraph.WriteString("\n")
+			}
+		case "tbl":
+			tables = append(tables, nil)
+		case "tr":
+			if len(tables) == 1 {
+				tables[0] = append(tables[0], nil)
+			}
+		case "tc":
+			if len(tables) == 1 {
+				cell = nil
+			}
+		}
+	}, func(el xml.EndElement) {
+		switch el.Name.Local {
+		case "r":
+			inRun = false
+		case "t":
+			inText = false
+		case "p":
+			text := strings.TrimSpace(paragraph.String())
+			if text == "" {
+				return
+			}
+			if len(tables) > 0 {
+				cell = append(cell, text)
+				return
+			}
+			switch {
+			case heading > 0:
+				out.writeBlock(strings.Repeat("#", heading) + " " + text)
+			case listLevel >= 0:
+				out.writeBlock(strings.Repeat("  ", listLevel) + "- " + text)
+			default:
+				out.writeBlock(text)
+			}
+		case "tc":
+			if len(tables) == 1 {
+				rows := tables[0]
+				rows[len(rows)-1] = append(rows[len(rows)-1], strings.Join(cell, " "))
+			}
+		case "tbl":
+			rows := tables[len(tables)-1]
+			tables = tables[:len(tables)-1]
+			if len(tables) == 0 {
+				out.writeTable(rows)
+			}
+		}
+	}, func(text string) {
+		if inText {
+			paragraph.WriteString(text)
+		}
+	})
+}
+
+// headingLevel maps paragraph style IDs such as "Heading2" or "Title" to heading levels.
+func headingLevel(style string) int {
+	style = strings.ToLower(strings.ReplaceAll(style, " ", ""))
+	if style == "title" {
+		return 1
+	}
+	if level, err := strconv.Atoi(strings.TrimPrefix(style, "heading")); err == nil && strings.HasPrefix(style, "heading") && level >= 1 && level <= 6 {
+		return level
+	}
+	return 0
+}
+
+// convertXLSX extracts the cell values of every sheet of a workbook as a table.
+// Values are taken as stored, so dates and formatted numbers appear as raw numbers.
+func convertXLSX(pkg *ooxmlPackage, out *textBuilder) error {
+	sharedStrings, err := xlsxSharedStrings(pkg)
+	if err != nil {
+		return err
+	}
+	targets, err := pkg.relationships("xl/workbook.xml")
+	if err != nil {
+		return err
+	}
+
+	type sheet struct{ name, part string }
+	var sheets []sheet
+	err = pkg.walk("xl/workbook.xml", func(el xml.StartElement) {
+		if el.Name.Local == "sheet" {
+			sheets = append(sheets, sheet{name: attr(el, "name"), part: targets[relationshipID(el)]})
+		}
+	}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sheets {
+		if s.part == "" {
+			continue
+		}
+		rows, err := xlsxRows(pkg, s.part, sharedStrings)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		out.writeBlock("## " + s.name)
+		out.writeTable(rows)
+	}
+	return nil
+}
+
+// xlsxSharedStrings reads the shared string table referenced by string cells.
+func xlsxSharedStrings(pkg *ooxmlPackage) ([]string, error) {
+	var (
+		sharedStrings []string
+		item          strings.Builder
+		inText        bool
+		inPhonetic    bool
+	)
+	err := pkg.walk("xl/sharedStrings.xml", func(el xml.StartElement) {
+		switch el.Name.Local {
+		case "si":
+			item.Reset()
+		case "t":
+			inText = true
+		case "rPh":
+			inPhonetic = true
+		}
+	}, func(el xml.EndElement) {
+		switch el.Name.Local {
+		case "si":
+			sharedStrings = append(sharedStrings, item.String())
+		case "t":
+			inText = false
+		case "rPh":
+			inPhonetic = false
+		}
+	}, func(text string) {
+		if inText && !inPhonetic {
+			item.WriteString(text)
+		}
+	})
+	return sharedStrings, err
+}
+
+// xlsxRows reads the non-empty rows of a sheet, keeping cells at their column.
+func xlsxRows(pkg *ooxmlPackage, part string, sharedStrings []string) ([][]string, error) {
+	var (
+		rows       [][]string
+		row        []string
+		column     int
+		cellType   string
+		value      strings.Builder
+		inValue    bool
+		inPhonetic bool
+	)
+	err := pkg.walk(part, func(el xml.StartElement) {
+		switch el.Name.Local {
+		case "row":
+			row, column = nil, 0
+		case "c":
+			if ref := attr(el, "r"); ref != "" {
+				column = columnIndex(ref)
+			}
+			cellType = attr(el, "t")
+			value.Reset()
+		case "v", "t":
+			inValue = true
+		case "rPh":
+			inPhonetic = true
+		}
+	}, func(el xml.EndElement) {
+		switch el.Name.Local {
+		case "v", "t":
+			inValue = false
+		case "rPh":
+			inPhonetic = false
+		case "c":
+			text := value.String()
+			switch cellType {
+			case "s":
+				if index, err := strconv.Atoi(text); err == nil && index >= 0 && index < len(sharedStrings) {
+					text = sharedStrings[index]
+				}
+			case "b":
+				text = strconv.FormatBool(text == "1")
+			}
+			if text != "" && column < maxSheetColumns {
+				for len(row) <= column {
+					row = append(row, "")
+				}
+				row[column] = text
+			}
+			column++
+		case "row":
+			if len(row) > 0 {
+				rows = append(rows, row)
+			}
+		}
+	}, func(text string) {
+		if inValue && !inPhonetic {
+			value.WriteString(text)
+		}
+	})
+	return rows, err
+}
+
+// maxSheetColumns matches Excel's column limit (XFD), guarding against bogus references.
+const maxSheetColumns = 16384
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12".
+func columnIndex(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		if column > maxSheetColumns {
+			break
+		}
+	}
+	return column - 1
+}
+
+// convertPPTX extracts the text of every slide in presentation order.
+func convertPPTX(pkg *ooxmlPackage, out *textBuilder) error {
+	targets, err := pkg.relationships("ppt/presentation.xml")
+	if err != nil {
+		return err
+	}
+
+	var slides []string
+	err = pkg.walk("ppt/presentation.xml", func(el xml.StartElement) {
+		if el.Name.Local == "sldId" {
+			slides = append(slides, targets[relationshipID(el)])
+		}
+	}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	for i, part := range slides {
+		if part == "" {
+			continue
+		}
+		var (
+			paragraphs []string
+			paragraph  strings.Builder
+			inText     bool
+		)
+		err := pkg.walk(part, func(el xml.StartElement) {
+			switch el.Name.Local {
+			case "p":
+				paragraph.Reset()
+			case "t":
+				inText = true
+			case "br":
+				paragraph.WriteString("\n")
+			}
+		}, func(el xml.EndElement) {
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if text := strings.TrimSpace(paragraph.String()); text != "" {
+					paragraphs = append(paragraphs, text)
+				}
+			}
+		}, func(text string) {
+			if inText {
+				paragraph.WriteString(text)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		out.writeBlock(fmt.Sprintf("## Slide %d", i+1))
+		out.writeBlock(strings.Join(paragraphs, "\n\n"))
+	}
+	return nil
+}
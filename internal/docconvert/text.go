@@ -0,0 +1,56 @@
+package docconvert
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// convertCSV renders comma, semicolon or tab separated values as a Markdown table.
+func convertCSV(source string, out *textBuilder) error {
+	reader := csv.NewReader(strings.NewReader(source))
+	reader.Comma = csvDelimiter(source)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows [][]string
+	for !out.exceeded {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("parse csv: %w", err)
+		}
+		rows = append(rows, record)
+	}
+	out.writeTable(rows)
+	return nil
+}
+
+// csvDelimiter guesses the delimiter from the first line, since spreadsheet exports in many
+// locales use semicolons.
+func csvDelimiter(source string) rune {
+	header, _, _ := strings.Cut(source, "\n")
+	delimiter, most := ',', strings.Count(header, ",")
+	for _, candidate := range []rune{';', '\t'} {
+		if n := strings.Count(header, string(candidate)); n > most {
+			delimiter, most = candidate, n
+		}
+	}
+	return delimiter
+}
+
+// convertJSON validates and indents a JSON document for readability.
+func convertJSON(source string, out *textBuilder) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(source), "", "  "); err != nil {
+		return fmt.Errorf("parse json: %w", err)
+	}
+	out.WriteString(indented.String())
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package filestore provides local on-disk storage for files uploaded via the
+// OpenAI-compatible Files API.
+//
+// Contents are stored content-addressed by SHA-256, so re-uploading the same document
+// under a different name or purpose costs no additional disk space. Each upload gets
+// its own file ID and metadata record referencing the shared blob.
+//
+// Storage is bounded in two ways:
+//   - TTL: files expire after a fixed lifetime and are purged lazily
+//   - Quota: uploads are rejected once unique blob bytes would exceed the limit
+package filestore
@@ -0,0 +1,510 @@
+package filestore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown, deleted or expired file IDs.
+	ErrNotFound = errors.New("file not found")
+
+	// ErrQuotaExceeded is returned when an upload would exceed the storage quota.
+	ErrQuotaExceeded = errors.New("file storage quota exceeded")
+)
+
+// fileIDPattern restricts file IDs to the generated format, preventing path traversal
+// via user-supplied IDs.
+var fileIDPattern = regexp.MustCompile(`^file-[a-zA-Z0-9]{24}$`)
+
+// File describes a stored file.
+type File struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Purpose   string    `json:"purpose"`
+	Bytes     int64     `json:"bytes"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Store is a content-addressed file store rooted at a local directory.
+//
+// Layout:
+//
+//	<dir>/blobs/<sha256>   file contents, shared between uploads of identical data
+//	<dir>/files/<id>.json  per-upload metadata
+//
+// All operations are serialized by a mutex; file contents are streamed outside of it.
+type Store struct {
+	dir   string
+	ttl   time.Duration
+	quota int64
+	now   func() time.Time
+
+	mu sync.Mutex
+}
+
+// Option configures the Store.
+type Option func(*Store)
+
+// WithTTL sets the lifetime of uploaded files. Zero disables expiry.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Store) {
+		s.ttl = ttl
+	}
+}
+
+// WithQuota limits the total size of stored contents in bytes. Zero disables the limit.
+func WithQuota(bytes int64) Option {
+	return func(s *Store) {
+		s.quota = bytes
+	}
+}
+
+// New creates a Store rooted at dir, creating directories with 0700 permissions
+// if they don't exist.
+func New(dir string, opts ...Option) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("directory cannot be empty")
+	}
+
+	s := &Store{
+		dir: dir,
+		now: time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, sub := range []string{s.blobsDir(), s.filesDir()} {
+		if err := os.MkdirAll(sub, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Put stores the contents of r and returns the metadata of the new file.
+// Returns ErrQuotaExceeded if storing the contents would exceed the quota. Reading stops
+// as soon as the contents exceed the remaining quota, so oversized uploads never reach
+// the disk in full.
+func (s *Store) Put(ctx context.Context, filename, purpose string, r io.Reader) (*File, error) {
+	contents := io.Reader(&contextReader{ctx: ctx, r: r})
+	var remaining int64
+	if s.quota > 0 {
+		var err error
+		if remaining, err = s.remainingQuota(); err != nil {
+			return nil, err
+		}
+		// One byte beyond the remaining quota tells oversized uploads apart
+		contents = io.LimitReader(contents, remaining+1)
+	}
+
+	// Stream into a temp file while hashing; the final blob name is only known afterwards
+	tempFile, err := os.CreateTemp(s.blobsDir(), "*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tempName := tempFile.Name()
+	// Cleanup deferred for all exit paths; a no-op once renamed
+	defer func() { _ = os.Remove(tempName) }()
+	defer func() { _ = tempFile.Close() }()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hash), contents)
+	if err != nil {
+		return nil, err
+	}
+	if s.quota > 0 && size > remaining {
+		return nil, fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, s.quota-remaining, s.quota)
+	}
+	if err := tempFile.Close(); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	id, err := newFileID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.purgeLocked(); err != nil {
+		return nil, err
+	}
+
+	blobPath := s.blobPath(sum)
+	if _, err := os.Stat(blobPath); errors.Is(err, fs.ErrNotExist) {
+		if s.quota > 0 {
+			used, err := s.usageLocked()
+			if err != nil {
+				return nil, err
+			}
+			if used+size > s.quota {
+				return nil, fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, used, s.quota)
+			}
+		}
+		if err := os.Rename(tempName, blobPath); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	file := &File{
+		ID:        id,
+		Filename:  filename,
+		Purpose:   purpose,
+		Bytes:     size,
+		SHA256:    sum,
+		CreatedAt: now,
+	}
+	if s.ttl > 0 {
+		file.ExpiresAt = now.Add(s.ttl)
+	}
+
+	if err := s.writeMetadataLocked(file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Get returns the metadata of a file. Returns ErrNotFound for unknown or expired IDs.
+func (s *Store) Get(ctx context.Context, id string) (*File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getLocked(id)
+}
+
+// Open returns the metadata and a reader for the contents of a file.
+// The caller must close the reader.
+func (s *Store) Open(ctx context.Context, id string) (*File, io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.getLocked(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Open handles stay valid if the blob is removed concurrently
+	contents, err := os.Open(s.blobPath(file.SHA256))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+
+	return file, contents, nil
+}
+
+// ReadFile returns the metadata and full contents of a file.
+func (s *Store) ReadFile(ctx context.Context, id string) (*File, []byte, error) {
+	file, contents, err := s.Open(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = contents.Close() }()
+
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, data, nil
+}
+
+// List returns all unexpired files ordered by creation time, oldest first.
+func (s *Store) List(ctx context.Context) ([]File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.purgeLocked(); err != nil {
+		return nil, err
+	}
+
+	files, err := s.readAllMetadataLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(files, func(a, b File) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return files, nil
+}
+
+// Delete removes a file. Its contents are removed once no other file references them.
+// Returns ErrNotFound for unknown or expired IDs.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.getLocked(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.metadataPath(file.ID)); err != nil {
+		return err
+	}
+
+	return s.removeUnreferencedBlobsLocked()
+}
+
+// getLocked reads the metadata of a file, treating expired files as missing.
+func (s *Store) getLocked(id string) (*File, error) {
+	if !fileIDPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.metadataPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode metadata of %s: %w", id, err)
+	}
+	if s.expired(file) {
+		return nil, ErrNotFound
+	}
+
+	return &file, nil
+}
+
+// purgeLocked removes expired files and blobs no longer referenced by any file.
+func (s *Store) purgeLocked() error {
+	files, err := s.readAllMetadataLocked()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if s.expired(file) {
+			if err := os.Remove(s.metadataPath(file.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return s.removeUnreferencedBlobsLocked()
+}
+
+// removeUnreferencedBlobsLocked removes blobs without metadata referencing them.
+// Leftover temp files from interrupted uploads are not touched.
+func (s *Store) removeUnreferencedBlobsLocked() error {
+	files, err := s.readAllMetadataLocked()
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		referenced[file.SHA256] = struct{}{}
+	}
+
+	entries, err := os.ReadDir(s.blobsDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		if _, ok := referenced[name]; !ok {
+			if err := os.Remove(filepath.Join(s.blobsDir(), name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// remainingQuota returns the bytes that can still be stored, after purging expired files.
+func (s *Store) remainingQuota() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.purgeLocked(); err != nil {
+		return 0, err
+	}
+	used, err := s.usageLocked()
+	if err != nil {
+		return 0, err
+	}
+	return max(s.quota-used, 0), nil
+}
+
+// usageLocked sums the sizes of all stored blobs.
+func (s *Store) usageLocked() (int64, error) {
+	entries, err := os.ReadDir(s.blobsDir())
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		used += info.Size()
+	}
+	return used, nil
+}
+
+// readAllMetadataLocked reads all metadata records, including expired ones.
+func (s *Store) readAllMetadataLocked() ([]File, error) {
+	entries, err := os.ReadDir(s.filesDir())
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]File, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !fileIDPattern.MatchString(id) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.filesDir(), entry.Name()))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		var file File
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("decode metadata of %s: %w", id, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// writeMetadataLocked atomically writes a metadata record using temp file + rename.
+func (s *Store) writeMetadataLocked(file *File) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(s.filesDir(), "*.tmp")
+	if err != nil {
+		return err
+	}
+	tempName := tempFile.Name()
+	defer func() { _ = os.Remove(tempName) }()
+	defer func() { _ = tempFile.Close() }()
+
+	if _, err := tempFile.Write(data); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempName, s.metadataPath(file.ID))
+}
+
+func (s *Store) expired(file File) bool {
+	return !file.ExpiresAt.IsZero() && !s.now().Before(file.ExpiresAt)
+}
+
+func (s *Store) blobsDir() string {
+	return filepath.Join(s.dir, "blobs")
+}
+
+func (s *Store) filesDir() string {
+	return filepath.Join(s.dir, "files")
+}
+
+func (s *Store) blobPath(sum string) string {
+	return filepath.Join(s.blobsDir(), sum)
+}
+
+func (s *Store) metadataPath(id string) string {
+	return filepath.Join(s.filesDir(), id+".json")
+}
+
+// newFileID generates an OpenAI-style file ID ("file-" + 24 alphanumeric characters).
+func newFileID() (string, error) {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = alphabet[int(b)%len(alphabet)]
+	}
+	return "file-" + string(buf), nil
+}
+
+// contextReader aborts long uploads once the request context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,201 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStore creates a Store in a temporary directory with a controllable clock.
+func newTestStore(t *testing.T, opts ...Option) (*Store, *time.Time) {
+	t.Helper()
+	s, err := New(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func put(t *testing.T, s *Store, filename, contents string) *File {
+	t.Helper()
+	file, err := s.Put(context.Background(), filename, "assistants", strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("Failed to put %s: %v", filename, err)
+	}
+	return file
+}
+
+// blobCount returns the number of stored blobs, including leftover temp files.
+func blobCount(t *testing.T, s *Store) int {
+	t.Helper()
+	entries, err := os.ReadDir(s.blobsDir())
+	if err != nil {
+		t.Fatalf("Failed to read blobs: %v", err)
+	}
+	return len(entries)
+}
+
+func TestStore_PutAndRead(t *testing.T) {
+	t.Parallel()
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	file := put(t, s, "notes.txt", "hello")
+	if !fileIDPattern.MatchString(file.ID) || file.Bytes != 5 || file.Filename != "notes.txt" {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	if !file.ExpiresAt.IsZero() {
+		t.Errorf("Expected no expiry without TTL, got %v", file.ExpiresAt)
+	}
+
+	got, data, err := s.ReadFile(ctx, file.ID)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "hello" || *got != *file {
+		t.Errorf("ReadFile() = %+v %q, want %+v %q", got, data, file, "hello")
+	}
+
+	for _, id := range []string{"file-unknown000000000000000", "../files/" + file.ID, ""} {
+		if _, err := s.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): expected ErrNotFound, got %v", id, err)
+		}
+	}
+}
+
+func TestStore_Dedup(t *testing.T) {
+	t.Parallel()
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	first := put(t, s, "a.txt", "same contents")
+	second := put(t, s, "b.txt", "same contents")
+	if first.ID == second.ID || first.SHA256 != second.SHA256 {
+		t.Fatalf("Expected distinct files sharing contents, got %+v and %+v", first, second)
+	}
+	if n := blobCount(t, s); n != 1 {
+		t.Fatalf("Expected one shared blob, got %d", n)
+	}
+
+	files, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Expected 2 files, got %d", len(files))
+	}
+
+	// Deleting a file keeps contents still referenced by the other
+	_, contents, err := s.Open(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer func() { _ = contents.Close() }()
+
+	if err := s.Delete(ctx, first.ID); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if _, err := s.Get(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted file to be gone, got %v", err)
+	}
+	if _, data, err := s.ReadFile(ctx, second.ID); err != nil || string(data) != "same contents" {
+		t.Errorf("Expected contents of remaining file, got %q: %v", data, err)
+	}
+
+	if err := s.Delete(ctx, second.ID); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if n := blobCount(t, s); n != 0 {
+		t.Errorf("Expected unreferenced blob to be removed, got %d blobs", n)
+	}
+	if err := s.Delete(ctx, second.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+
+	// Handles opened before deletion stay readable
+	if data, err := io.ReadAll(contents); err != nil || string(data) != "same contents" {
+		t.Errorf("Expected open handle to stay readable, got %q: %v", data, err)
+	}
+}
+
+func TestStore_TTL(t *testing.T) {
+	t.Parallel()
+	s, now := newTestStore(t, WithTTL(time.Hour))
+	ctx := context.Background()
+
+	expiring := put(t, s, "old.txt", "old")
+	if want := now.Add(time.Hour); !expiring.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt: got %v, want %v", expiring.ExpiresAt, want)
+	}
+
+	*now = now.Add(30 * time.Minute)
+	fresh := put(t, s, "new.txt", "new")
+
+	*now = now.Add(30 * time.Minute)
+	if _, err := s.Get(ctx, expiring.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected expired file to be gone, got %v", err)
+	}
+	if _, _, err := s.Open(ctx, expiring.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected expired file not to open, got %v", err)
+	}
+
+	// Listing purges expired files and their blobs
+	files, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(files) != 1 || files[0].ID != fresh.ID {
+		t.Errorf("Expected only the unexpired file, got %+v", files)
+	}
+	if n := blobCount(t, s); n != 1 {
+		t.Errorf("Expected expired blob to be purged, got %d blobs", n)
+	}
+}
+
+// countingReader counts the bytes read from an endless stream of zeros.
+type countingReader struct {
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	clear(p)
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestStore_Quota(t *testing.T) {
+	t.Parallel()
+	s, now := newTestStore(t, WithQuota(10), WithTTL(time.Hour))
+	ctx := context.Background()
+
+	put(t, s, "a.txt", "123456")
+
+	if _, err := s.Put(ctx, "b.txt", "assistants", strings.NewReader("abcdef")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if n := blobCount(t, s); n != 1 {
+		t.Errorf("Expected rejected upload to leave no blob or temp file, got %d entries", n)
+	}
+
+	// Uploads stop being read once past the remaining quota
+	endless := &countingReader{}
+	if _, err := s.Put(ctx, "endless.bin", "assistants", endless); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if endless.n > 5 {
+		t.Errorf("Expected at most 5 bytes read beyond the quota check, got %d", endless.n)
+	}
+
+	// Contents fitting the remaining quota are stored
+	put(t, s, "c.txt", "abcd")
+
+	// Expired files no longer count against the quota
+	*now = now.Add(time.Hour)
+	put(t, s, "d.txt", "0123456789")
+}
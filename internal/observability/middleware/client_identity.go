@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// ClientIdentity extracts the subject of a verified client certificate (mTLS) and
+// records it as the client identity in the request's log attributes.
+// No-op for plain HTTP or TLS connections without client certificates.
+func ClientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// VerifiedChains is only populated when the certificate was validated against ClientCAs,
+		// so unverified certificates (ClientAuth below VerifyClientCertIfGiven) are never trusted.
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity := r.TLS.VerifiedChains[0][0].Subject.String()
+		SetLogAttrs(r.Context(), slog.String("client_identity", identity))
+
+		next.ServeHTTP(w, r)
+	})
+}
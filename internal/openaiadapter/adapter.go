@@ -44,6 +44,40 @@ type (
 	]
 )
 
+// Type aliases for OpenAI-compatible legacy text completion operations.
+// Streaming chunks share the response shape (object "text_completion").
+// CreateCompletionAdapter is the concrete adapter interface for this operation.
+type (
+	CreateCompletionRequest  = types.CreateCompletionRequest
+	CreateCompletionResponse = types.CreateCompletionResponse
+	CreateCompletionChunk    = types.CreateCompletionResponse
+
+	CreateCompletionAdapter = Adapter[
+		CreateCompletionRequest,
+		CreateCompletionResponse,
+		CreateCompletionChunk,
+	]
+)
+
+// Type aliases for OpenAI-compatible batch operations.
+// Batches don't follow the request/response/chunk shape of Adapter and are served by
+// dedicated adapter methods (create, retrieve, list, cancel, output).
+type (
+	Batch               = types.Batch
+	BatchRequestInput   = types.BatchRequestInput
+	BatchRequestOutput  = types.BatchRequestOutput
+	CreateBatchRequest  = types.CreateBatchRequest
+	ListBatchesResponse = types.ListBatchesResponse
+)
+
+// Type aliases for OpenAI-compatible file operations.
+// Files are stored locally by the proxy and are not provider-specific.
+type (
+	OpenAIFile         = types.OpenAIFile
+	ListFilesResponse  = types.ListFilesResponse
+	DeleteFileResponse = types.DeleteFileResponse
+)
+
 // Type aliases for OpenAI-compatible error responses.
 // Error types are generated from OpenAPI spec (see types package).
 type (
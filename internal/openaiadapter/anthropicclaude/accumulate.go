@@ -0,0 +1,275 @@
+package anthropicclaude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+)
+
+// Internal streaming: non-streaming requests only receive response headers once the whole
+// message is generated, so requests with large max_tokens or thinking budgets run into
+// upstream, intermediary and ResponseHeaderTimeout limits. Above a max_tokens threshold
+// (see WithInternalStreaming), such requests are sent as streaming requests and the events
+// are accumulated into the message a non-streaming request would have returned.
+
+// newMessage calls Anthropic's non-streaming API, or its streaming API if max_tokens
+// reaches the internal streaming threshold.
+func (a *CreateChatCompletionAdapter) newMessage(
+	ctx context.Context,
+	client *anthropic.Client,
+	params anthropic.MessageNewParams,
+	opts []option.RequestOption,
+) (*anthropic.Message, error) {
+	if a.streamThreshold <= 0 || params.MaxTokens < int64(a.streamThreshold) {
+		return client.Messages.New(ctx, params, opts...)
+	}
+
+	stream := client.Messages.NewStreaming(ctx, params, opts...)
+	defer func() { _ = stream.Close() }()
+
+	body, err := accumulateMessage(stream)
+	if err != nil {
+		return nil, err
+	}
+	var message anthropic.Message
+	if err := message.UnmarshalJSON(body); err != nil {
+		return nil, fmt.Errorf("decode streamed message: %w", err)
+	}
+	return &message, nil
+}
+
+// ReadMessageStream reads an Anthropic Messages API event stream to its end and returns
+// the body of the equivalent non-streaming response. Error events are returned as errors
+// carrying the Anthropic error response (see StreamErrorBody).
+func ReadMessageStream(resp *http.Response) ([]byte, error) {
+	stream := ssestream.NewStream[anthropic.MessageStreamEventUnion](ssestream.NewDecoder(resp), nil)
+	defer func() { _ = stream.Close() }()
+	return accumulateMessage(stream)
+}
+
+// messageFieldOrder is the order of fields in non-streaming responses. message_start may
+// list them differently, so the accumulated message is brought into this order.
+var messageFieldOrder = []string{"id", "type", "role", "model", "content", "stop_reason", "stop_sequence", "usage"}
+
+// accumulateMessage reads a stream to its end and returns the JSON of the complete message,
+// shaped like a non-streaming response. Fields are taken verbatim from the events, so
+// fields unknown to the SDK are preserved.
+func accumulateMessage(stream messageStream) ([]byte, error) {
+	var message *jsonObject
+	blocks := newStreamedContentBlocks()
+	stopped := false
+
+	for stream.Next() {
+		event := stream.Current()
+		switch eventType := event.AsAny().(type) {
+		case anthropic.MessageStartEvent:
+			var err error
+			if message, err = parseJSONObject([]byte(eventType.Message.RawJSON())); err != nil {
+				return nil, fmt.Errorf("read message_start event: %w", err)
+			}
+
+		case anthropic.ContentBlockStartEvent:
+			if err := blocks.start(eventType.Index, eventType.ContentBlock.Type, eventType.ContentBlock.RawJSON()); err != nil {
+				return nil, err
+			}
+
+		case anthropic.ContentBlockDeltaEvent:
+			switch deltaVariant := eventType.Delta.AsAny().(type) {
+			case anthropic.TextDelta:
+				blocks.appendText(eventType.Index, deltaVariant.Text)
+			case anthropic.InputJSONDelta:
+				blocks.appendInput(eventType.Index, deltaVariant.PartialJSON)
+			case anthropic.CitationsDelta:
+				blocks.appendCitation(eventType.Index, deltaVariant.Citation.RawJSON())
+			case anthropic.ThinkingDelta:
+				blocks.appendThinking(eventType.Index, deltaVariant.Thinking)
+			case anthropic.SignatureDelta:
+				blocks.appendSignature(eventType.Index, deltaVariant.Signature)
+			}
+
+		case anthropic.MessageDeltaEvent:
+			if message == nil {
+				return nil, fmt.Errorf("received message_delta event before message_start")
+			}
+			if err := applyMessageDelta(message, event.RawJSON()); err != nil {
+				return nil, err
+			}
+
+		case anthropic.MessageStopEvent:
+			stopped = true
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	if message == nil || !stopped {
+		return nil, fmt.Errorf("message stream ended unexpectedly")
+	}
+
+	content, err := blocks.rawBlocks()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := marshalJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("encode message content: %w", err)
+	}
+	message.set("content", encoded)
+	message.moveToFront(messageFieldOrder...)
+	return marshalJSON(message)
+}
+
+// applyMessageDelta applies the fields of a message_delta event to the message. Usage in
+// message_delta is cumulative, so its counts replace those of message_start.
+func applyMessageDelta(message *jsonObject, rawJSON string) error {
+	var event struct {
+		Delta json.RawMessage `json:"delta"`
+		Usage json.RawMessage `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(rawJSON), &event); err != nil {
+		return fmt.Errorf("read message_delta event: %w", err)
+	}
+	if len(event.Delta) > 0 && string(event.Delta) != "null" {
+		delta, err := parseJSONObject(event.Delta)
+		if err != nil {
+			return fmt.Errorf("read message_delta event: %w", err)
+		}
+		for _, field := range delta.keys {
+			message.set(field, delta.values[field])
+		}
+	}
+
+	if len(event.Usage) == 0 || string(event.Usage) == "null" {
+		return nil
+	}
+	delta, err := parseJSONObject(event.Usage)
+	if err != nil {
+		return fmt.Errorf("read message_delta event: %w", err)
+	}
+	usage, err := parseJSONObject(message.get("usage"))
+	if err != nil {
+		usage = &jsonObject{}
+	}
+	for _, field := range delta.keys {
+		if value := delta.values[field]; string(value) != "null" {
+			usage.set(field, value)
+		}
+	}
+	encoded, err := marshalJSON(usage)
+	if err != nil {
+		return fmt.Errorf("encode usage: %w", err)
+	}
+	message.set("usage", encoded)
+	return nil
+}
+
+// jsonObject is a JSON object that keeps the order of its fields, so objects rebuilt from
+// stream events serialize like the response they stand for.
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// parseJSONObject decodes a JSON object, keeping its values verbatim.
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected JSON object")
+	}
+	object := &jsonObject{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		object.set(tok.(string), value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// get returns the value of a field, or nil.
+func (o *jsonObject) get(key string) json.RawMessage {
+	return o.values[key]
+}
+
+// set replaces the value of a field in place, or appends the field if it's new.
+func (o *jsonObject) set(key string, value json.RawMessage) {
+	if o.values == nil {
+		o.values = make(map[string]json.RawMessage)
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// delete removes a field.
+func (o *jsonObject) delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	o.keys = slices.DeleteFunc(o.keys, func(k string) bool { return k == key })
+}
+
+// moveToFront orders the given fields first, in the given order. Fields that don't
+// exist are skipped and the remaining fields keep their order.
+func (o *jsonObject) moveToFront(keys ...string) {
+	ordered := make([]string, 0, len(o.keys))
+	for _, key := range keys {
+		if _, ok := o.values[key]; ok {
+			ordered = append(ordered, key)
+		}
+	}
+	for _, key := range o.keys {
+		if !slices.Contains(keys, key) {
+			ordered = append(ordered, key)
+		}
+	}
+	o.keys = ordered
+}
+
+// MarshalJSON implements json.Marshaler, writing the fields in order.
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := marshalJSON(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalJSON encodes v like the Anthropic API does, without escaping HTML characters.
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
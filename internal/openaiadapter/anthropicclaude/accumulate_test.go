@@ -0,0 +1,176 @@
+package anthropicclaude_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+func TestCreateChatCompletionAdapter_InternalStreaming(t *testing.T) {
+	t.Parallel()
+
+	t.Run("streams above threshold", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageStream([]string{"def add(a, b):", "\n    return a + b"}, "end_turn", 10, 16),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithInternalStreaming(16))
+
+		resp, err := adapter.ProcessRequest(context.Background(), newContinuationRequest(t, false), transport)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		if err := json.Unmarshal(transport.bodies[0], &req); err != nil || !req.Stream {
+			t.Errorf("Expected a streaming upstream request, got %s", transport.bodies[0])
+		}
+
+		choice := resp.Choices[0]
+		if choice.Message.Content == nil || *choice.Message.Content != "def add(a, b):\n    return a + b" {
+			t.Errorf("Content: got %v", choice.Message.Content)
+		}
+		if choice.FinishReason != types.CreateChatCompletionResponseChoiceFinishReasonStop {
+			t.Errorf("Finish reason: got %q, want stop", choice.FinishReason)
+		}
+		if resp.Usage.PromptTokens != 10 || resp.Usage.CompletionTokens != 16 {
+			t.Errorf("Usage: got %+v", *resp.Usage)
+		}
+	})
+
+	t.Run("buffered below threshold", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageResponse("def add(a, b):", "end_turn", 10, 16),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithInternalStreaming(17))
+
+		if _, err := adapter.ProcessRequest(context.Background(), newContinuationRequest(t, false), transport); err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if strings.Contains(string(transport.bodies[0]), `"stream"`) {
+			t.Errorf("Expected a non-streaming upstream request, got %s", transport.bodies[0])
+		}
+	})
+}
+
+func TestReadMessageStream(t *testing.T) {
+	t.Parallel()
+
+	events := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":12,"cache_read_input_tokens":4,"output_tokens":1}}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Look it up."}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`,
+		``,
+		`event: content_block_stop`,
+		`data: {"type":"content_block_stop","index":0}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{}}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		``,
+		`event: content_block_stop`,
+		`data: {"type":"content_block_stop","index":1}`,
+		``,
+		`event: message_delta`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":30}}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	}, "\n") + "\n"
+
+	body, err := anthropicclaude.ReadMessageStream(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(events)),
+	})
+	if err != nil {
+		t.Fatalf("ReadMessageStream failed: %v", err)
+	}
+
+	assertJSONEqual(t, string(body), `{
+		"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0",
+		"content":[
+			{"type":"thinking","thinking":"Look it up.","signature":"c2ln"},
+			{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{"city":"Paris"}}
+		],
+		"stop_reason":"tool_use","stop_sequence":null,
+		"usage":{"input_tokens":12,"cache_read_input_tokens":4,"output_tokens":30}
+	}`)
+}
+
+func TestReadMessageStream_MatchesNonStreamingResponse(t *testing.T) {
+	t.Parallel()
+
+	events, err := os.ReadFile("testdata/accumulate/tool_use.sse")
+	if err != nil {
+		t.Fatalf("Failed to read stream fixture: %v", err)
+	}
+	want, err := os.ReadFile("testdata/accumulate/tool_use.json")
+	if err != nil {
+		t.Fatalf("Failed to read response fixture: %v", err)
+	}
+
+	body, err := anthropicclaude.ReadMessageStream(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(string(events))),
+	})
+	if err != nil {
+		t.Fatalf("ReadMessageStream failed: %v", err)
+	}
+
+	// Field order and escaping match the non-streaming response byte for byte
+	if got := string(body); got != strings.TrimSpace(string(want)) {
+		t.Errorf("Body mismatch:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestReadMessageStream_Error(t *testing.T) {
+	t.Parallel()
+
+	events := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		``,
+		`event: error`,
+		`data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		``,
+	}, "\n") + "\n"
+
+	_, err := anthropicclaude.ReadMessageStream(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(events)),
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	body, ok := anthropicclaude.StreamErrorBody(err)
+	if !ok || !strings.Contains(body, "overloaded_error") {
+		t.Errorf("Expected the stream error body, got %q (%v)", body, err)
+	}
+}
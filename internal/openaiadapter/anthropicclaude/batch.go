@@ -0,0 +1,397 @@
+package anthropicclaude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+const (
+	// batchEndpoint is the only OpenAI endpoint supported inside batches.
+	batchEndpoint = "/v1/chat/completions"
+
+	// batchCompletionWindow reflects Anthropic's 24 hour processing limit for Message Batches.
+	batchCompletionWindow = "24h"
+)
+
+// BatchAdapter transforms OpenAI Batch API operations to Anthropic Message Batches.
+//
+// The adapter is stateless: OpenAI batch IDs are Anthropic batch IDs, and batch objects are
+// derived from Anthropic's batch state on every call.
+//
+// Anthropic-specific transformations:
+//   - Input: JSONL chat completion requests are converted with the chat completion adapter
+//   - Status: processing_status plus cancel/end timestamps map to OpenAI batch statuses
+//   - Output: Individual results become OpenAI output lines; the output file ID is the batch ID
+type BatchAdapter struct {
+	chat CreateChatCompletionAdapter
+}
+
+// NewBatchAdapter creates a new batch adapter.
+// Options apply to the conversion of the contained chat completion requests.
+func NewBatchAdapter(opts ...Option) *BatchAdapter {
+	return &BatchAdapter{
+		chat: *NewCreateChatCompletionAdapter(opts...),
+	}
+}
+
+// CreateBatch validates and converts each chat completion request and submits them as a
+// single Anthropic Message Batch.
+func (a *BatchAdapter) CreateBatch(
+	ctx context.Context,
+	inputs []openaiadapter.BatchRequestInput,
+	transport http.RoundTripper,
+) (*openaiadapter.Batch, error) {
+	if len(inputs) == 0 {
+		return nil, newInvalidRequestError("batch input cannot be empty")
+	}
+
+	requests := make([]anthropic.MessageBatchNewParamsRequest, 0, len(inputs))
+	seen := make(map[string]struct{}, len(inputs))
+	var betas []string
+	for i, input := range inputs {
+		line := i + 1
+
+		if input.CustomId == "" {
+			return nil, newInvalidRequestError("line %d: custom_id is required", line)
+		}
+		if _, dup := seen[input.CustomId]; dup {
+			return nil, newInvalidRequestError("line %d: duplicate custom_id %q", line, input.CustomId)
+		}
+		seen[input.CustomId] = struct{}{}
+
+		if input.Method != types.POST {
+			return nil, newInvalidRequestError("line %d: unsupported method %q (only POST)", line, input.Method)
+		}
+		if input.Url != batchEndpoint {
+			return nil, newInvalidRequestError("line %d: unsupported url %q (only %s)", line, input.Url, batchEndpoint)
+		}
+		if input.Body.Stream != nil && *input.Body.Stream {
+			return nil, newInvalidRequestError("line %d: streaming is not supported in batches", line)
+		}
+		if candidateCount(input.Body) > 1 {
+			return nil, newInvalidRequestError("line %d: n > 1 is not supported in batches", line)
+		}
+		if err := a.chat.validateRequest(input.Body); err != nil {
+			return nil, newInvalidRequestError("line %d: %s", line, err)
+		}
+
+		body, err := a.chat.resolveContentReferences(ctx, input.Body)
+		if err != nil {
+			var errResp *types.ErrorResponse
+			if errors.As(err, &errResp) {
+				return nil, newInvalidRequestError("line %d: %s", line, errResp.Err.Message)
+			}
+			return nil, toChatCompletionError(fmt.Errorf("line %d: %w", line, err))
+		}
+
+		params, err := buildBatchRequestParams(ctx, body, a.chat.historyMode)
+		if err != nil {
+			return nil, newInvalidRequestError("line %d: %s", line, err)
+		}
+
+		// Beta features apply to the whole batch
+		for _, beta := range serverToolBetaFeatures(body) {
+			if !slices.Contains(betas, beta) {
+				betas = append(betas, beta)
+			}
+		}
+
+		requests = append(requests, anthropic.MessageBatchNewParamsRequest{
+			CustomID: input.CustomId,
+			Params:   params,
+		})
+	}
+
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, toChatCompletionError(fmt.Errorf("initialize Anthropic client for batch request: %w", err))
+	}
+
+	batch, err := client.Messages.Batches.New(ctx, anthropic.MessageBatchNewParams{Requests: requests}, betaRequestOptions(betas)...)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	return toBatch(batch), nil
+}
+
+// RetrieveBatch returns the current state of a batch.
+func (a *BatchAdapter) RetrieveBatch(
+	ctx context.Context,
+	batchID string,
+	transport http.RoundTripper,
+) (*openaiadapter.Batch, error) {
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, toChatCompletionError(fmt.Errorf("initialize Anthropic client for batch request: %w", err))
+	}
+
+	batch, err := client.Messages.Batches.Get(ctx, batchID)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	return toBatch(batch), nil
+}
+
+// CancelBatch initiates cancellation of a batch. Requests already processed keep their results.
+func (a *BatchAdapter) CancelBatch(
+	ctx context.Context,
+	batchID string,
+	transport http.RoundTripper,
+) (*openaiadapter.Batch, error) {
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, toChatCompletionError(fmt.Errorf("initialize Anthropic client for batch request: %w", err))
+	}
+
+	batch, err := client.Messages.Batches.Cancel(ctx, batchID)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	return toBatch(batch), nil
+}
+
+// ListBatches returns a page of batches, most recent first.
+func (a *BatchAdapter) ListBatches(
+	ctx context.Context,
+	params types.ListBatchesParams,
+	transport http.RoundTripper,
+) (*openaiadapter.ListBatchesResponse, error) {
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, toChatCompletionError(fmt.Errorf("initialize Anthropic client for batch request: %w", err))
+	}
+
+	var query anthropic.MessageBatchListParams
+	if params.After != nil {
+		query.AfterID = anthropic.String(*params.After)
+	}
+	if params.Limit != nil {
+		query.Limit = anthropic.Int(int64(*params.Limit))
+	}
+
+	page, err := client.Messages.Batches.List(ctx, query)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	response := &openaiadapter.ListBatchesResponse{
+		Data:    make([]types.Batch, 0, len(page.Data)),
+		HasMore: page.HasMore,
+		Object:  types.List,
+	}
+	for i := range page.Data {
+		response.Data = append(response.Data, *toBatch(&page.Data[i]))
+	}
+	if page.FirstID != "" {
+		response.FirstId = &page.FirstID
+	}
+	if page.LastID != "" {
+		response.LastId = &page.LastID
+	}
+
+	return response, nil
+}
+
+// BatchOutput streams the results of an ended batch as OpenAI batch output lines.
+// Results are not guaranteed to be in input order; custom_id matches outputs to inputs.
+func (a *BatchAdapter) BatchOutput(
+	ctx context.Context,
+	batchID string,
+	transport http.RoundTripper,
+) (iter.Seq2[*openaiadapter.BatchRequestOutput, error], error) {
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, toChatCompletionError(fmt.Errorf("initialize Anthropic client for batch request: %w", err))
+	}
+
+	stream := client.Messages.Batches.ResultsStreaming(ctx, batchID)
+	// Request errors (unknown batch, batch still processing) surface before the first line
+	if err := stream.Err(); err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	return func(yield func(*openaiadapter.BatchRequestOutput, error) bool) {
+		defer func() { _ = stream.Close() }()
+
+		for stream.Next() {
+			output, err := a.toBatchRequestOutput(stream.Current())
+			if err != nil {
+				yield(nil, toChatCompletionError(err))
+				return
+			}
+			if !yield(output, nil) {
+				return
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			yield(nil, toChatCompletionError(err))
+		}
+	}, nil
+}
+
+// toBatchRequestOutput converts an individual Anthropic batch result to an OpenAI output line.
+//
+// Error transformation: OpenAI splits failures into a separate error file. Anthropic returns
+// all results in one stream, so failures are emitted inline with response=null and error set.
+func (a *BatchAdapter) toBatchRequestOutput(result anthropic.MessageBatchIndividualResponse) (*openaiadapter.BatchRequestOutput, error) {
+	output := &openaiadapter.BatchRequestOutput{
+		Id:       "batch_req_" + result.CustomID,
+		CustomId: result.CustomID,
+	}
+
+	switch result.Result.Type {
+	case "succeeded":
+		body, err := a.chat.transformResponse(&result.Result.Message)
+		if err != nil {
+			return nil, fmt.Errorf("transform batch result %s: %w", result.CustomID, err)
+		}
+		output.Response = &struct {
+			Body       types.CreateChatCompletionResponse `json:"body"`
+			RequestId  string                             `json:"request_id"`
+			StatusCode int                                `json:"status_code"`
+		}{
+			Body:       *body,
+			RequestId:  result.Result.Message.ID,
+			StatusCode: http.StatusOK,
+		}
+	case "errored":
+		output.Error = newBatchOutputError(
+			mapAnthropicErrorType(result.Result.Error.Error.Type),
+			result.Result.Error.Error.Message,
+		)
+	case "canceled":
+		output.Error = newBatchOutputError("batch_cancelled", "request was canceled before processing")
+	case "expired":
+		output.Error = newBatchOutputError("batch_expired", "request expired before processing")
+	default:
+		output.Error = newBatchOutputError("api_error", fmt.Sprintf("unknown batch result type %q", result.Result.Type))
+	}
+
+	return output, nil
+}
+
+// newBatchOutputError creates the error member of an OpenAI batch output line.
+func newBatchOutputError(code, message string) *struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+} {
+	return &struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{Code: code, Message: message}
+}
+
+// buildBatchRequestParams converts a chat completion request into Message Batch params.
+// Conversion is shared with regular requests; only the params type differs per endpoint.
+func buildBatchRequestParams(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	historyMode HistoryMode,
+) (anthropic.MessageBatchNewParamsRequestParams, error) {
+	systemPrompts, messages, err := transformMessages(ctx, clientReq.Messages, historyMode)
+	if err != nil {
+		return anthropic.MessageBatchNewParamsRequestParams{}, err
+	}
+	if err := enableDocumentCitations(clientReq, messages); err != nil {
+		return anthropic.MessageBatchNewParamsRequestParams{}, err
+	}
+
+	params, err := buildGenerationParams(clientReq)
+	if err != nil {
+		return anthropic.MessageBatchNewParamsRequestParams{}, fmt.Errorf("build generation params: %w", err)
+	}
+
+	return anthropic.MessageBatchNewParamsRequestParams{
+		MaxTokens:     params.MaxTokens,
+		Messages:      messages,
+		Model:         params.Model,
+		Temperature:   params.Temperature,
+		TopK:          params.TopK,
+		TopP:          params.TopP,
+		Metadata:      params.Metadata,
+		ServiceTier:   string(params.ServiceTier),
+		StopSequences: params.StopSequences,
+		System:        systemPrompts,
+		Thinking:      params.Thinking,
+		ToolChoice:    params.ToolChoice,
+		Tools:         params.Tools,
+	}, nil
+}
+
+// toBatch converts an Anthropic Message Batch to an OpenAI batch object.
+//
+// Status transformation: Anthropic only distinguishes in_progress, canceling and ended.
+// Ended batches are reported as cancelled when cancellation was initiated, expired when
+// no request was processed before expiry, and completed otherwise. OpenAI's validating
+// and finalizing phases have no Anthropic equivalent.
+func toBatch(batch *anthropic.MessageBatch) *openaiadapter.Batch {
+	counts := batch.RequestCounts
+	total := counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired
+
+	result := &openaiadapter.Batch{
+		Id:               batch.ID,
+		Object:           types.BatchObjectBatch,
+		Endpoint:         batchEndpoint,
+		InputFileId:      "", // Input is submitted inline, not as uploaded file
+		CompletionWindow: batchCompletionWindow,
+		CreatedAt:        int(batch.CreatedAt.Unix()),
+		InProgressAt:     unixOrNil(batch.CreatedAt),
+		ExpiresAt:        unixOrNil(batch.ExpiresAt),
+		CancellingAt:     unixOrNil(batch.CancelInitiatedAt),
+	}
+	result.RequestCounts = &struct {
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+		Total     int `json:"total"`
+	}{
+		Completed: int(counts.Succeeded),
+		Failed:    int(counts.Errored + counts.Canceled + counts.Expired),
+		Total:     int(total),
+	}
+
+	switch batch.ProcessingStatus {
+	case anthropic.MessageBatchProcessingStatusCanceling:
+		result.Status = types.Cancelling
+	case anthropic.MessageBatchProcessingStatusEnded:
+		switch {
+		case !batch.CancelInitiatedAt.IsZero():
+			result.Status = types.Cancelled
+			result.CancelledAt = unixOrNil(batch.EndedAt)
+		case counts.Expired > 0 && counts.Succeeded+counts.Errored == 0:
+			result.Status = types.Expired
+			result.ExpiredAt = unixOrNil(batch.EndedAt)
+		default:
+			result.Status = types.Completed
+			result.CompletedAt = unixOrNil(batch.EndedAt)
+		}
+		// Results of ended batches are served under the batch ID
+		result.OutputFileId = &batch.ID
+	default:
+		result.Status = types.InProgress
+	}
+
+	return result
+}
+
+// unixOrNil converts a timestamp to Unix seconds, returning nil for zero (null) timestamps.
+func unixOrNil(t time.Time) *int {
+	if t.IsZero() {
+		return nil
+	}
+	v := int(t.Unix())
+	return &v
+}
@@ -0,0 +1,170 @@
+package anthropicclaude
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+const (
+	// maxCandidates matches OpenAI's upper bound for n.
+	maxCandidates = 128
+
+	// maxConcurrentCandidates bounds parallel upstream requests per client request,
+	// so large n values don't exhaust rate limits at once.
+	maxConcurrentCandidates = 4
+)
+
+// candidateCount returns the number of completion choices requested via n.
+//
+// N transformation: Anthropic has no multi-candidate support, so each choice is generated
+// by an independent upstream request (see processCandidates and streamCandidates).
+func candidateCount(clientReq openaiadapter.CreateChatCompletionRequest) int {
+	if clientReq.N == nil {
+		return 1
+	}
+	return *clientReq.N
+}
+
+// processCandidates generates n choices via concurrent upstream requests and merges them
+// into a single response with summed usage. Fails as a whole if any candidate fails.
+func (a *CreateChatCompletionAdapter) processCandidates(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	transport http.RoundTripper,
+	n int,
+) (*openaiadapter.CreateChatCompletionResponse, error) {
+	responses := make([]*openaiadapter.CreateChatCompletionResponse, n)
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentCandidates)
+	for i := range n {
+		g.Go(func() error {
+			resp, err := a.processCandidate(gCtx, clientReq, transport)
+			if err != nil {
+				return newCandidateError(i, n, err)
+			}
+			responses[i] = resp
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	merged := *responses[0]
+	merged.Choices = make([]types.CreateChatCompletionResponseChoice, 0, n)
+	usages := make([]*types.CompletionUsage, 0, n)
+	for i, resp := range responses {
+		for _, choice := range resp.Choices {
+			choice.Index = i
+			merged.Choices = append(merged.Choices, choice)
+		}
+		usages = append(usages, resp.Usage)
+	}
+	merged.Usage = sumCompletionUsage(usages)
+	return &merged, nil
+}
+
+// streamCandidates generates n choices via concurrent upstream streams, interleaving their
+// chunks with the choice index set per candidate. Chunks share one response ID; with
+// include_usage, usage of all candidates is summed into a single final usage-only chunk.
+// Fails as a whole if any candidate fails.
+func (a *CreateChatCompletionAdapter) streamCandidates(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	transport http.RoundTripper,
+	n int,
+) iter.Seq2[*openaiadapter.CreateChatCompletionChunk, error] {
+	type candidateChunk struct {
+		index int
+		chunk *openaiadapter.CreateChatCompletionChunk
+	}
+
+	return func(yield func(*openaiadapter.CreateChatCompletionChunk, error) bool) {
+		// Cancels remaining candidates if the consumer stops early
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		chunks := make(chan candidateChunk)
+		done := make(chan error, 1)
+
+		// Candidates always report usage, so it can be summed across them
+		candidateUsage := true
+		candidateReq := clientReq
+		candidateReq.StreamOptions = &types.ChatCompletionStreamOptions{IncludeUsage: &candidateUsage}
+
+		g, gCtx := errgroup.WithContext(ctx)
+		g.SetLimit(maxConcurrentCandidates)
+		go func() {
+			for i := range n {
+				g.Go(func() error {
+					if err := gCtx.Err(); err != nil {
+						return err
+					}
+					stream, err := a.callProviderAPIStreaming(gCtx, clientReq, transport)
+					if err != nil {
+						return newCandidateError(i, n, err)
+					}
+					for chunk, err := range a.streamChunks(candidateReq, stream) {
+						if err != nil {
+							return newCandidateError(i, n, err)
+						}
+						select {
+						case chunks <- candidateChunk{index: i, chunk: chunk}:
+						case <-gCtx.Done():
+							return gCtx.Err()
+						}
+					}
+					return nil
+				})
+			}
+			done <- g.Wait()
+			close(chunks)
+		}()
+
+		responseID := newResponseID()
+		var model string
+		var usages []*types.CompletionUsage
+		for candidate := range chunks {
+			chunk := candidate.chunk
+			if chunk.Usage != nil {
+				usages = append(usages, chunk.Usage)
+				continue // Usage-only chunk of a candidate
+			}
+
+			chunk.Id = responseID
+			model = chunk.Model
+			for i := range chunk.Choices {
+				chunk.Choices[i].Index = candidate.index
+			}
+
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+
+		if err := <-done; err != nil {
+			yield(nil, toChatCompletionError(err))
+			return
+		}
+
+		if includeUsage(clientReq) {
+			yield(newUsageChunk(responseID, model, sumCompletionUsage(usages)), nil)
+		}
+	}
+}
+
+// newCandidateError converts a candidate's error to OpenAI format, naming the failed choice
+// so clients can tell a single failure apart from a failure of the whole request.
+func newCandidateError(index, n int, err error) *types.ErrorResponse {
+	errResp := *toChatCompletionError(err)
+	errResp.Err.Message = fmt.Sprintf("choice %d of %d failed: %s", index, n, errResp.Err.Message)
+	return &errResp
+}
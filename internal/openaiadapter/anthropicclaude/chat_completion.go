@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"iter"
 	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
@@ -20,7 +22,18 @@ import (
 //   - Developer messages: Merged with system prompts (no developer role equivalent)
 //   - Tool call IDs: Preserved bidirectionally for proper request/response matching
 //   - Streaming: Anthropic returns delta-based events similar to OpenAI protocol
-type CreateChatCompletionAdapter struct{}
+//   - Citations: Mapped to message annotations (url_citation or document_citation extension)
+//   - Server tools: Results round-trip via the opaque server_tool_state extension field
+//   - Custom tools: Emulated by function tools taking the raw input as single string parameter
+type CreateChatCompletionAdapter struct {
+	resolveFile       FileResolver
+	fetchURL          URLFetcher
+	convertDocument   DocumentConverter
+	maxContinuations  int
+	streamThreshold   int
+	contextManagement ContextManagement
+	historyMode       HistoryMode
+}
 
 // Compile-time interface implementation check.
 var _ openaiadapter.CreateChatCompletionAdapter = (*CreateChatCompletionAdapter)(nil)
@@ -48,11 +61,125 @@ type StreamingResponseContext struct {
 	// AnthropicMessage accumulates message metadata via selective Accumulate() calls.
 	// Only MessageStart/MessageDelta events are accumulated to avoid expensive content arrays.
 	AnthropicMessage anthropic.Message
+
+	// ContentLength counts characters of streamed content; annotation indices refer to it.
+	ContentLength int
+
+	// TextBlockStart maps Anthropic text block indices to their start in the streamed content.
+	TextBlockStart map[int64]int
+
+	// PendingCitations holds citations per text block until the block's end is known.
+	PendingCitations map[int64][]anthropic.TextCitationUnion
+
+	// SeparateText marks that a server tool block interrupted the text, so the next
+	// text block is separated by a newline (see contentWithAnnotations).
+	SeparateText bool
+
+	// StateBlocks reassembles blocks for server_tool_state; nil without server tools.
+	StateBlocks *streamedStateBlocks
+
+	// ToolCallConversions holds conversions of tool calls by tool name (see toolCallConversions).
+	ToolCallConversions map[string]toolCallConversion
+
+	// IncludeUsage emits a usage-only chunk at the end, as requested via stream_options.
+	IncludeUsage bool
+
+	// Thinking marks that thinking blocks were streamed, so reasoning tokens are unknown.
+	Thinking bool
+
+	// ConvertedToolArguments buffers arguments of converted tool calls per Anthropic block
+	// index. Arguments can only be unwrapped and validated once complete, so they are
+	// emitted as a single delta when the block ends.
+	ConvertedToolArguments map[int64]*strings.Builder
+}
+
+// Option configures adapters.
+type Option func(*adapterConfig)
+
+// adapterConfig holds optional adapter dependencies applied via Options.
+type adapterConfig struct {
+	resolveFile       FileResolver
+	fetchURL          URLFetcher
+	convertDocument   DocumentConverter
+	maxContinuations  int
+	streamThreshold   int
+	contextManagement ContextManagement
+	historyMode       HistoryMode
+}
+
+// WithFileResolver enables file_id references in chat completion requests.
+// Without a resolver, only inline file_data is supported.
+func WithFileResolver(resolve FileResolver) Option {
+	return func(c *adapterConfig) {
+		c.resolveFile = resolve
+	}
+}
+
+// WithURLFetcher enables inlining of remote image URLs. Without a fetcher, http(s)
+// image URLs are passed upstream for Anthropic to fetch.
+func WithURLFetcher(fetch URLFetcher) Option {
+	return func(c *adapterConfig) {
+		c.fetchURL = fetch
+	}
+}
+
+// WithDocumentConverter enables conversion of documents Anthropic can't read, such as
+// Office or HTML files. Without a converter, only PDF, text and image files are supported.
+func WithDocumentConverter(convert DocumentConverter) Option {
+	return func(c *adapterConfig) {
+		c.convertDocument = convert
+	}
+}
+
+// WithContinuation enables automatic continuation of responses that stop at max_tokens
+// or pause_turn, with up to maxRounds follow-up requests per response. Without it,
+// such responses end with finish_reason "length" or "stop".
+func WithContinuation(maxRounds int) Option {
+	return func(c *adapterConfig) {
+		c.maxContinuations = maxRounds
+	}
+}
+
+// WithInternalStreaming streams non-streaming requests with max_tokens of at least
+// threshold from Anthropic and returns them as a single response, so long generations
+// don't run into timeouts before the first response byte.
+func WithInternalStreaming(threshold int) Option {
+	return func(c *adapterConfig) {
+		c.streamThreshold = threshold
+	}
+}
+
+// WithContextManagement enables trimming of conversations that exceed the model's context
+// window (see ContextManagement). Without it, such requests fail upstream.
+func WithContextManagement(cfg ContextManagement) Option {
+	return func(c *adapterConfig) {
+		c.contextManagement = cfg
+	}
+}
+
+// WithHistoryMode selects how malformed conversation histories are handled (see
+// HistoryMode). Defaults to HistoryModeOff.
+func WithHistoryMode(mode HistoryMode) Option {
+	return func(c *adapterConfig) {
+		c.historyMode = mode
+	}
 }
 
 // NewCreateChatCompletionAdapter creates a new chat completion adapter.
-func NewCreateChatCompletionAdapter() *CreateChatCompletionAdapter {
-	return &CreateChatCompletionAdapter{}
+func NewCreateChatCompletionAdapter(opts ...Option) *CreateChatCompletionAdapter {
+	cfg := &adapterConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &CreateChatCompletionAdapter{
+		resolveFile:       cfg.resolveFile,
+		fetchURL:          cfg.fetchURL,
+		convertDocument:   cfg.convertDocument,
+		maxContinuations:  cfg.maxContinuations,
+		streamThreshold:   cfg.streamThreshold,
+		contextManagement: cfg.contextManagement,
+		historyMode:       cfg.historyMode,
+	}
 }
 
 // ProcessRequest handles non-streaming chat completion by validating the request,
@@ -66,18 +193,55 @@ func (a *CreateChatCompletionAdapter) ProcessRequest(
 		return nil, toChatCompletionError(err)
 	}
 
-	providerResp, err := a.callProviderAPI(ctx, clientReq, transport)
+	clientReq, err := a.resolveContentReferences(ctx, clientReq)
 	if err != nil {
 		return nil, toChatCompletionError(err)
 	}
 
-	resp, err := a.transformResponse(providerResp)
+	// Trimmed once for all candidates
+	clientReq, err = a.manageContext(ctx, clientReq, transport)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	if n := candidateCount(clientReq); n > 1 {
+		return a.processCandidates(ctx, clientReq, transport, n)
+	}
+
+	resp, err := a.processCandidate(ctx, clientReq, transport)
 	if err != nil {
 		return nil, toChatCompletionError(err)
 	}
 	return resp, nil
 }
 
+// processCandidate calls Anthropic's non-streaming API once and transforms the response.
+func (a *CreateChatCompletionAdapter) processCandidate(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	transport http.RoundTripper,
+) (*openaiadapter.CreateChatCompletionResponse, error) {
+	providerResp, err := a.callProviderAPI(ctx, clientReq, transport)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.transformResponse(providerResp)
+	if err != nil {
+		return nil, err
+	}
+	if conversions := toolCallConversions(clientReq); conversions != nil {
+		if err := convertToolCalls(resp, conversions); err != nil {
+			return nil, err
+		}
+	}
+	if usesLegacyFunctions(clientReq) {
+		if err := toLegacyFunctionCallResponse(resp); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
 // ProcessStreamingRequest handles streaming chat completion by validating the request,
 // calling Anthropic's streaming API and transforming events to OpenAI chunks via iterator.
 func (a *CreateChatCompletionAdapter) ProcessStreamingRequest(
@@ -89,17 +253,47 @@ func (a *CreateChatCompletionAdapter) ProcessStreamingRequest(
 		return nil, toChatCompletionError(err)
 	}
 
+	clientReq, err := a.resolveContentReferences(ctx, clientReq)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	// Trimmed once for all candidates
+	clientReq, err = a.manageContext(ctx, clientReq, transport)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	if n := candidateCount(clientReq); n > 1 {
+		return a.streamCandidates(ctx, clientReq, transport, n), nil
+	}
+
 	stream, err := a.callProviderAPIStreaming(ctx, clientReq, transport)
 	if err != nil {
 		return nil, toChatCompletionError(err)
 	}
+	return a.streamChunks(clientReq, stream), nil
+}
 
+// streamChunks transforms Anthropic stream events of a single response to OpenAI chunks.
+func (a *CreateChatCompletionAdapter) streamChunks(
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	stream messageStream,
+) iter.Seq2[*openaiadapter.CreateChatCompletionChunk, error] {
 	return func(yield func(*openaiadapter.CreateChatCompletionChunk, error) bool) {
 		defer func() { _ = stream.Close() }()
 
 		streamingContext := StreamingResponseContext{
-			NextToolCallIndex:  0,
-			AnthropicToolIndex: make(map[int64]ToolIndexMapping),
+			NextToolCallIndex:      0,
+			AnthropicToolIndex:     make(map[int64]ToolIndexMapping),
+			TextBlockStart:         make(map[int64]int),
+			PendingCitations:       make(map[int64][]anthropic.TextCitationUnion),
+			ToolCallConversions:    toolCallConversions(clientReq),
+			ConvertedToolArguments: make(map[int64]*strings.Builder),
+			IncludeUsage:           includeUsage(clientReq),
+		}
+		if hasServerTools(clientReq) {
+			streamingContext.StateBlocks = newStreamedStateBlocks()
 		}
 
 		for stream.Next() {
@@ -114,6 +308,12 @@ func (a *CreateChatCompletionAdapter) ProcessStreamingRequest(
 			if chunk == nil {
 				continue
 			}
+			if usesLegacyFunctions(clientReq) {
+				if err := toLegacyFunctionCallChunk(chunk); err != nil {
+					yield(nil, toChatCompletionError(err))
+					return
+				}
+			}
 
 			if !yield(chunk, nil) {
 				return
@@ -124,7 +324,7 @@ func (a *CreateChatCompletionAdapter) ProcessStreamingRequest(
 			yield(nil, toChatCompletionError(err))
 			return
 		}
-	}, nil
+	}
 }
 
 // validateRequest performs minimal validation of universally required fields.
@@ -137,6 +337,9 @@ func (a *CreateChatCompletionAdapter) validateRequest(
 	if len(clientReq.Messages) == 0 {
 		return fmt.Errorf("messages array cannot be empty")
 	}
+	if clientReq.N != nil && (*clientReq.N < 1 || *clientReq.N > maxCandidates) {
+		return newInvalidRequestError("n must be between 1 and %d", maxCandidates)
+	}
 
 	return nil
 }
@@ -153,25 +356,28 @@ func (a *CreateChatCompletionAdapter) callProviderAPI(
 	}
 
 	// Transform and separate OpenAI messages - preserves order while hoisting system prompts
-	transformed, err := fromChatCompletionRequestMessages(clientReq.Messages)
+	systemPrompts, messages, err := transformMessages(ctx, clientReq.Messages, a.historyMode)
 	if err != nil {
-		return nil, fmt.Errorf("transform messages: %w", err)
+		return nil, err
 	}
-	systemPrompts, messages := hoistSystemPrompts(transformed)
 
 	params, err := buildGenerationParams(clientReq)
 	if err != nil {
 		return nil, fmt.Errorf("build generation params: %w", err)
 	}
+	if err := enableDocumentCitations(clientReq, messages); err != nil {
+		return nil, err
+	}
 	params.Messages = messages
 	params.System = systemPrompts
 
-	message, err := client.Messages.New(ctx, params)
+	opts := serverToolRequestOptions(clientReq)
+	message, err := a.newMessage(ctx, client, params, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return message, nil
+	return a.continueMessage(ctx, client, params, opts, message)
 }
 
 // callProviderAPIStreaming transforms the request and calls Anthropic's streaming API.
@@ -179,28 +385,37 @@ func (a *CreateChatCompletionAdapter) callProviderAPIStreaming(
 	ctx context.Context,
 	clientReq openaiadapter.CreateChatCompletionRequest,
 	transport http.RoundTripper,
-) (*ssestream.Stream[anthropic.MessageStreamEventUnion], error) {
+) (messageStream, error) {
 	client, err := newClient(transport)
 	if err != nil {
 		return nil, fmt.Errorf("initialize Anthropic client for streaming request: %w", err)
 	}
 
 	// Transform and separate OpenAI messages - preserves order while hoisting system prompts
-	transformed, err := fromChatCompletionRequestMessages(clientReq.Messages)
+	systemPrompts, messages, err := transformMessages(ctx, clientReq.Messages, a.historyMode)
 	if err != nil {
-		return nil, fmt.Errorf("transform messages: %w", err)
+		return nil, err
 	}
-	systemPrompts, messages := hoistSystemPrompts(transformed)
 
 	params, err := buildGenerationParams(clientReq)
 	if err != nil {
 		return nil, fmt.Errorf("build generation params: %w", err)
 	}
+	if err := enableDocumentCitations(clientReq, messages); err != nil {
+		return nil, err
+	}
 	params.Messages = messages
 	params.System = systemPrompts
 
-	stream := client.Messages.NewStreaming(ctx, params)
-	return stream, nil
+	opts := serverToolRequestOptions(clientReq)
+	stream := client.Messages.NewStreaming(ctx, params, opts...)
+	if a.maxContinuations == 0 {
+		return stream, nil
+	}
+	return newContinuedStream(stream, a.maxContinuations, func(prefill anthropic.MessageParam) messageStream {
+		params.Messages = append(slices.Clip(messages), prefill)
+		return client.Messages.NewStreaming(ctx, params, opts...)
+	}), nil
 }
 
 // transformResponse converts Anthropic message to OpenAI chat completion format.
@@ -208,6 +423,7 @@ func (a *CreateChatCompletionAdapter) transformResponse(
 	providerResp *anthropic.Message,
 ) (*openaiadapter.CreateChatCompletionResponse, error) {
 	var messageContent *string
+	var annotations *[]types.ChatCompletionAnnotation
 	var toolCalls *types.ChatCompletionMessageToolCalls
 
 	// Extract text content (including refusals)
@@ -217,34 +433,49 @@ func (a *CreateChatCompletionAdapter) transformResponse(
 	// regular content, clients would send thinking back as normal assistant messages in history,
 	// confusing the model.
 	//
-	// Citations transformation: Anthropic's Citations within TextBlock provide source attribution.
-	// OpenAI has no equivalent citation metadata in chat completion response format.
+	// Citations transformation: Anthropic's Citations within TextBlock provide source attribution
+	// and map to OpenAI annotations (see toChatCompletionAnnotation).
 	//
 	// RedactedThinkingBlock transformation: Anthropic's redacted thinking blocks for privacy.
 	// OpenAI has no equivalent redacted content mechanism in chat completion response format.
-	textContent := textFromAnthropicContentBlocks(providerResp.Content)
+	textContent, textAnnotations := contentWithAnnotations(providerResp.Content)
 	if textContent != "" {
 		messageContent = &textContent
 	}
+	if len(textAnnotations) > 0 {
+		annotations = &textAnnotations
+	}
 
 	// Extract tool calls
-	//
-	// ServerToolUseBlock transformation: Anthropic's server-side tool execution blocks.
-	// OpenAI chat completion has no equivalent server-side tool mechanism.
-	//
-	// WebSearchToolResultBlock transformation: Anthropic's web search tool results.
-	// OpenAI chat completion has no equivalent built-in web search tool result type.
 	var err error
 	toolCalls, err = toChatCompletionMessageToolCalls(providerResp.Content)
 	if err != nil {
 		return nil, fmt.Errorf("extract tool calls: %w", err)
 	}
 
+	// ServerToolUseBlock transformation: Anthropic's server-side tool executions have no
+	// OpenAI equivalent and must not surface as tool_calls the client would try to execute.
+	//
+	// WebSearchToolResultBlock transformation: search results map to url_citation annotations.
+	//
+	// Both are preserved verbatim in server_tool_state, so they can be restored when the
+	// client sends the message back in history (see restoreServerToolBlocks).
+	var serverToolState *string
+	if blocks := serverToolStateBlocks(providerResp.Content); blocks != nil {
+		state, err := encodeServerToolState(blocks)
+		if err != nil {
+			return nil, err
+		}
+		serverToolState = &state
+	}
+
 	message := types.ChatCompletionResponseMessage{
-		Role:      types.ChatCompletionResponseMessageRoleAssistant,
-		Content:   messageContent,
-		Refusal:   nil, // Refusals are returned as content with finish_reason="content_filter"
-		ToolCalls: toolCalls,
+		Role:            types.ChatCompletionResponseMessageRoleAssistant,
+		Content:         messageContent,
+		Refusal:         nil, // Refusals are returned as content with finish_reason="content_filter"
+		ToolCalls:       toolCalls,
+		Annotations:     annotations,
+		ServerToolState: serverToolState,
 	}
 
 	choice := types.CreateChatCompletionResponseChoice{
@@ -254,6 +485,9 @@ func (a *CreateChatCompletionAdapter) transformResponse(
 		Message:      message,
 	}
 
+	usage := toCompletionUsage(providerResp.Usage)
+	setReasoningTokens(usage, hasThinking(providerResp.Content))
+
 	// Generate fallback ID if Anthropic doesn't provide one
 	responseID := providerResp.ID
 	if responseID == "" {
@@ -266,7 +500,7 @@ func (a *CreateChatCompletionAdapter) transformResponse(
 		Id:      responseID,
 		Model:   string(providerResp.Model),
 		Object:  types.ChatCompletion,
-		Usage:   toCompletionUsage(providerResp.Usage),
+		Usage:   usage,
 	}
 
 	return &response, nil
@@ -295,6 +529,25 @@ func (a *CreateChatCompletionAdapter) newStreamChunk(
 	}
 }
 
+// newUsageChunk creates the final usage-only chunk OpenAI streams with include_usage.
+func newUsageChunk(responseID string, model string, usage *types.CompletionUsage) *openaiadapter.CreateChatCompletionChunk {
+	return &openaiadapter.CreateChatCompletionChunk{
+		Choices: []types.CreateChatCompletionStreamResponseChoice{},
+		Created: 0,
+		Id:      responseID,
+		Model:   model,
+		Object:  types.ChatCompletionChunk,
+		Usage:   usage,
+	}
+}
+
+// includeUsage reports whether the client requested usage via stream_options.include_usage.
+func includeUsage(clientReq openaiadapter.CreateChatCompletionRequest) bool {
+	return clientReq.StreamOptions != nil &&
+		clientReq.StreamOptions.IncludeUsage != nil &&
+		*clientReq.StreamOptions.IncludeUsage
+}
+
 // transformStreamEvent converts an Anthropic stream event to OpenAI chunk format.
 // Selectively accumulates message metadata from MessageStart/MessageDelta events while
 // skipping ContentBlock events to avoid expensive content array building. Handles index
@@ -306,11 +559,13 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 
 	// Event lifecycle transformation:
 	//   message_start       → emit role
-	//   content_block_start → emit tool metadata (tool_use only), skip text/thinking
-	//   content_block_delta → emit text/tool JSON deltas, skip thinking/citations/signatures
-	//   content_block_stop  → skip (no-op)
-	//   message_delta       → emit finish_reason + usage (final data arrives here)
-	//   message_stop        → skip (termination signal, no data)
+	//   content_block_start → emit tool metadata (tool_use only), search results as annotations,
+	//                         skip text/thinking/server_tool_use
+	//   content_block_delta → emit text/tool JSON deltas, collect citations, skip thinking/signatures
+	//   content_block_stop  → emit collected citations as annotations (text only),
+	//                         converted arguments of buffered tool calls
+	//   message_delta       → emit finish_reason + server_tool_state (final data arrives here)
+	//   message_stop        → emit usage-only chunk if include_usage is set
 	switch eventType := event.AsAny().(type) {
 	// First event: provides message metadata (ID, Model, initial Usage)
 	case anthropic.MessageStartEvent:
@@ -336,8 +591,54 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 
 	// New content block begins (text/tool_use/thinking)
 	case anthropic.ContentBlockStartEvent:
+		// Text and server tool blocks are reassembled for server_tool_state
+		if err := streamingContext.StateBlocks.start(eventType.Index, eventType.ContentBlock.Type, eventType.ContentBlock.RawJSON()); err != nil {
+			return nil, err
+		}
+
+		if isServerToolBlock(eventType.ContentBlock.Type) {
+			streamingContext.SeparateText = true
+		}
+
+		if eventType.ContentBlock.Type == "thinking" || eventType.ContentBlock.Type == "redacted_thinking" {
+			streamingContext.Thinking = true
+		}
+
+		if eventType.ContentBlock.Type == "web_search_tool_result" {
+			annotations := webSearchResultAnnotations(eventType.ContentBlock.AsWebSearchToolResult(), streamingContext.ContentLength)
+			if len(annotations) == 0 {
+				return nil, nil
+			}
+			return a.newStreamChunk(
+				types.ChatCompletionStreamResponseDelta{Annotations: &annotations},
+				nil, // Finish reason comes in MessageDeltaEvent
+				streamingContext.AnthropicMessage.ID,
+				string(streamingContext.AnthropicMessage.Model),
+				nil, // Usage comes in MessageDeltaEvent
+			), nil
+		}
+
 		if eventType.ContentBlock.Type == "text" {
-			return nil, nil // Content comes in delta events
+			separate := streamingContext.SeparateText && streamingContext.ContentLength > 0
+			streamingContext.SeparateText = false
+			if separate {
+				streamingContext.ContentLength++
+			}
+
+			// Citations cover the whole block; remember where it starts in the content
+			streamingContext.TextBlockStart[eventType.Index] = streamingContext.ContentLength
+			if !separate {
+				return nil, nil // Content comes in delta events
+			}
+
+			separator := "\n"
+			return a.newStreamChunk(
+				types.ChatCompletionStreamResponseDelta{Content: &separator},
+				nil, // Finish reason comes in MessageDeltaEvent
+				streamingContext.AnthropicMessage.ID,
+				string(streamingContext.AnthropicMessage.Model),
+				nil, // Usage comes in MessageDeltaEvent
+			), nil
 		}
 
 		if eventType.ContentBlock.Type == "tool_use" {
@@ -354,6 +655,28 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 			}
 			streamingContext.NextToolCallIndex++
 
+			conversion, converted := streamingContext.ToolCallConversions[toolName]
+			if converted {
+				streamingContext.ConvertedToolArguments[eventType.Index] = &strings.Builder{}
+			}
+
+			if conversion.Custom {
+				emptyInput := ""
+				toolCallItem, err := newCustomToolCallChunk(openaiIdx, &toolID, &toolName, &emptyInput)
+				if err != nil {
+					return nil, err
+				}
+
+				toolCalls := []types.ChatCompletionStreamResponseDelta_ToolCalls_Item{toolCallItem}
+				return a.newStreamChunk(
+					types.ChatCompletionStreamResponseDelta{ToolCalls: &toolCalls},
+					nil, // Finish reason comes in MessageDeltaEvent
+					streamingContext.AnthropicMessage.ID,
+					string(streamingContext.AnthropicMessage.Model),
+					nil, // Usage comes in MessageDeltaEvent
+				), nil
+			}
+
 			emptyArgs := ""
 			toolCall := types.ChatCompletionMessageToolCallChunk{
 				Id:    &toolID,
@@ -385,7 +708,7 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 			), nil
 		}
 
-		return nil, nil // Non-mappable blocks (thinking, etc.)
+		return nil, nil // Non-mappable blocks (thinking, server_tool_use, etc.)
 
 	// Incremental content: text fragments or tool JSON deltas
 	case anthropic.ContentBlockDeltaEvent:
@@ -395,14 +718,26 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 		case anthropic.TextDelta:
 			if deltaVariant.Text != "" {
 				delta.Content = &deltaVariant.Text
+				streamingContext.ContentLength += utf8.RuneCountInString(deltaVariant.Text)
+				streamingContext.StateBlocks.appendText(eventType.Index, deltaVariant.Text)
 			}
 		case anthropic.InputJSONDelta:
 			// Retrieve OpenAI tool index from mapping created in ContentBlockStartEvent
 			toolMetadata, exists := streamingContext.AnthropicToolIndex[eventType.Index]
 			if !exists {
+				// Server tool input is executed by Anthropic, only kept for server_tool_state
+				if streamingContext.StateBlocks.appendInput(eventType.Index, deltaVariant.PartialJSON) {
+					return nil, nil
+				}
 				return nil, fmt.Errorf("received InputJSONDelta for unknown tool at index %d", eventType.Index)
 			}
 
+			// Converted arguments are emitted on block stop
+			if arguments, ok := streamingContext.ConvertedToolArguments[eventType.Index]; ok {
+				arguments.WriteString(deltaVariant.PartialJSON)
+				return nil, nil
+			}
+
 			toolCall := types.ChatCompletionMessageToolCallChunk{
 				Index: toolMetadata.OpenAIToolCallIdx,
 				Function: &struct {
@@ -424,7 +759,12 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 			// Skip: would break round-trips (clients would echo thinking as regular messages)
 			return nil, nil
 		case anthropic.CitationsDelta:
-			// Skip: no OpenAI equivalent
+			// Collect: the cited span ends with the block, annotations are emitted on block stop
+			streamingContext.PendingCitations[eventType.Index] = append(
+				streamingContext.PendingCitations[eventType.Index],
+				anthropic.TextCitationUnion(deltaVariant.Citation),
+			)
+			streamingContext.StateBlocks.appendCitation(eventType.Index, deltaVariant.Citation.RawJSON())
 			return nil, nil
 		case anthropic.SignatureDelta:
 			// Skip: no OpenAI equivalent
@@ -445,7 +785,65 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 
 	// Content block finished
 	case anthropic.ContentBlockStopEvent:
-		return nil, nil // Content already streamed via start/delta events
+		if arguments, ok := streamingContext.ConvertedToolArguments[eventType.Index]; ok {
+			delete(streamingContext.ConvertedToolArguments, eventType.Index)
+
+			toolMetadata := streamingContext.AnthropicToolIndex[eventType.Index]
+			conversion := streamingContext.ToolCallConversions[toolMetadata.Name]
+			convertedArgs, err := conversion.convertArguments(toolMetadata.Name, arguments.String())
+			if err != nil {
+				return nil, err
+			}
+
+			var toolCallItem types.ChatCompletionStreamResponseDelta_ToolCalls_Item
+			if conversion.Custom {
+				if toolCallItem, err = newCustomToolCallChunk(toolMetadata.OpenAIToolCallIdx, nil, nil, &convertedArgs); err != nil {
+					return nil, err
+				}
+			} else {
+				toolCall := types.ChatCompletionMessageToolCallChunk{
+					Index: toolMetadata.OpenAIToolCallIdx,
+					Function: &struct {
+						Arguments *string `json:"arguments,omitempty"`
+						Name      *string `json:"name,omitempty"`
+					}{
+						Arguments: &convertedArgs,
+					},
+				}
+				if err := toolCallItem.FromChatCompletionMessageToolCallChunk(toolCall); err != nil {
+					return nil, fmt.Errorf("create tool argument chunk: %w", err)
+				}
+			}
+
+			toolCalls := []types.ChatCompletionStreamResponseDelta_ToolCalls_Item{toolCallItem}
+			return a.newStreamChunk(
+				types.ChatCompletionStreamResponseDelta{ToolCalls: &toolCalls},
+				nil, // No finish reason yet
+				streamingContext.AnthropicMessage.ID,
+				string(streamingContext.AnthropicMessage.Model),
+				nil, // No usage yet
+			), nil
+		}
+
+		citations := streamingContext.PendingCitations[eventType.Index]
+		if len(citations) == 0 {
+			return nil, nil // Content already streamed via start/delta events
+		}
+		delete(streamingContext.PendingCitations, eventType.Index)
+
+		start := streamingContext.TextBlockStart[eventType.Index]
+		annotations := make([]types.ChatCompletionAnnotation, 0, len(citations))
+		for _, citation := range citations {
+			annotations = append(annotations, toChatCompletionAnnotation(citation, start, streamingContext.ContentLength))
+		}
+
+		return a.newStreamChunk(
+			types.ChatCompletionStreamResponseDelta{Annotations: &annotations},
+			nil, // No finish reason yet
+			streamingContext.AnthropicMessage.ID,
+			string(streamingContext.AnthropicMessage.Model),
+			nil, // No usage yet
+		), nil
 
 	// StopReason and final OutputTokens arrive here (not in MessageStopEvent)
 	case anthropic.MessageDeltaEvent:
@@ -453,20 +851,36 @@ func (a *CreateChatCompletionAdapter) transformStreamEvent(
 		if err := streamingContext.AnthropicMessage.Accumulate(event); err != nil {
 			return nil, fmt.Errorf("accumulate message delta: %w", err)
 		}
+		accumulateDeltaUsage(&streamingContext.AnthropicMessage.Usage, eventType.Usage)
 
-		// Final chunk with finish_reason and usage (content already streamed in deltas)
+		// Server tool blocks are complete once the message ends
+		serverToolState, err := streamingContext.StateBlocks.state()
+		if err != nil {
+			return nil, err
+		}
+
+		// Final chunk with finish_reason (content already streamed in deltas)
 		finishReason := toFinishReasonStreaming(streamingContext.AnthropicMessage.StopReason)
 		return a.newStreamChunk(
-			types.ChatCompletionStreamResponseDelta{},
+			types.ChatCompletionStreamResponseDelta{ServerToolState: serverToolState},
 			&finishReason,
 			streamingContext.AnthropicMessage.ID,
 			string(streamingContext.AnthropicMessage.Model),
-			toCompletionUsage(streamingContext.AnthropicMessage.Usage),
+			nil, // Usage comes in a separate chunk on MessageStopEvent
 		), nil
 
-	// Termination signal (contains no data we need)
+	// Termination signal: usage is final once the message ends
 	case anthropic.MessageStopEvent:
-		return nil, nil
+		if !streamingContext.IncludeUsage {
+			return nil, nil
+		}
+		usage := toCompletionUsage(streamingContext.AnthropicMessage.Usage)
+		setReasoningTokens(usage, streamingContext.Thinking)
+		return newUsageChunk(
+			streamingContext.AnthropicMessage.ID,
+			string(streamingContext.AnthropicMessage.Model),
+			usage,
+		), nil
 
 	// Unknown or future event type
 	default:
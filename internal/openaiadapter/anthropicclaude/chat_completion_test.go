@@ -10,14 +10,18 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
 )
 
-// mockTransport captures HTTP requests and returns canned responses
+// mockTransport captures HTTP requests and returns canned responses.
+// Safe for concurrent use; with concurrent requests the last one is captured.
 type mockTransport struct {
+	mu              sync.Mutex
 	capturedRequest *http.Request
 	capturedBody    []byte
 	responseBody    string
@@ -25,6 +29,9 @@ type mockTransport struct {
 }
 
 func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.capturedRequest = req
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
@@ -68,6 +75,12 @@ type streamingTurn struct {
 	OpenAIChunks     []json.RawMessage `json:"openaiChunks"`     // OpenAI chunks adapter yields
 }
 
+// body joins the SSE lines into a response body. Every event, including the last one,
+// is terminated by a blank line as in real streams.
+func (st streamingTurn) body() string {
+	return strings.Join(st.AnthropicSSE, "\n") + "\n"
+}
+
 // fixture represents a test case loaded from a JSON file.
 type fixture[T any] struct {
 	Name  string
@@ -226,7 +239,7 @@ func TestCreateChatCompletionAdapter_Streaming(t *testing.T) {
 
 				// Setup mock transport with SSE response (join array into string)
 				mock := &mockTransport{
-					responseBody:   strings.Join(turn.AnthropicSSE, "\n"),
+					responseBody:   turn.body(),
 					responseStatus: http.StatusOK,
 				}
 
@@ -292,6 +305,137 @@ func TestCreateChatCompletionAdapter_Streaming(t *testing.T) {
 	}
 }
 
+func TestCreateChatCompletionAdapter_StreamingCandidates(t *testing.T) {
+	t.Parallel()
+	fixtures := loadFixtures[streamingTurn](t, "testdata/streaming/stop_end_turn_stream.json")
+	turn := fixtures[0].Turns[0]
+
+	newRequest := func(t *testing.T, n int) types.CreateChatCompletionRequest {
+		t.Helper()
+		var openaiReq types.CreateChatCompletionRequest
+		if err := json.Unmarshal(turn.OpenAIRequest, &openaiReq); err != nil {
+			t.Fatalf("Failed to parse openaiRequest: %v", err)
+		}
+		openaiReq.N = &n
+		return openaiReq
+	}
+
+	t.Run("interleaved", func(t *testing.T) {
+		t.Parallel()
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter()
+		mock := &mockTransport{
+			responseBody:   turn.body(),
+			responseStatus: http.StatusOK,
+		}
+
+		const n = 3
+		stream, err := adapter.ProcessStreamingRequest(context.Background(), newRequest(t, n), mock)
+		if err != nil {
+			t.Fatalf("ProcessStreamingRequest failed: %v", err)
+		}
+
+		ids := make(map[string]bool)
+		contents := make(map[int]string)
+		finished := make(map[int]bool)
+		var last *types.CreateChatCompletionStreamResponse
+		for chunk, err := range stream {
+			if err != nil {
+				t.Fatalf("Unexpected stream error: %v", err)
+			}
+			ids[chunk.Id] = true
+			for _, choice := range chunk.Choices {
+				if choice.Delta.Content != nil {
+					contents[choice.Index] += *choice.Delta.Content
+				}
+				if choice.FinishReason != nil {
+					finished[choice.Index] = true
+				}
+			}
+			if chunk.Usage != nil && len(chunk.Choices) > 0 {
+				t.Errorf("Usage must only be sent in the final chunk, got it for choice %d", chunk.Choices[0].Index)
+			}
+			last = chunk
+		}
+
+		if len(ids) != 1 {
+			t.Errorf("Expected one response ID across chunks, got %d", len(ids))
+		}
+		for i := range n {
+			if contents[i] != contents[0] || !finished[i] {
+				t.Errorf("Choice %d: content %q finished %v, want %q finished", i, contents[i], finished[i], contents[0])
+			}
+		}
+		if last == nil || len(last.Choices) != 0 || last.Usage == nil {
+			t.Fatalf("Expected final usage chunk without choices, got %+v", last)
+		}
+
+		var want struct {
+			Usage types.CompletionUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(turn.OpenAIChunks[len(turn.OpenAIChunks)-1], &want); err != nil {
+			t.Fatalf("Failed to parse final chunk: %v", err)
+		}
+		if last.Usage.PromptTokens != n*want.Usage.PromptTokens || last.Usage.CompletionTokens != n*want.Usage.CompletionTokens {
+			t.Errorf("Usage not summed: got %+v, want %d times %+v", *last.Usage, n, want.Usage)
+		}
+	})
+
+	t.Run("candidate failure", func(t *testing.T) {
+		t.Parallel()
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter()
+		transport := &failingTransport{
+			mockTransport: mockTransport{
+				responseBody:   turn.body(),
+				responseStatus: http.StatusOK,
+			},
+			failCall: 2,
+		}
+
+		stream, err := adapter.ProcessStreamingRequest(context.Background(), newRequest(t, 3), transport)
+		if err != nil {
+			t.Fatalf("ProcessStreamingRequest failed: %v", err)
+		}
+
+		var streamErr error
+		for _, err := range stream {
+			if err != nil {
+				streamErr = err
+				break
+			}
+		}
+
+		var errorResponse *types.ErrorResponse
+		if !errors.As(streamErr, &errorResponse) {
+			t.Fatalf("Expected types.ErrorResponse, got: %v", streamErr)
+		}
+		if errorResponse.Err.Type != "invalid_request_error" ||
+			!strings.HasPrefix(errorResponse.Err.Message, "choice ") ||
+			!strings.HasSuffix(errorResponse.Err.Message, "failed: prompt is too long") {
+			t.Errorf("Unexpected error: %+v", errorResponse.Err)
+		}
+	})
+}
+
+// failingTransport behaves like mockTransport but fails the nth request with an
+// Anthropic invalid_request_error.
+type failingTransport struct {
+	mockTransport
+	calls    atomic.Int32
+	failCall int32
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.calls.Add(1) != f.failCall {
+		return f.mockTransport.RoundTrip(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       io.NopCloser(strings.NewReader(`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}`)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Request:    req,
+	}, nil
+}
+
 func BenchmarkCreateChatCompletion_Buffered(b *testing.B) {
 	data, err := os.ReadFile("testdata/buffered/tool_use.json")
 	if err != nil {
@@ -359,7 +503,7 @@ func BenchmarkCreateChatCompletion_Streaming(b *testing.B) {
 
 	for b.Loop() {
 		mock := &mockTransport{
-			responseBody:   strings.Join(firstTurn.AnthropicSSE, "\n"),
+			responseBody:   firstTurn.body(),
 			responseStatus: http.StatusOK,
 		}
 
@@ -377,3 +521,55 @@ func BenchmarkCreateChatCompletion_Streaming(b *testing.B) {
 		}
 	}
 }
+
+func TestCreateChatCompletionAdapter_CountTokens(t *testing.T) {
+	t.Parallel()
+	fixtures := loadFixtures[turn](t, "testdata/count_tokens/*.json")
+
+	for _, fix := range fixtures {
+		t.Run(fix.Name, func(t *testing.T) {
+			t.Parallel()
+			adapter := anthropicclaude.NewCreateChatCompletionAdapter()
+
+			for _, turn := range fix.Turns {
+				status := turn.AnthropicResponseStatus
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				mock := &mockTransport{
+					responseBody:   string(turn.AnthropicResponse),
+					responseStatus: status,
+				}
+
+				var openaiReq types.CreateChatCompletionRequest
+				if err := json.Unmarshal(turn.OpenAIRequest, &openaiReq); err != nil {
+					t.Fatalf("Failed to parse openaiRequest: %v", err)
+				}
+
+				count, err := adapter.CountTokens(context.Background(), openaiReq, mock)
+
+				if !strings.HasSuffix(mock.capturedRequest.URL.Path, "/messages/count_tokens") {
+					t.Errorf("Expected request to /messages/count_tokens endpoint, got: %s", mock.capturedRequest.URL.Path)
+				}
+				assertJSONEqual(t, string(mock.capturedBody), string(turn.AnthropicRequest))
+
+				var got string
+				if err != nil {
+					var errorResponse *types.ErrorResponse
+					if !errors.As(err, &errorResponse) {
+						t.Fatalf("Expected types.ErrorResponse, got: %T", err)
+					}
+					gotResponse, marshalErr := json.Marshal(errorResponse)
+					if marshalErr != nil {
+						t.Fatalf("Failed to marshal error response: %v", marshalErr)
+					}
+					got = string(gotResponse)
+				} else {
+					got = count.RawJSON()
+				}
+				assertJSONEqual(t, got, string(turn.OpenAIResponse))
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package anthropicclaude
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// enableDocumentCitations enables citations on request documents selected via extra_body.
+// Anthropic only cites documents that opt in, so document Q&A needs this to return annotations.
+//
+// Selection via extra_body (document indices count document blocks across all messages,
+// matching the document_index of returned citations):
+//
+//	extra_body: {"citations": true}    // all documents
+//	extra_body: {"citations": [0, 2]}  // first and third document
+func enableDocumentCitations(clientReq openaiadapter.CreateChatCompletionRequest, messages []anthropic.MessageParam) error {
+	if clientReq.ExtraBody == nil {
+		return nil
+	}
+	setting, ok := (*clientReq.ExtraBody)["citations"]
+	if !ok || setting == nil {
+		return nil
+	}
+
+	var selected func(documentIndex int) bool
+	switch v := setting.(type) {
+	case bool:
+		selected = func(int) bool { return v }
+	case []any:
+		indices := make(map[int]bool, len(v))
+		for _, item := range v {
+			index, ok := item.(float64)
+			if !ok || index < 0 || index != float64(int(index)) {
+				return newInvalidRequestError("extra_body.citations must be a boolean or an array of document indices")
+			}
+			indices[int(index)] = true
+		}
+		selected = func(documentIndex int) bool { return indices[documentIndex] }
+	default:
+		return newInvalidRequestError("extra_body.citations must be a boolean or an array of document indices")
+	}
+
+	documentIndex := 0
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			if block.OfDocument == nil {
+				continue
+			}
+			if selected(documentIndex) {
+				block.OfDocument.Citations = anthropic.CitationsConfigParam{Enabled: anthropic.Bool(true)}
+			}
+			documentIndex++
+		}
+	}
+	return nil
+}
+
+// contentWithAnnotations extracts the text content of a response together with its citations
+// and web search results.
+//
+// Anthropic attaches citations to whole text blocks and splits text around cited spans,
+// so blocks of a cited response form continuous prose and are joined without separator.
+// Text before and after server tool blocks is separated by a newline, like responses
+// without citations are by textFromAnthropicContentBlocks.
+func contentWithAnnotations(content []anthropic.ContentBlockUnion) (string, []types.ChatCompletionAnnotation) {
+	annotated := false
+	for _, block := range content {
+		if (block.Type == "text" && len(block.Citations) > 0) || isServerToolBlock(block.Type) {
+			annotated = true
+			break
+		}
+	}
+	if !annotated {
+		return textFromAnthropicContentBlocks(content), nil
+	}
+
+	var text strings.Builder
+	var annotations []types.ChatCompletionAnnotation
+	offset := 0
+	separate := false
+	for _, block := range content {
+		if isServerToolBlock(block.Type) {
+			separate = true
+		}
+
+		switch block := block.AsAny().(type) {
+		case anthropic.TextBlock:
+			if separate && text.Len() > 0 {
+				text.WriteString("\n")
+				offset++
+			}
+			separate = false
+
+			start := offset
+			offset += utf8.RuneCountInString(block.Text)
+			text.WriteString(block.Text)
+
+			for _, citation := range block.Citations {
+				annotations = append(annotations, toChatCompletionAnnotation(citation, start, offset))
+			}
+		case anthropic.WebSearchToolResultBlock:
+			annotations = append(annotations, webSearchResultAnnotations(block, offset)...)
+		}
+	}
+	return text.String(), annotations
+}
+
+// toChatCompletionAnnotation converts an Anthropic citation of the content span
+// [startIndex, endIndex) to an OpenAI annotation.
+//
+// Citation transformation:
+//   - web_search_result_location, search_result_location with URL source → url_citation
+//   - char_location, page_location, content_block_location → document_citation (extension)
+//   - search_result_location without URL source → document_citation with content_block_location
+func toChatCompletionAnnotation(citation anthropic.TextCitationUnion, startIndex, endIndex int) types.ChatCompletionAnnotation {
+	switch citation.Type {
+	case "web_search_result_location":
+		return newURLAnnotation(citation.URL, citation.Title, startIndex, endIndex)
+	case "search_result_location":
+		if strings.HasPrefix(citation.Source, "http://") || strings.HasPrefix(citation.Source, "https://") {
+			return newURLAnnotation(citation.Source, citation.Title, startIndex, endIndex)
+		}
+	}
+
+	documentCitation := types.ChatCompletionDocumentCitation{
+		StartIndex:    startIndex,
+		EndIndex:      endIndex,
+		CitedText:     citation.CitedText,
+		DocumentIndex: int(citation.DocumentIndex),
+	}
+	if citation.DocumentTitle != "" {
+		documentCitation.DocumentTitle = &citation.DocumentTitle
+	}
+
+	switch citation.Type {
+	case "char_location":
+		documentCitation.Location = types.ChatCompletionDocumentCitationLocation{
+			Type:  types.CharLocation,
+			Start: int(citation.StartCharIndex),
+			End:   int(citation.EndCharIndex),
+		}
+	case "page_location":
+		documentCitation.Location = types.ChatCompletionDocumentCitationLocation{
+			Type:  types.PageLocation,
+			Start: int(citation.StartPageNumber),
+			End:   int(citation.EndPageNumber),
+		}
+	default:
+		// content_block_location and search results share block ranges
+		if citation.Type == "search_result_location" {
+			documentCitation.DocumentIndex = int(citation.SearchResultIndex)
+			if citation.Title != "" {
+				documentCitation.DocumentTitle = &citation.Title
+			}
+		}
+		documentCitation.Location = types.ChatCompletionDocumentCitationLocation{
+			Type:  types.ContentBlockLocation,
+			Start: int(citation.StartBlockIndex),
+			End:   int(citation.EndBlockIndex),
+		}
+	}
+
+	return types.ChatCompletionAnnotation{
+		Type:             types.DocumentCitation,
+		DocumentCitation: &documentCitation,
+	}
+}
+
+// newURLAnnotation creates an OpenAI url_citation annotation.
+func newURLAnnotation(url, title string, startIndex, endIndex int) types.ChatCompletionAnnotation {
+	return types.ChatCompletionAnnotation{
+		Type: types.UrlCitation,
+		UrlCitation: &types.ChatCompletionUrlCitation{
+			StartIndex: startIndex,
+			EndIndex:   endIndex,
+			Url:        url,
+			Title:      title,
+		},
+	}
+}
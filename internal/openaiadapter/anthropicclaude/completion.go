@@ -0,0 +1,393 @@
+package anthropicclaude
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"strconv"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+const (
+	// defaultCompletionMaxTokens matches the OpenAI default for legacy completions.
+	defaultCompletionMaxTokens = 16
+
+	// fillInTheMiddleStop terminates the assistant prefill opened for suffix completions.
+	fillInTheMiddleStop = "</middle>"
+)
+
+// CreateCompletionAdapter transforms legacy OpenAI text completion requests to Anthropic Messages.
+//
+// Anthropic-specific transformations:
+//   - Prompt: Wrapped as a single user turn (Messages API has no raw text completion)
+//   - Suffix: Fill-in-the-middle via tagged prefix/suffix and an assistant prefill
+//   - Echo: Prompt is prepended to the returned text (first chunk when streaming)
+//   - Streaming: Text deltas become text_completion chunks
+type CreateCompletionAdapter struct{}
+
+// Compile-time interface implementation check.
+var _ openaiadapter.CreateCompletionAdapter = (*CreateCompletionAdapter)(nil)
+
+// NewCreateCompletionAdapter creates a new text completion adapter.
+func NewCreateCompletionAdapter() *CreateCompletionAdapter {
+	return &CreateCompletionAdapter{}
+}
+
+// ProcessRequest handles non-streaming text completion by validating the request,
+// calling Anthropic's API and transforming the response back to OpenAI format.
+func (a *CreateCompletionAdapter) ProcessRequest(
+	ctx context.Context,
+	clientReq openaiadapter.CreateCompletionRequest,
+	transport http.RoundTripper,
+) (*openaiadapter.CreateCompletionResponse, error) {
+	prompt, err := a.validateRequest(clientReq)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	providerResp, err := a.callProviderAPI(ctx, clientReq, prompt, transport)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	return a.transformResponse(clientReq, prompt, providerResp), nil
+}
+
+// ProcessStreamingRequest handles streaming text completion by validating the request,
+// calling Anthropic's streaming API and transforming events to OpenAI chunks via iterator.
+func (a *CreateCompletionAdapter) ProcessStreamingRequest(
+	ctx context.Context,
+	clientReq openaiadapter.CreateCompletionRequest,
+	transport http.RoundTripper,
+) (iter.Seq2[*openaiadapter.CreateCompletionChunk, error], error) {
+	prompt, err := a.validateRequest(clientReq)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	stream, err := a.callProviderAPIStreaming(ctx, clientReq, prompt, transport)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	echo := clientReq.Echo != nil && *clientReq.Echo
+	includeUsage := clientReq.StreamOptions != nil &&
+		clientReq.StreamOptions.IncludeUsage != nil &&
+		*clientReq.StreamOptions.IncludeUsage
+
+	return func(yield func(*openaiadapter.CreateCompletionChunk, error) bool) {
+		defer func() { _ = stream.Close() }()
+
+		var message anthropic.Message
+
+		for stream.Next() {
+			event := stream.Current()
+
+			var chunk *openaiadapter.CreateCompletionChunk
+
+			switch eventType := event.AsAny().(type) {
+			case anthropic.MessageStartEvent:
+				// Accumulate message metadata (ID, Model, Usage) - skips content arrays
+				if err := message.Accumulate(event); err != nil {
+					yield(nil, toChatCompletionError(fmt.Errorf("accumulate message start: %w", err)))
+					return
+				}
+				if message.ID == "" {
+					message.ID = newCompletionID()
+				}
+				// Echo transformation: the prompt precedes generated text in the first chunk
+				if echo && prompt != "" {
+					chunk = a.newStreamChunk(message.ID, string(message.Model), prompt, nil, nil)
+				}
+
+			case anthropic.ContentBlockDeltaEvent:
+				// Thinking, signature and citation deltas have no text completion equivalent
+				if textDelta, ok := eventType.Delta.AsAny().(anthropic.TextDelta); ok && textDelta.Text != "" {
+					chunk = a.newStreamChunk(message.ID, string(message.Model), textDelta.Text, nil, nil)
+				}
+
+			case anthropic.MessageDeltaEvent:
+				// Accumulate message delta (StopReason, Usage) - skips content arrays
+				if err := message.Accumulate(event); err != nil {
+					yield(nil, toChatCompletionError(fmt.Errorf("accumulate message delta: %w", err)))
+					return
+				}
+				finishReason := toCompletionFinishReason(message.StopReason)
+				chunk = a.newStreamChunk(message.ID, string(message.Model), "", &finishReason, nil)
+
+			case anthropic.MessageStopEvent:
+				// Usage is final once the message ends; only sent as separate chunk on request
+				if includeUsage {
+					chunk = &openaiadapter.CreateCompletionChunk{
+						Choices: []types.CreateCompletionResponseChoice{},
+						Created: 0,
+						Id:      message.ID,
+						Model:   string(message.Model),
+						Object:  types.TextCompletion,
+						Usage:   toCompletionUsage(message.Usage),
+					}
+				}
+			}
+
+			if chunk == nil {
+				continue
+			}
+
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			yield(nil, toChatCompletionError(err))
+			return
+		}
+	}, nil
+}
+
+// validateRequest performs minimal validation and extracts the single text prompt.
+func (a *CreateCompletionAdapter) validateRequest(
+	clientReq openaiadapter.CreateCompletionRequest,
+) (string, error) {
+	if clientReq.Model == "" {
+		return "", fmt.Errorf("model is required")
+	}
+
+	prompt, err := fromCompletionPrompt(clientReq.Prompt)
+	if err != nil {
+		return "", err
+	}
+
+	// Anthropic rejects empty text blocks; fill-in-the-middle wraps the prompt and is always non-empty
+	if prompt == "" && clientReq.Suffix == nil {
+		return "", fmt.Errorf("prompt cannot be empty")
+	}
+
+	return prompt, nil
+}
+
+// callProviderAPI transforms the request and calls Anthropic's non-streaming API.
+func (a *CreateCompletionAdapter) callProviderAPI(
+	ctx context.Context,
+	clientReq openaiadapter.CreateCompletionRequest,
+	prompt string,
+	transport http.RoundTripper,
+) (*anthropic.Message, error) {
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, fmt.Errorf("initialize Anthropic client for non-streaming request: %w", err)
+	}
+
+	params, err := buildCompletionParams(clientReq, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("build generation params: %w", err)
+	}
+
+	message, err := client.Messages.New(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// callProviderAPIStreaming transforms the request and calls Anthropic's streaming API.
+func (a *CreateCompletionAdapter) callProviderAPIStreaming(
+	ctx context.Context,
+	clientReq openaiadapter.CreateCompletionRequest,
+	prompt string,
+	transport http.RoundTripper,
+) (*ssestream.Stream[anthropic.MessageStreamEventUnion], error) {
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, fmt.Errorf("initialize Anthropic client for streaming request: %w", err)
+	}
+
+	params, err := buildCompletionParams(clientReq, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("build generation params: %w", err)
+	}
+
+	stream := client.Messages.NewStreaming(ctx, params)
+	return stream, nil
+}
+
+// transformResponse converts Anthropic message to OpenAI text completion format.
+func (a *CreateCompletionAdapter) transformResponse(
+	clientReq openaiadapter.CreateCompletionRequest,
+	prompt string,
+	providerResp *anthropic.Message,
+) *openaiadapter.CreateCompletionResponse {
+	text := textFromAnthropicContentBlocks(providerResp.Content)
+	if clientReq.Echo != nil && *clientReq.Echo {
+		text = prompt + text
+	}
+
+	finishReason := toCompletionFinishReason(providerResp.StopReason)
+
+	// Generate fallback ID if Anthropic doesn't provide one
+	responseID := providerResp.ID
+	if responseID == "" {
+		responseID = newCompletionID()
+	}
+
+	return &openaiadapter.CreateCompletionResponse{
+		Choices: []types.CreateCompletionResponseChoice{{
+			FinishReason: &finishReason,
+			Index:        0,
+			Logprobs:     nil, // Anthropic doesn't provide logprobs
+			Text:         text,
+		}},
+		Created: 0, // Anthropic SDK doesn't provide created timestamp
+		Id:      responseID,
+		Model:   string(providerResp.Model),
+		Object:  types.TextCompletion,
+		Usage:   toCompletionUsage(providerResp.Usage),
+	}
+}
+
+// newStreamChunk creates an OpenAI text completion chunk with consistent defaults.
+func (a *CreateCompletionAdapter) newStreamChunk(
+	responseID string,
+	model string,
+	text string,
+	finishReason *types.CreateCompletionResponseChoiceFinishReason,
+	usage *types.CompletionUsage,
+) *openaiadapter.CreateCompletionChunk {
+	return &openaiadapter.CreateCompletionChunk{
+		Choices: []types.CreateCompletionResponseChoice{{
+			FinishReason: finishReason,
+			Index:        0,
+			Logprobs:     nil,
+			Text:         text,
+		}},
+		Created: 0,
+		Id:      responseID,
+		Model:   model,
+		Object:  types.TextCompletion,
+		Usage:   usage,
+	}
+}
+
+// buildCompletionParams builds Anthropic generation configuration from a text completion request.
+func buildCompletionParams(
+	clientReq openaiadapter.CreateCompletionRequest,
+	prompt string,
+) (anthropic.MessageNewParams, error) {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(clientReq.Model),
+		MaxTokens: defaultCompletionMaxTokens,
+	}
+
+	if clientReq.MaxTokens != nil && *clientReq.MaxTokens > 0 {
+		model := lookupModel(clientReq.Model)
+		params.MaxTokens = model.clampMaxTokens(int64(*clientReq.MaxTokens))
+	}
+
+	// Sampling parameters
+	// Convert via string to avoid float32->float64 precision issues (0.7 -> "0.7" -> 0.7)
+	if clientReq.Temperature != nil {
+		temp, err := strconv.ParseFloat(fmt.Sprintf("%v", *clientReq.Temperature), 64)
+		if err != nil {
+			return params, fmt.Errorf("invalid temperature value: %w", err)
+		}
+		params.Temperature = anthropic.Float(temp)
+	}
+	if clientReq.TopP != nil {
+		topP, err := strconv.ParseFloat(fmt.Sprintf("%v", *clientReq.TopP), 64)
+		if err != nil {
+			return params, fmt.Errorf("invalid top_p value: %w", err)
+		}
+		params.TopP = anthropic.Float(topP)
+	}
+
+	// Stop sequences
+	if clientReq.Stop != nil {
+		if sequences, err := clientReq.Stop.AsStopConfiguration1(); err == nil {
+			params.StopSequences = sequences
+		} else if single, err := clientReq.Stop.AsStopConfiguration0(); err == nil && single != "" {
+			params.StopSequences = []string{single}
+		}
+	}
+
+	if clientReq.User != nil {
+		params.Metadata = anthropic.MetadataParam{
+			UserID: anthropic.String(*clientReq.User),
+		}
+	}
+
+	// Suffix transformation: Anthropic has no native fill-in-the-middle mode. The prompt and
+	// suffix are tagged in the user turn and the assistant turn is prefilled with an opening
+	// tag, so the model continues directly with the inserted text until the closing tag.
+	if clientReq.Suffix != nil {
+		fim := fmt.Sprintf(
+			"Fill in the text between <prefix> and <suffix>. Reply with the inserted text only, "+
+				"wrapped in <middle></middle>.\n\n<prefix>%s</prefix><suffix>%s</suffix>",
+			prompt, *clientReq.Suffix,
+		)
+		params.Messages = []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(fim)),
+			anthropic.NewAssistantMessage(anthropic.NewTextBlock("<middle>")),
+		}
+		params.StopSequences = append(params.StopSequences, fillInTheMiddleStop)
+		return params, nil
+	}
+
+	params.Messages = []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
+	}
+
+	// BestOf/N transformation: OpenAI generates multiple candidates server-side. Anthropic
+	// API does not support multiple candidates per request.
+
+	// Logprobs/LogitBias transformation: Anthropic API provides no token-level
+	// probabilities or bias controls.
+
+	// FrequencyPenalty/PresencePenalty/Seed transformation: no Anthropic equivalents
+	// (see buildGenerationParams).
+
+	return params, nil
+}
+
+// fromCompletionPrompt extracts a single text prompt from OpenAI's prompt union.
+//
+// Token prompts transformation: OpenAI accepts pre-tokenized prompts (arrays of token IDs).
+// Anthropic uses a different tokenizer and only accepts text, so token prompts are rejected.
+// Multiple prompts would require one Anthropic request per prompt and are rejected as well.
+func fromCompletionPrompt(prompt types.CreateCompletionRequest_Prompt) (string, error) {
+	if text, err := prompt.AsCreateCompletionRequestPrompt0(); err == nil {
+		return text, nil
+	}
+
+	if texts, err := prompt.AsCreateCompletionRequestPrompt1(); err == nil {
+		switch len(texts) {
+		case 0:
+			return "", fmt.Errorf("prompt cannot be empty")
+		case 1:
+			return texts[0], nil
+		default:
+			return "", fmt.Errorf("multiple prompts not supported by Anthropic Claude (got %d)", len(texts))
+		}
+	}
+
+	return "", fmt.Errorf("token prompts not supported by Anthropic Claude")
+}
+
+// toCompletionFinishReason maps Anthropic stop reasons to OpenAI text completion finish reasons.
+// Tool use cannot occur since no tools are sent; refusals map to content_filter (see toFinishReason).
+func toCompletionFinishReason(stopReason anthropic.StopReason) types.CreateCompletionResponseChoiceFinishReason {
+	switch stopReason {
+	case anthropic.StopReasonMaxTokens:
+		return types.Length
+	case anthropic.StopReasonRefusal:
+		return types.ContentFilter
+	default:
+		return types.Stop
+	}
+}
@@ -0,0 +1,129 @@
+package anthropicclaude_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+func TestCreateCompletionAdapter_Buffered(t *testing.T) {
+	t.Parallel()
+	fixtures := loadFixtures[turn](t, "testdata/completions/buffered/*.json")
+
+	for _, fix := range fixtures {
+		t.Run(fix.Name, func(t *testing.T) {
+			t.Parallel()
+			adapter := anthropicclaude.NewCreateCompletionAdapter()
+
+			ctx := context.Background()
+
+			for i, turn := range fix.Turns {
+				t.Logf("Turn %d", i+1)
+
+				status := turn.AnthropicResponseStatus
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				mock := &mockTransport{
+					responseBody:   string(turn.AnthropicResponse),
+					responseStatus: status,
+				}
+
+				var openaiReq types.CreateCompletionRequest
+				if err := json.Unmarshal(turn.OpenAIRequest, &openaiReq); err != nil {
+					t.Fatalf("Failed to parse openaiRequest: %v", err)
+				}
+
+				response, err := adapter.ProcessRequest(ctx, openaiReq, mock)
+
+				if string(turn.AnthropicRequest) != "null" {
+					if !strings.Contains(mock.capturedRequest.URL.Path, "/messages") {
+						t.Errorf("Expected request to /messages endpoint, got: %s", mock.capturedRequest.URL.Path)
+					}
+
+					assertJSONEqual(t, string(mock.capturedBody), string(turn.AnthropicRequest))
+				}
+
+				var got any = response
+				if err != nil {
+					var errorResponse *types.ErrorResponse
+					if !errors.As(err, &errorResponse) {
+						t.Fatalf("Expected types.ErrorResponse, got: %T", err)
+					}
+					got = errorResponse
+				}
+
+				gotResponse, marshalErr := json.Marshal(got)
+				if marshalErr != nil {
+					t.Fatalf("Failed to marshal response: %v", marshalErr)
+				}
+				assertJSONEqual(t, string(gotResponse), string(turn.OpenAIResponse))
+			}
+		})
+	}
+}
+
+func TestCreateCompletionAdapter_Streaming(t *testing.T) {
+	t.Parallel()
+	fixtures := loadFixtures[streamingTurn](t, "testdata/completions/streaming/*.json")
+
+	for _, fix := range fixtures {
+		t.Run(fix.Name, func(t *testing.T) {
+			t.Parallel()
+			adapter := anthropicclaude.NewCreateCompletionAdapter()
+
+			ctx := context.Background()
+
+			for i, turn := range fix.Turns {
+				t.Logf("Turn %d", i+1)
+
+				mock := &mockTransport{
+					responseBody:   turn.body(),
+					responseStatus: http.StatusOK,
+				}
+
+				var openaiReq types.CreateCompletionRequest
+				if err := json.Unmarshal(turn.OpenAIRequest, &openaiReq); err != nil {
+					t.Fatalf("Failed to parse openaiRequest: %v", err)
+				}
+
+				stream, err := adapter.ProcessStreamingRequest(ctx, openaiReq, mock)
+				if err != nil {
+					t.Fatalf("ProcessStreamingRequest failed: %v", err)
+				}
+
+				var chunks []string
+				for chunk, err := range stream {
+					if err != nil {
+						t.Fatalf("Stream error: %v", err)
+					}
+					chunkJSON, err := json.Marshal(chunk)
+					if err != nil {
+						t.Fatalf("Failed to marshal chunk: %v", err)
+					}
+					chunks = append(chunks, string(chunkJSON))
+				}
+
+				if string(turn.AnthropicRequest) != "null" {
+					assertJSONEqual(t, string(mock.capturedBody), string(turn.AnthropicRequest))
+				}
+
+				if len(chunks) != len(turn.OpenAIChunks) {
+					t.Errorf("Chunk count mismatch: got %d, want %d", len(chunks), len(turn.OpenAIChunks))
+					t.Fatalf("Got chunks:\n%s", strings.Join(chunks, "\n"))
+				}
+
+				for j, wantChunk := range turn.OpenAIChunks {
+					assertJSONEqual(t, chunks[j], string(wantChunk))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package anthropicclaude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// ContextStrategy selects how conversations exceeding the input budget are shortened.
+type ContextStrategy string
+
+const (
+	// ContextStrategyDropOldest drops the oldest turns.
+	ContextStrategyDropOldest ContextStrategy = "drop_oldest"
+	// ContextStrategySummarize replaces the oldest turns by a summary written by a cheap model.
+	ContextStrategySummarize ContextStrategy = "summarize"
+)
+
+// DefaultSummaryModel writes summaries for ContextStrategySummarize unless configured otherwise.
+const DefaultSummaryModel = "claude-haiku-4-5"
+
+const (
+	// mediaTokenEstimate approximates an image, file or audio part, which can't be sized
+	// without decoding it.
+	mediaTokenEstimate = 1600
+	// messageTokenOverhead approximates the role and framing tokens of a message.
+	messageTokenOverhead = 4
+	// summaryMaxTokens bounds summaries and is reserved in the input budget for them.
+	summaryMaxTokens = 1024
+	// maxTranscriptBytes bounds the transcript sent for summarization, keeping its most
+	// recent part.
+	maxTranscriptBytes = 400_000
+)
+
+// summaryPrompt instructs the summary model.
+const summaryPrompt = "Summarize the following conversation between a user and an assistant, " +
+	"which was cut to fit the context window. Keep facts, decisions, open questions, names, " +
+	"numbers and code identifiers the conversation may build on. Reply with the summary only."
+
+// ContextManagement configures trimming of chat histories that don't fit the input budget,
+// the model's context window minus max_tokens.
+type ContextManagement struct {
+	Strategy ContextStrategy
+
+	// SummaryModel writes summaries for ContextStrategySummarize. Defaults to DefaultSummaryModel.
+	SummaryModel string
+
+	// CountTokens calibrates the estimate with Anthropic's token counting API, at the cost
+	// of an additional request.
+	CountTokens bool
+
+	// MaxInputTokens overrides the input budget derived from the model's context window.
+	MaxInputTokens int64
+}
+
+// ContextTrim describes how the history of a request was shortened.
+type ContextTrim struct {
+	Strategy ContextStrategy
+	// Messages is the number of dropped or summarized messages.
+	Messages int
+	// InputTokens is the estimated input before trimming.
+	InputTokens int64
+	// Budget is the input budget trimmed to.
+	Budget int64
+}
+
+// String formats the trim as key-value pairs, e.g. for a response header.
+func (t ContextTrim) String() string {
+	return fmt.Sprintf("strategy=%s; messages=%d; input_tokens=%d; budget=%d", t.Strategy, t.Messages, t.InputTokens, t.Budget)
+}
+
+// contextTrimReporterKey is the context key of the reporter set by WithContextTrimReporter.
+type contextTrimReporterKey struct{}
+
+// WithContextTrimReporter returns a context in which chat completion requests report
+// history trimming to report, e.g. to set a response header. report is called at most once
+// per request, before any upstream request for the completion is sent.
+func WithContextTrimReporter(ctx context.Context, report func(ContextTrim)) context.Context {
+	return context.WithValue(ctx, contextTrimReporterKey{}, report)
+}
+
+// manageContext returns clientReq with its oldest turns dropped or summarized if the
+// estimated input exceeds the budget. Turns are only cut before user messages, so tool
+// calls keep their results; system and developer messages are always kept. Requests that
+// don't fit even with only the last turn fail with context_length_exceeded.
+//
+// Requests are returned unchanged if context management is disabled or the budget is
+// unknown, e.g. for models missing from the capability table.
+func (a *CreateChatCompletionAdapter) manageContext(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	transport http.RoundTripper,
+) (openaiadapter.CreateChatCompletionRequest, error) {
+	if a.contextManagement.Strategy == "" {
+		return clientReq, nil
+	}
+	budget := a.contextBudget(clientReq)
+	if budget <= 0 {
+		return clientReq, nil
+	}
+
+	fixed := estimateRequestOverhead(clientReq)
+	total := fixed
+	tokens := make([]int64, len(clientReq.Messages))
+	for i, msg := range clientReq.Messages {
+		raw, err := msg.MarshalJSON()
+		if err != nil {
+			return clientReq, fmt.Errorf("encode message %d: %w", i, err)
+		}
+		tokens[i] = estimateTokens(raw) + messageTokenOverhead
+		total += tokens[i]
+	}
+
+	if a.contextManagement.CountTokens {
+		count, err := a.CountTokens(ctx, clientReq, transport)
+		if err != nil {
+			return clientReq, err
+		}
+		// Scale the estimates so they add up to the exact count
+		scale := float64(count.InputTokens) / float64(max(total, 1))
+		fixed = int64(float64(fixed) * scale)
+		for i := range tokens {
+			tokens[i] = int64(float64(tokens[i]) * scale)
+		}
+		total = count.InputTokens
+	}
+	if total <= budget {
+		return clientReq, nil
+	}
+
+	var reserve int64
+	if a.contextManagement.Strategy == ContextStrategySummarize {
+		reserve = summaryMaxTokens
+	}
+	cut, ok := trimCutIndex(clientReq.Messages, tokens, fixed+reserve, budget)
+	if !ok {
+		slog.InfoContext(ctx, "conversation history exceeds context window even after trimming",
+			"model", clientReq.Model,
+			"input_tokens", total,
+			"budget", budget,
+		)
+		return clientReq, newContextLengthError(clientReq.Model, total, budget)
+	}
+
+	var system, dropped []types.ChatCompletionRequestMessage
+	for _, msg := range clientReq.Messages[:cut] {
+		if isSystemMessage(msg) {
+			system = append(system, msg)
+		} else {
+			dropped = append(dropped, msg)
+		}
+	}
+
+	trim := ContextTrim{
+		Strategy:    a.contextManagement.Strategy,
+		Messages:    len(dropped),
+		InputTokens: total,
+		Budget:      budget,
+	}
+	if trim.Strategy == ContextStrategySummarize {
+		summary, err := a.summarize(ctx, dropped, transport)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to summarize conversation, dropping oldest turns instead", "error", err)
+			trim.Strategy = ContextStrategyDropOldest
+		} else {
+			system = append(system, summary)
+		}
+	}
+
+	messages := make([]types.ChatCompletionRequestMessage, 0, len(system)+len(clientReq.Messages)-cut)
+	messages = append(messages, system...)
+	messages = append(messages, clientReq.Messages[cut:]...)
+	clientReq.Messages = messages
+
+	slog.InfoContext(ctx, "trimmed conversation history to fit context window",
+		"model", clientReq.Model,
+		"strategy", trim.Strategy,
+		"messages", trim.Messages,
+		"input_tokens", trim.InputTokens,
+		"budget", trim.Budget,
+	)
+	if report, ok := ctx.Value(contextTrimReporterKey{}).(func(ContextTrim)); ok {
+		report(trim)
+	}
+	return clientReq, nil
+}
+
+// contextBudget returns the input tokens available to a request, or 0 if unknown.
+func (a *CreateChatCompletionAdapter) contextBudget(clientReq openaiadapter.CreateChatCompletionRequest) int64 {
+	if a.contextManagement.MaxInputTokens > 0 {
+		return a.contextManagement.MaxInputTokens
+	}
+	model := lookupModel(clientReq.Model)
+	if model.contextWindow == 0 {
+		return 0
+	}
+	// Invalid generation settings are reported when the request is built
+	params, err := buildGenerationParams(clientReq)
+	if err != nil {
+		return 0
+	}
+	return model.contextWindow - params.MaxTokens
+}
+
+// trimCutIndex returns the index of the earliest user message from which the conversation
+// fits the budget, keeping system messages before it. At least one message is dropped.
+func trimCutIndex(messages []types.ChatCompletionRequestMessage, tokens []int64, fixed, budget int64) (int, bool) {
+	// suffix[i] is the estimate of all messages from i, plus system messages before i
+	suffix := make([]int64, len(messages)+1)
+	var system int64
+	for i, msg := range messages {
+		if isSystemMessage(msg) {
+			system += tokens[i]
+		}
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		suffix[i] = suffix[i+1]
+		if !isSystemMessage(messages[i]) {
+			suffix[i] += tokens[i]
+		}
+	}
+
+	droppable := false
+	for i, msg := range messages {
+		role, _ := msg.Discriminator()
+		if droppable && role == string(types.User) && fixed+system+suffix[i] <= budget {
+			return i, true
+		}
+		if !isSystemMessage(msg) {
+			droppable = true
+		}
+	}
+	return 0, false
+}
+
+// isSystemMessage reports whether msg is a system or developer message.
+func isSystemMessage(msg types.ChatCompletionRequestMessage) bool {
+	role, _ := msg.Discriminator()
+	return role == string(types.System) || role == string(types.ChatCompletionRequestDeveloperMessageRoleDeveloper)
+}
+
+// summarize asks the summary model to summarize messages and returns the summary as a
+// system message.
+func (a *CreateChatCompletionAdapter) summarize(
+	ctx context.Context,
+	messages []types.ChatCompletionRequestMessage,
+	transport http.RoundTripper,
+) (types.ChatCompletionRequestMessage, error) {
+	var summaryMsg types.ChatCompletionRequestMessage
+
+	var transcript strings.Builder
+	for _, msg := range messages {
+		raw, err := msg.MarshalJSON()
+		if err != nil {
+			return summaryMsg, fmt.Errorf("encode message: %w", err)
+		}
+		transcript.WriteString(transcriptEntry(raw))
+	}
+	text := transcript.String()
+	if len(text) > maxTranscriptBytes {
+		// Start at a line boundary to avoid splitting entries and multi-byte characters
+		text = text[len(text)-maxTranscriptBytes:]
+		if _, rest, ok := strings.Cut(text, "\n"); ok {
+			text = rest
+		}
+	}
+
+	client, err := newClient(transport)
+	if err != nil {
+		return summaryMsg, fmt.Errorf("initialize Anthropic client for summary: %w", err)
+	}
+	model := a.contextManagement.SummaryModel
+	if model == "" {
+		model = DefaultSummaryModel
+	}
+	message, err := client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     anthropic.Model(model),
+		MaxTokens: summaryMaxTokens,
+		System:    []anthropic.TextBlockParam{{Text: summaryPrompt}},
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))},
+	})
+	if err != nil {
+		return summaryMsg, err
+	}
+
+	var summary strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			summary.WriteString(block.Text)
+		}
+	}
+	if strings.TrimSpace(summary.String()) == "" {
+		return summaryMsg, fmt.Errorf("summary model %s returned no text", model)
+	}
+
+	encoded, err := json.Marshal(map[string]string{
+		"role":    string(types.System),
+		"content": "Summary of the earlier conversation, which was shortened to fit the context window:\n\n" + summary.String(),
+	})
+	if err != nil {
+		return summaryMsg, err
+	}
+	err = summaryMsg.UnmarshalJSON(encoded)
+	return summaryMsg, err
+}
+
+// transcriptEntry renders a message as plain text lines for summarization. Media parts are
+// replaced by placeholders.
+func transcriptEntry(raw []byte) string {
+	var msg struct {
+		Role      string          `json:"role"`
+		Content   json.RawMessage `json:"content"`
+		ToolCalls []struct {
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+		FunctionCall *struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function_call"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return ""
+	}
+
+	var entry strings.Builder
+	if text := transcriptText(msg.Content); text != "" {
+		fmt.Fprintf(&entry, "%s: %s\n", msg.Role, text)
+	}
+	for _, call := range msg.ToolCalls {
+		fmt.Fprintf(&entry, "%s called %s(%s)\n", msg.Role, call.Function.Name, call.Function.Arguments)
+	}
+	if call := msg.FunctionCall; call != nil {
+		fmt.Fprintf(&entry, "%s called %s(%s)\n", msg.Role, call.Name, call.Arguments)
+	}
+	return entry.String()
+}
+
+// transcriptText returns the text of string or content part array content.
+func transcriptText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	var parts []struct {
+		Type    string `json:"type"`
+		Text    string `json:"text"`
+		Refusal string `json:"refusal"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "refusal":
+			texts = append(texts, part.Refusal)
+		default:
+			texts = append(texts, "["+part.Type+"]")
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// estimateRequestOverhead estimates the tokens of tool and function definitions.
+func estimateRequestOverhead(clientReq openaiadapter.CreateChatCompletionRequest) int64 {
+	var tokens int64
+	if clientReq.Tools != nil {
+		if raw, err := json.Marshal(clientReq.Tools); err == nil {
+			tokens += estimateTokens(raw)
+		}
+	}
+	if clientReq.Functions != nil {
+		if raw, err := json.Marshal(clientReq.Functions); err == nil {
+			tokens += estimateTokens(raw)
+		}
+	}
+	return tokens
+}
+
+// estimateTokens roughly estimates the tokens of a JSON value at four characters per
+// token of its strings and keys, counting media parts at a flat rate.
+func estimateTokens(raw []byte) int64 {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return int64(len(raw) / 4)
+	}
+
+	var chars, media int64
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			switch v["type"] {
+			case "image_url", "file", "input_audio":
+				media++
+				return
+			}
+			for key, field := range v {
+				chars += int64(len(key))
+				walk(field)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case string:
+			chars += int64(len(v))
+		}
+	}
+	walk(value)
+	return chars/4 + media*mediaTokenEstimate
+}
+
+// newContextLengthError creates an OpenAI context_length_exceeded error.
+func newContextLengthError(model string, tokens, budget int64) *types.ErrorResponse {
+	errResp := newInvalidParamError("messages",
+		"messages exceed the context window of %s even after trimming: about %d input tokens, at most %d available",
+		model, tokens, budget)
+	code := "context_length_exceeded"
+	errResp.Err.Code = &code
+	return errResp
+}
@@ -0,0 +1,158 @@
+package anthropicclaude_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// newLongConversation returns a request whose oldest turn, a tool call with its result,
+// is far larger than the later turns.
+func newLongConversation(t *testing.T) types.CreateChatCompletionRequest {
+	t.Helper()
+	long := strings.Repeat("lorem ipsum ", 200)
+	body := `{"model":"claude-sonnet-4-0","max_completion_tokens":1024,"messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"` + long + `"},
+		{"role":"assistant","content":"` + long + `","tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"42"},
+		{"role":"assistant","content":"It is 42."},
+		{"role":"user","content":"And doubled?"},
+		{"role":"assistant","content":"84."},
+		{"role":"user","content":"Thanks!"}
+	]}`
+	var req types.CreateChatCompletionRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("Failed to parse request: %v", err)
+	}
+	return req
+}
+
+// upstreamRequest parses the system prompt and messages of a captured request body.
+func upstreamRequest(t *testing.T, body []byte) (string, []json.RawMessage) {
+	t.Helper()
+	var req struct {
+		Model    string            `json:"model"`
+		System   json.RawMessage   `json:"system"`
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("Failed to parse upstream request: %v", err)
+	}
+	return string(req.System), req.Messages
+}
+
+func TestCreateChatCompletionAdapter_ContextManagement(t *testing.T) {
+	t.Parallel()
+
+	t.Run("drops oldest turns", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{newMessageResponse("You're welcome!", "end_turn", 20, 4)}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContextManagement(anthropicclaude.ContextManagement{
+			Strategy:       anthropicclaude.ContextStrategyDropOldest,
+			MaxInputTokens: 200,
+		}))
+
+		var trims []anthropicclaude.ContextTrim
+		ctx := anthropicclaude.WithContextTrimReporter(context.Background(), func(trim anthropicclaude.ContextTrim) {
+			trims = append(trims, trim)
+		})
+		if _, err := adapter.ProcessRequest(ctx, newLongConversation(t), transport); err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+
+		system, messages := upstreamRequest(t, transport.bodies[0])
+		if !strings.Contains(system, "Be brief.") {
+			t.Errorf("System prompt dropped: %s", system)
+		}
+		// The tool result alone would fit, but turns are only cut before user messages
+		if len(messages) != 3 || !strings.Contains(string(messages[0]), "And doubled?") {
+			t.Errorf("Expected the last 3 messages, got %d: %s", len(messages), messages)
+		}
+		if len(trims) != 1 || trims[0].Strategy != anthropicclaude.ContextStrategyDropOldest || trims[0].Messages != 4 || trims[0].Budget != 200 {
+			t.Errorf("Unexpected trim report: %+v", trims)
+		}
+	})
+
+	t.Run("summarizes oldest turns", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageResponse("The user looked up 42.", "end_turn", 600, 8),
+			newMessageResponse("You're welcome!", "end_turn", 40, 4),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContextManagement(anthropicclaude.ContextManagement{
+			Strategy:       anthropicclaude.ContextStrategySummarize,
+			MaxInputTokens: 1200,
+		}))
+
+		resp, err := adapter.ProcessRequest(context.Background(), newLongConversation(t), transport)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if *resp.Choices[0].Message.Content != "You're welcome!" {
+			t.Errorf("Content: got %q", *resp.Choices[0].Message.Content)
+		}
+
+		if len(transport.bodies) != 2 {
+			t.Fatalf("Expected summary and completion requests, got %d", len(transport.bodies))
+		}
+		var summaryReq struct {
+			Model string `json:"model"`
+		}
+		if err := json.Unmarshal(transport.bodies[0], &summaryReq); err != nil || summaryReq.Model != anthropicclaude.DefaultSummaryModel {
+			t.Errorf("Summary model: got %q, want %q", summaryReq.Model, anthropicclaude.DefaultSummaryModel)
+		}
+		if body := string(transport.bodies[0]); !strings.Contains(body, "assistant called lookup({})") || !strings.Contains(body, "tool: 42") {
+			t.Errorf("Transcript incomplete: %s", body)
+		}
+
+		system, messages := upstreamRequest(t, transport.bodies[1])
+		if !strings.Contains(system, "Be brief.") || !strings.Contains(system, "The user looked up 42.") {
+			t.Errorf("Summary missing from system prompt: %s", system)
+		}
+		if len(messages) != 3 {
+			t.Errorf("Expected the last 3 messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("fits without trimming", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{newMessageResponse("You're welcome!", "end_turn", 600, 4)}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContextManagement(anthropicclaude.ContextManagement{
+			Strategy: anthropicclaude.ContextStrategyDropOldest,
+		}))
+
+		if _, err := adapter.ProcessRequest(context.Background(), newLongConversation(t), transport); err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if _, messages := upstreamRequest(t, transport.bodies[0]); len(messages) != 7 {
+			t.Errorf("Expected all 7 messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("last turn exceeds budget", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContextManagement(anthropicclaude.ContextManagement{
+			Strategy:       anthropicclaude.ContextStrategyDropOldest,
+			MaxInputTokens: 5,
+		}))
+
+		_, err := adapter.ProcessRequest(context.Background(), newLongConversation(t), transport)
+		var errResp *types.ErrorResponse
+		if !errors.As(err, &errResp) {
+			t.Fatalf("Expected ErrorResponse, got %v", err)
+		}
+		if errResp.Err.Code == nil || *errResp.Err.Code != "context_length_exceeded" || errResp.Err.Param == nil || *errResp.Err.Param != "messages" {
+			t.Errorf("Unexpected error: %+v", errResp.Err)
+		}
+		if len(transport.bodies) != 0 {
+			t.Errorf("Expected no upstream request, got %d", len(transport.bodies))
+		}
+	})
+}
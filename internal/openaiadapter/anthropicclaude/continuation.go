@@ -0,0 +1,438 @@
+package anthropicclaude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+)
+
+// Continuation transformation: Anthropic stops at max_tokens (the request's limit or the
+// model's output cap) and pauses long server tool turns with pause_turn. OpenAI clients
+// only see finish_reason "length" or "stop" and would have to continue themselves. With
+// continuation enabled (see WithContinuation), the partial output is sent back as assistant
+// prefill and the continuation is stitched into the same response or stream.
+//
+// Only text and server tool content is continued: thinking blocks can't be prefilled and
+// tool calls need results first. Such responses are returned as they are.
+
+// messageStream is a stream of Anthropic message events. Implemented by ssestream.Stream
+// and continuedStream.
+type messageStream interface {
+	Next() bool
+	Current() anthropic.MessageStreamEventUnion
+	Err() error
+	Close() error
+}
+
+// canContinue reports whether a response with content blocks of the given types stopped
+// early and can be continued by prefill.
+func canContinue(stopReason anthropic.StopReason, blockTypes []string) bool {
+	switch stopReason {
+	case anthropic.StopReasonMaxTokens:
+		// Server tool input cut off mid-way can't be resumed
+		if len(blockTypes) == 0 || blockTypes[len(blockTypes)-1] != "text" {
+			return false
+		}
+	case anthropic.StopReasonPauseTurn:
+	default:
+		return false
+	}
+	for _, blockType := range blockTypes {
+		if blockType != "text" && !isServerToolBlock(blockType) {
+			return false
+		}
+	}
+	return true
+}
+
+// continueMessage sends follow-up requests while the response can be continued, at most
+// a.maxContinuations times, and merges them into a single response with summed usage.
+func (a *CreateChatCompletionAdapter) continueMessage(
+	ctx context.Context,
+	client *anthropic.Client,
+	params anthropic.MessageNewParams,
+	opts []option.RequestOption,
+	message *anthropic.Message,
+) (*anthropic.Message, error) {
+	messages := params.Messages
+	for range a.maxContinuations {
+		blockTypes := make([]string, 0, len(message.Content))
+		blocks := make([]json.RawMessage, 0, len(message.Content))
+		for _, block := range message.Content {
+			blockTypes = append(blockTypes, block.Type)
+			blocks = append(blocks, json.RawMessage(block.RawJSON()))
+		}
+		if !canContinue(message.StopReason, blockTypes) {
+			break
+		}
+
+		prefill, trimmed, ok, err := continuationPrefill(blocks)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		params.Messages = append(slices.Clip(messages), prefill)
+		continuation, err := a.newMessage(ctx, client, params, opts)
+		if err != nil {
+			return nil, err
+		}
+		if message, err = mergeContinuation(message, continuation, trimmed); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// continuationPrefill builds the assistant message continuing a response from its content
+// blocks. Adjacent text blocks are joined, and trailing whitespace is trimmed from the
+// final text since Anthropic rejects prefills ending in whitespace. The trimmed whitespace
+// is returned so it isn't repeated by the continuation (see continuationText).
+// Reports false if no content is left to prefill.
+func continuationPrefill(blocks []json.RawMessage) (anthropic.MessageParam, string, bool, error) {
+	var fields []map[string]json.RawMessage
+	var texts []string
+	var citations [][]json.RawMessage
+	for i, block := range blocks {
+		var blockFields map[string]json.RawMessage
+		if err := json.Unmarshal(block, &blockFields); err != nil {
+			return anthropic.MessageParam{}, "", false, fmt.Errorf("read content block %d: %w", i, err)
+		}
+		var blockType string
+		_ = json.Unmarshal(blockFields["type"], &blockType)
+		if blockType != "text" {
+			fields = append(fields, blockFields)
+			texts = append(texts, "")
+			citations = append(citations, nil)
+			continue
+		}
+
+		var text string
+		var blockCitations []json.RawMessage
+		if err := json.Unmarshal(blockFields["text"], &text); err != nil {
+			return anthropic.MessageParam{}, "", false, fmt.Errorf("read text of content block %d: %w", i, err)
+		}
+		if raw, ok := blockFields["citations"]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &blockCitations); err != nil {
+				return anthropic.MessageParam{}, "", false, fmt.Errorf("read citations of content block %d: %w", i, err)
+			}
+		}
+
+		if last := len(fields) - 1; last >= 0 && fields[last] == nil {
+			texts[last] += text
+			citations[last] = append(citations[last], blockCitations...)
+			continue
+		}
+		fields = append(fields, nil) // nil marks a text block
+		texts = append(texts, text)
+		citations = append(citations, blockCitations)
+	}
+
+	var trimmed string
+	if last := len(fields) - 1; last >= 0 && fields[last] == nil {
+		text := strings.TrimRightFunc(texts[last], unicode.IsSpace)
+		trimmed = texts[last][len(text):]
+		texts[last] = text
+		if text == "" {
+			fields, texts, citations = fields[:last], texts[:last], citations[:last]
+		}
+	}
+	if len(fields) == 0 {
+		return anthropic.MessageParam{}, "", false, nil
+	}
+
+	content := make([]anthropic.ContentBlockParamUnion, 0, len(fields))
+	for i, blockFields := range fields {
+		var block []byte
+		var err error
+		if blockFields == nil {
+			block, err = encodeTextBlock(texts[i], citations[i])
+		} else {
+			block, err = json.Marshal(blockFields)
+		}
+		if err != nil {
+			return anthropic.MessageParam{}, "", false, fmt.Errorf("encode prefill block %d: %w", i, err)
+		}
+		content = append(content, param.Override[anthropic.ContentBlockParamUnion](json.RawMessage(block)))
+	}
+	return anthropic.MessageParam{Role: anthropic.MessageParamRoleAssistant, Content: content}, trimmed, true, nil
+}
+
+// encodeTextBlock encodes a text block, omitting citations if there are none.
+func encodeTextBlock(text string, citations []json.RawMessage) ([]byte, error) {
+	block := map[string]any{"type": "text", "text": text}
+	if len(citations) > 0 {
+		block["citations"] = citations
+	}
+	return json.Marshal(block)
+}
+
+// continuationText removes whitespace trimmed from the prefill from the start of continued
+// text, since the model usually repeats it. pending holds the whitespace not matched yet,
+// so it can be matched across stream deltas.
+func continuationText(pending *string, text string) string {
+	if *pending == "" {
+		return text
+	}
+	n := 0
+	for n < len(text) && n < len(*pending) && text[n] == (*pending)[n] {
+		n++
+	}
+	if n == len(text) {
+		*pending = (*pending)[n:]
+		return ""
+	}
+	*pending = ""
+	return text[n:]
+}
+
+// mergeContinuation appends a continuation to the response it continues. Text continuing
+// a text block is joined into that block, so the response reads as if generated at once.
+// The stop reason is taken from the continuation and usage is summed.
+func mergeContinuation(message, continuation *anthropic.Message, trimmed string) (*anthropic.Message, error) {
+	merged := *message
+	merged.Content = slices.Clone(message.Content)
+	next := continuation.Content
+
+	last := len(merged.Content) - 1
+	if last >= 0 && merged.Content[last].Type == "text" && len(next) > 0 && next[0].Type == "text" {
+		var citations []json.RawMessage
+		for _, block := range []anthropic.ContentBlockUnion{merged.Content[last], next[0]} {
+			for _, citation := range block.Citations {
+				citations = append(citations, json.RawMessage(citation.RawJSON()))
+			}
+		}
+		text := merged.Content[last].Text + continuationText(&trimmed, next[0].Text)
+		encoded, err := encodeTextBlock(text, citations)
+		if err != nil {
+			return nil, fmt.Errorf("encode continued text block: %w", err)
+		}
+		if err := merged.Content[last].UnmarshalJSON(encoded); err != nil {
+			return nil, fmt.Errorf("decode continued text block: %w", err)
+		}
+		next = next[1:]
+	}
+	merged.Content = append(merged.Content, next...)
+
+	merged.StopReason = continuation.StopReason
+	merged.StopSequence = continuation.StopSequence
+	merged.Usage = sumUsage(message.Usage, continuation.Usage)
+	return &merged, nil
+}
+
+// sumUsage sums the token counts of two responses.
+func sumUsage(a, b anthropic.Usage) anthropic.Usage {
+	a.InputTokens += b.InputTokens
+	a.OutputTokens += b.OutputTokens
+	a.CacheCreationInputTokens += b.CacheCreationInputTokens
+	a.CacheReadInputTokens += b.CacheReadInputTokens
+	a.ServerToolUse.WebSearchRequests += b.ServerToolUse.WebSearchRequests
+	return a
+}
+
+// continuedStream stitches continuations into a single stream of events (see
+// continueMessage). Events of continuations are renumbered to follow the blocks streamed
+// so far, their message_start is dropped and the final message_delta reports the usage
+// of all rounds.
+type continuedStream struct {
+	stream     messageStream
+	next       func(prefill anthropic.MessageParam) messageStream
+	roundsLeft int
+
+	// blocks and blockTypes hold the content of all rounds for the prefill
+	blocks     *streamedStateBlocks
+	blockTypes []string
+
+	continued  bool            // whether the current round is a continuation
+	offset     int64           // block index of the current round's first block
+	trimmed    string          // prefill whitespace not yet matched (see continuationText)
+	usage      anthropic.Usage // usage of completed rounds
+	roundUsage anthropic.Usage
+
+	current anthropic.MessageStreamEventUnion
+	err     error
+}
+
+// newContinuedStream wraps stream to continue it at most maxRounds times; next opens the
+// stream continuing the given prefill.
+func newContinuedStream(
+	stream messageStream,
+	maxRounds int,
+	next func(prefill anthropic.MessageParam) messageStream,
+) *continuedStream {
+	return &continuedStream{
+		stream:     stream,
+		next:       next,
+		roundsLeft: maxRounds,
+		blocks:     newStreamedStateBlocks(),
+	}
+}
+
+// Next advances to the next event, switching to a continuation where the current round
+// stops early.
+func (c *continuedStream) Next() bool {
+	for c.err == nil && c.stream.Next() {
+		event, skip, err := c.translate(c.stream.Current())
+		if err != nil {
+			c.err = err
+			return false
+		}
+		if skip {
+			continue
+		}
+		c.current = event
+		return true
+	}
+	return false
+}
+
+// translate renumbers and records an event of the current round. Reports true for events
+// that are dropped from the stitched stream.
+func (c *continuedStream) translate(event anthropic.MessageStreamEventUnion) (anthropic.MessageStreamEventUnion, bool, error) {
+	switch eventType := event.AsAny().(type) {
+	case anthropic.MessageStartEvent:
+		c.roundUsage = eventType.Message.Usage
+		return event, c.continued, nil
+
+	case anthropic.ContentBlockStartEvent:
+		index := eventType.Index + c.offset
+		c.blockTypes = append(c.blockTypes, eventType.ContentBlock.Type)
+		if eventType.ContentBlock.Type != "text" {
+			c.trimmed = "" // Only text continuing the prefill repeats its whitespace
+		}
+		if err := c.blocks.start(index, eventType.ContentBlock.Type, eventType.ContentBlock.RawJSON()); err != nil {
+			return event, false, err
+		}
+		return c.renumber(event, index, nil)
+
+	case anthropic.ContentBlockDeltaEvent:
+		index := eventType.Index + c.offset
+		var delta any
+		switch deltaVariant := eventType.Delta.AsAny().(type) {
+		case anthropic.TextDelta:
+			text := continuationText(&c.trimmed, deltaVariant.Text)
+			if text == "" && deltaVariant.Text != "" {
+				return event, true, nil // Repeated whitespace only
+			}
+			if text != deltaVariant.Text {
+				delta = map[string]string{"type": "text_delta", "text": text}
+			}
+			c.blocks.appendText(index, text)
+		case anthropic.InputJSONDelta:
+			c.blocks.appendInput(index, deltaVariant.PartialJSON)
+		case anthropic.CitationsDelta:
+			c.blocks.appendCitation(index, deltaVariant.Citation.RawJSON())
+		}
+		return c.renumber(event, index, delta)
+
+	case anthropic.ContentBlockStopEvent:
+		return c.renumber(event, eventType.Index+c.offset, nil)
+
+	case anthropic.MessageDeltaEvent:
+		round := c.roundUsage
+		accumulateDeltaUsage(&round, eventType.Usage)
+		usage := sumUsage(c.usage, round)
+
+		if c.roundsLeft > 0 && canContinue(eventType.Delta.StopReason, c.blockTypes) {
+			continued, err := c.continueStream(usage)
+			if err != nil || continued {
+				return event, continued, err
+			}
+		}
+		if !c.continued {
+			return event, false, nil
+		}
+		return rewriteEvent(event, map[string]any{"usage": map[string]int64{
+			"input_tokens":                usage.InputTokens,
+			"output_tokens":               usage.OutputTokens,
+			"cache_creation_input_tokens": usage.CacheCreationInputTokens,
+			"cache_read_input_tokens":     usage.CacheReadInputTokens,
+		}})
+	}
+	return event, false, nil
+}
+
+// continueStream replaces the current round by a continuation. Reports false if there is
+// no content to continue.
+func (c *continuedStream) continueStream(usage anthropic.Usage) (bool, error) {
+	blocks, err := c.blocks.rawBlocks()
+	if err != nil {
+		return false, err
+	}
+	prefill, trimmed, ok, err := continuationPrefill(blocks)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// The message_stop of the current round is dropped along with the stream
+	_ = c.stream.Close()
+	c.stream = c.next(prefill)
+	c.roundsLeft--
+	c.continued = true
+	c.offset = int64(len(c.blockTypes))
+	c.trimmed = trimmed
+	c.usage = usage
+	c.roundUsage = anthropic.Usage{}
+	return true, nil
+}
+
+// renumber moves a content block event of a continuation to the given index, optionally
+// replacing its delta.
+func (c *continuedStream) renumber(event anthropic.MessageStreamEventUnion, index int64, delta any) (anthropic.MessageStreamEventUnion, bool, error) {
+	if !c.continued && delta == nil {
+		return event, false, nil
+	}
+	fields := map[string]any{"index": index}
+	if delta != nil {
+		fields["delta"] = delta
+	}
+	return rewriteEvent(event, fields)
+}
+
+// Current returns the current event.
+func (c *continuedStream) Current() anthropic.MessageStreamEventUnion {
+	return c.current
+}
+
+// Err returns the error that ended the stream, if any.
+func (c *continuedStream) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.stream.Err()
+}
+
+// Close closes the current round's stream.
+func (c *continuedStream) Close() error {
+	return c.stream.Close()
+}
+
+// rewriteEvent replaces top-level fields of an event. Events are decoded from their raw
+// JSON on access, so changes have to be made to the JSON.
+func rewriteEvent(event anthropic.MessageStreamEventUnion, fields map[string]any) (anthropic.MessageStreamEventUnion, bool, error) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(event.RawJSON()), &raw); err != nil {
+		return event, false, fmt.Errorf("read %s event: %w", event.Type, err)
+	}
+	for key, value := range fields {
+		raw[key] = value
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return event, false, fmt.Errorf("encode %s event: %w", event.Type, err)
+	}
+	var rewritten anthropic.MessageStreamEventUnion
+	if err := rewritten.UnmarshalJSON(encoded); err != nil {
+		return event, false, fmt.Errorf("decode %s event: %w", event.Type, err)
+	}
+	return rewritten, false, nil
+}
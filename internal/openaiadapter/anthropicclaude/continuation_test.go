@@ -0,0 +1,242 @@
+package anthropicclaude_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// sequenceTransport returns canned responses in order and captures all request bodies.
+type sequenceTransport struct {
+	mu        sync.Mutex
+	responses []string
+	bodies    [][]byte
+}
+
+func (s *sequenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.bodies = append(s.bodies, body)
+	response := s.responses[min(len(s.bodies), len(s.responses))-1]
+
+	contentType := "application/json"
+	if req.Header.Get("Accept") == "text/event-stream" {
+		contentType = "text/event-stream"
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(response)),
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Request:    req,
+	}, nil
+}
+
+// lastMessage returns the last message of the nth captured request.
+func (s *sequenceTransport) lastMessage(t *testing.T, n int) string {
+	t.Helper()
+	var req struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(s.bodies[n], &req); err != nil {
+		t.Fatalf("Failed to parse request %d: %v", n, err)
+	}
+	return string(req.Messages[len(req.Messages)-1])
+}
+
+func newMessageResponse(text, stopReason string, inputTokens, outputTokens int) string {
+	content, _ := json.Marshal(text)
+	return `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0",` +
+		`"content":[{"type":"text","text":` + string(content) + `}],` +
+		`"stop_reason":"` + stopReason + `","stop_sequence":null,` +
+		`"usage":{"input_tokens":` + strconv.Itoa(inputTokens) + `,"output_tokens":` + strconv.Itoa(outputTokens) + `}}`
+}
+
+func newMessageStream(deltas []string, stopReason string, inputTokens, outputTokens int) string {
+	events := []string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":` + strconv.Itoa(inputTokens) + `,"output_tokens":1}}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		``,
+	}
+	for _, delta := range deltas {
+		text, _ := json.Marshal(delta)
+		events = append(events,
+			`event: content_block_delta`,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":`+string(text)+`}}`,
+			``,
+		)
+	}
+	events = append(events,
+		`event: content_block_stop`,
+		`data: {"type":"content_block_stop","index":0}`,
+		``,
+		`event: message_delta`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"`+stopReason+`","stop_sequence":null},"usage":{"output_tokens":`+strconv.Itoa(outputTokens)+`}}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	)
+	return strings.Join(events, "\n") + "\n"
+}
+
+func newContinuationRequest(t *testing.T, stream bool) types.CreateChatCompletionRequest {
+	t.Helper()
+	body := `{"model":"claude-sonnet-4-0","max_tokens":16,"messages":[{"role":"user","content":"Write add in Python."}]}`
+	if stream {
+		body = `{"model":"claude-sonnet-4-0","max_tokens":16,"stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Write add in Python."}]}`
+	}
+	var req types.CreateChatCompletionRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("Failed to parse request: %v", err)
+	}
+	return req
+}
+
+func TestCreateChatCompletionAdapter_Continuation(t *testing.T) {
+	t.Parallel()
+
+	const (
+		wantContent = "def add(a, b):\n    return a + b"
+		wantPrefill = `{"content":[{"text":"def add(a, b):","type":"text"}],"role":"assistant"}`
+	)
+
+	t.Run("buffered", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageResponse("def add(a, b):\n", "max_tokens", 10, 16),
+			newMessageResponse("\n    return a + b", "end_turn", 25, 8),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContinuation(2))
+
+		resp, err := adapter.ProcessRequest(context.Background(), newContinuationRequest(t, false), transport)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+
+		if len(transport.bodies) != 2 {
+			t.Fatalf("Expected 2 upstream requests, got %d", len(transport.bodies))
+		}
+		assertJSONEqual(t, transport.lastMessage(t, 1), wantPrefill)
+
+		choice := resp.Choices[0]
+		if choice.Message.Content == nil || *choice.Message.Content != wantContent {
+			t.Errorf("Content: got %v, want %q", choice.Message.Content, wantContent)
+		}
+		if choice.FinishReason != types.CreateChatCompletionResponseChoiceFinishReasonStop {
+			t.Errorf("Finish reason: got %q, want stop", choice.FinishReason)
+		}
+		if resp.Usage.PromptTokens != 35 || resp.Usage.CompletionTokens != 24 || resp.Usage.TotalTokens != 59 {
+			t.Errorf("Usage not summed: got %+v", *resp.Usage)
+		}
+	})
+
+	t.Run("buffered stops after max rounds", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageResponse("one ", "max_tokens", 10, 16),
+			newMessageResponse("two ", "max_tokens", 10, 16),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContinuation(1))
+
+		resp, err := adapter.ProcessRequest(context.Background(), newContinuationRequest(t, false), transport)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+
+		if len(transport.bodies) != 2 {
+			t.Fatalf("Expected 2 upstream requests, got %d", len(transport.bodies))
+		}
+		if content := *resp.Choices[0].Message.Content; content != "one two " {
+			t.Errorf("Content: got %q, want %q", content, "one two ")
+		}
+		if resp.Choices[0].FinishReason != types.CreateChatCompletionResponseChoiceFinishReasonLength {
+			t.Errorf("Finish reason: got %q, want length", resp.Choices[0].FinishReason)
+		}
+	})
+
+	t.Run("buffered without continuation", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageResponse("def add(a, b):\n", "max_tokens", 10, 16),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter()
+
+		resp, err := adapter.ProcessRequest(context.Background(), newContinuationRequest(t, false), transport)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if len(transport.bodies) != 1 || resp.Choices[0].FinishReason != types.CreateChatCompletionResponseChoiceFinishReasonLength {
+			t.Errorf("Expected a single request ending with length, got %d requests and %q", len(transport.bodies), resp.Choices[0].FinishReason)
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		t.Parallel()
+		transport := &sequenceTransport{responses: []string{
+			newMessageStream([]string{"def add(a, b):", "\n"}, "max_tokens", 10, 16),
+			newMessageStream([]string{"\n", "    return a + b"}, "end_turn", 25, 8),
+		}}
+		adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithContinuation(2))
+
+		stream, err := adapter.ProcessStreamingRequest(context.Background(), newContinuationRequest(t, true), transport)
+		if err != nil {
+			t.Fatalf("ProcessStreamingRequest failed: %v", err)
+		}
+
+		var content strings.Builder
+		var roles, finishes int
+		var finishReason types.CreateChatCompletionStreamResponseChoiceFinishReason
+		var usage *types.CompletionUsage
+		for chunk, err := range stream {
+			if err != nil {
+				t.Fatalf("Unexpected stream error: %v", err)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			for _, choice := range chunk.Choices {
+				if choice.Delta.Role != nil {
+					roles++
+				}
+				if choice.Delta.Content != nil {
+					content.WriteString(*choice.Delta.Content)
+				}
+				if choice.FinishReason != nil {
+					finishes++
+					finishReason = *choice.FinishReason
+				}
+			}
+		}
+
+		if len(transport.bodies) != 2 {
+			t.Fatalf("Expected 2 upstream requests, got %d", len(transport.bodies))
+		}
+		assertJSONEqual(t, transport.lastMessage(t, 1), wantPrefill)
+
+		if content.String() != wantContent {
+			t.Errorf("Content: got %q, want %q", content.String(), wantContent)
+		}
+		if roles != 1 || finishes != 1 || finishReason != types.CreateChatCompletionStreamResponseChoiceFinishReasonStop {
+			t.Errorf("Expected one role and one stop chunk, got %d roles, %d finish reasons (%q)", roles, finishes, finishReason)
+		}
+		if usage == nil || usage.PromptTokens != 35 || usage.CompletionTokens != 24 || usage.TotalTokens != 59 {
+			t.Errorf("Usage not summed: got %+v", usage)
+		}
+	})
+}
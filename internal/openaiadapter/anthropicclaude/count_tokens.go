@@ -0,0 +1,102 @@
+package anthropicclaude
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+)
+
+// CountTokens counts the input tokens of an OpenAI chat completion request via Anthropic's
+// count_tokens API. Messages, system prompts, tools and thinking are converted exactly as
+// for generation, so the count matches what the adapter would send.
+// Errors are returned in OpenAI-compatible format.
+func (a *CreateChatCompletionAdapter) CountTokens(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	transport http.RoundTripper,
+) (*anthropic.MessageTokensCount, error) {
+	if err := a.validateRequest(clientReq); err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	clientReq, err := a.resolveContentReferences(ctx, clientReq)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	client, err := newClient(transport)
+	if err != nil {
+		return nil, toChatCompletionError(fmt.Errorf("initialize Anthropic client for token counting: %w", err))
+	}
+
+	params, err := buildCountTokensParams(ctx, clientReq, a.historyMode)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	count, err := client.Messages.CountTokens(ctx, params, serverToolRequestOptions(clientReq)...)
+	if err != nil {
+		return nil, toChatCompletionError(err)
+	}
+
+	return count, nil
+}
+
+// buildCountTokensParams derives count_tokens parameters from the generation parameters.
+// Sampling settings (max_tokens, temperature, stop sequences) don't affect input tokens
+// and have no count_tokens equivalent, so only prompt-relevant fields are carried over.
+func buildCountTokensParams(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	historyMode HistoryMode,
+) (anthropic.MessageCountTokensParams, error) {
+	systemPrompts, messages, err := transformMessages(ctx, clientReq.Messages, historyMode)
+	if err != nil {
+		return anthropic.MessageCountTokensParams{}, err
+	}
+	if err := enableDocumentCitations(clientReq, messages); err != nil {
+		return anthropic.MessageCountTokensParams{}, err
+	}
+
+	generationParams, err := buildGenerationParams(clientReq)
+	if err != nil {
+		return anthropic.MessageCountTokensParams{}, fmt.Errorf("build generation params: %w", err)
+	}
+
+	params := anthropic.MessageCountTokensParams{
+		Model:      generationParams.Model,
+		Messages:   messages,
+		Thinking:   generationParams.Thinking,
+		ToolChoice: generationParams.ToolChoice,
+	}
+
+	if len(systemPrompts) > 0 {
+		params.System = anthropic.MessageCountTokensParamsSystemUnion{
+			OfTextBlockArray: systemPrompts,
+		}
+	}
+
+	// Tool unions are structurally identical but distinct types per endpoint
+	for _, tool := range generationParams.Tools {
+		if definition, ok := tool.Overrides(); ok {
+			// Server tools from extra_body are passed through as raw definitions
+			params.Tools = append(params.Tools, param.Override[anthropic.MessageCountTokensToolUnionParam](definition))
+			continue
+		}
+		params.Tools = append(params.Tools, anthropic.MessageCountTokensToolUnionParam{
+			OfTool:                  tool.OfTool,
+			OfBashTool20250124:      tool.OfBashTool20250124,
+			OfTextEditor20250124:    tool.OfTextEditor20250124,
+			OfTextEditor20250429:    tool.OfTextEditor20250429,
+			OfTextEditor20250728:    tool.OfTextEditor20250728,
+			OfWebSearchTool20250305: tool.OfWebSearchTool20250305,
+		})
+	}
+
+	return params, nil
+}
@@ -0,0 +1,115 @@
+package anthropicclaude
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// customToolInputProperty is the single string parameter of function tools emulating
+// OpenAI custom tools.
+const customToolInputProperty = "input"
+
+// newCustomToolParam builds the Anthropic function tool emulating an OpenAI custom tool.
+//
+// CustomTool transformation: Anthropic has no freeform tools, so OpenAI custom tools are
+// emulated by a function tool of the same name taking the raw input as a single string
+// parameter. Grammar constraints cannot be enforced and are passed as a hint in the input
+// description instead. Calls of these tools are unwrapped back into custom tool calls.
+func newCustomToolParam(tool types.CustomToolChatCompletions) (anthropic.ToolParam, error) {
+	inputDescription, err := customToolFormatHint(tool.Custom.Format)
+	if err != nil {
+		return anthropic.ToolParam{}, fmt.Errorf("custom tool %s: %w", tool.Custom.Name, err)
+	}
+
+	toolParam := anthropic.ToolParam{
+		Name: tool.Custom.Name,
+		InputSchema: anthropic.ToolInputSchemaParam{
+			Properties: map[string]any{
+				customToolInputProperty: map[string]any{
+					"type":        "string",
+					"description": inputDescription,
+				},
+			},
+			Required: []string{customToolInputProperty},
+		},
+	}
+	if tool.Custom.Description != nil {
+		toolParam.Description = anthropic.String(toolDescription(tool.Custom.Name, *tool.Custom.Description))
+	}
+	return toolParam, nil
+}
+
+// customToolFormatHint describes the expected input of a custom tool for the model.
+func customToolFormatHint(format *types.CustomToolChatCompletions_Custom_Format) (string, error) {
+	const freeformHint = "The raw input for the tool, passed through verbatim."
+	if format == nil {
+		return freeformHint, nil
+	}
+
+	formatType, err := format.Discriminator()
+	if err != nil {
+		return "", fmt.Errorf("get type of format: %w", err)
+	}
+
+	switch formatType {
+	case string(types.CustomToolChatCompletionsTextFormatTypeText):
+		return freeformHint, nil
+	case string(types.Grammar):
+		grammarFormat, err := format.AsCustomToolChatCompletionsGrammarFormat()
+		if err != nil {
+			return "", fmt.Errorf("extract grammar format: %w", err)
+		}
+		return fmt.Sprintf(
+			"%s It must match the following %s grammar exactly:\n%s",
+			freeformHint, grammarFormat.Grammar.Syntax, grammarFormat.Grammar.Definition,
+		), nil
+	default:
+		return "", fmt.Errorf("unsupported format type %s", formatType)
+	}
+}
+
+// customToolUseInput wraps a custom tool call's raw input as input of the emulating function tool.
+func customToolUseInput(input string) map[string]any {
+	return map[string]any{customToolInputProperty: input}
+}
+
+// customToolCallInput unwraps the raw input from arguments of the emulating function tool.
+// Arguments without the expected string parameter are passed through unchanged, so nothing
+// the model generated gets lost.
+func customToolCallInput(arguments string) string {
+	var wrapped map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &wrapped); err != nil {
+		return arguments
+	}
+
+	var input string
+	if err := json.Unmarshal(wrapped[customToolInputProperty], &input); err != nil {
+		return arguments
+	}
+	return input
+}
+
+// newCustomToolCallChunk creates a streamed custom tool call delta.
+func newCustomToolCallChunk(index int, id, name, input *string) (types.ChatCompletionStreamResponseDelta_ToolCalls_Item, error) {
+	toolCall := types.ChatCompletionMessageCustomToolCallChunk{
+		Id:    id,
+		Index: index,
+		Custom: &struct {
+			Input *string `json:"input,omitempty"`
+			Name  *string `json:"name,omitempty"`
+		}{
+			Input: input,
+			Name:  name,
+		},
+	}
+
+	var toolCallItem types.ChatCompletionStreamResponseDelta_ToolCalls_Item
+	if err := toolCallItem.FromChatCompletionMessageCustomToolCallChunk(toolCall); err != nil {
+		return toolCallItem, fmt.Errorf("create custom tool call chunk: %w", err)
+	}
+	return toolCallItem, nil
+}
@@ -21,4 +21,8 @@
 // # Adapters
 //
 // CreateChatCompletionAdapter: OpenAI CreateChatCompletion → Anthropic Messages
+//
+// CreateCompletionAdapter: OpenAI CreateCompletion (legacy text completions) → Anthropic Messages
+//
+// BatchAdapter: OpenAI Batch (chat completions JSONL) → Anthropic Message Batches
 package anthropicclaude
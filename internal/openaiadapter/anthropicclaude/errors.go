@@ -20,6 +20,12 @@ func toChatCompletionError(err error) *types.ErrorResponse {
 		return nil
 	}
 
+	// Errors already in OpenAI format (e.g. request validation) pass through unchanged
+	var errResp *types.ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp
+	}
+
 	// Note: Anthropic error responses don't include 'code' or 'param' fields,
 	// so these are always nil in the OpenAI-compatible response.
 
@@ -43,11 +49,8 @@ func toChatCompletionError(err error) *types.ErrorResponse {
 		}
 	}
 
-	// streamingErrorPrefix is the prefix used by the Anthropic SDK when wrapping streaming errors.
-	const streamingErrorPrefix = "received error while streaming: "
-
 	// Streaming: SDK embeds JSON in error string with known prefix
-	if jsonStr, ok := strings.CutPrefix(err.Error(), streamingErrorPrefix); ok {
+	if jsonStr, ok := StreamErrorBody(err); ok {
 		if errorResp, parseErr := parseErrorResponseJSON(jsonStr); parseErr == nil {
 			return &types.ErrorResponse{
 				Err: types.Error{
@@ -67,6 +70,34 @@ func toChatCompletionError(err error) *types.ErrorResponse {
 	}
 }
 
+// streamingErrorPrefix is the prefix used by the Anthropic SDK when wrapping streaming errors.
+const streamingErrorPrefix = "received error while streaming: "
+
+// StreamErrorBody returns the Anthropic error response of an error event received while
+// streaming. Reports false for other errors.
+func StreamErrorBody(err error) (string, bool) {
+	return strings.CutPrefix(err.Error(), streamingErrorPrefix)
+}
+
+// newInvalidRequestError creates an OpenAI invalid_request_error for client input that
+// cannot be processed, so handlers respond with 400 instead of a generic server error.
+func newInvalidRequestError(format string, args ...any) *types.ErrorResponse {
+	return &types.ErrorResponse{
+		Err: types.Error{
+			Message: fmt.Sprintf(format, args...),
+			Type:    "invalid_request_error",
+		},
+	}
+}
+
+// newInvalidParamError creates an OpenAI invalid_request_error naming the request
+// parameter that cannot be satisfied.
+func newInvalidParamError(param, format string, args ...any) *types.ErrorResponse {
+	errResp := newInvalidRequestError(format, args...)
+	errResp.Err.Param = &param
+	return errResp
+}
+
 // parseErrorResponseJSON parses Anthropic error JSON into structured ErrorResponse.
 // Shared by both non-streaming (RawJSON) and streaming (error string) error paths.
 func parseErrorResponseJSON(jsonStr string) (*anthropic.ErrorResponse, error) {
@@ -0,0 +1,160 @@
+package anthropicclaude
+
+import (
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// usesLegacyFunctions reports whether the request uses OpenAI's deprecated functions API
+// instead of tools, so responses have to use the legacy function_call shape.
+func usesLegacyFunctions(clientReq openaiadapter.CreateChatCompletionRequest) bool {
+	return clientReq.Functions != nil && len(*clientReq.Functions) > 0 && clientReq.Tools == nil
+}
+
+// fromChatCompletionFunctions transforms OpenAI's deprecated functions array to Anthropic tools.
+func fromChatCompletionFunctions(functions []types.ChatCompletionFunctions) ([]anthropic.ToolUnionParam, error) {
+	tools := make([]anthropic.ToolUnionParam, 0, len(functions))
+	for _, function := range functions {
+		toolParam, err := newToolParam(function.Name, function.Description, function.Parameters, false)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, anthropic.ToolUnionParam{OfTool: &toolParam})
+	}
+	return tools, nil
+}
+
+// fromFunctionCallOption converts OpenAI's deprecated function_call to Anthropic tool choice.
+func fromFunctionCallOption(
+	functionCall *types.CreateChatCompletionRequest_FunctionCall,
+) (anthropic.ToolChoiceUnionParam, error) {
+	if mode, err := functionCall.AsCreateChatCompletionRequestFunctionCall0(); err == nil {
+		switch mode {
+		case types.CreateChatCompletionRequestFunctionCall0None:
+			return anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}, nil
+		case types.CreateChatCompletionRequestFunctionCall0Auto:
+			return anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{}}, nil
+		default:
+			return anthropic.ToolChoiceUnionParam{}, fmt.Errorf("unsupported function_call mode: %s", mode)
+		}
+	}
+
+	option, err := functionCall.AsChatCompletionFunctionCallOption()
+	if err != nil || option.Name == "" {
+		return anthropic.ToolChoiceUnionParam{}, fmt.Errorf("function_call must be \"none\", \"auto\" or {\"name\": ...}")
+	}
+	return anthropic.ToolChoiceUnionParam{
+		OfTool: &anthropic.ToolChoiceToolParam{Name: option.Name},
+	}, nil
+}
+
+// disableParallelToolUse restricts the model to a single tool call per response.
+// Tool choice "none" is left unchanged since it permits no tool calls at all.
+func disableParallelToolUse(toolChoice *anthropic.ToolChoiceUnionParam) {
+	switch {
+	case toolChoice.OfAuto != nil:
+		toolChoice.OfAuto.DisableParallelToolUse = anthropic.Bool(true)
+	case toolChoice.OfAny != nil:
+		toolChoice.OfAny.DisableParallelToolUse = anthropic.Bool(true)
+	case toolChoice.OfTool != nil:
+		toolChoice.OfTool.DisableParallelToolUse = anthropic.Bool(true)
+	case toolChoice.OfNone != nil:
+	default:
+		toolChoice.OfAuto = &anthropic.ToolChoiceAutoParam{DisableParallelToolUse: anthropic.Bool(true)}
+	}
+}
+
+// legacyFunctionCallID derives the tool use ID of an assistant function_call in history.
+// Legacy function calls carry no ID, so the message index keeps IDs unique per request
+// and lets the following function message reference its call.
+func legacyFunctionCallID(msgIndex int) string {
+	return fmt.Sprintf("call_function_%d", msgIndex)
+}
+
+// fromChatCompletionRequestFunctionMessage converts an OpenAI function message to an Anthropic
+// tool result for the function call with the given tool use ID.
+func fromChatCompletionRequestFunctionMessage(
+	msg types.ChatCompletionRequestFunctionMessage,
+	toolUseID string,
+) *anthropic.MessageParam {
+	// Like tool messages, function messages are never skipped, even if empty (see
+	// fromChatCompletionRequestToolMessage)
+	var content string
+	if msg.Content != nil {
+		content = *msg.Content
+	}
+
+	msgParam := anthropic.NewUserMessage(anthropic.NewToolResultBlock(toolUseID, content, false))
+	return &msgParam
+}
+
+// toLegacyFunctionCallResponse rewrites tool calls of a response to the deprecated
+// function_call shape. Only the first tool call is kept; requests using functions
+// disable parallel tool use, so the model generates at most one.
+func toLegacyFunctionCallResponse(resp *openaiadapter.CreateChatCompletionResponse) error {
+	for i := range resp.Choices {
+		choice := &resp.Choices[i]
+		if choice.Message.ToolCalls == nil || len(*choice.Message.ToolCalls) == 0 {
+			continue
+		}
+
+		toolCall, err := (*choice.Message.ToolCalls)[0].AsChatCompletionMessageToolCall()
+		if err != nil {
+			return fmt.Errorf("extract tool call for function_call: %w", err)
+		}
+		choice.Message.FunctionCall = &struct {
+			Arguments string `json:"arguments"`
+			Name      string `json:"name"`
+		}{
+			Arguments: toolCall.Function.Arguments,
+			Name:      toolCall.Function.Name,
+		}
+		choice.Message.ToolCalls = nil
+
+		if choice.FinishReason == types.CreateChatCompletionResponseChoiceFinishReasonToolCalls {
+			choice.FinishReason = types.CreateChatCompletionResponseChoiceFinishReasonFunctionCall
+		}
+	}
+	return nil
+}
+
+// toLegacyFunctionCallChunk rewrites tool call deltas of a chunk to the deprecated
+// function_call shape (see toLegacyFunctionCallResponse).
+func toLegacyFunctionCallChunk(chunk *openaiadapter.CreateChatCompletionChunk) error {
+	for i := range chunk.Choices {
+		choice := &chunk.Choices[i]
+
+		if choice.FinishReason != nil && *choice.FinishReason == types.CreateChatCompletionStreamResponseChoiceFinishReasonToolCalls {
+			finishReason := types.CreateChatCompletionStreamResponseChoiceFinishReasonFunctionCall
+			choice.FinishReason = &finishReason
+		}
+
+		if choice.Delta.ToolCalls == nil {
+			continue
+		}
+		toolCalls := *choice.Delta.ToolCalls
+		choice.Delta.ToolCalls = nil
+
+		for _, item := range toolCalls {
+			toolCall, err := item.AsChatCompletionMessageToolCallChunk()
+			if err != nil {
+				return fmt.Errorf("extract tool call chunk for function_call: %w", err)
+			}
+			if toolCall.Index != 0 || toolCall.Function == nil {
+				continue
+			}
+			choice.Delta.FunctionCall = &struct {
+				Arguments *string `json:"arguments,omitempty"`
+				Name      *string `json:"name,omitempty"`
+			}{
+				Arguments: toolCall.Function.Arguments,
+				Name:      toolCall.Function.Name,
+			}
+		}
+	}
+	return nil
+}
@@ -17,18 +17,7 @@ func buildGenerationParams(
 	params := anthropic.MessageNewParams{
 		Model: anthropic.Model(clientReq.Model),
 	}
-
-	// MaxTokens is required in Anthropic API
-	if clientReq.MaxCompletionTokens != nil {
-		params.MaxTokens = int64(*clientReq.MaxCompletionTokens)
-		//lint:ignore SA1019 Support for deprecated max_tokens field required for backward compatibility
-	} else if clientReq.MaxTokens != nil { //nolint:staticcheck // Support deprecated max_tokens for backward compatibility
-		params.MaxTokens = int64(*clientReq.MaxTokens) //nolint:staticcheck // Support deprecated max_tokens for backward compatibility
-	} else {
-		// Default to 8K tokens (reasonable for most use cases)
-		// Users needing more can specify explicitly via max_completion_tokens
-		params.MaxTokens = 8192
-	}
+	model := lookupModel(clientReq.Model)
 
 	// Sampling parameters
 	// Convert via string to avoid float32->float64 precision issues (0.7 -> "0.7" -> 0.7)
@@ -74,6 +63,23 @@ func buildGenerationParams(
 		params.ToolChoice = toolChoice
 	}
 
+	// Functions transformation: OpenAI's deprecated functions/function_call map to Anthropic
+	// tools and tool choice like their tools/tool_choice successors.
+	if clientReq.Functions != nil {
+		functionTools, err := fromChatCompletionFunctions(*clientReq.Functions)
+		if err != nil {
+			return params, fmt.Errorf("transform functions: %w", err)
+		}
+		params.Tools = append(params.Tools, functionTools...)
+	}
+	if clientReq.FunctionCall != nil && clientReq.ToolChoice == nil {
+		toolChoice, err := fromFunctionCallOption(clientReq.FunctionCall)
+		if err != nil {
+			return params, newInvalidRequestError("transform function_call: %s", err)
+		}
+		params.ToolChoice = toolChoice
+	}
+
 	// OpenAI user tracking fields to Anthropic's Metadata.UserID
 	// SafetyIdentifier takes precedence over deprecated User field
 	if clientReq.SafetyIdentifier != nil {
@@ -87,12 +93,17 @@ func buildGenerationParams(
 	}
 
 	// Build thinking configuration from reasoning effort and extra_body overrides
-	thinking, err := buildThinking(clientReq)
+	thinking, thinkingParam, err := buildThinking(clientReq, model)
 	if err != nil {
 		return params, fmt.Errorf("build thinking config: %w", err)
 	}
 	params.Thinking = thinking
 
+	// MaxTokens is required in Anthropic API and must leave room for the thinking budget
+	if err := sizeOutput(&params, clientReq, model, thinkingParam); err != nil {
+		return params, err
+	}
+
 	// ServiceTier transformation: Map OpenAI tiers to Anthropic equivalents
 	if clientReq.ServiceTier != nil {
 		// Map "auto" and "default" to Anthropic's "auto"
@@ -112,8 +123,8 @@ func buildGenerationParams(
 	// parameters - only temperature and top_p for sampling control.
 
 	// N (candidate count) transformation: OpenAI's N parameter generates multiple independent
-	// completions. Anthropic API does not support multiple candidates per request.
-	// This is a semantic incompatibility.
+	// completions. Anthropic API does not support multiple candidates per request, so the
+	// adapter issues one request per candidate (see candidateCount).
 
 	// Seed transformation: OpenAI's Seed enables deterministic outputs. Anthropic API
 	// does not have equivalent seed-based determinism controls.
@@ -161,15 +172,18 @@ func buildGenerationParams(
 		}
 	}
 
-	// WebSearchOptions transformation: OpenAI's WebSearchOptions enables web search via client
-	// request parameter. Anthropic supports web search via server tools (WebSearchTool20250305)
-	// that return ServerToolUseBlock and WebSearchResultBlock content types in responses.
-	// These server-side tool blocks cannot be mapped to OpenAI's response format, which only
-	// supports client-side tool calls. In multi-turn conversations, when the client sends
-	// previous assistant messages back in history, we cannot reconstruct the original
-	// ServerToolUseBlock/WebSearchResultBlock content - breaking conversation continuity.
-	// This is an architectural incompatibility between server-side tools (Anthropic) and
-	// client-side only tools (OpenAI).
+	// Legacy function_call responses hold a single call, so parallel tool use is disabled
+	if usesLegacyFunctions(clientReq) {
+		disableParallelToolUse(&params.ToolChoice)
+	}
+
+	// WebSearchOptions transformation: OpenAI's WebSearchOptions maps to Anthropic's web search
+	// server tool. Server tool blocks round-trip via server_tool_state (see buildServerTools).
+	serverTools, err := buildServerTools(clientReq)
+	if err != nil {
+		return params, err
+	}
+	params.Tools = append(params.Tools, serverTools...)
 
 	return params, nil
 }
@@ -0,0 +1,289 @@
+package anthropicclaude
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// HistoryMode selects how conversation histories Anthropic would reject are handled.
+type HistoryMode string
+
+const (
+	// HistoryModeOff sends histories as received, only merging consecutive tool messages
+	// into one user turn. Anthropic rejects malformed histories itself.
+	HistoryModeOff HistoryMode = "off"
+	// HistoryModeRepair normalizes such histories, e.g. by inserting error results for
+	// unanswered tool calls and merging consecutive turns of the same role.
+	HistoryModeRepair HistoryMode = "repair"
+	// HistoryModeStrict rejects such histories, naming the offending message.
+	HistoryModeStrict HistoryMode = "strict"
+)
+
+// missingToolResult is the content of results inserted for unanswered tool calls.
+const missingToolResult = "Error: no result was provided for this tool call."
+
+// transformMessages converts OpenAI messages to Anthropic system prompts and messages,
+// repairing or rejecting malformed histories according to mode.
+func transformMessages(
+	ctx context.Context,
+	messages []types.ChatCompletionRequestMessage,
+	mode HistoryMode,
+) ([]anthropic.TextBlockParam, []anthropic.MessageParam, error) {
+	transformed, err := fromChatCompletionRequestMessages(messages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transform messages: %w", err)
+	}
+	switch mode {
+	case HistoryModeRepair, HistoryModeStrict:
+		transformed, err = repairHistory(ctx, transformed, mode)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		transformed = mergeConsecutiveToolMessages(transformed)
+	}
+	systemPrompts, msgParams := hoistSystemPrompts(transformed)
+	return systemPrompts, msgParams, nil
+}
+
+// repairHistory establishes what Anthropic requires of a conversation: user and assistant
+// turns alternate, and the tool_use blocks of an assistant turn are answered by exactly
+// one tool_result each at the start of the following user turn.
+//
+// OpenAI clients send tool results as separate tool messages, which are merged with the
+// user turn they belong to in any mode. Beyond that, HistoryModeRepair drops empty
+// assistant messages and results of unknown tool calls, merges consecutive user or
+// assistant messages, and answers tool calls without results by error results. In
+// HistoryModeStrict, these cases are rejected instead. Every repair is logged.
+//
+// System and developer messages are returned first, in their original order, since
+// they are hoisted to the system prompt either way.
+func repairHistory(ctx context.Context, messages []transformedMessage, mode HistoryMode) ([]transformedMessage, error) {
+	strict := mode == HistoryModeStrict
+
+	var system, turns []transformedMessage
+	// Tool calls of the last assistant turn that haven't been answered yet
+	var pending []string
+	var pendingIndex int
+	// Role of the last message merged into the last turn
+	var lastRole string
+
+	// closePending answers pending tool calls by error results in the user turn following
+	// their assistant turn, which is added if missing.
+	closePending := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if strict {
+			return newHistoryError(pendingIndex, "tool_calls %s have no tool messages responding to them", strings.Join(pending, ", "))
+		}
+		logRepair(ctx, pendingIndex, "answered tool calls without results by error results", "tool_call_ids", pending)
+		results := make([]anthropic.ContentBlockParamUnion, 0, len(pending))
+		for _, id := range pending {
+			results = append(results, newMissingToolResult(id))
+		}
+		pending = nil
+		if last := len(turns) - 1; last >= 0 && turnRole(turns[last]) == anthropic.MessageParamRoleUser {
+			turns[last] = appendUserBlocks(turns[last], results)
+			return nil
+		}
+		turns = append(turns, appendUserBlocks(transformedMessage{Role: string(types.Tool), Index: pendingIndex}, results))
+		lastRole = string(types.Tool)
+		return nil
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case string(types.System), string(types.ChatCompletionRequestDeveloperMessageRoleDeveloper):
+			system = append(system, msg)
+			continue
+		}
+
+		msgParam, ok := msg.Content.(*anthropic.MessageParam)
+		if !ok || msgParam == nil || len(msgParam.Content) == 0 {
+			if strict {
+				return nil, newHistoryError(msg.Index, "%s message has no content", msg.Role)
+			}
+			logRepair(ctx, msg.Index, "dropped empty message", "role", msg.Role)
+			continue
+		}
+
+		if msgParam.Role == anthropic.MessageParamRoleAssistant {
+			if err := closePending(); err != nil {
+				return nil, err
+			}
+			pending = toolUseIDs(msgParam)
+			pendingIndex = msg.Index
+
+			last := len(turns) - 1
+			if last < 0 || turnRole(turns[last]) != anthropic.MessageParamRoleAssistant {
+				turns = append(turns, msg)
+				lastRole = msg.Role
+				continue
+			}
+			if strict {
+				return nil, newHistoryError(msg.Index, "assistant message follows another assistant message")
+			}
+			logRepair(ctx, msg.Index, "merged consecutive assistant messages")
+			// Tool calls of the earlier message were closed above, so all pending ones are ours
+			merged := anthropic.NewAssistantMessage(slices.Concat(turns[last].Content.(*anthropic.MessageParam).Content, msgParam.Content)...)
+			turns[last].Content = &merged
+			continue
+		}
+
+		// Keep only results of pending tool calls, each answered once
+		blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msgParam.Content))
+		for _, block := range msgParam.Content {
+			if result := block.OfToolResult; result != nil {
+				i := slices.Index(pending, result.ToolUseID)
+				if i < 0 {
+					if strict {
+						return nil, newHistoryError(msg.Index, "tool_call_id %s does not respond to a tool call of the preceding assistant message", result.ToolUseID)
+					}
+					logRepair(ctx, msg.Index, "dropped result of unknown tool call", "tool_call_id", result.ToolUseID)
+					continue
+				}
+				pending = slices.Delete(pending, i, i+1)
+			}
+			blocks = append(blocks, block)
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		last := len(turns) - 1
+		if last < 0 || turnRole(turns[last]) != anthropic.MessageParamRoleUser {
+			turns = append(turns, appendUserBlocks(transformedMessage{Role: msg.Role, Index: msg.Index}, blocks))
+			lastRole = msg.Role
+			continue
+		}
+		if msg.Role == string(types.User) && lastRole == string(types.User) {
+			if strict {
+				return nil, newHistoryError(msg.Index, "user message follows another user message")
+			}
+			logRepair(ctx, msg.Index, "merged consecutive user messages")
+		}
+		turns[last] = appendUserBlocks(turns[last], blocks)
+		lastRole = msg.Role
+	}
+
+	// A trailing assistant turn with tool calls can't be continued without their results
+	if err := closePending(); err != nil {
+		return nil, err
+	}
+
+	return append(system, turns...), nil
+}
+
+// logRepair logs a change repairHistory made to the message at index.
+func logRepair(ctx context.Context, index int, repair string, args ...any) {
+	slog.InfoContext(ctx, "repaired conversation history", slices.Concat([]any{"message_index", index, "repair", repair}, args)...)
+}
+
+// mergeConsecutiveToolMessages combines consecutive tool messages into single user messages
+// and drops empty assistant messages, which is all HistoryModeOff does. Tool results are
+// sent as user messages containing tool_result blocks, one turn per assistant turn.
+func mergeConsecutiveToolMessages(messages []transformedMessage) []transformedMessage {
+	var result []transformedMessage
+	var accumulatedToolBlocks []anthropic.ContentBlockParamUnion
+
+	flushToolBlocks := func() {
+		if len(accumulatedToolBlocks) > 0 {
+			mergedMsg := anthropic.NewUserMessage(accumulatedToolBlocks...)
+			result = append(result, transformedMessage{
+				Role:    string(types.Tool),
+				Content: &mergedMsg,
+			})
+			accumulatedToolBlocks = nil
+		}
+	}
+
+	for _, msg := range messages {
+		msgParam, isMessage := msg.Content.(*anthropic.MessageParam)
+		if isMessage && msgParam == nil {
+			continue
+		}
+		if msg.Role == string(types.Tool) {
+			// Accumulate tool blocks
+			if isMessage {
+				accumulatedToolBlocks = append(accumulatedToolBlocks, msgParam.Content...)
+			}
+		} else {
+			// Non-tool message: flush any accumulated tool blocks, then add this message
+			flushToolBlocks()
+			result = append(result, msg)
+		}
+	}
+
+	flushToolBlocks()
+
+	return result
+}
+
+// appendUserBlocks returns turn with blocks appended to its user message, keeping tool
+// results at the start as Anthropic requires.
+func appendUserBlocks(turn transformedMessage, blocks []anthropic.ContentBlockParamUnion) transformedMessage {
+	var existing []anthropic.ContentBlockParamUnion
+	if msgParam, ok := turn.Content.(*anthropic.MessageParam); ok {
+		existing = msgParam.Content
+	}
+
+	var results, other []anthropic.ContentBlockParamUnion
+	for _, block := range slices.Concat(existing, blocks) {
+		if block.OfToolResult != nil {
+			results = append(results, block)
+		} else {
+			other = append(other, block)
+		}
+	}
+
+	merged := anthropic.NewUserMessage(slices.Concat(results, other)...)
+	turn.Content = &merged
+	if len(results) > 0 {
+		turn.Role = string(types.Tool)
+	}
+	return turn
+}
+
+// turnRole returns the Anthropic role of a conversation turn.
+func turnRole(turn transformedMessage) anthropic.MessageParamRole {
+	if msgParam, ok := turn.Content.(*anthropic.MessageParam); ok {
+		return msgParam.Role
+	}
+	return ""
+}
+
+// toolUseIDs returns the IDs of the tool calls in an assistant message.
+func toolUseIDs(msgParam *anthropic.MessageParam) []string {
+	var ids []string
+	for _, block := range msgParam.Content {
+		if toolUse := block.OfToolUse; toolUse != nil {
+			ids = append(ids, toolUse.ID)
+		}
+	}
+	return ids
+}
+
+// newMissingToolResult returns an error result for a tool call the client didn't answer.
+func newMissingToolResult(toolUseID string) anthropic.ContentBlockParamUnion {
+	return anthropic.ContentBlockParamUnion{OfToolResult: &anthropic.ToolResultBlockParam{
+		ToolUseID: toolUseID,
+		Content: []anthropic.ToolResultBlockParamContentUnion{
+			{OfText: &anthropic.TextBlockParam{Text: missingToolResult}},
+		},
+		IsError: anthropic.Bool(true),
+	}}
+}
+
+// newHistoryError rejects a malformed history in strict mode, naming the offending message
+// the way OpenAI names request parameters.
+func newHistoryError(index int, format string, args ...any) error {
+	return newInvalidParamError(fmt.Sprintf("messages.[%d]", index), "messages.[%d]: %s", index, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,205 @@
+package anthropicclaude_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// newHistoryRequest returns a request with the given messages, a JSON array.
+func newHistoryRequest(t *testing.T, messages string) types.CreateChatCompletionRequest {
+	t.Helper()
+	var req types.CreateChatCompletionRequest
+	if err := json.Unmarshal([]byte(`{"model":"claude-sonnet-4-0","messages":`+messages+`}`), &req); err != nil {
+		t.Fatalf("Failed to parse request: %v", err)
+	}
+	return req
+}
+
+const (
+	lookupCall    = `{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}`
+	lookupUse     = `{"type":"tool_use","id":"call_1","name":"lookup","input":{}}`
+	lookupMissing = `{"type":"tool_result","tool_use_id":"call_1","is_error":true,"content":[{"type":"text","text":"Error: no result was provided for this tool call."}]}`
+)
+
+func TestCreateChatCompletionAdapter_HistoryRepair(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		messages  string
+		want      string
+		wantParam string
+	}{
+		{
+			name: "tool call without result",
+			messages: `[
+				{"role":"user","content":"Look it up."},
+				{"role":"assistant","content":null,"tool_calls":[` + lookupCall + `]},
+				{"role":"user","content":"Never mind."}
+			]`,
+			want: `[
+				{"role":"user","content":[{"type":"text","text":"Look it up."}]},
+				{"role":"assistant","content":[` + lookupUse + `]},
+				{"role":"user","content":[` + lookupMissing + `,{"type":"text","text":"Never mind."}]}
+			]`,
+			wantParam: "messages.[1]",
+		},
+		{
+			name: "result of unknown tool call",
+			messages: `[
+				{"role":"user","content":"Look it up."},
+				{"role":"assistant","content":null,"tool_calls":[` + lookupCall + `]},
+				{"role":"tool","tool_call_id":"call_1","content":"42"},
+				{"role":"tool","tool_call_id":"call_9","content":"stale"},
+				{"role":"assistant","content":"It is 42."}
+			]`,
+			want: `[
+				{"role":"user","content":[{"type":"text","text":"Look it up."}]},
+				{"role":"assistant","content":[` + lookupUse + `]},
+				{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","is_error":false,"content":[{"type":"text","text":"42"}]}]},
+				{"role":"assistant","content":[{"type":"text","text":"It is 42."}]}
+			]`,
+			wantParam: "messages.[3]",
+		},
+		{
+			name: "empty assistant message",
+			messages: `[
+				{"role":"user","content":"Hi"},
+				{"role":"assistant","content":""},
+				{"role":"assistant","content":"Hello!"},
+				{"role":"user","content":"Bye"}
+			]`,
+			want: `[
+				{"role":"user","content":[{"type":"text","text":"Hi"}]},
+				{"role":"assistant","content":[{"type":"text","text":"Hello!"}]},
+				{"role":"user","content":[{"type":"text","text":"Bye"}]}
+			]`,
+			wantParam: "messages.[1]",
+		},
+		{
+			name: "consecutive user messages",
+			messages: `[
+				{"role":"user","content":"Hi"},
+				{"role":"system","content":"Be brief."},
+				{"role":"user","content":"Are you there?"}
+			]`,
+			want: `[
+				{"role":"user","content":[{"type":"text","text":"Hi"},{"type":"text","text":"Are you there?"}]}
+			]`,
+			wantParam: "messages.[2]",
+		},
+		{
+			name: "trailing tool calls",
+			messages: `[
+				{"role":"user","content":"Look it up."},
+				{"role":"assistant","content":"Looking.","tool_calls":[` + lookupCall + `]}
+			]`,
+			want: `[
+				{"role":"user","content":[{"type":"text","text":"Look it up."}]},
+				{"role":"assistant","content":[{"type":"text","text":"Looking."},` + lookupUse + `]},
+				{"role":"user","content":[` + lookupMissing + `]}
+			]`,
+			wantParam: "messages.[1]",
+		},
+		{
+			name: "tool results merged with user message",
+			messages: `[
+				{"role":"user","content":"Look it up."},
+				{"role":"assistant","content":null,"tool_calls":[` + lookupCall + `]},
+				{"role":"tool","tool_call_id":"call_1","content":"42"},
+				{"role":"user","content":"Thanks!"}
+			]`,
+			want: `[
+				{"role":"user","content":[{"type":"text","text":"Look it up."}]},
+				{"role":"assistant","content":[` + lookupUse + `]},
+				{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","is_error":false,"content":[{"type":"text","text":"42"}]},{"type":"text","text":"Thanks!"}]}
+			]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/repair", func(t *testing.T) {
+			t.Parallel()
+			transport := &sequenceTransport{responses: []string{newMessageResponse("OK", "end_turn", 10, 1)}}
+			adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithHistoryMode(anthropicclaude.HistoryModeRepair))
+
+			if _, err := adapter.ProcessRequest(context.Background(), newHistoryRequest(t, tt.messages), transport); err != nil {
+				t.Fatalf("ProcessRequest failed: %v", err)
+			}
+			_, messages := upstreamRequest(t, transport.bodies[0])
+			got, err := json.Marshal(messages)
+			if err != nil {
+				t.Fatalf("Failed to marshal messages: %v", err)
+			}
+			assertJSONEqual(t, string(got), tt.want)
+		})
+
+		t.Run(tt.name+"/strict", func(t *testing.T) {
+			t.Parallel()
+			transport := &sequenceTransport{responses: []string{newMessageResponse("OK", "end_turn", 10, 1)}}
+			adapter := anthropicclaude.NewCreateChatCompletionAdapter(anthropicclaude.WithHistoryMode(anthropicclaude.HistoryModeStrict))
+
+			_, err := adapter.ProcessRequest(context.Background(), newHistoryRequest(t, tt.messages), transport)
+			if tt.wantParam == "" {
+				if err != nil {
+					t.Fatalf("ProcessRequest failed: %v", err)
+				}
+				return
+			}
+
+			var errResp *types.ErrorResponse
+			if !errors.As(err, &errResp) {
+				t.Fatalf("Expected ErrorResponse, got %v", err)
+			}
+			if errResp.Err.Param == nil || *errResp.Err.Param != tt.wantParam || !strings.HasPrefix(errResp.Err.Message, tt.wantParam) {
+				t.Errorf("Expected error naming %s, got %+v", tt.wantParam, errResp.Err)
+			}
+			if len(transport.bodies) != 0 {
+				t.Errorf("Expected no upstream request, got %d", len(transport.bodies))
+			}
+		})
+	}
+}
+
+func TestCreateChatCompletionAdapter_HistoryOff(t *testing.T) {
+	t.Parallel()
+
+	// Only consecutive tool messages are merged; everything else is left to Anthropic
+	messages := `[
+		{"role":"user","content":"Look it up."},
+		{"role":"assistant","content":"","tool_calls":[` + lookupCall + `,{"id":"call_2","type":"function","function":{"name":"lookup","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"42"},
+		{"role":"tool","tool_call_id":"call_9","content":"stale"},
+		{"role":"user","content":"Thanks!"},
+		{"role":"assistant","content":""},
+		{"role":"user","content":"Bye"}
+	]`
+	want := `[
+		{"role":"user","content":[{"type":"text","text":"Look it up."}]},
+		{"role":"assistant","content":[` + lookupUse + `,{"type":"tool_use","id":"call_2","name":"lookup","input":{}}]},
+		{"role":"user","content":[
+			{"type":"tool_result","tool_use_id":"call_1","is_error":false,"content":[{"type":"text","text":"42"}]},
+			{"type":"tool_result","tool_use_id":"call_9","is_error":false,"content":[{"type":"text","text":"stale"}]}
+		]},
+		{"role":"user","content":[{"type":"text","text":"Thanks!"}]},
+		{"role":"user","content":[{"type":"text","text":"Bye"}]}
+	]`
+
+	transport := &sequenceTransport{responses: []string{newMessageResponse("OK", "end_turn", 10, 1)}}
+	adapter := anthropicclaude.NewCreateChatCompletionAdapter()
+	if _, err := adapter.ProcessRequest(context.Background(), newHistoryRequest(t, messages), transport); err != nil {
+		t.Fatalf("ProcessRequest failed: %v", err)
+	}
+	_, got := upstreamRequest(t, transport.bodies[0])
+	encoded, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("Failed to marshal messages: %v", err)
+	}
+	assertJSONEqual(t, string(encoded), want)
+}
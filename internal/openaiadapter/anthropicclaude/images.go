@@ -0,0 +1,161 @@
+package anthropicclaude
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+
+	// Decoders for image.Decode; formats Anthropic rejects (BMP, TIFF) are transcoded
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// Anthropic image limits, see https://docs.claude.com/en/docs/build-with-claude/vision
+const (
+	// maxImageBytes is the maximum size of a single image, measured base64 encoded.
+	maxImageBytes = 5 << 20
+
+	// maxImageEdge is the longest edge Anthropic accepts; larger images are rejected.
+	maxImageEdge = 8000
+
+	// maxDecodedImagePixels bounds images decoded for transcoding or downscaling. Decoding
+	// allocates all pixels up front, so a few KB of compressed data declaring huge dimensions
+	// would otherwise allocate gigabytes.
+	maxDecodedImagePixels = 40_000_000
+
+	// lowDetailImageEdge matches OpenAI's low detail mode (512x512).
+	lowDetailImageEdge = 512
+
+	// jpegQuality balances size and fidelity for transcoded images.
+	jpegQuality = 85
+)
+
+// supportedImageTypes are the media types Anthropic accepts for image blocks.
+var supportedImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// preprocessImage prepares image data for Anthropic so invalid images fail before upload.
+//
+// Pipeline:
+//   - Type: sniffed from content since clients frequently declare the wrong type
+//   - Format: formats Anthropic rejects (BMP, TIFF, ...) are transcoded to PNG or JPEG
+//   - Size: images above Anthropic's pixel or byte limits are downscaled; images too large
+//     to decode safely (see maxDecodedImagePixels) are rejected
+//   - Detail: detail "low" downscales to 512px on the longest edge like OpenAI
+//
+// Images already within limits are returned unchanged to avoid lossy re-encoding.
+func preprocessImage(
+	data []byte,
+	declaredType string,
+	detail *types.ChatCompletionRequestMessageContentPartImageImageUrlDetail,
+) (mediaType string, processed []byte, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("unsupported or corrupt image (declared %s): %w", declaredType, err)
+	}
+	mediaType = detectMIMEType(data, declaredType, "", "image/"+format)
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = "image/" + format
+	}
+
+	maxEdge := maxImageEdge
+	if detail != nil && *detail == types.ChatCompletionRequestMessageContentPartImageImageUrlDetailLow {
+		maxEdge = lowDetailImageEdge
+	}
+
+	if slices.Contains(supportedImageTypes, mediaType) && max(config.Width, config.Height) <= maxEdge && fitsImageLimit(data) {
+		return mediaType, data, nil
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxDecodedImagePixels {
+		return "", nil, newInvalidRequestError("image of %dx%d pixels exceeds the limit of %d pixels",
+			config.Width, config.Height, maxDecodedImagePixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("decode %s image: %w", mediaType, err)
+	}
+
+	// Photos stay JPEG; everything else becomes lossless PNG unless that is too large
+	preferJPEG := mediaType == "image/jpeg"
+	for {
+		img = downscaleImage(img, maxEdge)
+
+		mediaType, processed, err = encodeImage(img, preferJPEG)
+		if err != nil {
+			return "", nil, err
+		}
+		if fitsImageLimit(processed) {
+			return mediaType, processed, nil
+		}
+		if !preferJPEG && isOpaque(img) {
+			// Lossy encoding usually fits before any resolution has to be sacrificed
+			preferJPEG = true
+			continue
+		}
+
+		// Still too large: trade resolution for size
+		bounds := img.Bounds()
+		maxEdge = max(bounds.Dx(), bounds.Dy()) * 3 / 4
+		if maxEdge < 1 {
+			return "", nil, fmt.Errorf("image exceeds %d bytes", maxImageBytes)
+		}
+	}
+}
+
+// fitsImageLimit reports whether data stays within maxImageBytes once base64 encoded.
+func fitsImageLimit(data []byte) bool {
+	return base64.StdEncoding.EncodedLen(len(data)) <= maxImageBytes
+}
+
+// downscaleImage scales img down so its longest edge is at most maxEdge, keeping the aspect ratio.
+func downscaleImage(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	longest := max(width, height)
+	if longest <= maxEdge {
+		return img
+	}
+
+	scaledWidth := max(1, width*maxEdge/longest)
+	scaledHeight := max(1, height*maxEdge/longest)
+	scaled := image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// encodeImage encodes img as JPEG or PNG and returns the resulting media type.
+func encodeImage(img image.Image, asJPEG bool) (string, []byte, error) {
+	var buf bytes.Buffer
+	if asJPEG {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return "", nil, fmt.Errorf("encode jpeg: %w", err)
+		}
+		return "image/jpeg", buf.Bytes(), nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return "", nil, fmt.Errorf("encode png: %w", err)
+	}
+	return "image/png", buf.Bytes(), nil
+}
+
+// isOpaque reports whether img has no transparent pixels, so JPEG loses nothing but detail.
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package anthropicclaude
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// newPNGDeclaring returns a valid 1x1 PNG whose header declares the given dimensions.
+func newPNGDeclaring(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Signature (8 bytes), IHDR length (4) and type (4), then width and height
+	binary.BigEndian.PutUint32(data[16:20], width)
+	binary.BigEndian.PutUint32(data[20:24], height)
+	// IHDR data is 13 bytes, followed by the CRC over type and data
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestPreprocessImage_DecodedPixelLimit(t *testing.T) {
+	t.Parallel()
+
+	data := newPNGDeclaring(t, 30000, 30000)
+	if config, err := png.DecodeConfig(bytes.NewReader(data)); err != nil || config.Width != 30000 {
+		t.Fatalf("Expected PNG declaring 30000px, got %+v: %v", config, err)
+	}
+
+	_, _, err := preprocessImage(data, "image/png", nil)
+	var errResp *types.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Err.Type != "invalid_request_error" {
+		t.Fatalf("Expected invalid_request_error, got: %v", err)
+	}
+}
+
+func TestPreprocessImage_WithinLimits(t *testing.T) {
+	t.Parallel()
+
+	data := newPNGDeclaring(t, 1, 1)
+	mediaType, processed, err := preprocessImage(data, "image/jpeg", nil)
+	if err != nil {
+		t.Fatalf("Failed to preprocess image: %v", err)
+	}
+	if mediaType != "image/png" || !bytes.Equal(processed, data) {
+		t.Errorf("Expected image passed through as image/png, got %s", mediaType)
+	}
+}
@@ -122,7 +122,7 @@ func fromAssistantMessageContentParts(parts []types.ChatCompletionRequestAssista
 }
 
 // fromToolMessageContentParts converts tool message content parts to Anthropic content blocks.
-// Tool messages support: text only.
+// Tool messages support: text, images, files.
 func fromToolMessageContentParts(parts []types.ChatCompletionRequestToolMessageContentPart) ([]anthropic.ContentBlockParamUnion, error) {
 	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(parts))
 	for i, partUnion := range parts {
@@ -139,6 +139,28 @@ func fromToolMessageContentParts(parts []types.ChatCompletionRequestToolMessageC
 			}
 			blocks = append(blocks, fromChatCompletionRequestMessageContentPartText(textPart))
 
+		case string(types.ImageUrl):
+			imagePart, err := partUnion.AsChatCompletionRequestMessageContentPartImage()
+			if err != nil {
+				return nil, fmt.Errorf("extract image from tool content part %d: %w", i, err)
+			}
+			block, err := fromChatCompletionRequestMessageContentPartImage(imagePart)
+			if err != nil {
+				return nil, fmt.Errorf("transform image in tool content part %d: %w", i, err)
+			}
+			blocks = append(blocks, block)
+
+		case string(types.File):
+			filePart, err := partUnion.AsChatCompletionRequestMessageContentPartFile()
+			if err != nil {
+				return nil, fmt.Errorf("extract file from tool content part %d: %w", i, err)
+			}
+			block, err := fromChatCompletionRequestMessageContentPartFile(filePart)
+			if err != nil {
+				return nil, fmt.Errorf("transform file in tool content part %d: %w", i, err)
+			}
+			blocks = append(blocks, block)
+
 		default:
 			return nil, fmt.Errorf("content part type %s not supported in tool messages", discriminator)
 		}
@@ -208,12 +230,12 @@ func fromChatCompletionRequestMessageContentPartRefusal(refusalPart types.ChatCo
 }
 
 // fromChatCompletionRequestMessageContentPartImage converts OpenAI image content to Anthropic format.
+// Inline images pass through the preprocessing pipeline (see preprocessImage), which also
+// applies imagePart.ImageUrl.Detail since Anthropic has no detail level control.
+// Remote URLs are passed through for Anthropic to fetch.
 func fromChatCompletionRequestMessageContentPartImage(imagePart types.ChatCompletionRequestMessageContentPartImage) (anthropic.ContentBlockParamUnion, error) {
 	imageURL := imagePart.ImageUrl.Url
 
-	// Ignore imagePart.ImageUrl.Detail ("low"/"high"/"auto") because Anthropic
-	// doesn't have equivalent detail level control in API
-
 	if strings.HasPrefix(imageURL, "data:") {
 		// Parse data URL format: data:mime/type;base64,<data>
 		parts := strings.Split(imageURL, ",")
@@ -221,7 +243,7 @@ func fromChatCompletionRequestMessageContentPartImage(imagePart types.ChatComple
 			return anthropic.ContentBlockParamUnion{}, fmt.Errorf("invalid data URL format, expected data:mime/type;base64,data")
 		}
 
-		// Extract media type from data URL prefix
+		// Extract declared media type from data URL prefix (verified by content sniffing)
 		var mediaType string
 		if after, found := strings.CutPrefix(parts[0], "data:"); found {
 			if mimeType, _, _ := strings.Cut(after, ";"); mimeType != "" {
@@ -232,15 +254,12 @@ func fromChatCompletionRequestMessageContentPartImage(imagePart types.ChatComple
 			mediaType = "image/jpeg"
 		}
 
-		// Data is already base64 encoded in the data URL
-		encodedData := parts[1]
-
-		// Validate it's valid base64
-		if _, err := base64.StdEncoding.DecodeString(encodedData); err != nil {
+		decodedImage, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
 			return anthropic.ContentBlockParamUnion{}, fmt.Errorf("invalid base64 image data: %w", err)
 		}
 
-		return anthropic.NewImageBlockBase64(mediaType, encodedData), nil
+		return newImageBlock(decodedImage, mediaType, imagePart.ImageUrl.Detail)
 	} else if strings.HasPrefix(imageURL, "http://") || strings.HasPrefix(imageURL, "https://") {
 		return anthropic.NewImageBlock(anthropic.URLImageSourceParam{
 			URL: imageURL,
@@ -250,14 +269,28 @@ func fromChatCompletionRequestMessageContentPartImage(imagePart types.ChatComple
 	}
 }
 
-// fromChatCompletionRequestMessageContentPartFile converts OpenAI file content to Anthropic DocumentBlockParam.
-// Supports inline base64 file data (file_data field). File ID references (file_id) are not supported
-// as they would require a separate file storage/upload system.
+// newImageBlock preprocesses decoded image data and wraps it in a base64 image block.
+func newImageBlock(
+	data []byte,
+	declaredType string,
+	detail *types.ChatCompletionRequestMessageContentPartImageImageUrlDetail,
+) (anthropic.ContentBlockParamUnion, error) {
+	mediaType, processed, err := preprocessImage(data, declaredType, detail)
+	if err != nil {
+		return anthropic.ContentBlockParamUnion{}, err
+	}
+	return anthropic.NewImageBlockBase64(mediaType, base64.StdEncoding.EncodeToString(processed)), nil
+}
+
+// fromChatCompletionRequestMessageContentPartFile converts OpenAI file content to Anthropic DocumentBlockParam,
+// or ImageBlockParam for image files.
+// Supports inline base64 file data (file_data field). File ID references (file_id) must be resolved
+// to file_data beforehand (see resolveContentReferences).
 func fromChatCompletionRequestMessageContentPartFile(filePart types.ChatCompletionRequestMessageContentPartFile) (anthropic.ContentBlockParamUnion, error) {
 	file := filePart.File
 
 	if file.FileId != nil && *file.FileId != "" {
-		return anthropic.ContentBlockParamUnion{}, fmt.Errorf("file_id references not supported (requires file upload system), only inline file_data is supported")
+		return anthropic.ContentBlockParamUnion{}, fmt.Errorf("file_id references not supported without file uploads, only inline file_data is supported")
 	}
 
 	if file.FileData == nil || *file.FileData == "" {
@@ -296,8 +329,12 @@ func fromChatCompletionRequestMessageContentPartFile(filePart types.ChatCompleti
 		}
 		return block, nil
 
+	} else if strings.HasPrefix(mimeType, "image/") {
+		// Image files (e.g. uploads with purpose "vision") are sent as images, not documents
+		return newImageBlock(decodedFile, mimeType, nil)
+
 	} else {
-		return anthropic.ContentBlockParamUnion{}, fmt.Errorf("unsupported file type: %s (only PDF and text files supported by Anthropic)", mimeType)
+		return anthropic.ContentBlockParamUnion{}, fmt.Errorf("unsupported file type: %s (only PDF, text and image files supported by Anthropic)", mimeType)
 	}
 }
 
@@ -17,7 +17,8 @@ import (
 // handle Anthropic's separate System field appropriately.
 type transformedMessage struct {
 	Role    string // Original OpenAI role (system, developer, user, assistant, tool)
-	Content any    // Either *anthropic.MessageParam OR *anthropic.TextBlockParam
+	Content any    // Either *anthropic.MessageParam OR *anthropic.TextBlockParam, nil for empty assistant messages
+	Index   int    // Index of the originating OpenAI message
 }
 
 // contentPartWithText is a generic constraint for OpenAI content part union types.
@@ -28,13 +29,17 @@ type contentPartWithText interface {
 
 // fromChatCompletionRequestMessages converts OpenAI messages to Anthropic format.
 // Returns transformedMessage structs preserving conversation order, with system/developer messages
-// as TextBlockParam and user/assistant/tool messages as MessageParam. The caller is responsible
-// for separating system blocks into Anthropic's System field while maintaining message ordering.
+// as TextBlockParam and user/assistant/tool messages as MessageParam. Messages are transformed
+// one by one; the caller merges or repairs turns according to the history mode and separates
+// system blocks into Anthropic's System field (see transformMessages).
 func fromChatCompletionRequestMessages(
 	messages []types.ChatCompletionRequestMessage,
 ) ([]transformedMessage, error) {
 	transformed := make([]transformedMessage, 0, len(messages))
 
+	// Legacy function messages answer the most recent assistant function_call
+	var functionCallID string
+
 	for msgIndex, msg := range messages {
 		role, err := msg.Discriminator()
 		if err != nil {
@@ -57,6 +62,7 @@ func fromChatCompletionRequestMessages(
 			transformed = append(transformed, transformedMessage{
 				Role:    string(types.System),
 				Content: textBlock,
+				Index:   msgIndex,
 			})
 
 		case string(types.ChatCompletionRequestDeveloperMessageRoleDeveloper):
@@ -74,6 +80,7 @@ func fromChatCompletionRequestMessages(
 			transformed = append(transformed, transformedMessage{
 				Role:    string(types.ChatCompletionRequestDeveloperMessageRoleDeveloper),
 				Content: textBlock,
+				Index:   msgIndex,
 			})
 
 		case string(types.User):
@@ -91,6 +98,7 @@ func fromChatCompletionRequestMessages(
 			transformed = append(transformed, transformedMessage{
 				Role:    string(types.User),
 				Content: msgParam,
+				Index:   msgIndex,
 			})
 
 		case string(types.ChatCompletionRequestAssistantMessageRoleAssistant):
@@ -102,12 +110,14 @@ func fromChatCompletionRequestMessages(
 			if err != nil {
 				return nil, err
 			}
-			if msgParam == nil {
-				continue
+			if assistMsg.FunctionCall != nil {
+				functionCallID = legacyFunctionCallID(msgIndex)
 			}
+			// Empty assistant messages are kept without content for transformMessages to handle
 			transformed = append(transformed, transformedMessage{
 				Role:    string(types.ChatCompletionRequestAssistantMessageRoleAssistant),
 				Content: msgParam,
+				Index:   msgIndex,
 			})
 
 		case string(types.Tool):
@@ -125,54 +135,31 @@ func fromChatCompletionRequestMessages(
 			transformed = append(transformed, transformedMessage{
 				Role:    string(types.Tool),
 				Content: msgParam,
+				Index:   msgIndex,
 			})
 
 		case string(types.ChatCompletionRequestFunctionMessageRoleFunction):
-			return nil, fmt.Errorf("function messages not supported (deprecated in OpenAI API, use tool messages instead)")
-
-		default:
-			return nil, fmt.Errorf("unknown message role %s at index %d", role, msgIndex)
-		}
-	}
-
-	// Merge consecutive tool messages to satisfy Anthropic's strict role alternation requirement
-	return mergeConsecutiveToolMessages(transformed), nil
-}
-
-// mergeConsecutiveToolMessages combines consecutive tool messages into single user messages.
-// Required because Anthropic enforces strict role alternation (no consecutive user messages),
-// and tool results are sent as user messages containing tool_result blocks.
-func mergeConsecutiveToolMessages(messages []transformedMessage) []transformedMessage {
-	var result []transformedMessage
-	var accumulatedToolBlocks []anthropic.ContentBlockParamUnion
-
-	flushToolBlocks := func() {
-		if len(accumulatedToolBlocks) > 0 {
-			mergedMsg := anthropic.NewUserMessage(accumulatedToolBlocks...)
-			result = append(result, transformedMessage{
+			funcMsg, err := msg.AsChatCompletionRequestFunctionMessage()
+			if err != nil {
+				return nil, fmt.Errorf("extract function message %d: %w", msgIndex, err)
+			}
+			if functionCallID == "" {
+				return nil, newInvalidRequestError("function message %d has no preceding assistant function_call", msgIndex)
+			}
+			// Transformed like tool messages, so consecutive results are merged the same way
+			transformed = append(transformed, transformedMessage{
 				Role:    string(types.Tool),
-				Content: &mergedMsg,
+				Content: fromChatCompletionRequestFunctionMessage(funcMsg, functionCallID),
+				Index:   msgIndex,
 			})
-			accumulatedToolBlocks = nil
-		}
-	}
+			functionCallID = ""
 
-	for _, msg := range messages {
-		if msg.Role == string(types.Tool) {
-			// Accumulate tool blocks
-			if msgParam, ok := msg.Content.(*anthropic.MessageParam); ok {
-				accumulatedToolBlocks = append(accumulatedToolBlocks, msgParam.Content...)
-			}
-		} else {
-			// Non-tool message: flush any accumulated tool blocks, then add this message
-			flushToolBlocks()
-			result = append(result, msg)
+		default:
+			return nil, fmt.Errorf("unknown message role %s at index %d", role, msgIndex)
 		}
 	}
 
-	flushToolBlocks()
-
-	return result
+	return transformed, nil
 }
 
 // fromChatCompletionRequestSystemMessage converts an OpenAI system message to Anthropic TextBlockParam.
@@ -248,7 +235,11 @@ func fromChatCompletionRequestUserMessage(msg types.ChatCompletionRequestUserMes
 func fromChatCompletionRequestAssistantMessage(msg types.ChatCompletionRequestAssistantMessage, msgIndex int) (*anthropic.MessageParam, error) {
 	var allBlocks []anthropic.ContentBlockParamUnion
 
-	if msg.Content != nil {
+	// ServerToolState transformation: restores the original text and server tool blocks
+	// (server_tool_use, web_search_tool_result, ...) that content alone can't represent.
+	if restored, ok := restoreServerToolBlocks(msg); ok {
+		allBlocks = append(allBlocks, restored...)
+	} else if msg.Content != nil {
 		var content any
 		if textContent, err := msg.Content.AsChatCompletionRequestAssistantMessageContent0(); err == nil {
 			content = textContent
@@ -291,13 +282,9 @@ func fromChatCompletionRequestAssistantMessage(msg types.ChatCompletionRequestAs
 					return nil, fmt.Errorf("extract function tool call for assistant message %d, tool call %d: %w", msgIndex, toolCallIdx, err)
 				}
 
-				// Anthropic expects structured input data, not JSON strings.
-				// Handle empty string case: json.Unmarshal fails on "" with "unexpected end of JSON input"
-				inputObj := make(map[string]any)
-				if args := strings.TrimSpace(toolCall.Function.Arguments); args != "" {
-					if err := json.Unmarshal([]byte(args), &inputObj); err != nil {
-						return nil, fmt.Errorf("unmarshal tool call arguments for assistant message %d, tool call %d: %w", msgIndex, toolCallIdx, err)
-					}
+				inputObj, err := toolUseInput(toolCall.Function.Arguments)
+				if err != nil {
+					return nil, fmt.Errorf("unmarshal tool call arguments for assistant message %d, tool call %d: %w", msgIndex, toolCallIdx, err)
 				}
 
 				toolUseBlock := anthropic.NewToolUseBlock(
@@ -307,14 +294,38 @@ func fromChatCompletionRequestAssistantMessage(msg types.ChatCompletionRequestAs
 				)
 				allBlocks = append(allBlocks, toolUseBlock)
 
+			case string(types.ChatCompletionMessageCustomToolCallTypeCustom):
+				toolCall, err := toolCallItem.AsChatCompletionMessageCustomToolCall()
+				if err != nil {
+					return nil, fmt.Errorf("extract custom tool call for assistant message %d, tool call %d: %w", msgIndex, toolCallIdx, err)
+				}
+
+				// Custom tools are emulated by function tools wrapping the raw input (see newCustomToolParam)
+				toolUseBlock := anthropic.NewToolUseBlock(
+					toolCall.Id,
+					customToolUseInput(toolCall.Custom.Input),
+					toolCall.Custom.Name,
+				)
+				allBlocks = append(allBlocks, toolUseBlock)
+
 			default:
 				return nil, fmt.Errorf("unsupported tool call type %s in assistant message %d, tool call %d", toolCallDiscriminator, msgIndex, toolCallIdx)
 			}
 		}
 	}
 
+	// FunctionCall transformation: OpenAI's deprecated function_call is a tool call without ID.
+	// The derived ID is referenced by the following function message.
 	if msg.FunctionCall != nil {
-		return nil, fmt.Errorf("function_call field not supported (deprecated in OpenAI API, use tool_calls instead)")
+		inputObj, err := toolUseInput(msg.FunctionCall.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal function_call arguments for assistant message %d: %w", msgIndex, err)
+		}
+		allBlocks = append(allBlocks, anthropic.NewToolUseBlock(
+			legacyFunctionCallID(msgIndex),
+			inputObj,
+			msg.FunctionCall.Name,
+		))
 	}
 
 	if len(allBlocks) == 0 {
@@ -325,22 +336,28 @@ func fromChatCompletionRequestAssistantMessage(msg types.ChatCompletionRequestAs
 	return &msgParam, nil
 }
 
+// toolUseInput parses OpenAI's JSON-encoded tool call arguments, since Anthropic expects
+// structured input data, not JSON strings.
+func toolUseInput(arguments string) (map[string]any, error) {
+	// Handle empty string case: json.Unmarshal fails on "" with "unexpected end of JSON input"
+	inputObj := make(map[string]any)
+	if args := strings.TrimSpace(arguments); args != "" {
+		if err := json.Unmarshal([]byte(args), &inputObj); err != nil {
+			return nil, err
+		}
+	}
+	return inputObj, nil
+}
+
 // fromChatCompletionRequestToolMessage converts an OpenAI tool message to Anthropic MessageParam.
 // Tool results must be in user messages according to Anthropic's alternating turn pattern.
 // Note: tool_call_id validation is performed server-side by Anthropic's API.
 func fromChatCompletionRequestToolMessage(msg types.ChatCompletionRequestToolMessage, msgIndex int) (*anthropic.MessageParam, error) {
-	var content any
-	if textContent, err := msg.Content.AsChatCompletionRequestToolMessageContent0(); err == nil {
-		content = textContent
-	} else if arrayContent, err := msg.Content.AsChatCompletionRequestToolMessageContent1(); err == nil {
-		content = arrayContent
-	} else {
-		return nil, fmt.Errorf("extract tool message %d content format: %w", msgIndex, err)
+	resultContent, err := fromToolMessageContent(msg.Content)
+	if err != nil {
+		return nil, fmt.Errorf("transform tool message %d content: %w", msgIndex, err)
 	}
 
-	// OpenAI schema currently only supports text in tool messages
-	resultText := textFromOpenAIContent(content)
-
 	// IMPORTANT: Unlike other message types, we NEVER skip tool messages, even if empty.
 	// Tool results can legitimately be empty (void functions, delete operations, etc.),
 	// and the tool_call_id is required to close the tool invocation loop with Anthropic.
@@ -349,9 +366,13 @@ func fromChatCompletionRequestToolMessage(msg types.ChatCompletionRequestToolMes
 	// is_error field limitation: OpenAI spec has no standard field to indicate tool execution errors.
 	// Anthropic supports is_error to distinguish successful vs failed tool executions, allowing
 	// Claude to retry with corrections. Without OpenAI equivalent, we always set false.
-	toolResultBlock := anthropic.NewToolResultBlock(msg.ToolCallId, resultText, false)
+	toolResultBlock := anthropic.ToolResultBlockParam{
+		ToolUseID: msg.ToolCallId,
+		Content:   resultContent,
+		IsError:   anthropic.Bool(false),
+	}
 
-	msgParam := anthropic.NewUserMessage(toolResultBlock)
+	msgParam := anthropic.NewUserMessage(anthropic.ContentBlockParamUnion{OfToolResult: &toolResultBlock})
 	return &msgParam, nil
 }
 
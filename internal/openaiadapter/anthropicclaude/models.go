@@ -0,0 +1,79 @@
+package anthropicclaude
+
+import (
+	"strings"
+)
+
+const (
+	// defaultMaxTokens is the output budget for requests without max_tokens, on top of the
+	// thinking budget if thinking is enabled.
+	defaultMaxTokens = 8192
+
+	// minThinkingBudget is the smallest thinking budget Anthropic accepts.
+	minThinkingBudget = 1024
+)
+
+// modelCapabilities describes the limits of a model that requests are sized against.
+type modelCapabilities struct {
+	// contextWindow is the total of input and output tokens.
+	contextWindow int64
+	// maxOutputTokens is the largest accepted max_tokens, including thinking.
+	maxOutputTokens int64
+	// thinking reports support for extended thinking.
+	thinking bool
+	// effortBudgets maps reasoning_effort levels to thinking budgets.
+	effortBudgets map[string]int64
+}
+
+// defaultEffortBudgets maps OpenAI's reasoning effort levels to thinking budgets.
+var defaultEffortBudgets = map[string]int64{
+	"low":    1024,
+	"medium": 8192,
+	"high":   24576,
+}
+
+// modelFamilies lists capabilities by model ID prefix, so dated IDs and aliases (e.g.
+// claude-sonnet-4-0) share an entry. More specific prefixes come first.
+var modelFamilies = []struct {
+	prefix       string
+	capabilities modelCapabilities
+}{
+	{"claude-opus-4-5", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 64_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-sonnet-4-5", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 64_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-haiku-4-5", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 64_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-opus-4-1", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 32_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-opus-4", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 32_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-sonnet-4", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 64_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-3-7-sonnet", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 64_000, thinking: true, effortBudgets: defaultEffortBudgets}},
+	{"claude-3-5-sonnet", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 8192}},
+	{"claude-3-5-haiku", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 8192}},
+	{"claude-3-opus", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 4096}},
+	{"claude-3-haiku", modelCapabilities{contextWindow: 200_000, maxOutputTokens: 4096}},
+}
+
+// lookupModel returns the capabilities of a model. Unknown models, e.g. ones released
+// after this table, report no limits and thinking support, leaving validation to Anthropic.
+func lookupModel(model string) modelCapabilities {
+	for _, family := range modelFamilies {
+		if strings.HasPrefix(model, family.prefix) {
+			return family.capabilities
+		}
+	}
+	return modelCapabilities{thinking: true, effortBudgets: defaultEffortBudgets}
+}
+
+// outputLimit returns the largest max_tokens the model accepts, or 0 if unknown.
+func (m modelCapabilities) outputLimit() int64 {
+	if m.maxOutputTokens == 0 {
+		return 0
+	}
+	return min(m.maxOutputTokens, m.contextWindow)
+}
+
+// clampMaxTokens lowers maxTokens to the model's output limit.
+func (m modelCapabilities) clampMaxTokens(maxTokens int64) int64 {
+	if limit := m.outputLimit(); limit > 0 && maxTokens > limit {
+		return limit
+	}
+	return maxTokens
+}
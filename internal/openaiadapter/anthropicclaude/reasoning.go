@@ -1,7 +1,6 @@
 package anthropicclaude
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -9,9 +8,16 @@ import (
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
 )
 
+// Thinking budget sources, reported as the param of errors about the budget.
+const (
+	paramReasoningEffort = "reasoning_effort"
+	paramBudgetTokens    = "extra_body.thinking.budget_tokens"
+)
+
 // buildThinking builds Anthropic's thinking configuration from OpenAI's reasoning effort.
-// Maps OpenAI's effort levels (low/medium/high) to Anthropic's explicit token budgets.
-// Also handles extra_body overrides for advanced users who want direct Anthropic config.
+// Maps OpenAI's effort levels (low/medium/high) to the model's thinking budgets (see
+// modelCapabilities). Also handles extra_body overrides for advanced users who want direct
+// Anthropic config. Returns the parameter the budget was taken from, if any.
 //
 // Mapping: low ≈ 1,024 tokens, medium ≈ 8,192 tokens, high ≈ 24,576 tokens
 //
@@ -23,19 +29,24 @@ import (
 //	        "budget_tokens": 16000
 //	    }
 //	}
-func buildThinking(clientReq openaiadapter.CreateChatCompletionRequest) (anthropic.ThinkingConfigParamUnion, error) {
+func buildThinking(
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	model modelCapabilities,
+) (anthropic.ThinkingConfigParamUnion, string, error) {
 	var thinking anthropic.ThinkingConfigParamUnion
+	var param string
 
 	if clientReq.ReasoningEffort != nil {
-		switch *clientReq.ReasoningEffort {
-		case "low":
-			thinking = anthropic.ThinkingConfigParamOfEnabled(1024)
-		case "medium":
-			thinking = anthropic.ThinkingConfigParamOfEnabled(8192)
-		case "high":
-			thinking = anthropic.ThinkingConfigParamOfEnabled(24576)
-		default:
-			// Unknown reasoning_effort values are ignored; thinking remains unset
+		// Models without thinking fall back to the default budgets, so the request is rejected
+		// in sizeOutput instead of silently running without thinking
+		budgets := model.effortBudgets
+		if budgets == nil {
+			budgets = defaultEffortBudgets
+		}
+		// Unknown reasoning_effort values are ignored; thinking remains unset
+		if budget, ok := budgets[string(*clientReq.ReasoningEffort)]; ok {
+			thinking = anthropic.ThinkingConfigParamOfEnabled(budget)
+			param = paramReasoningEffort
 		}
 	}
 
@@ -54,23 +65,25 @@ func buildThinking(clientReq openaiadapter.CreateChatCompletionRequest) (anthrop
 					case string:
 						parsed, err := strconv.ParseInt(v, 10, 64)
 						if err != nil {
-							return thinking, fmt.Errorf("invalid budget_tokens: must be a valid integer")
+							return thinking, "", newInvalidParamError(paramBudgetTokens, "invalid budget_tokens: must be a valid integer")
 						}
 						budgetTokens = parsed
 					}
 
 					if budgetTokens > 0 {
 						thinking = anthropic.ThinkingConfigParamOfEnabled(budgetTokens)
+						param = paramBudgetTokens
 					} else {
 						// Require at least one budget source (reasoning_effort or budget_tokens)
 						if thinking.GetType() == nil {
-							return thinking, fmt.Errorf("extra_body.thinking.type is 'enabled' but budget_tokens not specified and no reasoning_effort set")
+							return thinking, "", newInvalidParamError(paramBudgetTokens, "extra_body.thinking.type is 'enabled' but budget_tokens not specified and no reasoning_effort set")
 						}
 					}
 				case "disabled":
 					thinking = anthropic.ThinkingConfigParamUnion{
 						OfDisabled: &anthropic.ThinkingConfigDisabledParam{},
 					}
+					param = ""
 				default:
 					// Unknown thinking.type values are ignored
 				}
@@ -78,5 +91,61 @@ func buildThinking(clientReq openaiadapter.CreateChatCompletionRequest) (anthrop
 		}
 	}
 
-	return thinking, nil
+	return thinking, param, nil
+}
+
+// sizeOutput sets max_tokens and the thinking budget consistently within the model's
+// limits. Without max_tokens, the default output budget is added on top of the thinking
+// budget. Client values above the model's output limit are clamped. Budgets from
+// reasoning_effort shrink to leave room for the answer within an explicit max_tokens,
+// while explicit budgets that don't fit are rejected.
+func sizeOutput(
+	params *anthropic.MessageNewParams,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+	model modelCapabilities,
+	thinkingParam string,
+) error {
+	var budget int64
+	if enabled := params.Thinking.OfEnabled; enabled != nil {
+		budget = enabled.BudgetTokens
+		if !model.thinking {
+			return newInvalidParamError(thinkingParam, "model %s does not support extended thinking", params.Model)
+		}
+		if budget < minThinkingBudget {
+			return newInvalidParamError(thinkingParam, "thinking budget must be at least %d tokens, got %d", minThinkingBudget, budget)
+		}
+	}
+
+	maxTokensParam := ""
+	switch {
+	case clientReq.MaxCompletionTokens != nil:
+		maxTokensParam = "max_completion_tokens"
+		params.MaxTokens = int64(*clientReq.MaxCompletionTokens)
+	//lint:ignore SA1019 Support for deprecated max_tokens field required for backward compatibility
+	case clientReq.MaxTokens != nil: //nolint:staticcheck // Support deprecated max_tokens for backward compatibility
+		maxTokensParam = "max_tokens"
+		params.MaxTokens = int64(*clientReq.MaxTokens) //nolint:staticcheck // Support deprecated max_tokens for backward compatibility
+	default:
+		// Users needing more can specify explicitly via max_completion_tokens
+		params.MaxTokens = budget + defaultMaxTokens
+	}
+	params.MaxTokens = model.clampMaxTokens(params.MaxTokens)
+
+	// Anthropic requires the thinking budget to stay below max_tokens
+	if budget == 0 || budget < params.MaxTokens {
+		return nil
+	}
+	if thinkingParam != paramReasoningEffort {
+		if maxTokensParam == "" {
+			return newInvalidParamError(thinkingParam, "budget_tokens (%d) must be less than the maximum output of %s (%d tokens)", budget, params.Model, params.MaxTokens)
+		}
+		return newInvalidParamError(thinkingParam, "budget_tokens (%d) must be less than %s (%d)", budget, maxTokensParam, params.MaxTokens)
+	}
+
+	budget = max(params.MaxTokens/2, minThinkingBudget)
+	if budget >= params.MaxTokens {
+		return newInvalidParamError(maxTokensParam, "%s must be greater than %d to use reasoning_effort", maxTokensParam, minThinkingBudget)
+	}
+	params.Thinking = anthropic.ThinkingConfigParamOfEnabled(budget)
+	return nil
 }
@@ -0,0 +1,357 @@
+package anthropicclaude
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// ErrFileNotFound is returned by a FileResolver for unknown or expired file IDs.
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrURLNotAllowed is returned by a URLFetcher for URLs outside its fetch policy.
+var ErrURLNotAllowed = errors.New("url not allowed")
+
+// ErrUnsupportedDocument is returned by a DocumentConverter for formats it doesn't convert.
+var ErrUnsupportedDocument = errors.New("unsupported document format")
+
+// FileResolver returns the filename and contents of a file uploaded via the Files API.
+// Errors for unknown IDs must wrap ErrFileNotFound so they surface as client errors.
+type FileResolver func(ctx context.Context, fileID string) (filename string, data []byte, err error)
+
+// URLFetcher downloads a remote image or document so it can be inlined.
+// Errors for URLs outside the fetch policy must wrap ErrURLNotAllowed; those URLs are
+// passed upstream unchanged.
+type URLFetcher func(ctx context.Context, url string) (mediaType, filename string, data []byte, err error)
+
+// DocumentConverter extracts plain text or Markdown from a document Anthropic can't read,
+// such as Office or HTML files. Errors for formats it doesn't know must wrap
+// ErrUnsupportedDocument so the file is passed on unchanged; other errors, such as for
+// disabled formats, reject the request.
+type DocumentConverter func(data []byte, mediaType, filename string) (string, error)
+
+// resolvableContentPart is implemented by content part unions that may hold file and
+// image_url parts, so references in user and tool messages are resolved alike.
+type resolvableContentPart[T any] interface {
+	*T
+	Discriminator() (string, error)
+	AsChatCompletionRequestMessageContentPartFile() (types.ChatCompletionRequestMessageContentPartFile, error)
+	AsChatCompletionRequestMessageContentPartImage() (types.ChatCompletionRequestMessageContentPartImage, error)
+	FromChatCompletionRequestMessageContentPartFile(v types.ChatCompletionRequestMessageContentPartFile) error
+	FromChatCompletionRequestMessageContentPartImage(v types.ChatCompletionRequestMessageContentPartImage) error
+}
+
+// resolveContentReferences replaces references in user and tool messages with inline data,
+// so message conversion stays independent of storage and network access:
+//   - file_id: replaced with the file_data of the uploaded file (see FileResolver)
+//   - image_url with http(s) URL: replaced with the fetched data (see URLFetcher)
+//
+// Inline files Anthropic can't read are converted to text files (see DocumentConverter).
+//
+// File ID transformation: OpenAI references uploaded files by ID, Anthropic only accepts
+// inline (or Anthropic-hosted) sources. Resolved files are converted like inline files,
+// yielding document blocks for PDFs/text and image blocks for images.
+//
+// Remote URL transformation: Anthropic fetches URL sources itself, which fails for
+// intranet URLs. Fetched images stay image parts (as data URL); fetched documents become
+// file parts, since a PDF behind an image_url can't be sent as an image block.
+//
+// Returns the request unchanged when it contains no references to resolve.
+func (a *CreateChatCompletionAdapter) resolveContentReferences(
+	ctx context.Context,
+	clientReq openaiadapter.CreateChatCompletionRequest,
+) (openaiadapter.CreateChatCompletionRequest, error) {
+	var messages []types.ChatCompletionRequestMessage
+
+	for msgIndex, msg := range clientReq.Messages {
+		updated, err := a.resolveMessageReferences(ctx, msg, msgIndex)
+		if err != nil {
+			return clientReq, err
+		}
+		if updated == nil {
+			continue
+		}
+
+		// Copy on first change so the caller's request is never mutated
+		if messages == nil {
+			messages = append([]types.ChatCompletionRequestMessage(nil), clientReq.Messages...)
+		}
+		messages[msgIndex] = *updated
+	}
+
+	if messages != nil {
+		clientReq.Messages = messages
+	}
+	return clientReq, nil
+}
+
+// resolveMessageReferences resolves references within the content parts of a user or tool
+// message. Returns nil if nothing was replaced.
+func (a *CreateChatCompletionAdapter) resolveMessageReferences(
+	ctx context.Context,
+	msg types.ChatCompletionRequestMessage,
+	msgIndex int,
+) (*types.ChatCompletionRequestMessage, error) {
+	role, err := msg.Discriminator()
+	if err != nil {
+		return nil, nil
+	}
+
+	var updated types.ChatCompletionRequestMessage
+	switch role {
+	case string(types.User):
+		userMsg, err := msg.AsChatCompletionRequestUserMessage()
+		if err != nil {
+			return nil, nil
+		}
+		// String content has no parts to resolve
+		parts, err := userMsg.Content.AsChatCompletionRequestUserMessageContent1()
+		if err != nil {
+			return nil, nil
+		}
+
+		resolved, changed, err := resolveContentParts(ctx, a, parts, msgIndex)
+		if err != nil || !changed {
+			return nil, err
+		}
+
+		if err := userMsg.Content.FromChatCompletionRequestUserMessageContent1(resolved); err != nil {
+			return nil, fmt.Errorf("update user message %d: %w", msgIndex, err)
+		}
+		if err := updated.FromChatCompletionRequestUserMessage(userMsg); err != nil {
+			return nil, fmt.Errorf("update user message %d: %w", msgIndex, err)
+		}
+
+	case string(types.Tool):
+		toolMsg, err := msg.AsChatCompletionRequestToolMessage()
+		if err != nil {
+			return nil, nil
+		}
+		// String content has no parts to resolve
+		parts, err := toolMsg.Content.AsChatCompletionRequestToolMessageContent1()
+		if err != nil {
+			return nil, nil
+		}
+
+		resolved, changed, err := resolveContentParts(ctx, a, parts, msgIndex)
+		if err != nil || !changed {
+			return nil, err
+		}
+
+		if err := toolMsg.Content.FromChatCompletionRequestToolMessageContent1(resolved); err != nil {
+			return nil, fmt.Errorf("update tool message %d: %w", msgIndex, err)
+		}
+		if err := updated.FromChatCompletionRequestToolMessage(toolMsg); err != nil {
+			return nil, fmt.Errorf("update tool message %d: %w", msgIndex, err)
+		}
+
+	default:
+		return nil, nil
+	}
+	return &updated, nil
+}
+
+// resolveContentParts resolves references within the content parts of a message.
+// Reports whether any part was replaced.
+func resolveContentParts[T any, PT resolvableContentPart[T]](
+	ctx context.Context,
+	a *CreateChatCompletionAdapter,
+	parts []T,
+	msgIndex int,
+) ([]T, bool, error) {
+	var resolved []T
+
+	for i := range parts {
+		part := PT(&parts[i])
+		discriminator, err := part.Discriminator()
+		if err != nil {
+			continue
+		}
+
+		var replacement *T
+		switch discriminator {
+		case string(types.File):
+			replacement, err = resolveFilePart[T, PT](ctx, a, part, msgIndex, i)
+		case string(types.ImageUrl):
+			replacement, err = resolveImageURLPart[T, PT](ctx, a, part, msgIndex, i)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		// Documents are converted once their data is inline, whether sent, uploaded or fetched
+		current := part
+		if replacement != nil {
+			current = PT(replacement)
+		}
+		converted, err := convertDocumentPart[T, PT](a, current, msgIndex, i)
+		if err != nil {
+			return nil, false, err
+		}
+		if converted != nil {
+			replacement = converted
+		}
+
+		if replacement == nil {
+			continue
+		}
+
+		if resolved == nil {
+			resolved = append([]T(nil), parts...)
+		}
+		resolved[i] = *replacement
+	}
+
+	if resolved == nil {
+		return parts, false, nil
+	}
+	return resolved, true, nil
+}
+
+// resolveFilePart replaces a file_id reference with the uploaded file's data.
+// Returns nil if the part has no file_id.
+func resolveFilePart[T any, PT resolvableContentPart[T]](
+	ctx context.Context,
+	a *CreateChatCompletionAdapter,
+	part PT,
+	msgIndex, partIndex int,
+) (*T, error) {
+	filePart, err := part.AsChatCompletionRequestMessageContentPartFile()
+	if err != nil || filePart.File.FileId == nil || *filePart.File.FileId == "" {
+		return nil, nil
+	}
+	fileID := *filePart.File.FileId
+
+	if a.resolveFile == nil {
+		return nil, newInvalidRequestError("message %d content part %d: file_id references are not supported, file uploads are disabled", msgIndex, partIndex)
+	}
+
+	filename, data, err := a.resolveFile(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, newInvalidRequestError("message %d content part %d: file %s not found", msgIndex, partIndex, fileID)
+		}
+		return nil, fmt.Errorf("resolve file %s in message %d: %w", fileID, msgIndex, err)
+	}
+
+	// Client-provided filename takes precedence over the uploaded name
+	if filePart.File.Filename == nil || *filePart.File.Filename == "" {
+		filePart.File.Filename = &filename
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	filePart.File.FileData = &encoded
+	filePart.File.FileId = nil
+
+	var replacement T
+	if err := PT(&replacement).FromChatCompletionRequestMessageContentPartFile(filePart); err != nil {
+		return nil, fmt.Errorf("update file in message %d content part %d: %w", msgIndex, partIndex, err)
+	}
+	return &replacement, nil
+}
+
+// resolveImageURLPart inlines a remote image_url. Returns nil if fetching is disabled,
+// the URL isn't remote or it is outside the fetch policy.
+func resolveImageURLPart[T any, PT resolvableContentPart[T]](
+	ctx context.Context,
+	a *CreateChatCompletionAdapter,
+	part PT,
+	msgIndex, partIndex int,
+) (*T, error) {
+	if a.fetchURL == nil {
+		return nil, nil
+	}
+	imagePart, err := part.AsChatCompletionRequestMessageContentPartImage()
+	if err != nil {
+		return nil, nil
+	}
+	imageURL := imagePart.ImageUrl.Url
+	if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
+		return nil, nil
+	}
+
+	mediaType, filename, data, err := a.fetchURL(ctx, imageURL)
+	if err != nil {
+		if errors.Is(err, ErrURLNotAllowed) {
+			return nil, nil
+		}
+		return nil, newInvalidRequestError("message %d content part %d: %s", msgIndex, partIndex, err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var replacement T
+	if strings.HasPrefix(mediaType, "image/") {
+		imagePart.ImageUrl.Url = "data:" + mediaType + ";base64," + encoded
+		if err := PT(&replacement).FromChatCompletionRequestMessageContentPartImage(imagePart); err != nil {
+			return nil, fmt.Errorf("update image in message %d content part %d: %w", msgIndex, partIndex, err)
+		}
+		return &replacement, nil
+	}
+
+	filePart := types.ChatCompletionRequestMessageContentPartFile{}
+	filePart.File.FileData = &encoded
+	if filename != "" {
+		filePart.File.Filename = &filename
+	}
+	if err := PT(&replacement).FromChatCompletionRequestMessageContentPartFile(filePart); err != nil {
+		return nil, fmt.Errorf("update document in message %d content part %d: %w", msgIndex, partIndex, err)
+	}
+	return &replacement, nil
+}
+
+// convertDocumentPart replaces an inline file Anthropic can't read with its extracted text.
+// Returns nil if conversion is disabled, the part is no inline file, Anthropic reads the
+// file natively or the converter doesn't know its format.
+//
+// Document transformation: Anthropic only accepts PDF, plain text and image documents.
+// Other formats are sent as plain text documents of their text or Markdown, keeping the
+// filename so it still becomes the document title.
+func convertDocumentPart[T any, PT resolvableContentPart[T]](
+	a *CreateChatCompletionAdapter,
+	part PT,
+	msgIndex, partIndex int,
+) (*T, error) {
+	if a.convertDocument == nil {
+		return nil, nil
+	}
+	filePart, err := part.AsChatCompletionRequestMessageContentPartFile()
+	if err != nil || filePart.File.FileData == nil || *filePart.File.FileData == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(*filePart.File.FileData)
+	if err != nil {
+		// Reported when the file is converted to a document block
+		return nil, nil
+	}
+
+	var filename string
+	if filePart.File.Filename != nil {
+		filename = *filePart.File.Filename
+	}
+	mediaType := detectMIMEType(data, "", filename, "application/octet-stream")
+	if mediaType == "application/pdf" || strings.HasPrefix(mediaType, "image/") {
+		return nil, nil
+	}
+
+	text, err := a.convertDocument(data, mediaType, filename)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedDocument) {
+			return nil, nil
+		}
+		return nil, newInvalidRequestError("message %d content part %d: %s", msgIndex, partIndex, err)
+	}
+
+	// The text is sniffed as text/plain, so it becomes a plain text document
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	filePart.File.FileData = &encoded
+
+	var replacement T
+	if err := PT(&replacement).FromChatCompletionRequestMessageContentPartFile(filePart); err != nil {
+		return nil, fmt.Errorf("update document in message %d content part %d: %w", msgIndex, partIndex, err)
+	}
+	return &replacement, nil
+}
@@ -59,12 +59,22 @@ func toFinishReasonStreaming(stopReason anthropic.StopReason) types.CreateChatCo
 // newResponseID generates an OpenAI-compatible response ID (chatcmpl-<token>).
 // Used as fallback when Anthropic doesn't provide an ID in the response.
 func newResponseID() string {
+	return "chatcmpl-" + newIDToken()
+}
+
+// newCompletionID generates an OpenAI-compatible text completion ID (cmpl-<token>).
+// Used as fallback when Anthropic doesn't provide an ID in the response.
+func newCompletionID() string {
+	return "cmpl-" + newIDToken()
+}
+
+// newIDToken generates a random URL-safe token for response IDs.
+func newIDToken() string {
 	b := make([]byte, 24) // 24 bytes yields 32 URL-safe base64 characters
 	_, err := rand.Read(b)
 	if err != nil {
 		panic(err)
 	}
 	// Use RawURLEncoding to avoid '+', '/' and trailing '='
-	token := base64.RawURLEncoding.EncodeToString(b)
-	return "chatcmpl-" + token
+	return base64.RawURLEncoding.EncodeToString(b)
 }
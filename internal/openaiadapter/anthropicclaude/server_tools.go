@@ -0,0 +1,442 @@
+package anthropicclaude
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// serverToolStatePrefix versions the server_tool_state encoding so it can evolve
+// without misreading state from older responses.
+const serverToolStatePrefix = "v1."
+
+// serverToolBetas maps server tool versions to the beta features they require.
+var serverToolBetas = map[string]string{
+	"code_execution_20250522": "code-execution-2025-05-22",
+	"code_execution_20250825": "code-execution-2025-08-25",
+	"web_fetch_20250910":      "web-fetch-2025-09-10",
+}
+
+// buildServerTools builds Anthropic server tools, which Anthropic executes itself.
+//
+// Sources:
+//
+//   - web_search_options: enables web search (web_search_20250305) with the user location
+//
+//   - extra_body.tools: Anthropic server tool definitions passed through unchanged
+//
+//     extra_body: {
+//     "tools": [
+//     {"type": "code_execution_20250522", "name": "code_execution"},
+//     {"type": "web_search_20250305", "name": "web_search", "max_uses": 3}
+//     ]
+//     }
+//
+// A web_search tool in extra_body.tools takes precedence over web_search_options.
+func buildServerTools(clientReq openaiadapter.CreateChatCompletionRequest) ([]anthropic.ToolUnionParam, error) {
+	definitions, err := extraBodyServerTools(clientReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var tools []anthropic.ToolUnionParam
+	for _, definition := range definitions {
+		tools = append(tools, param.Override[anthropic.ToolUnionParam](definition))
+	}
+
+	hasWebSearch := slices.ContainsFunc(definitions, func(definition map[string]any) bool {
+		return definition["name"] == "web_search"
+	})
+	if clientReq.WebSearchOptions != nil && !hasWebSearch {
+		webSearch := anthropic.WebSearchTool20250305Param{}
+
+		// SearchContextSize transformation: Anthropic has no equivalent, the amount of
+		// search context is determined by the model.
+		if userLocation := clientReq.WebSearchOptions.UserLocation; userLocation != nil {
+			location := userLocation.Approximate
+			if location.City != nil {
+				webSearch.UserLocation.City = anthropic.String(*location.City)
+			}
+			if location.Country != nil {
+				webSearch.UserLocation.Country = anthropic.String(*location.Country)
+			}
+			if location.Region != nil {
+				webSearch.UserLocation.Region = anthropic.String(*location.Region)
+			}
+			if location.Timezone != nil {
+				webSearch.UserLocation.Timezone = anthropic.String(*location.Timezone)
+			}
+		}
+		tools = append(tools, anthropic.ToolUnionParam{OfWebSearchTool20250305: &webSearch})
+	}
+
+	return tools, nil
+}
+
+// serverToolRequestOptions returns request options enabling the beta features required
+// by server tools in extra_body.tools.
+func serverToolRequestOptions(clientReq openaiadapter.CreateChatCompletionRequest) []option.RequestOption {
+	return betaRequestOptions(serverToolBetaFeatures(clientReq))
+}
+
+// betaRequestOptions returns request options enabling the given beta features.
+// Features are sent as a single header value, which the transport merges with its own.
+func betaRequestOptions(betas []string) []option.RequestOption {
+	if len(betas) == 0 {
+		return nil
+	}
+	return []option.RequestOption{option.WithHeader("anthropic-beta", strings.Join(betas, ","))}
+}
+
+// serverToolBetaFeatures returns the beta features required by server tools in extra_body.tools.
+func serverToolBetaFeatures(clientReq openaiadapter.CreateChatCompletionRequest) []string {
+	// Invalid definitions are reported by buildServerTools
+	definitions, _ := extraBodyServerTools(clientReq)
+
+	var betas []string
+	for _, definition := range definitions {
+		toolType, _ := definition["type"].(string)
+		if beta, ok := serverToolBetas[toolType]; ok && !slices.Contains(betas, beta) {
+			betas = append(betas, beta)
+		}
+	}
+	return betas
+}
+
+// extraBodyServerTools returns the server tool definitions in extra_body.tools.
+func extraBodyServerTools(clientReq openaiadapter.CreateChatCompletionRequest) ([]map[string]any, error) {
+	if clientReq.ExtraBody == nil {
+		return nil, nil
+	}
+	setting, ok := (*clientReq.ExtraBody)["tools"]
+	if !ok || setting == nil {
+		return nil, nil
+	}
+
+	items, ok := setting.([]any)
+	if !ok {
+		return nil, newInvalidRequestError("extra_body.tools must be an array of Anthropic server tool definitions")
+	}
+	definitions := make([]map[string]any, 0, len(items))
+	for i, item := range items {
+		definition, ok := item.(map[string]any)
+		if !ok {
+			return nil, newInvalidRequestError("extra_body.tools.%d must be an object", i)
+		}
+		if toolType, _ := definition["type"].(string); toolType == "" || toolType == "custom" {
+			// Client-side tools are defined via tools, their calls must map to tool_calls
+			return nil, newInvalidRequestError("extra_body.tools.%d must be an Anthropic server tool with a versioned type", i)
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+// hasServerTools reports whether the request enables server tools, so responses may
+// contain server tool blocks.
+func hasServerTools(clientReq openaiadapter.CreateChatCompletionRequest) bool {
+	if clientReq.WebSearchOptions != nil {
+		return true
+	}
+	definitions, _ := extraBodyServerTools(clientReq)
+	return len(definitions) > 0
+}
+
+// isServerToolBlock reports whether a content block of the given type stems from a server tool.
+func isServerToolBlock(blockType string) bool {
+	return blockType == "server_tool_use" || strings.HasSuffix(blockType, "_tool_result")
+}
+
+// serverToolStateBlocks returns the content blocks that have to be preserved for
+// server tool round-trips, or nil if the content contains no server tool blocks.
+//
+// Tool use blocks round-trip via tool_calls and thinking blocks are not exposed
+// (see transformResponse), so only text and server tool blocks are preserved.
+func serverToolStateBlocks(content []anthropic.ContentBlockUnion) []json.RawMessage {
+	if !slices.ContainsFunc(content, func(block anthropic.ContentBlockUnion) bool {
+		return isServerToolBlock(block.Type)
+	}) {
+		return nil
+	}
+
+	var blocks []json.RawMessage
+	for _, block := range content {
+		if block.Type == "text" || isServerToolBlock(block.Type) {
+			blocks = append(blocks, json.RawMessage(block.RawJSON()))
+		}
+	}
+	return blocks
+}
+
+// encodeServerToolState encodes content blocks as opaque server_tool_state.
+// Blocks are kept verbatim so encrypted search results and code execution
+// results reach Anthropic unchanged when sent back.
+func encodeServerToolState(blocks []json.RawMessage) (string, error) {
+	compacted := make([]json.RawMessage, 0, len(blocks))
+	for _, block := range blocks {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, block); err != nil {
+			return "", fmt.Errorf("compact content block: %w", err)
+		}
+		compacted = append(compacted, buf.Bytes())
+	}
+
+	encoded, err := json.Marshal(compacted)
+	if err != nil {
+		return "", fmt.Errorf("encode server tool state: %w", err)
+	}
+	return serverToolStatePrefix + base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// decodeServerToolState decodes server_tool_state produced by encodeServerToolState.
+func decodeServerToolState(state string) ([]json.RawMessage, error) {
+	encoded, ok := strings.CutPrefix(state, serverToolStatePrefix)
+	if !ok {
+		return nil, fmt.Errorf("unsupported server_tool_state version")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode server_tool_state: %w", err)
+	}
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(decoded, &blocks); err != nil {
+		return nil, fmt.Errorf("decode server_tool_state: %w", err)
+	}
+	return blocks, nil
+}
+
+// restoreServerToolBlocks reconstructs the original content blocks of an assistant message
+// from its server_tool_state, so server tool results stay part of the conversation.
+//
+// State is only used while the message content matches its text blocks; clients that edit
+// the content get their edited text, losing the server tool context instead of the edit.
+// Returns false if the message has no usable state.
+func restoreServerToolBlocks(msg types.ChatCompletionRequestAssistantMessage) ([]anthropic.ContentBlockParamUnion, bool) {
+	if msg.ServerToolState == nil || *msg.ServerToolState == "" {
+		return nil, false
+	}
+	blocks, err := decodeServerToolState(*msg.ServerToolState)
+	if err != nil {
+		return nil, false
+	}
+
+	// Text is derived like transformResponse does, so unedited content matches exactly
+	content := make([]anthropic.ContentBlockUnion, len(blocks))
+	for i, block := range blocks {
+		if err := content[i].UnmarshalJSON(block); err != nil {
+			return nil, false
+		}
+	}
+	if text, _ := contentWithAnnotations(content); text != assistantMessageText(msg) {
+		return nil, false
+	}
+
+	params := make([]anthropic.ContentBlockParamUnion, 0, len(blocks))
+	for _, block := range blocks {
+		params = append(params, param.Override[anthropic.ContentBlockParamUnion](block))
+	}
+	return params, true
+}
+
+// assistantMessageText returns the text content of an assistant message.
+func assistantMessageText(msg types.ChatCompletionRequestAssistantMessage) string {
+	if msg.Content == nil {
+		return ""
+	}
+	if text, err := msg.Content.AsChatCompletionRequestAssistantMessageContent0(); err == nil {
+		return text
+	}
+	parts, err := msg.Content.AsChatCompletionRequestAssistantMessageContent1()
+	if err != nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range parts {
+		if textPart, err := part.AsChatCompletionRequestMessageContentPartText(); err == nil && textPart.Type == types.ChatCompletionRequestMessageContentPartTextTypeText {
+			text.WriteString(textPart.Text)
+		}
+	}
+	return text.String()
+}
+
+// webSearchResultAnnotations converts the results of a web search to url_citation annotations.
+// Results aren't tied to a content span, so annotations are anchored at the given index.
+func webSearchResultAnnotations(result anthropic.WebSearchToolResultBlock, index int) []types.ChatCompletionAnnotation {
+	annotations := make([]types.ChatCompletionAnnotation, 0, len(result.Content.OfWebSearchResultBlockArray))
+	for _, searchResult := range result.Content.OfWebSearchResultBlockArray {
+		annotations = append(annotations, newURLAnnotation(searchResult.URL, searchResult.Title, index, index))
+	}
+	return annotations
+}
+
+// streamedStateBlocks reassembles text and server tool blocks from stream events,
+// since server_tool_state needs complete blocks that the stream only delivers in parts.
+type streamedStateBlocks struct {
+	indices        []int64
+	blocks         map[int64]*streamedStateBlock
+	hasServerTools bool
+
+	// allBlocks records blocks of every type, e.g. to rebuild a complete message
+	allBlocks bool
+}
+
+// streamedStateBlock is a content block under reassembly.
+type streamedStateBlock struct {
+	fields    *jsonObject
+	text      strings.Builder
+	input     strings.Builder
+	citations []json.RawMessage
+	thinking  strings.Builder
+	signature strings.Builder
+}
+
+// newStreamedStateBlocks creates an empty reassembly buffer.
+func newStreamedStateBlocks() *streamedStateBlocks {
+	return &streamedStateBlocks{blocks: make(map[int64]*streamedStateBlock)}
+}
+
+// newStreamedContentBlocks creates an empty reassembly buffer recording all blocks.
+func newStreamedContentBlocks() *streamedStateBlocks {
+	return &streamedStateBlocks{blocks: make(map[int64]*streamedStateBlock), allBlocks: true}
+}
+
+// start records a content block from its content_block_start event.
+// Blocks not preserved in server_tool_state are ignored unless all blocks are recorded.
+func (s *streamedStateBlocks) start(index int64, blockType string, rawJSON string) error {
+	if s == nil || (!s.allBlocks && blockType != "text" && !isServerToolBlock(blockType)) {
+		return nil
+	}
+	fields, err := parseJSONObject([]byte(rawJSON))
+	if err != nil {
+		return fmt.Errorf("record %s block at index %d: %w", blockType, index, err)
+	}
+	s.indices = append(s.indices, index)
+	s.blocks[index] = &streamedStateBlock{fields: fields}
+	s.hasServerTools = s.hasServerTools || isServerToolBlock(blockType)
+	return nil
+}
+
+// appendText records a text delta.
+func (s *streamedStateBlocks) appendText(index int64, text string) {
+	if block := s.block(index); block != nil {
+		block.text.WriteString(text)
+	}
+}
+
+// appendCitation records a citation delta.
+func (s *streamedStateBlocks) appendCitation(index int64, rawJSON string) {
+	if block := s.block(index); block != nil {
+		block.citations = append(block.citations, json.RawMessage(rawJSON))
+	}
+}
+
+// appendThinking records a thinking delta.
+func (s *streamedStateBlocks) appendThinking(index int64, thinking string) {
+	if block := s.block(index); block != nil {
+		block.thinking.WriteString(thinking)
+	}
+}
+
+// appendSignature records a signature delta of a thinking block.
+func (s *streamedStateBlocks) appendSignature(index int64, signature string) {
+	if block := s.block(index); block != nil {
+		block.signature.WriteString(signature)
+	}
+}
+
+// appendInput records an input delta of a server_tool_use block.
+// Reports whether the block at index is a recorded block.
+func (s *streamedStateBlocks) appendInput(index int64, partialJSON string) bool {
+	block := s.block(index)
+	if block == nil {
+		return false
+	}
+	block.input.WriteString(partialJSON)
+	return true
+}
+
+// block returns the recorded block at index, or nil.
+func (s *streamedStateBlocks) block(index int64) *streamedStateBlock {
+	if s == nil {
+		return nil
+	}
+	return s.blocks[index]
+}
+
+// state returns the server_tool_state of the reassembled blocks, or nil if the
+// stream contained no server tool blocks.
+func (s *streamedStateBlocks) state() (*string, error) {
+	if s == nil || !s.hasServerTools {
+		return nil, nil
+	}
+
+	blocks, err := s.rawBlocks()
+	if err != nil {
+		return nil, err
+	}
+	state, err := encodeServerToolState(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// rawBlocks returns the reassembled blocks in stream order.
+func (s *streamedStateBlocks) rawBlocks() ([]json.RawMessage, error) {
+	blocks := make([]json.RawMessage, 0, len(s.indices))
+	for _, index := range s.indices {
+		block := s.blocks[index]
+		var blockType string
+		if err := json.Unmarshal(block.fields.get("type"), &blockType); err != nil {
+			return nil, fmt.Errorf("read type of block at index %d: %w", index, err)
+		}
+
+		switch {
+		case blockType == "text":
+			text, err := marshalJSON(block.text.String())
+			if err != nil {
+				return nil, err
+			}
+			block.fields.set("text", text)
+			if len(block.citations) > 0 {
+				citations, err := marshalJSON(block.citations)
+				if err != nil {
+					return nil, err
+				}
+				block.fields.set("citations", citations)
+			} else {
+				block.fields.delete("citations")
+			}
+		case blockType == "thinking":
+			thinking, err := marshalJSON(block.thinking.String())
+			if err != nil {
+				return nil, err
+			}
+			signature, err := marshalJSON(block.signature.String())
+			if err != nil {
+				return nil, err
+			}
+			block.fields.set("thinking", thinking)
+			block.fields.set("signature", signature)
+		case block.input.Len() > 0:
+			block.fields.set("input", json.RawMessage(block.input.String()))
+		}
+
+		encoded, err := marshalJSON(block.fields)
+		if err != nil {
+			return nil, fmt.Errorf("encode block at index %d: %w", index, err)
+		}
+		blocks = append(blocks, encoded)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,144 @@
+package anthropicclaude_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// conformanceTurn pairs an Anthropic stream with an OpenAI stream of the same content
+// in OpenAI's wire format. Values differ between both providers, so only the shape of
+// the chunks is compared.
+type conformanceTurn struct {
+	OpenAIRequest json.RawMessage   `json:"openaiRequest"` // What client sends to adapter
+	AnthropicSSE  []string          `json:"anthropicSSE"`  // SSE event stream lines from Anthropic
+	OpenAIStream  []json.RawMessage `json:"openaiStream"`  // Chunks OpenAI streams for the request
+}
+
+// openAIOnlyChunkFields are set by OpenAI but have no Anthropic counterpart.
+var openAIOnlyChunkFields = map[string]bool{
+	"service_tier":       true,
+	"system_fingerprint": true,
+	"obfuscation":        true,
+}
+
+func TestCreateChatCompletionAdapter_StreamConformance(t *testing.T) {
+	t.Parallel()
+	fixtures := loadFixtures[conformanceTurn](t, "testdata/conformance/*.json")
+
+	for _, fix := range fixtures {
+		t.Run(fix.Name, func(t *testing.T) {
+			t.Parallel()
+			adapter := anthropicclaude.NewCreateChatCompletionAdapter()
+
+			for i, turn := range fix.Turns {
+				t.Logf("Turn %d", i+1)
+
+				mock := &mockTransport{
+					responseBody:   streamingTurn{AnthropicSSE: turn.AnthropicSSE}.body(),
+					responseStatus: http.StatusOK,
+				}
+
+				var openaiReq types.CreateChatCompletionRequest
+				if err := json.Unmarshal(turn.OpenAIRequest, &openaiReq); err != nil {
+					t.Fatalf("Failed to parse openaiRequest: %v", err)
+				}
+
+				stream, err := adapter.ProcessStreamingRequest(context.Background(), openaiReq, mock)
+				if err != nil {
+					t.Fatalf("ProcessStreamingRequest failed: %v", err)
+				}
+
+				var chunks []any
+				for chunk, err := range stream {
+					if err != nil {
+						t.Fatalf("Unexpected stream error: %v", err)
+					}
+					chunkJSON, err := json.Marshal(chunk)
+					if err != nil {
+						t.Fatalf("Failed to marshal chunk: %v", err)
+					}
+					var v any
+					if err := json.Unmarshal(chunkJSON, &v); err != nil {
+						t.Fatalf("Failed to unmarshal chunk: %v", err)
+					}
+					chunks = append(chunks, v)
+				}
+
+				if len(chunks) != len(turn.OpenAIStream) {
+					t.Fatalf("Chunk count mismatch: got %d, want %d", len(chunks), len(turn.OpenAIStream))
+				}
+
+				for j, want := range turn.OpenAIStream {
+					var recorded any
+					if err := json.Unmarshal(want, &recorded); err != nil {
+						t.Fatalf("Failed to parse chunk %d: %v", j, err)
+					}
+					for _, diff := range shapeDiff(fmt.Sprintf("chunk[%d]", j), chunks[j], recorded, true) {
+						t.Error(diff)
+					}
+				}
+			}
+		})
+	}
+}
+
+// shapeDiff reports where got is shaped differently than want. Every field of got must
+// exist in want with the same JSON type and arrays must have the same length. Fields set
+// in want must be set in got as well, except for fields specific to OpenAI, optional token
+// details and delta fields. Null and missing fields are considered equal.
+func shapeDiff(path string, got, want any, chunkLevel bool) []string {
+	switch want := want.(type) {
+	case map[string]any:
+		got, ok := got.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: got %T, want object", path, got)}
+		}
+		var diffs []string
+		for key, gotValue := range got {
+			if gotValue == nil {
+				continue
+			}
+			if want[key] == nil {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected field", path, key))
+				continue
+			}
+			diffs = append(diffs, shapeDiff(path+"."+key, gotValue, want[key], false)...)
+		}
+		for key, wantValue := range want {
+			if wantValue == nil || got[key] != nil || (chunkLevel && openAIOnlyChunkFields[key]) {
+				continue
+			}
+			// Deltas only carry what changed and token details are optional
+			if strings.HasSuffix(path, ".delta") || strings.HasSuffix(path, "_details") || strings.HasSuffix(key, "_details") {
+				continue
+			}
+			diffs = append(diffs, fmt.Sprintf("%s.%s: missing field", path, key))
+		}
+		return diffs
+	case []any:
+		got, ok := got.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: got %T, want array", path, got)}
+		}
+		if len(got) != len(want) {
+			return []string{fmt.Sprintf("%s: got %d elements, want %d", path, len(got), len(want))}
+		}
+		var diffs []string
+		for i := range want {
+			diffs = append(diffs, shapeDiff(fmt.Sprintf("%s[%d]", path, i), got[i], want[i], false)...)
+		}
+		return diffs
+	default:
+		if fmt.Sprintf("%T", got) != fmt.Sprintf("%T", want) {
+			return []string{fmt.Sprintf("%s: got %T, want %T", path, got, want)}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,155 @@
+package anthropicclaude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// fromToolMessageContent converts the content of a tool message to tool_result content.
+//
+// ToolResult transformation: text-only results become a single text block as before, so
+// multiple text parts are joined. Results containing images or files keep one block per
+// part, converted like user content (images are preprocessed, PDFs and text files become
+// documents).
+//
+// String outputs follow a convention for clients limited to string tool outputs: an output
+// that is entirely a base64 data URL, or a JSON-encoded content part or array of content
+// parts including an image_url or file part, is converted like the equivalent content parts.
+// Any other output is passed through as text.
+func fromToolMessageContent(content types.ChatCompletionRequestToolMessage_Content) ([]anthropic.ToolResultBlockParamContentUnion, error) {
+	var parts []types.ChatCompletionRequestToolMessageContentPart
+	if textContent, err := content.AsChatCompletionRequestToolMessageContent0(); err == nil {
+		unwrapped, err := toolOutputContentParts(textContent)
+		if err != nil {
+			return nil, err
+		}
+		if unwrapped == nil {
+			return []anthropic.ToolResultBlockParamContentUnion{{OfText: &anthropic.TextBlockParam{Text: textContent}}}, nil
+		}
+		parts = unwrapped
+	} else if arrayContent, err := content.AsChatCompletionRequestToolMessageContent1(); err == nil {
+		parts = arrayContent
+	} else {
+		return nil, fmt.Errorf("extract content format: %w", err)
+	}
+
+	if !hasMediaContentParts(parts) {
+		text := textFromOpenAIContentParts(parts)
+		return []anthropic.ToolResultBlockParamContentUnion{{OfText: &anthropic.TextBlockParam{Text: text}}}, nil
+	}
+
+	blocks, err := fromToolMessageContentParts(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	resultBlocks := make([]anthropic.ToolResultBlockParamContentUnion, 0, len(blocks))
+	for i, block := range blocks {
+		switch {
+		case block.OfText != nil:
+			resultBlocks = append(resultBlocks, anthropic.ToolResultBlockParamContentUnion{OfText: block.OfText})
+		case block.OfImage != nil:
+			resultBlocks = append(resultBlocks, anthropic.ToolResultBlockParamContentUnion{OfImage: block.OfImage})
+		case block.OfDocument != nil:
+			resultBlocks = append(resultBlocks, anthropic.ToolResultBlockParamContentUnion{OfDocument: block.OfDocument})
+		default:
+			return nil, fmt.Errorf("content part %d not supported in tool results", i)
+		}
+	}
+	return resultBlocks, nil
+}
+
+// toolOutputContentParts converts a string tool output following the data URL or JSON
+// content part convention to content parts. Returns nil for any other output.
+func toolOutputContentParts(output string) ([]types.ChatCompletionRequestToolMessageContentPart, error) {
+	trimmed := strings.TrimSpace(output)
+
+	if mediaType, data, ok := parseBase64DataURL(trimmed); ok {
+		var part types.ChatCompletionRequestToolMessageContentPart
+		if strings.HasPrefix(mediaType, "image/") {
+			imagePart := types.ChatCompletionRequestMessageContentPartImage{}
+			imagePart.ImageUrl.Url = trimmed
+			if err := part.FromChatCompletionRequestMessageContentPartImage(imagePart); err != nil {
+				return nil, fmt.Errorf("create image part from data URL: %w", err)
+			}
+		} else {
+			filePart := types.ChatCompletionRequestMessageContentPartFile{}
+			filePart.File.FileData = &data
+			if err := part.FromChatCompletionRequestMessageContentPartFile(filePart); err != nil {
+				return nil, fmt.Errorf("create file part from data URL: %w", err)
+			}
+		}
+		return []types.ChatCompletionRequestToolMessageContentPart{part}, nil
+	}
+
+	var parts []types.ChatCompletionRequestToolMessageContentPart
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		var part types.ChatCompletionRequestToolMessageContentPart
+		if err := json.Unmarshal([]byte(trimmed), &part); err != nil {
+			return nil, nil
+		}
+		parts = append(parts, part)
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal([]byte(trimmed), &parts); err != nil {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	// Only outputs made of content parts are unwrapped, other JSON stays text
+	for _, part := range parts {
+		discriminator, err := part.Discriminator()
+		if err != nil {
+			return nil, nil
+		}
+		switch discriminator {
+		case string(types.ChatCompletionRequestMessageContentPartTextTypeText), string(types.ImageUrl), string(types.File):
+		default:
+			return nil, nil
+		}
+	}
+	if !hasMediaContentParts(parts) {
+		return nil, nil
+	}
+	return parts, nil
+}
+
+// hasMediaContentParts reports whether any of the tool content parts is an image or file.
+func hasMediaContentParts(parts []types.ChatCompletionRequestToolMessageContentPart) bool {
+	for _, part := range parts {
+		discriminator, err := part.Discriminator()
+		if err != nil {
+			// Let the conversion report the invalid part
+			return true
+		}
+		if discriminator != string(types.ChatCompletionRequestMessageContentPartTextTypeText) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBase64DataURL splits a data URL of the form data:mime/type;base64,<data> into its
+// media type and base64 data.
+func parseBase64DataURL(s string) (mediaType, data string, ok bool) {
+	header, data, found := strings.Cut(s, ",")
+	if !found || data == "" || strings.ContainsAny(header, " \t\r\n") {
+		return "", "", false
+	}
+	header, found = strings.CutPrefix(header, "data:")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(header, ";base64")
+	if !found || mediaType == "" {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
@@ -0,0 +1,578 @@
+package anthropicclaude
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+const (
+	// wrappedSchemaProperty holds the arguments of tools whose schema root is not an object,
+	// since Anthropic only accepts object input schemas.
+	wrappedSchemaProperty = "value"
+
+	// maxToolDescriptionLength bounds tool and schema descriptions in characters. Longer
+	// descriptions mostly carry pasted documentation and crowd out the actual prompt.
+	maxToolDescriptionLength = 4096
+
+	// maxInlinedSchemaNodes bounds the nodes copied by $ref inlining. References that share
+	// definitions (A -> B, B -> C twice, ...) expand exponentially; past the budget,
+	// references are kept instead.
+	maxInlinedSchemaNodes = 10000
+)
+
+// normalizedToolSchema is a function parameters schema converted for Anthropic.
+type normalizedToolSchema struct {
+	// Schema is the object schema sent as tool input schema.
+	Schema map[string]any
+
+	// Wrapped marks that the client's schema root was wrapped in wrappedSchemaProperty.
+	Wrapped bool
+
+	// Truncated counts descriptions cut to maxToolDescriptionLength.
+	Truncated int
+}
+
+// normalizeToolSchema converts an OpenAI function parameters schema to a schema Anthropic
+// handles reliably. The client's schema is not modified.
+//
+// Schema transformation:
+//   - $ref: local references are inlined; recursive references and references past
+//     maxInlinedSchemaNodes are kept along with their definitions
+//   - Non-object roots (primitives, arrays, top-level anyOf/oneOf/allOf) are wrapped in an
+//     object with a single required property, unwrapped again in tool calls
+//   - Strict: objects forbid additional properties and require all their properties, which
+//     OpenAI's strict mode implies but Anthropic does not
+//   - Descriptions longer than maxToolDescriptionLength are truncated
+func normalizeToolSchema(parameters map[string]any, strict bool) (normalizedToolSchema, error) {
+	var normalized normalizedToolSchema
+
+	root, _ := cloneJSONValue(parameters).(map[string]any)
+	if root == nil {
+		root = map[string]any{}
+	}
+
+	// Definitions are inlined; only kept if recursive references still point into them
+	definitions := make(map[string]any)
+	for _, key := range []string{"$defs", "definitions"} {
+		if defs, ok := root[key]; ok {
+			definitions[key] = defs
+			delete(root, key)
+		}
+	}
+
+	inliner := schemaRefInliner{root: parameters}
+	root, err := inliner.inline(root, nil)
+	if err != nil {
+		return normalized, err
+	}
+
+	if !isObjectSchema(root) {
+		root = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{wrappedSchemaProperty: root},
+			"required":   []any{wrappedSchemaProperty},
+		}
+		normalized.Wrapped = true
+	}
+
+	if inliner.recursive {
+		for key, defs := range definitions {
+			root[key] = defs
+		}
+	}
+
+	visitSchemas(root, func(schema map[string]any) {
+		if strict {
+			enforceStrictObject(schema)
+		}
+		if description, ok := schema["description"].(string); ok {
+			if truncated, ok := truncateDescription(description); ok {
+				schema["description"] = truncated
+				normalized.Truncated++
+			}
+		}
+	})
+
+	normalized.Schema = root
+	return normalized, nil
+}
+
+// isObjectSchema reports whether a schema root is a plain object schema Anthropic accepts.
+// Schemas without type are treated as objects, since tool arguments always are.
+func isObjectSchema(schema map[string]any) bool {
+	for _, key := range []string{"anyOf", "oneOf", "allOf", "$ref"} {
+		if _, ok := schema[key]; ok {
+			return false
+		}
+	}
+	schemaType, ok := schema["type"]
+	return !ok || schemaType == "object"
+}
+
+// enforceStrictObject makes an object schema closed with all properties required.
+// OpenAI's strict mode rejects schemas that aren't, so clients expect these semantics.
+func enforceStrictObject(schema map[string]any) {
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok && schema["type"] != "object" {
+		return
+	}
+
+	schema["additionalProperties"] = false
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	required := make([]any, 0, len(names))
+	for _, name := range names {
+		required = append(required, name)
+	}
+	schema["required"] = required
+}
+
+// truncateDescription cuts descriptions longer than maxToolDescriptionLength characters.
+// Reports whether the description was truncated.
+func truncateDescription(description string) (string, bool) {
+	if utf8.RuneCountInString(description) <= maxToolDescriptionLength {
+		return description, false
+	}
+	runes := []rune(description)
+	return string(runes[:maxToolDescriptionLength]), true
+}
+
+// schemaRefInliner replaces local $ref references with the referenced schema.
+type schemaRefInliner struct {
+	// root is the client's schema that references are resolved against.
+	root map[string]any
+
+	// recursive marks that a reference was left in place, either because it is recursive or
+	// because inlining exceeded maxInlinedSchemaNodes.
+	recursive bool
+
+	// inlined counts the nodes copied so far.
+	inlined int
+}
+
+// inline resolves references in a schema and its subschemas. stack holds the references
+// being inlined, so recursion is detected instead of expanding endlessly.
+func (r *schemaRefInliner) inline(schema map[string]any, stack []string) (map[string]any, error) {
+	if ref, ok := schema["$ref"].(string); ok {
+		if ref == "#" || slices.Contains(stack, ref) {
+			r.recursive = true
+			return schema, nil
+		}
+
+		target, err := resolveSchemaRef(r.root, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		r.inlined += countJSONNodes(target)
+		if r.inlined > maxInlinedSchemaNodes {
+			r.recursive = true
+			return schema, nil
+		}
+
+		// Keywords next to $ref apply in addition to the referenced schema
+		resolved, _ := cloneJSONValue(target).(map[string]any)
+		for key, value := range schema {
+			if key != "$ref" {
+				resolved[key] = value
+			}
+		}
+		return r.inline(resolved, append(slices.Clip(stack), ref))
+	}
+
+	err := rewriteSubschemas(schema, func(subschema map[string]any) (map[string]any, error) {
+		return r.inline(subschema, stack)
+	})
+	return schema, err
+}
+
+// resolveSchemaRef resolves a local JSON pointer reference (e.g. #/$defs/Address).
+func resolveSchemaRef(root map[string]any, ref string) (map[string]any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q: only local references are supported", ref)
+	}
+
+	var node any = root
+	for token := range strings.SplitSeq(pointer, "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch value := node.(type) {
+		case map[string]any:
+			node = value[token]
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			node = value[index]
+		default:
+			node = nil
+		}
+	}
+
+	schema, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return schema, nil
+}
+
+// visitSchemas calls visit for a schema and all its subschemas.
+func visitSchemas(schema map[string]any, visit func(map[string]any)) {
+	visit(schema)
+	_ = rewriteSubschemas(schema, func(subschema map[string]any) (map[string]any, error) {
+		visitSchemas(subschema, visit)
+		return subschema, nil
+	})
+}
+
+// rewriteSubschemas replaces each direct subschema of a schema with the result of rewrite.
+// Only schema keywords are followed, so data like enum values or property names that look
+// like keywords are left alone.
+func rewriteSubschemas(schema map[string]any, rewrite func(map[string]any) (map[string]any, error)) error {
+	rewriteValue := func(value any) (any, error) {
+		subschema, ok := value.(map[string]any)
+		if !ok {
+			return value, nil // Boolean schemas
+		}
+		return rewrite(subschema)
+	}
+
+	for key, value := range schema {
+		var err error
+		switch key {
+		case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas":
+			subschemas, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			for name, subschema := range subschemas {
+				if subschemas[name], err = rewriteValue(subschema); err != nil {
+					return err
+				}
+			}
+
+		case "items", "additionalProperties", "additionalItems", "unevaluatedProperties",
+			"unevaluatedItems", "contains", "propertyNames", "not", "if", "then", "else":
+			if list, ok := value.([]any); ok {
+				// Array form of items (draft 4 tuples)
+				for i, subschema := range list {
+					if list[i], err = rewriteValue(subschema); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if schema[key], err = rewriteValue(value); err != nil {
+				return err
+			}
+
+		case "anyOf", "oneOf", "allOf", "prefixItems":
+			list, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			for i, subschema := range list {
+				if list[i], err = rewriteValue(subschema); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// countJSONNodes counts a decoded JSON value and all values nested in it.
+func countJSONNodes(value any) int {
+	count := 1
+	switch v := value.(type) {
+	case map[string]any:
+		for _, item := range v {
+			count += countJSONNodes(item)
+		}
+	case []any:
+		for _, item := range v {
+			count += countJSONNodes(item)
+		}
+	}
+	return count
+}
+
+// cloneJSONValue deep copies a decoded JSON value.
+func cloneJSONValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		clone := make(map[string]any, len(v))
+		for key, item := range v {
+			clone[key] = cloneJSONValue(item)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(v))
+		for i, item := range v {
+			clone[i] = cloneJSONValue(item)
+		}
+		return clone
+	default:
+		return v
+	}
+}
+
+// strictValidationSchema returns the client's schema with strict semantics applied (see
+// enforceStrictObject) for validating tool arguments. References are kept, so recursive
+// schemas are validated as well.
+func strictValidationSchema(parameters *types.FunctionParameters) map[string]any {
+	schema := map[string]any{}
+	if parameters != nil {
+		schema, _ = cloneJSONValue(map[string]any(*parameters)).(map[string]any)
+	}
+	visitSchemas(schema, enforceStrictObject)
+	return schema
+}
+
+// validateToolArguments validates JSON tool call arguments against the client's schema.
+//
+// Strict transformation: OpenAI guarantees arguments of strict functions match their
+// schema; Anthropic only follows schemas best-effort, so arguments are validated instead.
+// Covers the keywords OpenAI's strict mode supports.
+func validateToolArguments(schema map[string]any, arguments string) error {
+	var value any
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return fmt.Errorf("arguments are not valid JSON: %w", err)
+	}
+	validator := schemaValidator{root: schema, refs: make(map[schemaRefVisit]bool)}
+	return validator.validate(schema, value, "$")
+}
+
+// schemaValidator validates decoded JSON values against a JSON schema.
+type schemaValidator struct {
+	// root is the schema references are resolved against.
+	root map[string]any
+
+	// refs holds the references being followed for a value. Following the same reference
+	// again for the same value means the reference cycle consumes no input and would
+	// recurse endlessly (e.g. {"$ref":"#"} at the root).
+	refs map[schemaRefVisit]bool
+}
+
+// schemaRefVisit identifies a reference followed for a value, located by its path.
+type schemaRefVisit struct {
+	ref  string
+	path string
+}
+
+// validate checks a value against a schema; path locates the value for error messages.
+func (v schemaValidator) validate(schema map[string]any, value any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		visit := schemaRefVisit{ref: ref, path: path}
+		if v.refs[visit] {
+			return fmt.Errorf("%s: $ref %q is a cycle that matches no input", path, ref)
+		}
+		v.refs[visit] = true
+		defer delete(v.refs, visit)
+
+		target := v.root
+		if ref != "#" {
+			var err error
+			if target, err = resolveSchemaRef(v.root, ref); err != nil {
+				return err
+			}
+		}
+		if err := v.validate(target, value, path); err != nil {
+			return err
+		}
+	}
+
+	if schemaType, ok := schema["type"]; ok && !matchesSchemaType(schemaType, value) {
+		return fmt.Errorf("%s: expected type %v", path, schemaType)
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(item any) bool {
+		return reflect.DeepEqual(item, value)
+	}) {
+		return fmt.Errorf("%s: value is not one of the allowed values", path)
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return fmt.Errorf("%s: value does not match const", path)
+	}
+
+	for _, subschema := range schemaList(schema["allOf"]) {
+		if err := v.validate(subschema, value, path); err != nil {
+			return err
+		}
+	}
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 && !slices.ContainsFunc(anyOf, func(subschema map[string]any) bool {
+		return v.validate(subschema, value, path) == nil
+	}) {
+		return fmt.Errorf("%s: value matches none of anyOf", path)
+	}
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 {
+		matches := 0
+		for _, subschema := range oneOf {
+			if v.validate(subschema, value, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: value matches %d of oneOf, expected exactly 1", path, matches)
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		return v.validateObject(schema, typed, path)
+	case []any:
+		return v.validateArray(schema, typed, path)
+	case string:
+		return validateString(schema, typed, path)
+	case float64:
+		return validateNumber(schema, typed, path)
+	}
+	return nil
+}
+
+// validateObject checks properties, required and additionalProperties.
+func (v schemaValidator) validateObject(schema map[string]any, object map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, exists := object[name]; !exists {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	for name, value := range object {
+		propertyPath := path + "." + name
+		if property, ok := properties[name].(map[string]any); ok {
+			if err := v.validate(property, value, propertyPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: additional property not allowed", propertyPath)
+			}
+		case map[string]any:
+			if err := v.validate(additional, value, propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateArray checks items and item count bounds.
+func (v schemaValidator) validateArray(schema map[string]any, array []any, path string) error {
+	if minItems, ok := schema["minItems"].(float64); ok && float64(len(array)) < minItems {
+		return fmt.Errorf("%s: expected at least %v items", path, minItems)
+	}
+	if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(array)) > maxItems {
+		return fmt.Errorf("%s: expected at most %v items", path, maxItems)
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range array {
+			if err := v.validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateString checks length bounds and pattern.
+func validateString(schema map[string]any, value, path string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+		return fmt.Errorf("%s: expected at least %v characters", path, minLength)
+	}
+	if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+		return fmt.Errorf("%s: expected at most %v characters", path, maxLength)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		// Patterns Go can't compile (e.g. lookarounds) are skipped rather than failing valid calls
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			return fmt.Errorf("%s: value does not match pattern %q", path, pattern)
+		}
+	}
+	return nil
+}
+
+// validateNumber checks numeric bounds.
+func validateNumber(schema map[string]any, value float64, path string) error {
+	if minimum, ok := schema["minimum"].(float64); ok && value < minimum {
+		return fmt.Errorf("%s: expected at least %v", path, minimum)
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && value > maximum {
+		return fmt.Errorf("%s: expected at most %v", path, maximum)
+	}
+	if minimum, ok := schema["exclusiveMinimum"].(float64); ok && value <= minimum {
+		return fmt.Errorf("%s: expected more than %v", path, minimum)
+	}
+	if maximum, ok := schema["exclusiveMaximum"].(float64); ok && value >= maximum {
+		return fmt.Errorf("%s: expected less than %v", path, maximum)
+	}
+	return nil
+}
+
+// matchesSchemaType reports whether a value matches a schema type or list of types.
+func matchesSchemaType(schemaType any, value any) bool {
+	if list, ok := schemaType.([]any); ok {
+		return slices.ContainsFunc(list, func(item any) bool { return matchesSchemaType(item, value) })
+	}
+
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return true // Unknown types are not enforced
+	}
+}
+
+// schemaList returns the object schemas of a keyword holding a list of schemas.
+func schemaList(value any) []map[string]any {
+	list, _ := value.([]any)
+	schemas := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if schema, ok := item.(map[string]any); ok {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
@@ -0,0 +1,122 @@
+package anthropicclaude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// parseSchema decodes a JSON schema literal.
+func parseSchema(t *testing.T, schema string) map[string]any {
+	t.Helper()
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(schema), &parsed); err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	return parsed
+}
+
+func TestValidateToolArguments_RefCycles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		schema    string
+		arguments string
+		wantErr   string
+	}{
+		{
+			name:      "root self reference",
+			schema:    `{"$ref":"#"}`,
+			arguments: `{}`,
+			wantErr:   "cycle",
+		},
+		{
+			name:      "definition self reference",
+			schema:    `{"$ref":"#/$defs/A","$defs":{"A":{"$ref":"#/$defs/A"}}}`,
+			arguments: `{}`,
+			wantErr:   "cycle",
+		},
+		{
+			name:      "mutual references",
+			schema:    `{"$ref":"#/$defs/A","$defs":{"A":{"$ref":"#/$defs/B"},"B":{"anyOf":[{"$ref":"#/$defs/A"}]}}}`,
+			arguments: `{}`,
+			wantErr:   "matches none of anyOf",
+		},
+		{
+			name: "recursion consuming input",
+			schema: `{"type":"object","properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#"}}},
+				"required":["name","children"],"additionalProperties":false}`,
+			arguments: `{"name":"root","children":[{"name":"leaf","children":[]}]}`,
+		},
+		{
+			name: "recursion consuming invalid input",
+			schema: `{"type":"object","properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#"}}},
+				"required":["name","children"],"additionalProperties":false}`,
+			arguments: `{"name":"root","children":[{"name":1,"children":[]}]}`,
+			wantErr:   "$.children[0].name: expected type string",
+		},
+		{
+			name:      "same reference for sibling values",
+			schema:    `{"type":"object","properties":{"a":{"$ref":"#/$defs/S"},"b":{"$ref":"#/$defs/S"}},"$defs":{"S":{"type":"string"}}}`,
+			arguments: `{"a":"x","b":"y"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateToolArguments(parseSchema(t, tt.schema), tt.arguments)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected arguments to be valid, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeToolSchema_InliningLimit(t *testing.T) {
+	t.Parallel()
+
+	// Each definition references the next one twice, so full inlining would copy 2^40 nodes
+	const depth = 40
+	defs := make(map[string]any, depth+1)
+	for i := range depth {
+		next := map[string]any{"$ref": fmt.Sprintf("#/$defs/D%d", i+1)}
+		defs[fmt.Sprintf("D%d", i)] = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"left": next, "right": next},
+		}
+	}
+	defs[fmt.Sprintf("D%d", depth)] = map[string]any{"type": "string"}
+	schema := map[string]any{"$ref": "#/$defs/D0", "$defs": defs}
+
+	normalized, err := normalizeToolSchema(schema, false)
+	if err != nil {
+		t.Fatalf("Failed to normalize schema: %v", err)
+	}
+
+	if _, ok := normalized.Schema["$defs"]; !ok {
+		t.Error("Expected definitions to be kept for references past the inlining limit")
+	}
+	if nodes := countJSONNodes(normalized.Schema); nodes > 2*maxInlinedSchemaNodes {
+		t.Errorf("Expected at most %d nodes after inlining, got %d", 2*maxInlinedSchemaNodes, nodes)
+	}
+
+	// References within the budget are still inlined
+	normalized, err = normalizeToolSchema(parseSchema(t,
+		`{"type":"object","properties":{"a":{"$ref":"#/$defs/S"}},"$defs":{"S":{"type":"string"}}}`), false)
+	if err != nil {
+		t.Fatalf("Failed to normalize schema: %v", err)
+	}
+	if _, ok := normalized.Schema["$defs"]; ok {
+		t.Error("Expected definitions to be dropped after inlining all references")
+	}
+}
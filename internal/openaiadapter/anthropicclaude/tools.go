@@ -1,11 +1,14 @@
 package anthropicclaude
 
 import (
+	"encoding/json"
 	"fmt"
+	"log/slog"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/google/uuid"
 
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
 )
 
@@ -31,55 +34,30 @@ func fromChatCompletionTools(
 				return nil, fmt.Errorf("extract function tool %d: %w", i, err)
 			}
 
-			toolParam := anthropic.ToolParam{
-				Name:        chatTool.Function.Name,
-				InputSchema: anthropic.ToolInputSchemaParam{},
+			strict := chatTool.Function.Strict != nil && *chatTool.Function.Strict
+			toolParam, err := newToolParam(chatTool.Function.Name, chatTool.Function.Description, chatTool.Function.Parameters, strict)
+			if err != nil {
+				return nil, err
 			}
+			anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
+				OfTool: &toolParam,
+			})
 
-			if chatTool.Function.Description != nil {
-				toolParam.Description = anthropic.String(*chatTool.Function.Description)
+		case string(types.CustomToolChatCompletionsTypeCustom):
+			customTool, err := toolItem.AsCustomToolChatCompletions()
+			if err != nil {
+				return nil, fmt.Errorf("extract custom tool %d: %w", i, err)
 			}
 
-			// Transform schema format: OpenAI uses flat JSON Schema object, Anthropic separates
-			// properties/required into distinct fields with remaining fields in ExtraFields.
-			if chatTool.Function.Parameters != nil {
-				params := *chatTool.Function.Parameters
-
-				if props, ok := params["properties"]; ok {
-					toolParam.InputSchema.Properties = props
-				}
-
-				if req, ok := params["required"].([]any); ok {
-					var required []string
-					for _, r := range req {
-						if s, ok := r.(string); ok {
-							required = append(required, s)
-						}
-					}
-					toolParam.InputSchema.Required = required
-				}
-
-				// Preserve schema fields without dedicated Anthropic struct fields (e.g., additionalProperties).
-				var extraFields map[string]any
-				for key, value := range params {
-					if key != "type" && key != "properties" && key != "required" {
-						if extraFields == nil {
-							extraFields = make(map[string]any)
-						}
-						extraFields[key] = value
-					}
-				}
-				toolParam.InputSchema.ExtraFields = extraFields
+			// Anthropic only supports function tools; custom tools are emulated (see newCustomToolParam)
+			toolParam, err := newCustomToolParam(customTool)
+			if err != nil {
+				return nil, fmt.Errorf("convert custom tool %d: %w", i, err)
 			}
-
 			anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
 				OfTool: &toolParam,
 			})
 
-		case string(types.Custom):
-			// Anthropic only supports standard function tools, not OpenAI's custom tool extensions.
-			return nil, fmt.Errorf("custom tool not supported by Anthropic Claude at index %d", i)
-
 		default:
 			return nil, fmt.Errorf("unsupported tool type %s at index %d", discriminator, i)
 		}
@@ -88,6 +66,79 @@ func fromChatCompletionTools(
 	return anthropicTools, nil
 }
 
+// newToolParam builds an Anthropic tool from an OpenAI function definition.
+func newToolParam(
+	name string,
+	description *string,
+	parameters *types.FunctionParameters,
+	strict bool,
+) (anthropic.ToolParam, error) {
+	toolParam := anthropic.ToolParam{
+		Name:        name,
+		InputSchema: anthropic.ToolInputSchemaParam{},
+	}
+
+	if description != nil {
+		toolParam.Description = anthropic.String(toolDescription(name, *description))
+	}
+
+	var params map[string]any
+	if parameters != nil {
+		params = *parameters
+	}
+	normalized, err := normalizeToolSchema(params, strict)
+	if err != nil {
+		return toolParam, newInvalidRequestError("invalid parameters schema of function %s: %s", name, err)
+	}
+	if normalized.Truncated > 0 {
+		slog.Warn("tool schema descriptions truncated",
+			"tool", name, "count", normalized.Truncated, "max_length", maxToolDescriptionLength)
+	}
+
+	// Transform schema format: OpenAI uses flat JSON Schema object, Anthropic separates
+	// properties/required into distinct fields with remaining fields in ExtraFields.
+	if parameters != nil {
+		schema := normalized.Schema
+
+		if props, ok := schema["properties"]; ok {
+			toolParam.InputSchema.Properties = props
+		}
+
+		if req, ok := schema["required"].([]any); ok {
+			var required []string
+			for _, r := range req {
+				if s, ok := r.(string); ok {
+					required = append(required, s)
+				}
+			}
+			toolParam.InputSchema.Required = required
+		}
+
+		// Preserve schema fields without dedicated Anthropic struct fields (e.g., additionalProperties).
+		var extraFields map[string]any
+		for key, value := range schema {
+			if key != "type" && key != "properties" && key != "required" {
+				if extraFields == nil {
+					extraFields = make(map[string]any)
+				}
+				extraFields[key] = value
+			}
+		}
+		toolParam.InputSchema.ExtraFields = extraFields
+	}
+
+	return toolParam, nil
+}
+
+// toolDescription truncates oversized tool descriptions (see maxToolDescriptionLength).
+func toolDescription(name, description string) string {
+	truncated, ok := truncateDescription(description)
+	if ok {
+		slog.Warn("tool description truncated", "tool", name, "max_length", maxToolDescriptionLength)
+	}
+	return truncated
+}
+
 // fromToolChoiceOption converts OpenAI tool_choice to Anthropic ToolChoiceUnionParam.
 func fromToolChoiceOption(
 	toolChoice *types.ChatCompletionToolChoiceOption,
@@ -132,7 +183,12 @@ func fromToolChoiceOption(
 
 	if customChoice, err := toolChoice.AsChatCompletionNamedToolChoiceCustom(); err == nil {
 		if customChoice.Type == types.ChatCompletionNamedToolChoiceCustomTypeCustom {
-			return anthropic.ToolChoiceUnionParam{}, fmt.Errorf("custom tools not supported by Anthropic Claude")
+			// Custom tools are emulated by function tools of the same name
+			return anthropic.ToolChoiceUnionParam{
+				OfTool: &anthropic.ToolChoiceToolParam{
+					Name: customChoice.Custom.Name,
+				},
+			}, nil
 		}
 	}
 
@@ -166,9 +222,9 @@ func toChatCompletionMessageToolCalls(content []anthropic.ContentBlockUnion) (*t
 		// AsAny() returns the concrete type for Anthropic SDK union discrimination.
 		switch variant := block.AsAny().(type) {
 		case anthropic.ToolUseBlock:
-			// CustomToolCall transformation: OpenAI's ChatCompletionMessageCustomToolCall allows
-			// arbitrary custom tool definitions beyond standard function calling. Anthropic
-			// only supports standard function-based tools with no custom tool extension mechanism.
+			// CustomToolCall transformation: calls of emulated custom tools are returned as
+			// function calls here and rewritten by convertToolCalls, which knows the
+			// request's tools.
 
 			// OpenAI spec requires tool_call_id; generate fallback if missing.
 			toolCallID := variant.ID
@@ -215,3 +271,143 @@ func toChatCompletionMessageToolCalls(content []anthropic.ContentBlockUnion) (*t
 func newToolCallID() string {
 	return fmt.Sprintf("call_%s", uuid.New().String()[:8])
 }
+
+// toolCallConversion describes how calls of a tool are converted back to the client's format.
+type toolCallConversion struct {
+	// Custom marks emulated custom tools whose raw input is unwrapped (see newCustomToolParam).
+	Custom bool
+
+	// Wrapped marks non-object schema roots whose arguments are unwrapped (see normalizeToolSchema).
+	Wrapped bool
+
+	// StrictSchema is the schema that arguments of strict functions must match.
+	StrictSchema map[string]any
+}
+
+// toolCallConversions returns conversions of the request's tools by name, or nil if all
+// tool calls are returned unchanged.
+func toolCallConversions(clientReq openaiadapter.CreateChatCompletionRequest) map[string]toolCallConversion {
+	var conversions map[string]toolCallConversion
+	add := func(name string, conversion toolCallConversion) {
+		if !conversion.Custom && !conversion.Wrapped && conversion.StrictSchema == nil {
+			return
+		}
+		if conversions == nil {
+			conversions = make(map[string]toolCallConversion)
+		}
+		conversions[name] = conversion
+	}
+	// Wrapping is decided after reference inlining, so the schema is normalized again
+	wrapped := func(parameters *types.FunctionParameters) bool {
+		if parameters == nil {
+			return false
+		}
+		normalized, err := normalizeToolSchema(*parameters, false)
+		return err == nil && normalized.Wrapped
+	}
+
+	if clientReq.Tools != nil {
+		for _, toolItem := range *clientReq.Tools {
+			discriminator, err := toolItem.Discriminator()
+			if err != nil {
+				continue
+			}
+			switch discriminator {
+			case string(types.Function):
+				chatTool, err := toolItem.AsChatCompletionTool()
+				if err != nil {
+					continue
+				}
+				conversion := toolCallConversion{Wrapped: wrapped(chatTool.Function.Parameters)}
+				if chatTool.Function.Strict != nil && *chatTool.Function.Strict {
+					conversion.StrictSchema = strictValidationSchema(chatTool.Function.Parameters)
+				}
+				add(chatTool.Function.Name, conversion)
+			case string(types.CustomToolChatCompletionsTypeCustom):
+				customTool, err := toolItem.AsCustomToolChatCompletions()
+				if err != nil {
+					continue
+				}
+				add(customTool.Custom.Name, toolCallConversion{Custom: true})
+			}
+		}
+	}
+
+	if clientReq.Functions != nil {
+		for _, function := range *clientReq.Functions {
+			add(function.Name, toolCallConversion{Wrapped: wrapped(function.Parameters)})
+		}
+	}
+
+	return conversions
+}
+
+// convertArguments converts the JSON arguments the model generated for the emulating
+// Anthropic tool back to the client's format: raw input for custom tools, JSON otherwise.
+func (c toolCallConversion) convertArguments(name, arguments string) (string, error) {
+	if c.Custom {
+		return customToolCallInput(arguments), nil
+	}
+
+	if c.Wrapped {
+		var wrapped map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(arguments), &wrapped); err == nil {
+			if value, ok := wrapped[wrappedSchemaProperty]; ok {
+				arguments = string(value)
+			}
+		}
+	}
+
+	if c.StrictSchema != nil {
+		if err := validateToolArguments(c.StrictSchema, arguments); err != nil {
+			return "", fmt.Errorf("arguments of strict function %s do not match its schema: %w", name, err)
+		}
+	}
+	return arguments, nil
+}
+
+// convertToolCalls converts function tool calls of a response with toolCallConversions.
+func convertToolCalls(resp *openaiadapter.CreateChatCompletionResponse, conversions map[string]toolCallConversion) error {
+	for i := range resp.Choices {
+		toolCalls := resp.Choices[i].Message.ToolCalls
+		if toolCalls == nil {
+			continue
+		}
+
+		for j, item := range *toolCalls {
+			toolCall, err := item.AsChatCompletionMessageToolCall()
+			if err != nil {
+				return fmt.Errorf("extract tool call for conversion: %w", err)
+			}
+			conversion, ok := conversions[toolCall.Function.Name]
+			if !ok {
+				continue
+			}
+
+			arguments, err := conversion.convertArguments(toolCall.Function.Name, toolCall.Function.Arguments)
+			if err != nil {
+				return err
+			}
+
+			if !conversion.Custom {
+				toolCall.Function.Arguments = arguments
+				if err := (*toolCalls)[j].FromChatCompletionMessageToolCall(toolCall); err != nil {
+					return fmt.Errorf("create tool call item: %w", err)
+				}
+				continue
+			}
+
+			customToolCall := types.ChatCompletionMessageCustomToolCall{
+				Id:   toolCall.Id,
+				Type: types.ChatCompletionMessageCustomToolCallTypeCustom,
+			}
+			customToolCall.Custom.Name = toolCall.Function.Name
+			customToolCall.Custom.Input = arguments
+
+			if err := (*toolCalls)[j].FromChatCompletionMessageCustomToolCall(customToolCall); err != nil {
+				return fmt.Errorf("create custom tool call item: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -31,8 +31,8 @@ func toCompletionUsage(usage anthropic.Usage) *types.CompletionUsage {
 
 	// CompletionTokensDetails transformation: OpenAI tracks reasoning_tokens separately
 	// for extended thinking. Anthropic's thinking content is included in output_tokens
-	// without separate breakdown. While ThinkingBlock content exists in responses,
-	// usage metadata doesn't distinguish thinking tokens from regular output tokens.
+	// without separate breakdown, so reasoning tokens are only set where they can be
+	// derived (see setReasoningTokens).
 
 	// AcceptedPredictionTokens/RejectedPredictionTokens transformation: OpenAI's
 	// prediction token tracking for "Predicted Outputs" feature. Anthropic API
@@ -40,3 +40,96 @@ func toCompletionUsage(usage anthropic.Usage) *types.CompletionUsage {
 
 	return completionUsage
 }
+
+// accumulateDeltaUsage applies the cumulative usage of a message_delta event. Input counts
+// are only reported there by newer API versions and otherwise kept from message_start.
+func accumulateDeltaUsage(usage *anthropic.Usage, delta anthropic.MessageDeltaUsage) {
+	usage.OutputTokens = delta.OutputTokens
+	if delta.JSON.InputTokens.Valid() {
+		usage.InputTokens = delta.InputTokens
+	}
+	if delta.JSON.CacheCreationInputTokens.Valid() {
+		usage.CacheCreationInputTokens = delta.CacheCreationInputTokens
+	}
+	if delta.JSON.CacheReadInputTokens.Valid() {
+		usage.CacheReadInputTokens = delta.CacheReadInputTokens
+	}
+}
+
+// setReasoningTokens sets reasoning_tokens where they can be derived from the response:
+// without thinking blocks the model spent no tokens on reasoning. With thinking, the
+// share of output_tokens is unknown and reasoning_tokens stays unset.
+func setReasoningTokens(usage *types.CompletionUsage, thinking bool) {
+	if usage == nil || thinking {
+		return
+	}
+	reasoningTokens := 0
+	usage.CompletionTokensDetails = &struct {
+		AcceptedPredictionTokens *int `json:"accepted_prediction_tokens,omitempty"`
+		AudioTokens              *int `json:"audio_tokens,omitempty"`
+		ReasoningTokens          *int `json:"reasoning_tokens,omitempty"`
+		RejectedPredictionTokens *int `json:"rejected_prediction_tokens,omitempty"`
+	}{
+		ReasoningTokens: &reasoningTokens,
+	}
+}
+
+// hasThinking reports whether content contains (redacted) thinking blocks.
+func hasThinking(content []anthropic.ContentBlockUnion) bool {
+	for _, block := range content {
+		if block.Type == "thinking" || block.Type == "redacted_thinking" {
+			return true
+		}
+	}
+	return false
+}
+
+// sumCompletionUsage sums usage, e.g. across candidates of a response. Token details are
+// only summed if known for every usage, so a partial sum is never reported as total.
+func sumCompletionUsage(usages []*types.CompletionUsage) *types.CompletionUsage {
+	total := &types.CompletionUsage{}
+	var cachedTokens, reasoningTokens *int
+	reasoningKnown := true
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.TotalTokens += usage.TotalTokens
+
+		// Cached tokens are omitted when zero, so missing details count as zero
+		if usage.PromptTokensDetails != nil && usage.PromptTokensDetails.CachedTokens != nil {
+			cachedTokens = addTokens(cachedTokens, *usage.PromptTokensDetails.CachedTokens)
+		}
+
+		// Reasoning tokens are omitted when unknown, so missing details make the sum unknown
+		if usage.CompletionTokensDetails == nil || usage.CompletionTokensDetails.ReasoningTokens == nil {
+			reasoningKnown = false
+		} else {
+			reasoningTokens = addTokens(reasoningTokens, *usage.CompletionTokensDetails.ReasoningTokens)
+		}
+	}
+
+	if cachedTokens != nil {
+		total.PromptTokensDetails = &struct {
+			AudioTokens  *int `json:"audio_tokens,omitempty"`
+			CachedTokens *int `json:"cached_tokens,omitempty"`
+		}{
+			CachedTokens: cachedTokens,
+		}
+	}
+	if reasoningKnown && reasoningTokens != nil {
+		setReasoningTokens(total, false)
+		total.CompletionTokensDetails.ReasoningTokens = reasoningTokens
+	}
+	return total
+}
+
+// addTokens adds n to an optional token count.
+func addTokens(count *int, n int) *int {
+	if count != nil {
+		n += *count
+	}
+	return &n
+}
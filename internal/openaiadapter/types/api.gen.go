@@ -8,6 +8,29 @@ import (
 	"errors"
 
 	"github.com/oapi-codegen/runtime"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+// Defines values for BatchObject.
+const (
+	BatchObjectBatch BatchObject = "batch"
+)
+
+// Defines values for BatchStatus.
+const (
+	Cancelled  BatchStatus = "cancelled"
+	Cancelling BatchStatus = "cancelling"
+	Completed  BatchStatus = "completed"
+	Expired    BatchStatus = "expired"
+	Failed     BatchStatus = "failed"
+	Finalizing BatchStatus = "finalizing"
+	InProgress BatchStatus = "in_progress"
+	Validating BatchStatus = "validating"
+)
+
+// Defines values for BatchRequestInputMethod.
+const (
+	POST BatchRequestInputMethod = "POST"
 )
 
 // Defines values for ChatCompletionAllowedToolsMode.
@@ -21,11 +44,29 @@ const (
 	AllowedTools ChatCompletionAllowedToolsChoiceType = "allowed_tools"
 )
 
+// Defines values for ChatCompletionAnnotationType.
+const (
+	DocumentCitation ChatCompletionAnnotationType = "document_citation"
+	UrlCitation      ChatCompletionAnnotationType = "url_citation"
+)
+
+// Defines values for ChatCompletionDocumentCitationLocationType.
+const (
+	CharLocation         ChatCompletionDocumentCitationLocationType = "char_location"
+	ContentBlockLocation ChatCompletionDocumentCitationLocationType = "content_block_location"
+	PageLocation         ChatCompletionDocumentCitationLocationType = "page_location"
+)
+
 // Defines values for ChatCompletionMessageCustomToolCallType.
 const (
 	ChatCompletionMessageCustomToolCallTypeCustom ChatCompletionMessageCustomToolCallType = "custom"
 )
 
+// Defines values for ChatCompletionMessageCustomToolCallChunkType.
+const (
+	ChatCompletionMessageCustomToolCallChunkTypeCustom ChatCompletionMessageCustomToolCallChunkType = "custom"
+)
+
 // Defines values for ChatCompletionMessageToolCallType.
 const (
 	ChatCompletionMessageToolCallTypeFunction ChatCompletionMessageToolCallType = "function"
@@ -114,11 +155,6 @@ const (
 	User ChatCompletionRequestUserMessageRole = "user"
 )
 
-// Defines values for ChatCompletionResponseMessageAnnotationsType.
-const (
-	UrlCitation ChatCompletionResponseMessageAnnotationsType = "url_citation"
-)
-
 // Defines values for ChatCompletionResponseMessageRole.
 const (
 	ChatCompletionResponseMessageRoleAssistant ChatCompletionResponseMessageRole = "assistant"
@@ -145,6 +181,16 @@ const (
 	ChatCompletionToolChoiceOption0Required ChatCompletionToolChoiceOption0 = "required"
 )
 
+// Defines values for CreateBatchRequestCompletionWindow.
+const (
+	N24h CreateBatchRequestCompletionWindow = "24h"
+)
+
+// Defines values for CreateBatchRequestEndpoint.
+const (
+	V1chatcompletions CreateBatchRequestEndpoint = "/v1/chat/completions"
+)
+
 // Defines values for CreateChatCompletionRequestAudioFormat.
 const (
 	CreateChatCompletionRequestAudioFormatAac   CreateChatCompletionRequestAudioFormat = "aac"
@@ -201,9 +247,31 @@ const (
 	CreateChatCompletionStreamResponseChoiceFinishReasonToolCalls     CreateChatCompletionStreamResponseChoiceFinishReason = "tool_calls"
 )
 
+// Defines values for CreateCompletionResponseObject.
+const (
+	TextCompletion CreateCompletionResponseObject = "text_completion"
+)
+
+// Defines values for CreateCompletionResponseChoiceFinishReason.
+const (
+	ContentFilter CreateCompletionResponseChoiceFinishReason = "content_filter"
+	Length        CreateCompletionResponseChoiceFinishReason = "length"
+	Stop          CreateCompletionResponseChoiceFinishReason = "stop"
+)
+
+// Defines values for CreateFileRequestPurpose.
+const (
+	CreateFileRequestPurposeAssistants CreateFileRequestPurpose = "assistants"
+	CreateFileRequestPurposeBatch      CreateFileRequestPurpose = "batch"
+	CreateFileRequestPurposeEvals      CreateFileRequestPurpose = "evals"
+	CreateFileRequestPurposeFineTune   CreateFileRequestPurpose = "fine-tune"
+	CreateFileRequestPurposeUserData   CreateFileRequestPurpose = "user_data"
+	CreateFileRequestPurposeVision     CreateFileRequestPurpose = "vision"
+)
+
 // Defines values for CustomToolChatCompletionsType.
 const (
-	Custom CustomToolChatCompletionsType = "custom"
+	CustomToolChatCompletionsTypeCustom CustomToolChatCompletionsType = "custom"
 )
 
 // Defines values for CustomToolChatCompletionsGrammarFormatGrammarSyntax.
@@ -227,6 +295,18 @@ const (
 	ErrorEventEventError ErrorEventEvent = "error"
 )
 
+// Defines values for ListBatchesResponseObject.
+const (
+	List ListBatchesResponseObject = "list"
+)
+
+// Defines values for OpenAIFileStatus.
+const (
+	OpenAIFileStatusError     OpenAIFileStatus = "error"
+	OpenAIFileStatusProcessed OpenAIFileStatus = "processed"
+	OpenAIFileStatusUploaded  OpenAIFileStatus = "uploaded"
+)
+
 // Defines values for PredictionContentType.
 const (
 	Content PredictionContentType = "content"
@@ -283,6 +363,139 @@ const (
 	Medium WebSearchContextSize = "medium"
 )
 
+// Defines values for ListFilesParamsOrder.
+const (
+	Asc  ListFilesParamsOrder = "asc"
+	Desc ListFilesParamsOrder = "desc"
+)
+
+// Batch defines model for Batch.
+type Batch struct {
+	// CancelledAt The Unix timestamp (in seconds) for when the batch was cancelled.
+	CancelledAt *int `json:"cancelled_at,omitempty"`
+
+	// CancellingAt The Unix timestamp (in seconds) for when the batch started cancelling.
+	CancellingAt *int `json:"cancelling_at,omitempty"`
+
+	// CompletedAt The Unix timestamp (in seconds) for when the batch was completed.
+	CompletedAt *int `json:"completed_at,omitempty"`
+
+	// CompletionWindow The time frame within which the batch should be processed.
+	CompletionWindow string `json:"completion_window"`
+
+	// CreatedAt The Unix timestamp (in seconds) for when the batch was created.
+	CreatedAt int `json:"created_at"`
+
+	// Endpoint The OpenAI API endpoint used by the batch.
+	Endpoint string `json:"endpoint"`
+
+	// ErrorFileId The ID of the file containing the outputs of requests with errors.
+	ErrorFileId *string `json:"error_file_id,omitempty"`
+	Errors      *struct {
+		Data *[]struct {
+			// Code An error code identifying the error type.
+			Code *string `json:"code,omitempty"`
+
+			// Line The line number of the input file where the error occurred, if applicable.
+			Line *int `json:"line"`
+
+			// Message A human-readable message providing more details about the error.
+			Message *string `json:"message,omitempty"`
+
+			// Param The name of the parameter that caused the error, if applicable.
+			Param *string `json:"param"`
+		} `json:"data,omitempty"`
+
+		// Object The object type, which is always `list`.
+		Object *string `json:"object,omitempty"`
+	} `json:"errors,omitempty"`
+
+	// ExpiredAt The Unix timestamp (in seconds) for when the batch expired.
+	ExpiredAt *int `json:"expired_at,omitempty"`
+
+	// ExpiresAt The Unix timestamp (in seconds) for when the batch will expire.
+	ExpiresAt *int `json:"expires_at,omitempty"`
+
+	// FailedAt The Unix timestamp (in seconds) for when the batch failed.
+	FailedAt *int `json:"failed_at,omitempty"`
+
+	// FinalizingAt The Unix timestamp (in seconds) for when the batch started finalizing.
+	FinalizingAt *int   `json:"finalizing_at,omitempty"`
+	Id           string `json:"id"`
+
+	// InProgressAt The Unix timestamp (in seconds) for when the batch started processing.
+	InProgressAt *int `json:"in_progress_at,omitempty"`
+
+	// InputFileId The ID of the input file for the batch.
+	InputFileId string `json:"input_file_id"`
+
+	// Metadata Set of 16 key-value pairs that can be attached to an object. This can be
+	// useful for storing additional information about the object in a structured
+	// format, and querying for objects via API or the dashboard.
+	//
+	// Keys are strings with a maximum length of 64 characters. Values are strings
+	// with a maximum length of 512 characters.
+	Metadata *Metadata `json:"metadata"`
+
+	// Object The object type, which is always `batch`.
+	Object BatchObject `json:"object"`
+
+	// OutputFileId The ID of the file containing the outputs of successfully executed requests.
+	OutputFileId *string `json:"output_file_id,omitempty"`
+
+	// RequestCounts The request counts for different statuses within the batch.
+	RequestCounts *struct {
+		// Completed Number of requests that have been completed successfully.
+		Completed int `json:"completed"`
+
+		// Failed Number of requests that have failed.
+		Failed int `json:"failed"`
+
+		// Total Total number of requests in the batch.
+		Total int `json:"total"`
+	} `json:"request_counts,omitempty"`
+
+	// Status The current status of the batch.
+	Status BatchStatus `json:"status"`
+}
+
+// BatchObject The object type, which is always `batch`.
+type BatchObject string
+
+// BatchStatus The current status of the batch.
+type BatchStatus string
+
+// BatchRequestInput The per-line object of the batch input file
+type BatchRequestInput struct {
+	Body CreateChatCompletionRequest `json:"body"`
+
+	// CustomId A developer-provided per-request id that will be used to match outputs to inputs. Must be unique for each request in a batch.
+	CustomId string                  `json:"custom_id"`
+	Method   BatchRequestInputMethod `json:"method"`
+
+	// Url The relative URL to be used for the request. Only `/v1/chat/completions` is supported.
+	Url string `json:"url"`
+}
+
+// BatchRequestInputMethod defines model for BatchRequestInput.Method.
+type BatchRequestInputMethod string
+
+// BatchRequestOutput The per-line object of the batch output file
+type BatchRequestOutput struct {
+	// CustomId A developer-provided per-request id that will be used to match outputs to inputs.
+	CustomId string `json:"custom_id"`
+	Error    *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Id       string `json:"id"`
+	Response *struct {
+		Body       CreateChatCompletionResponse `json:"body"`
+		RequestId  string                       `json:"request_id"`
+		StatusCode int                          `json:"status_code"`
+	} `json:"response"`
+}
+
 // ChatCompletionAllowedTools Constrains the tools available to the model to a pre-defined set.
 type ChatCompletionAllowedTools struct {
 	// Mode Constrains the tools available to the model to a pre-defined set.
@@ -321,6 +534,50 @@ type ChatCompletionAllowedToolsChoice struct {
 // ChatCompletionAllowedToolsChoiceType defines model for ChatCompletionAllowedToolsChoice.Type.
 type ChatCompletionAllowedToolsChoiceType string
 
+// ChatCompletionAnnotation A citation for a span of the message content. `url_citation` follows OpenAI; `document_citation` is a proxy extension for citations of request documents, which have no URL.
+type ChatCompletionAnnotation struct {
+	// DocumentCitation A citation of a document from the request (proxy extension).
+	DocumentCitation *ChatCompletionDocumentCitation `json:"document_citation,omitempty"`
+	Type             ChatCompletionAnnotationType    `json:"type"`
+
+	// UrlCitation A URL citation when using web search.
+	UrlCitation *ChatCompletionUrlCitation `json:"url_citation,omitempty"`
+}
+
+// ChatCompletionAnnotationType defines model for ChatCompletionAnnotation.Type.
+type ChatCompletionAnnotationType string
+
+// ChatCompletionDocumentCitation A citation of a document from the request (proxy extension).
+type ChatCompletionDocumentCitation struct {
+	// CitedText The quoted text from the document.
+	CitedText string `json:"cited_text"`
+
+	// DocumentIndex Index of the cited document among all documents in the request.
+	DocumentIndex int `json:"document_index"`
+
+	// DocumentTitle Title of the cited document (e.g. the filename).
+	DocumentTitle *string `json:"document_title,omitempty"`
+
+	// EndIndex The index of the last character of the cited span in the message.
+	EndIndex int `json:"end_index"`
+
+	// Location Where the cited text is located in the document: characters of text documents, pages of PDFs (1-indexed) or content blocks of custom content documents. Ranges are exclusive at the end.
+	Location ChatCompletionDocumentCitationLocation `json:"location"`
+
+	// StartIndex The index of the first character of the cited span in the message.
+	StartIndex int `json:"start_index"`
+}
+
+// ChatCompletionDocumentCitationLocation Where the cited text is located in the document: characters of text documents, pages of PDFs (1-indexed) or content blocks of custom content documents. Ranges are exclusive at the end.
+type ChatCompletionDocumentCitationLocation struct {
+	End   int                                        `json:"end"`
+	Start int                                        `json:"start"`
+	Type  ChatCompletionDocumentCitationLocationType `json:"type"`
+}
+
+// ChatCompletionDocumentCitationLocationType defines model for ChatCompletionDocumentCitationLocation.Type.
+type ChatCompletionDocumentCitationLocationType string
+
 // ChatCompletionFunctionCallOption Specifying a particular function via `{"name": "my_function"}` forces the model to call that function.
 type ChatCompletionFunctionCallOption struct {
 	// Name The name of the function to call.
@@ -357,6 +614,23 @@ type ChatCompletionMessageCustomToolCall struct {
 // ChatCompletionMessageCustomToolCallType defines model for ChatCompletionMessageCustomToolCall.Type.
 type ChatCompletionMessageCustomToolCallType string
 
+// ChatCompletionMessageCustomToolCallChunk defines model for ChatCompletionMessageCustomToolCallChunk.
+type ChatCompletionMessageCustomToolCallChunk struct {
+	Custom *struct {
+		// Input The input for the custom tool call generated by the model.
+		Input *string `json:"input,omitempty"`
+
+		// Name The name of the custom tool to call.
+		Name *string `json:"name,omitempty"`
+	} `json:"custom,omitempty"`
+	Id    *string                                      `json:"id,omitempty"`
+	Index int                                          `json:"index"`
+	Type  ChatCompletionMessageCustomToolCallChunkType `json:"type"`
+}
+
+// ChatCompletionMessageCustomToolCallChunkType defines model for ChatCompletionMessageCustomToolCallChunk.Type.
+type ChatCompletionMessageCustomToolCallChunkType string
+
 // ChatCompletionMessageToolCall A call to a function tool created by the model.
 type ChatCompletionMessageToolCall struct {
 	Function struct {
@@ -451,6 +725,9 @@ type ChatCompletionRequestAssistantMessage struct {
 	Refusal *string                                   `json:"refusal"`
 	Role    ChatCompletionRequestAssistantMessageRole `json:"role"`
 
+	// ServerToolState Extension: opaque state of Anthropic server tool activity (web search, code execution) in this message. Send it back unchanged with the assistant message to preserve the original content blocks in history.
+	ServerToolState *string `json:"server_tool_state,omitempty"`
+
 	// ToolCalls The tool calls generated by the model, such as function calls.
 	ToolCalls *ChatCompletionMessageToolCalls `json:"tool_calls,omitempty"`
 }
@@ -686,16 +963,8 @@ type ChatCompletionRequestUserMessageContentPart struct {
 
 // ChatCompletionResponseMessage defines model for ChatCompletionResponseMessage.
 type ChatCompletionResponseMessage struct {
-	Annotations *[]struct {
-		Type        ChatCompletionResponseMessageAnnotationsType `json:"type"`
-		UrlCitation struct {
-			EndIndex   int    `json:"end_index"`
-			StartIndex int    `json:"start_index"`
-			Title      string `json:"title"`
-			Url        string `json:"url"`
-		} `json:"url_citation"`
-	} `json:"annotations,omitempty"`
-	Audio *struct {
+	Annotations *[]ChatCompletionAnnotation `json:"annotations,omitempty"`
+	Audio       *struct {
 		// Data Base64 encoded audio bytes generated by the model, in the format specified in the request.
 		Data      string `json:"data"`
 		ExpiresAt int    `json:"expires_at"`
@@ -724,13 +993,13 @@ type ChatCompletionResponseMessage struct {
 	Refusal *string                           `json:"refusal"`
 	Role    ChatCompletionResponseMessageRole `json:"role"`
 
+	// ServerToolState Extension: opaque state of Anthropic server tool activity (web search, code execution) in this message. Send it back unchanged with the assistant message to preserve the original content blocks in history.
+	ServerToolState *string `json:"server_tool_state,omitempty"`
+
 	// ToolCalls The tool calls generated by the model, such as function calls.
 	ToolCalls *ChatCompletionMessageToolCalls `json:"tool_calls,omitempty"`
 }
 
-// ChatCompletionResponseMessageAnnotationsType defines model for ChatCompletionResponseMessage.Annotations.Type.
-type ChatCompletionResponseMessageAnnotationsType string
-
 // ChatCompletionResponseMessageRole defines model for ChatCompletionResponseMessage.Role.
 type ChatCompletionResponseMessageRole string
 
@@ -749,17 +1018,25 @@ type ChatCompletionStreamOptions struct {
 
 // ChatCompletionStreamResponseDelta A chat completion delta generated by streamed model responses.
 type ChatCompletionStreamResponseDelta struct {
-	Content *string `json:"content,omitempty"`
+	// Annotations Citations for content emitted in this or earlier chunks.
+	Annotations *[]ChatCompletionAnnotation `json:"annotations,omitempty"`
+	Content     *string                     `json:"content,omitempty"`
 
 	// FunctionCall Deprecated and replaced by `tool_calls`. The name and arguments of a function that should be called, as generated by the model.
 	// Deprecated: Use `tool_calls`
 	FunctionCall *struct {
 		// Arguments The arguments to call the function with, as generated by the model in JSON format. Note that the model does not always generate valid JSON, and may hallucinate parameters not defined by your function schema. Validate the arguments in your code before calling your function.
 		Arguments *string `json:"arguments,omitempty"`
+
+		// Name The name of the function to call.
+		Name *string `json:"name,omitempty"`
 	} `json:"function_call,omitempty"`
-	Refusal   *string                                             `json:"refusal,omitempty"`
-	Role      *ChatCompletionStreamResponseDeltaRole              `json:"role,omitempty"`
-	ToolCalls *[]ChatCompletionStreamResponseDelta_ToolCalls_Item `json:"tool_calls,omitempty"`
+	Refusal *string                                `json:"refusal,omitempty"`
+	Role    *ChatCompletionStreamResponseDeltaRole `json:"role,omitempty"`
+
+	// ServerToolState Extension: opaque state of Anthropic server tool activity in the streamed message, sent with the final chunk. Send it back with the assistant message to preserve the original content blocks in history.
+	ServerToolState *string                                             `json:"server_tool_state,omitempty"`
+	ToolCalls       *[]ChatCompletionStreamResponseDelta_ToolCalls_Item `json:"tool_calls,omitempty"`
 }
 
 // ChatCompletionStreamResponseDeltaRole defines model for ChatCompletionStreamResponseDelta.Role.
@@ -823,6 +1100,21 @@ type ChatCompletionToolChoiceOption struct {
 // ChatCompletionToolChoiceOption0 defines model for ChatCompletionToolChoiceOption.0.
 type ChatCompletionToolChoiceOption0 string
 
+// ChatCompletionUrlCitation A URL citation when using web search.
+type ChatCompletionUrlCitation struct {
+	// EndIndex The index of the last character of the URL citation in the message.
+	EndIndex int `json:"end_index"`
+
+	// StartIndex The index of the first character of the URL citation in the message.
+	StartIndex int `json:"start_index"`
+
+	// Title The title of the web resource.
+	Title string `json:"title"`
+
+	// Url The URL of the web resource.
+	Url string `json:"url"`
+}
+
 // CompletionUsage Usage statistics for the completion request.
 type CompletionUsage struct {
 	// CompletionTokens Number of tokens in the generated completion.
@@ -864,6 +1156,32 @@ type CompletionUsage struct {
 	TotalTokens int `json:"total_tokens"`
 }
 
+// CreateBatchRequest defines model for CreateBatchRequest.
+type CreateBatchRequest struct {
+	// CompletionWindow The time frame within which the batch should be processed.
+	CompletionWindow CreateBatchRequestCompletionWindow `json:"completion_window"`
+
+	// Endpoint The endpoint to be used for all requests in the batch. Only `/v1/chat/completions` is supported.
+	Endpoint CreateBatchRequestEndpoint `json:"endpoint"`
+
+	// InputFileId The ID of an uploaded JSONL file (purpose `batch`) that contains the requests for the new batch.
+	InputFileId string `json:"input_file_id"`
+
+	// Metadata Set of 16 key-value pairs that can be attached to an object. This can be
+	// useful for storing additional information about the object in a structured
+	// format, and querying for objects via API or the dashboard.
+	//
+	// Keys are strings with a maximum length of 64 characters. Values are strings
+	// with a maximum length of 512 characters.
+	Metadata *Metadata `json:"metadata"`
+}
+
+// CreateBatchRequestCompletionWindow The time frame within which the batch should be processed.
+type CreateBatchRequestCompletionWindow string
+
+// CreateBatchRequestEndpoint The endpoint to be used for all requests in the batch. Only `/v1/chat/completions` is supported.
+type CreateBatchRequestEndpoint string
+
 // CreateChatCompletionRequest defines model for CreateChatCompletionRequest.
 type CreateChatCompletionRequest struct {
 	Audio *struct {
@@ -1124,6 +1442,101 @@ type CreateChatCompletionStreamResponseChoice struct {
 // CreateChatCompletionStreamResponseChoiceFinishReason defines model for CreateChatCompletionStreamResponseChoice.FinishReason.
 type CreateChatCompletionStreamResponseChoiceFinishReason string
 
+// CreateCompletionRequest defines model for CreateCompletionRequest.
+type CreateCompletionRequest struct {
+	BestOf *int  `json:"best_of"`
+	Echo   *bool `json:"echo"`
+
+	// ExtraBody Extra parameters to add to the request body. Will be merged.
+	ExtraBody        *map[string]interface{}        `json:"extra_body,omitempty"`
+	FrequencyPenalty *float32                       `json:"frequency_penalty"`
+	LogitBias        *map[string]int                `json:"logit_bias"`
+	Logprobs         *int                           `json:"logprobs"`
+	MaxTokens        *int                           `json:"max_tokens"`
+	Model            string                         `json:"model"`
+	N                *int                           `json:"n"`
+	PresencePenalty  *float32                       `json:"presence_penalty"`
+	Prompt           CreateCompletionRequest_Prompt `json:"prompt"`
+	Seed             *int64                         `json:"seed"`
+
+	// Stop Not supported with latest reasoning models `o3` and `o4-mini`.
+	//
+	// Up to 4 sequences where the API will stop generating further tokens. The
+	// returned text will not contain the stop sequence.
+	Stop   *StopConfiguration `json:"stop"`
+	Stream *bool              `json:"stream"`
+
+	// StreamOptions Options for streaming response. Only set this when you set `stream: true`.
+	StreamOptions *ChatCompletionStreamOptions `json:"stream_options"`
+
+	// Suffix The suffix that comes after a completion of inserted text. Used for fill-in-the-middle completions.
+	Suffix      *string  `json:"suffix"`
+	Temperature *float32 `json:"temperature"`
+	TopP        *float32 `json:"top_p"`
+	User        *string  `json:"user,omitempty"`
+}
+
+// CreateCompletionRequestPrompt0 defines model for .
+type CreateCompletionRequestPrompt0 = string
+
+// CreateCompletionRequestPrompt1 defines model for .
+type CreateCompletionRequestPrompt1 = []string
+
+// CreateCompletionRequestPrompt2 defines model for .
+type CreateCompletionRequestPrompt2 = []int
+
+// CreateCompletionRequestPrompt3 defines model for .
+type CreateCompletionRequestPrompt3 = [][]int
+
+// CreateCompletionRequest_Prompt defines model for CreateCompletionRequest.Prompt.
+type CreateCompletionRequest_Prompt struct {
+	union json.RawMessage
+}
+
+// CreateCompletionResponse defines model for CreateCompletionResponse.
+type CreateCompletionResponse struct {
+	Choices           []CreateCompletionResponseChoice `json:"choices"`
+	Created           int                              `json:"created"`
+	Id                string                           `json:"id"`
+	Model             string                           `json:"model"`
+	Object            CreateCompletionResponseObject   `json:"object"`
+	SystemFingerprint *string                          `json:"system_fingerprint,omitempty"`
+
+	// Usage Usage statistics for the completion request.
+	Usage *CompletionUsage `json:"usage,omitempty"`
+}
+
+// CreateCompletionResponseObject defines model for CreateCompletionResponse.Object.
+type CreateCompletionResponseObject string
+
+// CreateCompletionResponseChoice defines model for CreateCompletionResponseChoice.
+type CreateCompletionResponseChoice struct {
+	FinishReason *CreateCompletionResponseChoiceFinishReason `json:"finish_reason"`
+	Index        int                                         `json:"index"`
+	Logprobs     *struct {
+		TextOffset    *[]int                `json:"text_offset,omitempty"`
+		TokenLogprobs *[]float32            `json:"token_logprobs,omitempty"`
+		Tokens        *[]string             `json:"tokens,omitempty"`
+		TopLogprobs   *[]map[string]float32 `json:"top_logprobs,omitempty"`
+	} `json:"logprobs"`
+	Text string `json:"text"`
+}
+
+// CreateCompletionResponseChoiceFinishReason defines model for CreateCompletionResponseChoice.FinishReason.
+type CreateCompletionResponseChoiceFinishReason string
+
+// CreateFileRequest defines model for CreateFileRequest.
+type CreateFileRequest struct {
+	// File The File object (not file name) to be uploaded.
+	File openapi_types.File `json:"file"`
+
+	// Purpose The intended purpose of the uploaded file. One of: - `assistants`: Used in the Assistants API - `batch`: Used in the Batch API - `fine-tune`: Used for fine-tuning - `vision`: Images used for vision fine-tuning - `user_data`: Flexible file type for any purpose - `evals`: Used for eval data sets
+	Purpose CreateFileRequestPurpose `json:"purpose"`
+}
+
+// CreateFileRequestPurpose The intended purpose of the uploaded file. One of: - `assistants`: Used in the Assistants API - `batch`: Used in the Batch API - `fine-tune`: Used for fine-tuning - `vision`: Images used for vision fine-tuning - `user_data`: Flexible file type for any purpose - `evals`: Used for eval data sets
+type CreateFileRequestPurpose string
+
 // CreateModelResponseProperties defines model for CreateModelResponseProperties.
 type CreateModelResponseProperties struct {
 	// Metadata Set of 16 key-value pairs that can be attached to an object. This can be
@@ -1193,6 +1606,15 @@ type CustomToolChatCompletionsTextFormat struct {
 // CustomToolChatCompletionsTextFormatType defines model for CustomToolChatCompletionsTextFormat.Type.
 type CustomToolChatCompletionsTextFormatType string
 
+// DeleteFileResponse defines model for DeleteFileResponse.
+type DeleteFileResponse struct {
+	Deleted bool   `json:"deleted"`
+	Id      string `json:"id"`
+
+	// Object The object type, which is always `file`.
+	Object string `json:"object"`
+}
+
 // Error defines model for Error.
 type Error struct {
 	Code    *string `json:"code,omitempty"`
@@ -1237,6 +1659,27 @@ type FunctionObject struct {
 // Omitting `parameters` defines a function with an empty parameter list.
 type FunctionParameters map[string]interface{}
 
+// ListBatchesResponse defines model for ListBatchesResponse.
+type ListBatchesResponse struct {
+	Data    []Batch                   `json:"data"`
+	FirstId *string                   `json:"first_id,omitempty"`
+	HasMore bool                      `json:"has_more"`
+	LastId  *string                   `json:"last_id,omitempty"`
+	Object  ListBatchesResponseObject `json:"object"`
+}
+
+// ListBatchesResponseObject defines model for ListBatchesResponse.Object.
+type ListBatchesResponseObject string
+
+// ListFilesResponse defines model for ListFilesResponse.
+type ListFilesResponse struct {
+	Data    []OpenAIFile `json:"data"`
+	FirstId string       `json:"first_id"`
+	HasMore bool         `json:"has_more"`
+	LastId  string       `json:"last_id"`
+	Object  string       `json:"object"`
+}
+
 // Metadata Set of 16 key-value pairs that can be attached to an object. This can be
 // useful for storing additional information about the object in a structured
 // format, and querying for objects via API or the dashboard.
@@ -1273,6 +1716,36 @@ type ModelResponseProperties struct {
 	User        *string      `json:"user,omitempty"`
 }
 
+// OpenAIFile The `File` object represents a document that has been uploaded to the proxy.
+type OpenAIFile struct {
+	// Bytes The size of the file, in bytes.
+	Bytes int `json:"bytes"`
+
+	// CreatedAt The Unix timestamp (in seconds) for when the file was created.
+	CreatedAt int `json:"created_at"`
+
+	// ExpiresAt The Unix timestamp (in seconds) for when the file will expire.
+	ExpiresAt *int `json:"expires_at,omitempty"`
+
+	// Filename The name of the file.
+	Filename string `json:"filename"`
+
+	// Id The file identifier, which can be referenced in the API endpoints.
+	Id string `json:"id"`
+
+	// Object The object type, which is always `file`.
+	Object string `json:"object"`
+
+	// Purpose The intended purpose of the file as given on upload.
+	Purpose string `json:"purpose"`
+
+	// Status Deprecated. Always `processed` once the upload completed.
+	Status OpenAIFileStatus `json:"status"`
+}
+
+// OpenAIFileStatus Deprecated. Always `processed` once the upload completed.
+type OpenAIFileStatus string
+
 // ParallelToolCalls Whether to enable [parallel function calling](/docs/guides/function-calling#configuring-parallel-function-calling) during tool use.
 type ParallelToolCalls = bool
 
@@ -1448,9 +1921,35 @@ type WebSearchLocation struct {
 	Timezone *string `json:"timezone,omitempty"`
 }
 
+// ListBatchesParams defines parameters for ListBatches.
+type ListBatchesParams struct {
+	After *string `form:"after,omitempty" json:"after,omitempty"`
+	Limit *int    `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListFilesParams defines parameters for ListFiles.
+type ListFilesParams struct {
+	Purpose *string               `form:"purpose,omitempty" json:"purpose,omitempty"`
+	After   *string               `form:"after,omitempty" json:"after,omitempty"`
+	Limit   *int                  `form:"limit,omitempty" json:"limit,omitempty"`
+	Order   *ListFilesParamsOrder `form:"order,omitempty" json:"order,omitempty"`
+}
+
+// ListFilesParamsOrder defines parameters for ListFiles.
+type ListFilesParamsOrder string
+
+// CreateBatchJSONRequestBody defines body for CreateBatch for application/json ContentType.
+type CreateBatchJSONRequestBody = CreateBatchRequest
+
 // CreateChatCompletionJSONRequestBody defines body for CreateChatCompletion for application/json ContentType.
 type CreateChatCompletionJSONRequestBody = CreateChatCompletionRequest
 
+// CreateCompletionJSONRequestBody defines body for CreateCompletion for application/json ContentType.
+type CreateCompletionJSONRequestBody = CreateCompletionRequest
+
+// CreateFileMultipartRequestBody defines body for CreateFile for multipart/form-data ContentType.
+type CreateFileMultipartRequestBody = CreateFileRequest
+
 // AsChatCompletionMessageToolCall returns the union data inside the ChatCompletionMessageToolCalls_Item as a ChatCompletionMessageToolCall
 func (t ChatCompletionMessageToolCalls_Item) AsChatCompletionMessageToolCall() (ChatCompletionMessageToolCall, error) {
 	var body ChatCompletionMessageToolCall
@@ -2232,6 +2731,62 @@ func (t *ChatCompletionRequestToolMessageContentPart) MergeChatCompletionRequest
 	return err
 }
 
+// AsChatCompletionRequestMessageContentPartImage returns the union data inside the ChatCompletionRequestToolMessageContentPart as a ChatCompletionRequestMessageContentPartImage
+func (t ChatCompletionRequestToolMessageContentPart) AsChatCompletionRequestMessageContentPartImage() (ChatCompletionRequestMessageContentPartImage, error) {
+	var body ChatCompletionRequestMessageContentPartImage
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromChatCompletionRequestMessageContentPartImage overwrites any union data inside the ChatCompletionRequestToolMessageContentPart as the provided ChatCompletionRequestMessageContentPartImage
+func (t *ChatCompletionRequestToolMessageContentPart) FromChatCompletionRequestMessageContentPartImage(v ChatCompletionRequestMessageContentPartImage) error {
+	v.Type = "image_url"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeChatCompletionRequestMessageContentPartImage performs a merge with any union data inside the ChatCompletionRequestToolMessageContentPart, using the provided ChatCompletionRequestMessageContentPartImage
+func (t *ChatCompletionRequestToolMessageContentPart) MergeChatCompletionRequestMessageContentPartImage(v ChatCompletionRequestMessageContentPartImage) error {
+	v.Type = "image_url"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+// AsChatCompletionRequestMessageContentPartFile returns the union data inside the ChatCompletionRequestToolMessageContentPart as a ChatCompletionRequestMessageContentPartFile
+func (t ChatCompletionRequestToolMessageContentPart) AsChatCompletionRequestMessageContentPartFile() (ChatCompletionRequestMessageContentPartFile, error) {
+	var body ChatCompletionRequestMessageContentPartFile
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromChatCompletionRequestMessageContentPartFile overwrites any union data inside the ChatCompletionRequestToolMessageContentPart as the provided ChatCompletionRequestMessageContentPartFile
+func (t *ChatCompletionRequestToolMessageContentPart) FromChatCompletionRequestMessageContentPartFile(v ChatCompletionRequestMessageContentPartFile) error {
+	v.Type = "file"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeChatCompletionRequestMessageContentPartFile performs a merge with any union data inside the ChatCompletionRequestToolMessageContentPart, using the provided ChatCompletionRequestMessageContentPartFile
+func (t *ChatCompletionRequestToolMessageContentPart) MergeChatCompletionRequestMessageContentPartFile(v ChatCompletionRequestMessageContentPartFile) error {
+	v.Type = "file"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
 func (t ChatCompletionRequestToolMessageContentPart) Discriminator() (string, error) {
 	var discriminator struct {
 		Discriminator string `json:"type"`
@@ -2246,6 +2801,10 @@ func (t ChatCompletionRequestToolMessageContentPart) ValueByDiscriminator() (int
 		return nil, err
 	}
 	switch discriminator {
+	case "file":
+		return t.AsChatCompletionRequestMessageContentPartFile()
+	case "image_url":
+		return t.AsChatCompletionRequestMessageContentPartImage()
 	case "text":
 		return t.AsChatCompletionRequestMessageContentPartText()
 	default:
@@ -2502,6 +3061,34 @@ func (t *ChatCompletionStreamResponseDelta_ToolCalls_Item) MergeChatCompletionMe
 	return err
 }
 
+// AsChatCompletionMessageCustomToolCallChunk returns the union data inside the ChatCompletionStreamResponseDelta_ToolCalls_Item as a ChatCompletionMessageCustomToolCallChunk
+func (t ChatCompletionStreamResponseDelta_ToolCalls_Item) AsChatCompletionMessageCustomToolCallChunk() (ChatCompletionMessageCustomToolCallChunk, error) {
+	var body ChatCompletionMessageCustomToolCallChunk
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromChatCompletionMessageCustomToolCallChunk overwrites any union data inside the ChatCompletionStreamResponseDelta_ToolCalls_Item as the provided ChatCompletionMessageCustomToolCallChunk
+func (t *ChatCompletionStreamResponseDelta_ToolCalls_Item) FromChatCompletionMessageCustomToolCallChunk(v ChatCompletionMessageCustomToolCallChunk) error {
+	v.Type = "custom"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeChatCompletionMessageCustomToolCallChunk performs a merge with any union data inside the ChatCompletionStreamResponseDelta_ToolCalls_Item, using the provided ChatCompletionMessageCustomToolCallChunk
+func (t *ChatCompletionStreamResponseDelta_ToolCalls_Item) MergeChatCompletionMessageCustomToolCallChunk(v ChatCompletionMessageCustomToolCallChunk) error {
+	v.Type = "custom"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
 func (t ChatCompletionStreamResponseDelta_ToolCalls_Item) Discriminator() (string, error) {
 	var discriminator struct {
 		Discriminator string `json:"type"`
@@ -2516,6 +3103,8 @@ func (t ChatCompletionStreamResponseDelta_ToolCalls_Item) ValueByDiscriminator()
 		return nil, err
 	}
 	switch discriminator {
+	case "custom":
+		return t.AsChatCompletionMessageCustomToolCallChunk()
 	case "function":
 		return t.AsChatCompletionMessageToolCallChunk()
 	default:
@@ -2976,6 +3565,120 @@ func (t *CreateChatCompletionRequest_Tools_Item) UnmarshalJSON(b []byte) error {
 	return err
 }
 
+// AsCreateCompletionRequestPrompt0 returns the union data inside the CreateCompletionRequest_Prompt as a CreateCompletionRequestPrompt0
+func (t CreateCompletionRequest_Prompt) AsCreateCompletionRequestPrompt0() (CreateCompletionRequestPrompt0, error) {
+	var body CreateCompletionRequestPrompt0
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromCreateCompletionRequestPrompt0 overwrites any union data inside the CreateCompletionRequest_Prompt as the provided CreateCompletionRequestPrompt0
+func (t *CreateCompletionRequest_Prompt) FromCreateCompletionRequestPrompt0(v CreateCompletionRequestPrompt0) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeCreateCompletionRequestPrompt0 performs a merge with any union data inside the CreateCompletionRequest_Prompt, using the provided CreateCompletionRequestPrompt0
+func (t *CreateCompletionRequest_Prompt) MergeCreateCompletionRequestPrompt0(v CreateCompletionRequestPrompt0) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+// AsCreateCompletionRequestPrompt1 returns the union data inside the CreateCompletionRequest_Prompt as a CreateCompletionRequestPrompt1
+func (t CreateCompletionRequest_Prompt) AsCreateCompletionRequestPrompt1() (CreateCompletionRequestPrompt1, error) {
+	var body CreateCompletionRequestPrompt1
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromCreateCompletionRequestPrompt1 overwrites any union data inside the CreateCompletionRequest_Prompt as the provided CreateCompletionRequestPrompt1
+func (t *CreateCompletionRequest_Prompt) FromCreateCompletionRequestPrompt1(v CreateCompletionRequestPrompt1) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeCreateCompletionRequestPrompt1 performs a merge with any union data inside the CreateCompletionRequest_Prompt, using the provided CreateCompletionRequestPrompt1
+func (t *CreateCompletionRequest_Prompt) MergeCreateCompletionRequestPrompt1(v CreateCompletionRequestPrompt1) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+// AsCreateCompletionRequestPrompt2 returns the union data inside the CreateCompletionRequest_Prompt as a CreateCompletionRequestPrompt2
+func (t CreateCompletionRequest_Prompt) AsCreateCompletionRequestPrompt2() (CreateCompletionRequestPrompt2, error) {
+	var body CreateCompletionRequestPrompt2
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromCreateCompletionRequestPrompt2 overwrites any union data inside the CreateCompletionRequest_Prompt as the provided CreateCompletionRequestPrompt2
+func (t *CreateCompletionRequest_Prompt) FromCreateCompletionRequestPrompt2(v CreateCompletionRequestPrompt2) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeCreateCompletionRequestPrompt2 performs a merge with any union data inside the CreateCompletionRequest_Prompt, using the provided CreateCompletionRequestPrompt2
+func (t *CreateCompletionRequest_Prompt) MergeCreateCompletionRequestPrompt2(v CreateCompletionRequestPrompt2) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+// AsCreateCompletionRequestPrompt3 returns the union data inside the CreateCompletionRequest_Prompt as a CreateCompletionRequestPrompt3
+func (t CreateCompletionRequest_Prompt) AsCreateCompletionRequestPrompt3() (CreateCompletionRequestPrompt3, error) {
+	var body CreateCompletionRequestPrompt3
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromCreateCompletionRequestPrompt3 overwrites any union data inside the CreateCompletionRequest_Prompt as the provided CreateCompletionRequestPrompt3
+func (t *CreateCompletionRequest_Prompt) FromCreateCompletionRequestPrompt3(v CreateCompletionRequestPrompt3) error {
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeCreateCompletionRequestPrompt3 performs a merge with any union data inside the CreateCompletionRequest_Prompt, using the provided CreateCompletionRequestPrompt3
+func (t *CreateCompletionRequest_Prompt) MergeCreateCompletionRequestPrompt3(v CreateCompletionRequestPrompt3) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JSONMerge(t.union, b)
+	t.union = merged
+	return err
+}
+
+func (t CreateCompletionRequest_Prompt) MarshalJSON() ([]byte, error) {
+	b, err := t.union.MarshalJSON()
+	return b, err
+}
+
+func (t *CreateCompletionRequest_Prompt) UnmarshalJSON(b []byte) error {
+	err := t.union.UnmarshalJSON(b)
+	return err
+}
+
 // AsCustomToolChatCompletionsTextFormat returns the union data inside the CustomToolChatCompletions_Custom_Format as a CustomToolChatCompletionsTextFormat
 func (t CustomToolChatCompletions_Custom_Format) AsCustomToolChatCompletionsTextFormat() (CustomToolChatCompletionsTextFormat, error) {
 	var body CustomToolChatCompletionsTextFormat
@@ -0,0 +1,46 @@
+//go:build goexperiment.jsonv2
+
+package proxy
+
+import (
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// APIKeyTransport is an http.RoundTripper that authenticates with an Anthropic Console API
+// key taken from Source. Unlike ImpersonationTransport, it doesn't inject the Claude Code
+// system prompt or OAuth beta features; client betas are passed through unchanged.
+type APIKeyTransport struct {
+	Source oauth2.TokenSource
+	Base   http.RoundTripper
+}
+
+// Compile-time check that APIKeyTransport implements http.RoundTripper.
+var _ http.RoundTripper = (*APIKeyTransport)(nil)
+
+// RoundTrip implements http.RoundTripper interface.
+// Filters headers and sends the API key as x-api-key instead of a Bearer token.
+func (t *APIKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	token, err := t.Source.Token()
+	if err != nil {
+		// RoundTrip must always close the body, including on errors
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	newReq := req.Clone(req.Context())
+	newReq.Header = filterHeaders(newReq.Header)
+	newReq.Header.Del("Authorization")
+	newReq.Header.Set("X-Api-Key", token.AccessToken)
+	newReq.Header.Set("Anthropic-Version", "2023-06-01")
+
+	return base.RoundTrip(newReq)
+}
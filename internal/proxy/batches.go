@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/florianilch/claudine-proxy/internal/filestore"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// BatchesHandler serves the OpenAI-compatible Batch API facade on top of Anthropic Message Batches.
+//
+// Batches are created from an uploaded input file (input_file_id) like on OpenAI, or, as a
+// proxy-specific extension, from a JSONL request body (one chat completion BatchRequestInput
+// per line). Results are returned as JSONL from GET /batches/{batch_id}/output, and from
+// GET /files/{output_file_id}/content when file uploads are enabled.
+type BatchesHandler struct {
+	Adapter   *anthropicclaude.BatchAdapter
+	Transport http.RoundTripper
+
+	// Files resolves input_file_id; nil disables batch creation from uploaded files.
+	Files *filestore.Store
+}
+
+// CreateBatch handles POST /batches with either a JSON body referencing an uploaded input
+// file or a JSONL body of chat completion requests.
+func (h *BatchesHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var (
+		inputs      []openaiadapter.BatchRequestInput
+		inputFileID string
+		err         error
+	)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req openaiadapter.CreateBatchRequest
+		if !decodeOpenAIRequest(ctx, w, r, &req) {
+			return
+		}
+		inputFileID = req.InputFileId
+		inputs, err = h.readBatchInputFile(ctx, req)
+	} else {
+		inputs, err = decodeBatchInput(r.Body)
+	}
+	if err != nil {
+		var errResp *openaiadapter.ErrorResponse
+		if errors.As(err, &errResp) {
+			writeJSONOpenAIError(ctx, w, errResp)
+			return
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
+			writeInvalidRequestError(ctx, w, http.StatusText(http.StatusRequestEntityTooLarge))
+			return
+		}
+		slog.ErrorContext(ctx, "failed to decode batch input", "error", err)
+		writeInvalidRequestError(ctx, w, err.Error())
+		return
+	}
+
+	batch, err := h.Adapter.CreateBatch(ctx, inputs, h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch creation failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+	// Anthropic doesn't track input files, so only the creation response can reference it
+	batch.InputFileId = inputFileID
+
+	writeJSON(ctx, w, batch, http.StatusOK)
+}
+
+// readBatchInputFile validates an OpenAI create batch request and decodes its input file.
+func (h *BatchesHandler) readBatchInputFile(
+	ctx context.Context,
+	req openaiadapter.CreateBatchRequest,
+) ([]openaiadapter.BatchRequestInput, error) {
+	if h.Files == nil {
+		return nil, newInvalidRequestError("input_file_id is not supported, file uploads are disabled; send the requests as JSONL body instead")
+	}
+	if req.Endpoint != types.V1chatcompletions {
+		return nil, newInvalidRequestError(fmt.Sprintf("unsupported endpoint %q (only %s)", req.Endpoint, types.V1chatcompletions))
+	}
+	if req.CompletionWindow != types.N24h {
+		return nil, newInvalidRequestError(fmt.Sprintf("unsupported completion_window %q (only %s)", req.CompletionWindow, types.N24h))
+	}
+
+	_, contents, err := h.Files.Open(ctx, req.InputFileId)
+	if err != nil {
+		if errors.Is(err, filestore.ErrNotFound) {
+			return nil, newInvalidRequestError("No such File object: " + req.InputFileId)
+		}
+		return nil, err
+	}
+	defer func() { _ = contents.Close() }()
+
+	return decodeBatchInput(contents)
+}
+
+// ListBatches handles GET /batches with optional after/limit query parameters.
+func (h *BatchesHandler) ListBatches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var params types.ListBatchesParams
+	query := r.URL.Query()
+	if after := query.Get("after"); after != "" {
+		params.After = &after
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			writeInvalidRequestError(ctx, w, "limit must be a positive integer")
+			return
+		}
+		params.Limit = &n
+	}
+
+	batches, err := h.Adapter.ListBatches(ctx, params, h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch listing failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	writeJSON(ctx, w, batches, http.StatusOK)
+}
+
+// RetrieveBatch handles GET /batches/{batch_id}.
+func (h *BatchesHandler) RetrieveBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	batch, err := h.Adapter.RetrieveBatch(ctx, r.PathValue("batch_id"), h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch retrieval failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	writeJSON(ctx, w, batch, http.StatusOK)
+}
+
+// CancelBatch handles POST /batches/{batch_id}/cancel.
+func (h *BatchesHandler) CancelBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	batch, err := h.Adapter.CancelBatch(ctx, r.PathValue("batch_id"), h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch cancellation failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	writeJSON(ctx, w, batch, http.StatusOK)
+}
+
+// BatchOutput handles GET /batches/{batch_id}/output, streaming results as JSONL.
+func (h *BatchesHandler) BatchOutput(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	outputs, err := h.Adapter.BatchOutput(ctx, r.PathValue("batch_id"), h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch output retrieval failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.WriteHeader(http.StatusOK)
+
+	// json.Encoder terminates every value with a newline, producing JSONL
+	enc := json.NewEncoder(w)
+	for output, err := range outputs {
+		if ctx.Err() != nil {
+			slog.DebugContext(ctx, "client disconnected during batch output")
+			return
+		}
+		if err != nil {
+			// Status is already sent; a truncated body is the only signal left
+			slog.ErrorContext(ctx, "batch output stream error", "error", err)
+			return
+		}
+		if err := enc.Encode(output); err != nil {
+			slog.ErrorContext(ctx, "failed to write batch output line", "error", err)
+			return
+		}
+	}
+}
+
+// decodeBatchInput decodes a JSONL body into batch request inputs.
+// Values are whitespace-separated, so blank lines are tolerated; errors report the
+// 1-based position of the offending request.
+func decodeBatchInput(body io.Reader) ([]openaiadapter.BatchRequestInput, error) {
+	var inputs []openaiadapter.BatchRequestInput
+
+	dec := json.NewDecoder(body)
+	for line := 1; ; line++ {
+		var input openaiadapter.BatchRequestInput
+		if err := dec.Decode(&input); err != nil {
+			if errors.Is(err, io.EOF) {
+				return inputs, nil
+			}
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("invalid batch input on line %d: %w", line, err)
+		}
+		inputs = append(inputs, input)
+	}
+}
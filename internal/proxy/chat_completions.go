@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"iter"
 	"log/slog"
 	"net/http"
 
@@ -25,28 +26,15 @@ func (h *CreateChatCompletionsHandler) ServeHTTP(w http.ResponseWriter, r *http.
 	ctx := r.Context()
 
 	var req openaiadapter.CreateChatCompletionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		var maxBytesErr *http.MaxBytesError
-		if errors.As(err, &maxBytesErr) {
-			slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
-			writeJSONOpenAIError(ctx, w, &openaiadapter.ErrorResponse{
-				Err: openaiadapter.Error{
-					Message: http.StatusText(http.StatusRequestEntityTooLarge),
-					Type:    "invalid_request_error",
-				},
-			})
-			return
-		}
-		slog.ErrorContext(ctx, "failed to decode request", "error", err)
-		writeJSONOpenAIError(ctx, w, &openaiadapter.ErrorResponse{
-			Err: openaiadapter.Error{
-				Message: http.StatusText(http.StatusBadRequest),
-				Type:    "invalid_request_error",
-			},
-		})
+	if !decodeOpenAIRequest(ctx, w, r, &req) {
 		return
 	}
 
+	// Trimming happens before the response is written, so the header is still sent
+	ctx = anthropicclaude.WithContextTrimReporter(ctx, func(trim anthropicclaude.ContextTrim) {
+		w.Header().Set("X-Context-Trimmed", trim.String())
+	})
+
 	if req.Stream != nil && *req.Stream {
 		h.streamResponse(ctx, w, req)
 	} else {
@@ -66,19 +54,7 @@ func (h *CreateChatCompletionsHandler) writeResponse(
 	response, err := h.Adapter.ProcessRequest(ctx, req, h.Transport)
 	if err != nil {
 		slog.ErrorContext(ctx, "request failed", "error", err)
-
-		var errResp *openaiadapter.ErrorResponse
-		if errors.As(err, &errResp) {
-			writeJSONOpenAIError(ctx, w, errResp)
-			return
-		}
-
-		writeJSONOpenAIError(ctx, w, &openaiadapter.ErrorResponse{
-			Err: openaiadapter.Error{
-				Message: http.StatusText(http.StatusInternalServerError),
-				Type:    "api_error",
-			},
-		})
+		writeJSONAdapterError(ctx, w, err)
 		return
 	}
 
@@ -97,22 +73,60 @@ func (h *CreateChatCompletionsHandler) streamResponse(
 	stream, err := h.Adapter.ProcessStreamingRequest(ctx, req, h.Transport)
 	if err != nil {
 		slog.ErrorContext(ctx, "streaming request failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
 
-		var errResp *openaiadapter.ErrorResponse
-		if errors.As(err, &errResp) {
-			writeJSONOpenAIError(ctx, w, errResp)
-			return
-		}
+	writeSSEOpenAIStream(ctx, w, stream)
+}
 
+// decodeOpenAIRequest decodes an OpenAI-compatible JSON request body into req.
+// Writes an OpenAI error response and returns false if decoding fails.
+func decodeOpenAIRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, req any) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
+			writeJSONOpenAIError(ctx, w, &openaiadapter.ErrorResponse{
+				Err: openaiadapter.Error{
+					Message: http.StatusText(http.StatusRequestEntityTooLarge),
+					Type:    "invalid_request_error",
+				},
+			})
+			return false
+		}
+		slog.ErrorContext(ctx, "failed to decode request", "error", err)
 		writeJSONOpenAIError(ctx, w, &openaiadapter.ErrorResponse{
 			Err: openaiadapter.Error{
-				Message: http.StatusText(http.StatusInternalServerError),
-				Type:    "api_error",
+				Message: http.StatusText(http.StatusBadRequest),
+				Type:    "invalid_request_error",
 			},
 		})
+		return false
+	}
+	return true
+}
+
+// writeJSONAdapterError writes an adapter error as OpenAI-compatible error response.
+// Errors not already mapped by the adapter are masked as generic api_error.
+func writeJSONAdapterError(ctx context.Context, w http.ResponseWriter, err error) {
+	var errResp *openaiadapter.ErrorResponse
+	if errors.As(err, &errResp) {
+		writeJSONOpenAIError(ctx, w, errResp)
 		return
 	}
 
+	writeJSONOpenAIError(ctx, w, &openaiadapter.ErrorResponse{
+		Err: openaiadapter.Error{
+			Message: http.StatusText(http.StatusInternalServerError),
+			Type:    "api_error",
+		},
+	})
+}
+
+// writeSSEOpenAIStream writes adapter chunks as OpenAI-compatible SSE stream,
+// including error events and the [DONE] termination marker.
+func writeSSEOpenAIStream[TChunk any](ctx context.Context, w http.ResponseWriter, stream iter.Seq2[*TChunk, error]) {
 	sse, err := NewSSEWriter(w)
 	if err != nil {
 		slog.ErrorContext(ctx, "SSE not supported", "error", err)
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+)
+
+// CreateCompletionsHandler handles OpenAI-compatible legacy text completion requests.
+type CreateCompletionsHandler struct {
+	Adapter   *anthropicclaude.CreateCompletionAdapter
+	Transport http.RoundTripper
+}
+
+// Compile-time check to ensure CreateCompletionsHandler implements http.Handler
+var _ http.Handler = (*CreateCompletionsHandler)(nil)
+
+// ServeHTTP implements http.Handler interface for streaming or non-streaming requests.
+func (h *CreateCompletionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req openaiadapter.CreateCompletionRequest
+	if !decodeOpenAIRequest(ctx, w, r, &req) {
+		return
+	}
+
+	if req.Stream != nil && *req.Stream {
+		h.streamResponse(ctx, w, req)
+	} else {
+		h.writeResponse(ctx, w, req)
+	}
+}
+
+// writeResponse handles non-streaming text completion requests.
+func (h *CreateCompletionsHandler) writeResponse(
+	ctx context.Context,
+	w http.ResponseWriter,
+	req openaiadapter.CreateCompletionRequest,
+) {
+	if ctx.Err() != nil {
+		return
+	}
+	response, err := h.Adapter.ProcessRequest(ctx, req, h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "request failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	writeJSON(ctx, w, response, http.StatusOK)
+}
+
+// streamResponse streams text completion chunks using SSE.
+func (h *CreateCompletionsHandler) streamResponse(
+	ctx context.Context,
+	w http.ResponseWriter,
+	req openaiadapter.CreateCompletionRequest,
+) {
+	if ctx.Err() != nil {
+		return
+	}
+	stream, err := h.Adapter.ProcessStreamingRequest(ctx, req, h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "streaming request failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	writeSSEOpenAIStream(ctx, w, stream)
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+)
+
+// CountChatCompletionTokensHandler counts input tokens for OpenAI-compatible chat completion
+// requests. Proxy-specific extension: OpenAI has no token counting endpoint, so clients
+// receive Anthropic's count_tokens response ({"input_tokens": N}) to budget context windows.
+type CountChatCompletionTokensHandler struct {
+	Adapter   *anthropicclaude.CreateChatCompletionAdapter
+	Transport http.RoundTripper
+}
+
+// Compile-time check to ensure CountChatCompletionTokensHandler implements http.Handler
+var _ http.Handler = (*CountChatCompletionTokensHandler)(nil)
+
+// ServeHTTP implements http.Handler interface.
+func (h *CountChatCompletionTokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req openaiadapter.CreateChatCompletionRequest
+	if !decodeOpenAIRequest(ctx, w, r, &req) {
+		return
+	}
+
+	count, err := h.Adapter.CountTokens(ctx, req, h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "token counting failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	// Forward Anthropic's response verbatim to keep fields added by future API versions
+	if raw := count.RawJSON(); raw != "" {
+		writeJSON(ctx, w, json.RawMessage(raw), http.StatusOK)
+		return
+	}
+	writeJSON(ctx, w, map[string]int64{"input_tokens": count.InputTokens}, http.StatusOK)
+}
@@ -0,0 +1,20 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/florianilch/claudine-proxy/internal/docconvert"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+)
+
+// newDocumentConverter adapts the converter to the adapter's document conversion.
+func newDocumentConverter(converter *docconvert.Converter) anthropicclaude.DocumentConverter {
+	return func(data []byte, mediaType, filename string) (string, error) {
+		text, err := converter.Convert(data, mediaType, filename)
+		if errors.Is(err, docconvert.ErrUnsupported) {
+			return "", fmt.Errorf("%w: %w", anthropicclaude.ErrUnsupportedDocument, err)
+		}
+		return text, err
+	}
+}
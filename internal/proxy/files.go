@@ -0,0 +1,274 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/florianilch/claudine-proxy/internal/filestore"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/types"
+)
+
+// batchIDPrefix identifies Anthropic Message Batch IDs, which double as batch output file IDs.
+const batchIDPrefix = "msgbatch_"
+
+// multipartMemoryLimit is the part of an upload kept in memory; larger uploads spill to temp files.
+const multipartMemoryLimit = 32 << 20
+
+// FilesHandler serves the OpenAI-compatible Files API backed by a local file store.
+//
+// Uploaded files can be referenced via file_id in chat completion requests and as
+// input_file_id of batches. Batch output files are served from Anthropic on demand.
+type FilesHandler struct {
+	Store *filestore.Store
+
+	// Batches serves GET /files/{file_id}/content for batch output file IDs (optional).
+	Batches *BatchesHandler
+}
+
+// CreateFile handles POST /files with a multipart body containing file and purpose.
+func (h *FilesHandler) CreateFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseMultipartForm(multipartMemoryLimit); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
+			writeInvalidRequestError(ctx, w, http.StatusText(http.StatusRequestEntityTooLarge))
+			return
+		}
+		slog.ErrorContext(ctx, "failed to parse upload", "error", err)
+		writeInvalidRequestError(ctx, w, "request body must be multipart/form-data with file and purpose fields")
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	purpose := types.CreateFileRequestPurpose(r.FormValue("purpose"))
+	if !slices.Contains([]types.CreateFileRequestPurpose{
+		types.CreateFileRequestPurposeAssistants,
+		types.CreateFileRequestPurposeBatch,
+		types.CreateFileRequestPurposeEvals,
+		types.CreateFileRequestPurposeFineTune,
+		types.CreateFileRequestPurposeUserData,
+		types.CreateFileRequestPurposeVision,
+	}, purpose) {
+		writeInvalidRequestError(ctx, w, "purpose must be one of assistants, batch, evals, fine-tune, user_data, vision")
+		return
+	}
+
+	upload, header, err := r.FormFile("file")
+	if err != nil {
+		writeInvalidRequestError(ctx, w, "file is required")
+		return
+	}
+	defer func() { _ = upload.Close() }()
+
+	file, err := h.Store.Put(ctx, header.Filename, string(purpose), upload)
+	if err != nil {
+		if errors.Is(err, filestore.ErrQuotaExceeded) {
+			slog.WarnContext(ctx, "file storage quota exceeded", "error", err)
+			writeInvalidRequestError(ctx, w, "file storage quota exceeded, delete files or wait for them to expire")
+			return
+		}
+		slog.ErrorContext(ctx, "failed to store file", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "file uploaded", "file_id", file.ID, "bytes", file.Bytes, "purpose", file.Purpose)
+	writeJSON(ctx, w, toOpenAIFile(file), http.StatusOK)
+}
+
+// ListFiles handles GET /files with optional purpose/after/limit/order query parameters.
+func (h *FilesHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limit := 10000
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeInvalidRequestError(ctx, w, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	order := types.ListFilesParamsOrder(query.Get("order"))
+	switch order {
+	case "":
+		order = types.Desc
+	case types.Asc, types.Desc:
+	default:
+		writeInvalidRequestError(ctx, w, "order must be asc or desc")
+		return
+	}
+
+	files, err := h.Store.List(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "file listing failed", "error", err)
+		writeJSONAdapterError(ctx, w, err)
+		return
+	}
+	if order == types.Desc {
+		slices.Reverse(files)
+	}
+
+	// Cursor pagination: skip up to and including the file given as "after"
+	if after := query.Get("after"); after != "" {
+		if i := slices.IndexFunc(files, func(f filestore.File) bool { return f.ID == after }); i >= 0 {
+			files = files[i+1:]
+		}
+	}
+
+	purpose := query.Get("purpose")
+	resp := openaiadapter.ListFilesResponse{
+		Object: "list",
+		Data:   []openaiadapter.OpenAIFile{},
+	}
+	for _, file := range files {
+		if purpose != "" && file.Purpose != purpose {
+			continue
+		}
+		if len(resp.Data) == limit {
+			resp.HasMore = true
+			break
+		}
+		resp.Data = append(resp.Data, toOpenAIFile(&file))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+
+	writeJSON(ctx, w, resp, http.StatusOK)
+}
+
+// RetrieveFile handles GET /files/{file_id}.
+func (h *FilesHandler) RetrieveFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	fileID := r.PathValue("file_id")
+
+	file, err := h.Store.Get(ctx, fileID)
+	if err != nil {
+		h.writeStoreError(ctx, w, fileID, err)
+		return
+	}
+
+	writeJSON(ctx, w, toOpenAIFile(file), http.StatusOK)
+}
+
+// DeleteFile handles DELETE /files/{file_id}.
+func (h *FilesHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	fileID := r.PathValue("file_id")
+
+	if err := h.Store.Delete(ctx, fileID); err != nil {
+		h.writeStoreError(ctx, w, fileID, err)
+		return
+	}
+
+	writeJSON(ctx, w, openaiadapter.DeleteFileResponse{
+		Id:      fileID,
+		Object:  "file",
+		Deleted: true,
+	}, http.StatusOK)
+}
+
+// FileContent handles GET /files/{file_id}/content.
+// Batch output file IDs are batch IDs; their content is the batch output JSONL.
+func (h *FilesHandler) FileContent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	fileID := r.PathValue("file_id")
+
+	if h.Batches != nil && strings.HasPrefix(fileID, batchIDPrefix) {
+		r.SetPathValue("batch_id", fileID)
+		h.Batches.BatchOutput(w, r)
+		return
+	}
+
+	file, contents, err := h.Store.Open(ctx, fileID)
+	if err != nil {
+		h.writeStoreError(ctx, w, fileID, err)
+		return
+	}
+	defer func() { _ = contents.Close() }()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, contents); err != nil {
+		slog.ErrorContext(ctx, "failed to write file content", "error", err)
+	}
+}
+
+// writeStoreError writes a file store error, mapping unknown files to 404 like OpenAI.
+func (h *FilesHandler) writeStoreError(ctx context.Context, w http.ResponseWriter, fileID string, err error) {
+	if errors.Is(err, filestore.ErrNotFound) {
+		writeJSON(ctx, w, &openaiadapter.ErrorResponse{
+			Err: openaiadapter.Error{
+				Message: "No such File object: " + fileID,
+				Type:    "invalid_request_error",
+			},
+		}, http.StatusNotFound)
+		return
+	}
+
+	slog.ErrorContext(ctx, "file store operation failed", "file_id", fileID, "error", err)
+	writeJSONAdapterError(ctx, w, err)
+}
+
+// writeInvalidRequestError writes an OpenAI invalid_request_error with the given message.
+func writeInvalidRequestError(ctx context.Context, w http.ResponseWriter, message string) {
+	writeJSONOpenAIError(ctx, w, newInvalidRequestError(message))
+}
+
+// newInvalidRequestError creates an OpenAI invalid_request_error with the given message.
+func newInvalidRequestError(message string) *openaiadapter.ErrorResponse {
+	return &openaiadapter.ErrorResponse{
+		Err: openaiadapter.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+	}
+}
+
+// toOpenAIFile converts stored file metadata to an OpenAI file object.
+func toOpenAIFile(file *filestore.File) openaiadapter.OpenAIFile {
+	result := openaiadapter.OpenAIFile{
+		Id:        file.ID,
+		Object:    "file",
+		Bytes:     int(file.Bytes),
+		CreatedAt: int(file.CreatedAt.Unix()),
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    types.OpenAIFileStatusProcessed,
+	}
+	if !file.ExpiresAt.IsZero() {
+		expiresAt := int(file.ExpiresAt.Unix())
+		result.ExpiresAt = &expiresAt
+	}
+	return result
+}
+
+// newFileResolver adapts the file store to the adapter's file_id resolution.
+func newFileResolver(store *filestore.Store) anthropicclaude.FileResolver {
+	return func(ctx context.Context, fileID string) (string, []byte, error) {
+		file, data, err := store.ReadFile(ctx, fileID)
+		if err != nil {
+			if errors.Is(err, filestore.ErrNotFound) {
+				return "", nil, fmt.Errorf("%w: %s", anthropicclaude.ErrFileNotFound, fileID)
+			}
+			return "", nil, err
+		}
+		return file.Filename, data, nil
+	}
+}
@@ -3,6 +3,7 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/json/jsontext"
 	"io"
@@ -65,26 +66,24 @@ func (t *ImpersonationTransport) RoundTrip(req *http.Request) (*http.Response, e
 	// Clone request for modification
 	newReq := req.Clone(req.Context())
 
-	// Filter headers to prevent client-side headers (User-Agent, custom headers, etc.)
-	// from breaking Anthropic API requirements or leaking proxy implementation details.
-	originalHeaders := newReq.Header
-	newReq.Header = make(http.Header)
-	for key, values := range originalHeaders {
-		if allowedHeaders[key] {
-			newReq.Header[key] = values
-		}
-	}
+	newReq.Header = filterHeaders(newReq.Header)
 
 	// Set required Anthropic API version and merge beta features
 	newReq.Header.Set("Anthropic-Version", "2023-06-01")
 	incomingBetaHeaderValue := newReq.Header.Get("Anthropic-Beta")
 	newReq.Header.Set("Anthropic-Beta", buildBetaHeader(incomingBetaHeaderValue))
 
-	// Skip body transformation for non-POST requests or requests without bodies
-	if req.Method != http.MethodPost || req.Body == nil {
+	// Skip body transformation for non-POST requests or requests without bodies (e.g. batch cancel)
+	if req.Method != http.MethodPost || req.Body == nil || req.Body == http.NoBody {
 		return base.RoundTrip(newReq)
 	}
 
+	// Message Batches wrap Messages API params per request; inject into each of them
+	inject := injectSystemPrompt
+	if strings.HasSuffix(req.URL.Path, "/messages/batches") {
+		inject = injectBatchSystemPrompts
+	}
+
 	// Create pipe for streaming body transformation
 	pr, pw := io.Pipe()
 
@@ -92,7 +91,7 @@ func (t *ImpersonationTransport) RoundTrip(req *http.Request) (*http.Response, e
 	// Note: No goroutine leak on context cancellation. When http.Transport cancels
 	// the request, it closes pr, which unblocks all writes to pw with ErrClosedPipe.
 	go func() {
-		err := injectSystemPrompt(req.Body, pw)
+		err := inject(req.Body, pw)
 		// Propagate transformation error (if any) or signal success to reader
 		pw.CloseWithError(err)
 		_ = req.Body.Close()
@@ -108,6 +107,18 @@ func (t *ImpersonationTransport) RoundTrip(req *http.Request) (*http.Response, e
 	return base.RoundTrip(newReq)
 }
 
+// filterHeaders returns the allowedHeaders of h. Client-side headers (User-Agent, custom
+// headers, etc.) could break Anthropic API requirements or leak proxy implementation details.
+func filterHeaders(h http.Header) http.Header {
+	filtered := make(http.Header)
+	for key, values := range h {
+		if allowedHeaders[key] {
+			filtered[key] = values
+		}
+	}
+	return filtered
+}
+
 // injectSystemPrompt uses encoding/json/jsontext for streaming JSON transformation.
 //
 // We need to inject a system prompt into API requests without buffering the entire
@@ -193,6 +204,118 @@ func injectSystemPrompt(r io.Reader, w io.Writer) error {
 	return enc.WriteToken(tok)
 }
 
+// injectBatchSystemPrompts injects the system prompt into the params of every request in a
+// Message Batch body ({"requests": [{"custom_id": ..., "params": {...}}]}).
+//
+// The batch envelope and requests array are streamed token by token like injectSystemPrompt.
+// Only each params object is read as a value and transformed via injectSystemPrompt, so memory
+// use is bounded by the largest single request rather than the whole batch.
+func injectBatchSystemPrompts(r io.Reader, w io.Writer) error {
+	dec := jsontext.NewDecoder(r)
+	enc := jsontext.NewEncoder(w)
+
+	return transformObject(dec, enc, "requests", func() error {
+		return transformArray(dec, enc, func() error {
+			return transformObject(dec, enc, "params", func() error {
+				params, err := dec.ReadValue()
+				if err != nil {
+					return err
+				}
+				var buf bytes.Buffer
+				if err := injectSystemPrompt(bytes.NewReader(params), &buf); err != nil {
+					return err
+				}
+				return enc.WriteValue(jsontext.Value(bytes.TrimSpace(buf.Bytes())))
+			})
+		})
+	})
+}
+
+// transformObject streams a JSON object from dec to enc. For the given field, transform is
+// called with dec positioned at its value and must read it and write a replacement to enc.
+// Non-objects pass through unchanged.
+func transformObject(dec *jsontext.Decoder, enc *jsontext.Encoder, field string, transform func() error) error {
+	if dec.PeekKind() != '{' {
+		val, err := dec.ReadValue()
+		if err != nil {
+			return err
+		}
+		return enc.WriteValue(val)
+	}
+
+	tok, err := dec.ReadToken()
+	if err != nil {
+		return err
+	}
+	if err := enc.WriteToken(tok); err != nil {
+		return err
+	}
+
+	for dec.PeekKind() != '}' {
+		key, err := dec.ReadToken()
+		if err != nil {
+			return err
+		}
+		if err := enc.WriteToken(key); err != nil {
+			return err
+		}
+
+		if key.Kind() == '"' && key.String() == field {
+			if err := transform(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, err := dec.ReadValue()
+		if err != nil {
+			return err
+		}
+		if err := enc.WriteValue(val); err != nil {
+			return err
+		}
+	}
+
+	tok, err = dec.ReadToken()
+	if err != nil {
+		return err
+	}
+	return enc.WriteToken(tok)
+}
+
+// transformArray streams a JSON array from dec to enc. For every element, transform is called
+// with dec positioned at the element and must read it and write a replacement to enc.
+// Non-arrays pass through unchanged.
+func transformArray(dec *jsontext.Decoder, enc *jsontext.Encoder, transform func() error) error {
+	if dec.PeekKind() != '[' {
+		val, err := dec.ReadValue()
+		if err != nil {
+			return err
+		}
+		return enc.WriteValue(val)
+	}
+
+	tok, err := dec.ReadToken()
+	if err != nil {
+		return err
+	}
+	if err := enc.WriteToken(tok); err != nil {
+		return err
+	}
+
+	for dec.PeekKind() != ']' {
+		if err := transform(); err != nil {
+			return err
+		}
+	}
+
+	tok, err = dec.ReadToken()
+	if err != nil {
+		return err
+	}
+	return enc.WriteToken(tok)
+}
+
 // ensureSystemPrompt checks if prompt is the first element and adds it if not.
 // Writes directly to the encoder to avoid intermediate allocations.
 func ensureSystemPrompt(enc *jsontext.Encoder, systemVal jsontext.Value) error {
@@ -321,6 +321,73 @@ func TestSystemInjectorEdgeCases(t *testing.T) {
 	}
 }
 
+func TestBatchSystemInjector(t *testing.T) {
+	input := `{
+		"requests": [
+			{
+				"custom_id": "first",
+				"params": {
+					"model": "claude-3-sonnet",
+					"max_tokens": 1024,
+					"messages": [{"role": "user", "content": "Hello"}]
+				}
+			},
+			{
+				"custom_id": "second",
+				"params": {
+					"model": "claude-3-sonnet",
+					"max_tokens": 1024,
+					"system": [{"type": "text", "text": "You are a helpful assistant."}],
+					"messages": [{"role": "user", "content": "Hi"}]
+				}
+			}
+		]
+	}`
+	expected := `{
+		"requests": [
+			{
+				"custom_id": "first",
+				"params": {
+					"model": "claude-3-sonnet",
+					"max_tokens": 1024,
+					"messages": [{"role": "user", "content": "Hello"}],
+					"system": [{"type": "text", "text": "You are Claude Code, Anthropic's official CLI for Claude."}]
+				}
+			},
+			{
+				"custom_id": "second",
+				"params": {
+					"model": "claude-3-sonnet",
+					"max_tokens": 1024,
+					"system": [
+						{"type": "text", "text": "You are Claude Code, Anthropic's official CLI for Claude."},
+						{"type": "text", "text": "You are a helpful assistant."}
+					],
+					"messages": [{"role": "user", "content": "Hi"}]
+				}
+			}
+		]
+	}`
+
+	output := &bytes.Buffer{}
+	if err := injectBatchSystemPrompts(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	if got, want := normalizeJSON(t, output.String()), normalizeJSON(t, expected); got != want {
+		t.Errorf("Transform mismatch:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// No top-level system field must be added to the batch envelope
+	var envelope map[string]any
+	if err := json.Unmarshal(output.Bytes(), &envelope); err != nil {
+		t.Fatalf("Invalid output JSON: %v", err)
+	}
+	if _, exists := envelope["system"]; exists {
+		t.Error("System field was added to batch envelope")
+	}
+}
+
 func TestImpersonationTransport(t *testing.T) {
 	// Create test server that captures request headers and body
 	var receivedBody string
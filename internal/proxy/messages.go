@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"log/slog"
+	"net/http"
+
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter"
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter/openaicompat"
+)
+
+// CreateMessagesHandler handles Anthropic Messages API requests for models served by
+// an OpenAI-compatible upstream.
+type CreateMessagesHandler struct {
+	Adapter   *openaicompat.CreateMessageAdapter
+	Transport http.RoundTripper
+}
+
+// Compile-time check to ensure CreateMessagesHandler implements http.Handler
+var _ http.Handler = (*CreateMessagesHandler)(nil)
+
+// ServeHTTP implements http.Handler interface for streaming or non-streaming requests.
+func (h *CreateMessagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req anthropicadapter.CreateMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
+			writeAnthropicError(ctx, w, http.StatusRequestEntityTooLarge, "request_too_large", http.StatusText(http.StatusRequestEntityTooLarge))
+			return
+		}
+		slog.ErrorContext(ctx, "failed to decode request", "error", err)
+		writeAnthropicError(ctx, w, http.StatusBadRequest, "invalid_request_error", http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if req.Stream {
+		stream, err := h.Adapter.ProcessStreamingRequest(ctx, req, h.Transport)
+		if err != nil {
+			slog.ErrorContext(ctx, "streaming request failed", "error", err)
+			writeAnthropicAdapterError(ctx, w, err)
+			return
+		}
+		writeSSEAnthropicStream(ctx, w, stream)
+		return
+	}
+
+	response, err := h.Adapter.ProcessRequest(ctx, req, h.Transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "request failed", "error", err)
+		writeAnthropicAdapterError(ctx, w, err)
+		return
+	}
+	writeJSON(ctx, w, response, http.StatusOK)
+}
+
+// writeAnthropicAdapterError writes an adapter error as Anthropic error response.
+// Errors not already mapped by the adapter are masked as generic api_error.
+func writeAnthropicAdapterError(ctx context.Context, w http.ResponseWriter, err error) {
+	var errResp *anthropicadapter.ErrorResponse
+	if errors.As(err, &errResp) {
+		writeJSON(ctx, w, errResp, errResp.StatusCode)
+		return
+	}
+	writeAnthropicError(ctx, w, http.StatusInternalServerError, "api_error", http.StatusText(http.StatusInternalServerError))
+}
+
+// writeSSEAnthropicStream writes adapter events as Anthropic SSE stream, naming each
+// event after its type. Errors end the stream with an error event.
+func writeSSEAnthropicStream(ctx context.Context, w http.ResponseWriter, stream iter.Seq2[*anthropicadapter.MessageStreamEvent, error]) {
+	sse, err := NewSSEWriter(w)
+	if err != nil {
+		slog.ErrorContext(ctx, "SSE not supported", "error", err)
+		writeAnthropicError(ctx, w, http.StatusInternalServerError, "api_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	for event, err := range stream {
+		// Check for client disconnect before processing event
+		if ctx.Err() != nil {
+			slog.DebugContext(ctx, "client disconnected during stream")
+			return
+		}
+
+		if err != nil {
+			slog.ErrorContext(ctx, "stream error", "error", err)
+			var errResp *anthropicadapter.ErrorResponse
+			if !errors.As(err, &errResp) {
+				errResp = anthropicadapter.NewErrorResponse(http.StatusInternalServerError, "api_error", err.Error())
+			}
+			if writeErr := sse.WriteEvent("error"); writeErr != nil {
+				slog.ErrorContext(ctx, "failed to write error event type", "error", writeErr)
+				return
+			}
+			if writeErr := sse.WriteData(errResp); writeErr != nil {
+				slog.ErrorContext(ctx, "failed to write error", "error", writeErr)
+			}
+			return
+		}
+
+		if err := sse.WriteEvent(event.Type); err != nil {
+			slog.ErrorContext(ctx, "failed to write event type", "error", err)
+			return
+		}
+		if err := sse.WriteData(event); err != nil {
+			slog.ErrorContext(ctx, "failed to write event", "error", err)
+			return
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package proxy
 
-import "net/http"
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
 
 // Recovery recovers from panics in HTTP handlers and returns HTTP 500 to the client.
 func Recovery(next http.Handler) http.Handler {
@@ -27,6 +32,20 @@ func RequestSizeLimit(maxBytes int64) func(http.Handler) http.Handler {
 	}
 }
 
+// ReadTimeout extends the deadline for reading the request body beyond the server's
+// ReadTimeout, for routes accepting uploads too large to send within it.
+func ReadTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(timeout))
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				slog.WarnContext(r.Context(), "failed to extend read deadline", "error", err)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // applyMiddlewares applies middlewares to a handler in the order they appear.
 // The first middleware in the slice is the outermost (executes first).
 func applyMiddlewares(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
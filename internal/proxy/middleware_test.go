@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		wantRead bool
+	}{
+		{name: "server read timeout", handler: readAll(), wantRead: false},
+		{name: "extended read timeout", handler: ReadTimeout(time.Minute)(readAll()), wantRead: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewUnstartedServer(tt.handler)
+			server.Config.ReadTimeout = 100 * time.Millisecond
+			server.Start()
+			defer server.Close()
+
+			// The body arrives slower than the server's ReadTimeout allows
+			body, writer := io.Pipe()
+			go func() {
+				for range 3 {
+					time.Sleep(75 * time.Millisecond)
+					if _, err := writer.Write([]byte("chunk")); err != nil {
+						return
+					}
+				}
+				_ = writer.Close()
+			}()
+
+			resp, err := http.Post(server.URL, "application/octet-stream", body)
+			if err != nil {
+				if tt.wantRead {
+					t.Fatalf("Request failed: %v", err)
+				}
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if got := resp.StatusCode == http.StatusOK; got != tt.wantRead {
+				t.Errorf("Expected body read %v, got status %d", tt.wantRead, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// readAll answers 200 once the request body was read completely, and 400 otherwise.
+func readAll() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -4,6 +4,7 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -15,8 +16,11 @@ import (
 
 	"golang.org/x/oauth2"
 
+	"github.com/florianilch/claudine-proxy/internal/docconvert"
+	"github.com/florianilch/claudine-proxy/internal/filestore"
 	"github.com/florianilch/claudine-proxy/internal/observability/middleware"
 	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/urlfetch"
 )
 
 const (
@@ -26,8 +30,9 @@ const (
 
 // Proxy represents the forward proxy server
 type Proxy struct {
-	mux    *http.ServeMux
-	server *http.Server
+	mux       *http.ServeMux
+	server    *http.Server
+	tlsConfig *tls.Config
 }
 
 // Compile-time check that Proxy implements http.Handler
@@ -42,6 +47,19 @@ type ReadinessChecker interface {
 type config struct {
 	baseURL   string
 	transport http.RoundTripper
+	tlsConfig *tls.Config
+	fileStore *filestore.Store
+
+	urlFetcher     *urlfetch.Fetcher
+	inlineMessages bool
+
+	documentConverter *docconvert.Converter
+	maxContinuations  int
+	streamThreshold   int
+	contextManagement *ContextManagement
+	historyMode       string
+	apiKeyAuth        bool
+	upstreams         []Upstream
 }
 
 // Option configures the proxy
@@ -61,6 +79,101 @@ func WithBaseURL(baseURL string) Option {
 	}
 }
 
+// WithTLSConfig enables TLS for inbound connections.
+// Set ClientCAs and ClientAuth on the config to require client certificates (mTLS).
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithFileStore enables the Files API and file_id references backed by the given store.
+func WithFileStore(store *filestore.Store) Option {
+	return func(c *config) {
+		c.fileStore = store
+	}
+}
+
+// WithURLFetcher enables inlining of remote image URLs in chat completion requests.
+// URLs allowed by the fetcher's policy are downloaded by the proxy instead of Anthropic.
+func WithURLFetcher(fetcher *urlfetch.Fetcher) Option {
+	return func(c *config) {
+		c.urlFetcher = fetcher
+	}
+}
+
+// WithMessagesURLInlining additionally rewrites URL sources in Messages API requests.
+// Has no effect without WithURLFetcher.
+func WithMessagesURLInlining() Option {
+	return func(c *config) {
+		c.inlineMessages = true
+	}
+}
+
+// WithDocumentConverter enables conversion of Office, HTML, CSV and JSON files in chat
+// completion requests to plain text documents, since Anthropic only reads PDF and text.
+func WithDocumentConverter(converter *docconvert.Converter) Option {
+	return func(c *config) {
+		c.documentConverter = converter
+	}
+}
+
+// WithContinuation enables automatic continuation of chat completions that stop at the
+// output token limit, with up to maxRounds follow-up requests per response.
+func WithContinuation(maxRounds int) Option {
+	return func(c *config) {
+		c.maxContinuations = maxRounds
+	}
+}
+
+// WithInternalStreaming streams non-streaming Messages API and chat completion requests
+// with max_tokens of at least threshold from Anthropic and returns them as a single
+// response, so long generations don't run into response header timeouts.
+func WithInternalStreaming(threshold int) Option {
+	return func(c *config) {
+		c.streamThreshold = threshold
+	}
+}
+
+// ContextManagement configures trimming of chat completion histories that exceed the
+// model's context window.
+type ContextManagement struct {
+	// Strategy is "drop_oldest" or "summarize".
+	Strategy string
+	// SummaryModel writes summaries for the "summarize" strategy.
+	SummaryModel string
+	// CountTokens counts input tokens via Anthropic instead of estimating them.
+	CountTokens bool
+	// MaxInputTokens overrides the input budget derived from the model's context window.
+	MaxInputTokens int
+}
+
+// WithContextManagement enables trimming of chat completion histories that exceed the
+// model's context window. Trimming is reported in the X-Context-Trimmed response header
+// and logged at info level. Context management is off unless this option is given.
+func WithContextManagement(cfg ContextManagement) Option {
+	return func(c *config) {
+		c.contextManagement = &cfg
+	}
+}
+
+// WithHistoryMode selects how chat completion histories Anthropic would reject, such as
+// tool calls without results, are handled: "off" (the default) sends them as received,
+// "repair" normalizes them and "strict" rejects the request naming the offending message.
+func WithHistoryMode(mode string) Option {
+	return func(c *config) {
+		c.historyMode = mode
+	}
+}
+
+// WithAPIKeyAuth sends the token as an Anthropic Console API key (x-api-key) instead of
+// an OAuth Bearer token, without impersonating Claude Code.
+func WithAPIKeyAuth() Option {
+	return func(c *config) {
+		c.apiKeyAuth = true
+	}
+}
+
 // DefaultTransport returns a new http.Transport configured for API requirements.
 // Clones http.DefaultTransport and adds ResponseHeaderTimeout to prevent indefinite hangs.
 // Returns a fresh instance on each call to prevent accidental mutation.
@@ -92,14 +205,7 @@ func New(ts oauth2.TokenSource, health ReadinessChecker, opts ...Option) (*Proxy
 		return nil, fmt.Errorf("invalid upstream URL: %w", err)
 	}
 
-	// Compose transport chain (request execution order):
-	// oauth2.Transport → ImpersonationTransport → cfg.transport
-	transport := &oauth2.Transport{
-		Source: ts,
-		Base: &ImpersonationTransport{
-			Base: cfg.transport,
-		},
-	}
+	transport := newAnthropicTransport(ts, cfg.apiKeyAuth, cfg.transport)
 
 	// Build reverse proxy for Anthropic API
 	reverseProxyHandler := &httputil.ReverseProxy{
@@ -115,9 +221,54 @@ func New(ts oauth2.TokenSource, health ReadinessChecker, opts ...Option) (*Proxy
 		Transport:     transport,
 	}
 
+	// Uploaded files are resolved by the adapters when referenced via file_id
+	var adapterOpts []anthropicclaude.Option
+	if cfg.fileStore != nil {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithFileResolver(newFileResolver(cfg.fileStore)))
+	}
+	// Remote URLs within the fetch policy are inlined, since Anthropic can't reach intranet hosts
+	if cfg.urlFetcher != nil {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithURLFetcher(newURLFetcher(cfg.urlFetcher)))
+	}
+	// Documents Anthropic can't read are sent as their extracted text
+	if cfg.documentConverter != nil {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithDocumentConverter(newDocumentConverter(cfg.documentConverter)))
+	}
+	if cfg.maxContinuations > 0 {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithContinuation(cfg.maxContinuations))
+	}
+	if cfg.streamThreshold > 0 {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithInternalStreaming(cfg.streamThreshold))
+	}
+	// Histories exceeding the context window are trimmed before the request is sent
+	if cm := cfg.contextManagement; cm != nil {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithContextManagement(anthropicclaude.ContextManagement{
+			Strategy:       anthropicclaude.ContextStrategy(cm.Strategy),
+			SummaryModel:   cm.SummaryModel,
+			CountTokens:    cm.CountTokens,
+			MaxInputTokens: int64(cm.MaxInputTokens),
+		}))
+	}
+	if cfg.historyMode != "" {
+		adapterOpts = append(adapterOpts, anthropicclaude.WithHistoryMode(anthropicclaude.HistoryMode(cfg.historyMode)))
+	}
+
 	// OpenAI SDK compatibility handler
 	createChatCompletionsHandler := &CreateChatCompletionsHandler{
-		Adapter:   anthropicclaude.NewCreateChatCompletionAdapter(),
+		Adapter:   anthropicclaude.NewCreateChatCompletionAdapter(adapterOpts...),
+		Transport: transport,
+	}
+	countChatCompletionTokensHandler := &CountChatCompletionTokensHandler{
+		Adapter:   createChatCompletionsHandler.Adapter,
+		Transport: transport,
+	}
+	batchesHandler := &BatchesHandler{
+		Adapter:   anthropicclaude.NewBatchAdapter(adapterOpts...),
+		Transport: transport,
+		Files:     cfg.fileStore,
+	}
+	createCompletionsHandler := &CreateCompletionsHandler{
+		Adapter:   anthropicclaude.NewCreateCompletionAdapter(),
 		Transport: transport,
 	}
 
@@ -125,21 +276,144 @@ func New(ts oauth2.TokenSource, health ReadinessChecker, opts ...Option) (*Proxy
 
 	mux := http.NewServeMux()
 
+	// Long non-streaming Messages API requests are streamed from upstream and buffered
+	createMessageHandler := streamLongMessages(cfg.streamThreshold, reverseProxyHandler)
+
+	// Requests for models of additional upstreams are routed to them
+	chatCompletionsHandler := http.Handler(createChatCompletionsHandler)
+	if len(cfg.upstreams) > 0 {
+		messageRoutes, chatCompletionRoutes, err := newUpstreamRoutes(cfg.upstreams, cfg.transport, createChatCompletionsHandler.Adapter, upstream.Path, cfg.streamThreshold)
+		if err != nil {
+			return nil, err
+		}
+		createMessageHandler = routeByModel(messageRoutes)(createMessageHandler)
+		chatCompletionsHandler = routeByModel(chatCompletionRoutes)(chatCompletionsHandler)
+	}
+
+	// Messages API requests optionally get URL sources inlined before forwarding, whichever
+	// upstream serves them
+	messagesHandler := http.Handler(reverseProxyHandler)
+	if cfg.urlFetcher != nil && cfg.inlineMessages {
+		messagesHandler = InlineURLSources(cfg.urlFetcher)(reverseProxyHandler)
+		createMessageHandler = InlineURLSources(cfg.urlFetcher)(createMessageHandler)
+	}
+
 	// Forward proxy to Anthropic Messages API
-	mux.Handle("POST "+upstream.Path+"/messages", applyMiddlewares(reverseProxyHandler,
+	mux.Handle("POST "+upstream.Path+"/messages", applyMiddlewares(createMessageHandler,
+		middleware.Logging(logger),
+		Recovery,
+		middleware.TraceContextExtraction,
+		middleware.ClientIdentity,
+		middleware.RequestIDGeneration,
+		RequestSizeLimit(33<<20), // Anthropic enforces 32MB
+		middleware.RequestIDPropagation,
+	))
+
+	// Forward proxy to Anthropic Token Counting API (system prompt is injected for accurate counts)
+	mux.Handle("POST "+upstream.Path+"/messages/count_tokens", applyMiddlewares(messagesHandler,
 		middleware.Logging(logger),
 		Recovery,
 		middleware.TraceContextExtraction,
+		middleware.ClientIdentity,
 		middleware.RequestIDGeneration,
 		RequestSizeLimit(33<<20), // Anthropic enforces 32MB
 		middleware.RequestIDPropagation,
 	))
 
+	// Forward proxy to Anthropic Message Batches API (system prompt is injected into every request)
+	for _, pattern := range []string{
+		"POST " + upstream.Path + "/messages/batches",
+		"GET " + upstream.Path + "/messages/batches",
+		"GET " + upstream.Path + "/messages/batches/{batch_id}",
+		"DELETE " + upstream.Path + "/messages/batches/{batch_id}",
+		"POST " + upstream.Path + "/messages/batches/{batch_id}/cancel",
+		"GET " + upstream.Path + "/messages/batches/{batch_id}/results",
+	} {
+		mux.Handle(pattern, applyMiddlewares(reverseProxyHandler,
+			middleware.Logging(logger),
+			Recovery,
+			middleware.TraceContextExtraction,
+			middleware.ClientIdentity,
+			middleware.RequestIDGeneration,
+			RequestSizeLimit(257<<20), // Anthropic enforces 256MB for batches
+			middleware.RequestIDPropagation,
+		))
+	}
+
 	// OpenAI SDK compatibility layer
-	mux.Handle("POST "+upstream.Path+"/chat/completions", applyMiddlewares(createChatCompletionsHandler,
+	mux.Handle("POST "+upstream.Path+"/chat/completions", applyMiddlewares(chatCompletionsHandler,
+		middleware.Logging(logger),
+		Recovery,
+		middleware.TraceContextExtraction,
+		middleware.ClientIdentity,
+		middleware.RequestIDGeneration,
+		RequestSizeLimit(31<<20), // proxy handles error
+		middleware.RequestIDPropagation,
+	))
+
+	// Proxy-specific token counting for OpenAI chat completion bodies
+	mux.Handle("POST "+upstream.Path+"/chat/completions/count_tokens", applyMiddlewares(countChatCompletionTokensHandler,
+		middleware.Logging(logger),
+		Recovery,
+		middleware.TraceContextExtraction,
+		middleware.ClientIdentity,
+		middleware.RequestIDGeneration,
+		RequestSizeLimit(31<<20), // proxy handles error
+		middleware.RequestIDPropagation,
+	))
+
+	// OpenAI-style Batch API facade on top of Message Batches
+	for pattern, handler := range map[string]http.HandlerFunc{
+		"POST " + upstream.Path + "/batches":                   batchesHandler.CreateBatch,
+		"GET " + upstream.Path + "/batches":                    batchesHandler.ListBatches,
+		"GET " + upstream.Path + "/batches/{batch_id}":         batchesHandler.RetrieveBatch,
+		"POST " + upstream.Path + "/batches/{batch_id}/cancel": batchesHandler.CancelBatch,
+		"GET " + upstream.Path + "/batches/{batch_id}/output":  batchesHandler.BatchOutput,
+	} {
+		mux.Handle(pattern, applyMiddlewares(handler,
+			middleware.Logging(logger),
+			Recovery,
+			middleware.TraceContextExtraction,
+			middleware.ClientIdentity,
+			middleware.RequestIDGeneration,
+			ReadTimeout(10*time.Minute), // input files of up to 255MB outlast the server's ReadTimeout
+			RequestSizeLimit(255<<20),   // proxy handles error
+			middleware.RequestIDPropagation,
+		))
+	}
+
+	// OpenAI-style Files API backed by the local file store
+	if cfg.fileStore != nil {
+		filesHandler := &FilesHandler{
+			Store:   cfg.fileStore,
+			Batches: batchesHandler,
+		}
+		for pattern, handler := range map[string]http.HandlerFunc{
+			"POST " + upstream.Path + "/files":                  filesHandler.CreateFile,
+			"GET " + upstream.Path + "/files":                   filesHandler.ListFiles,
+			"GET " + upstream.Path + "/files/{file_id}":         filesHandler.RetrieveFile,
+			"DELETE " + upstream.Path + "/files/{file_id}":      filesHandler.DeleteFile,
+			"GET " + upstream.Path + "/files/{file_id}/content": filesHandler.FileContent,
+		} {
+			mux.Handle(pattern, applyMiddlewares(handler,
+				middleware.Logging(logger),
+				Recovery,
+				middleware.TraceContextExtraction,
+				middleware.ClientIdentity,
+				middleware.RequestIDGeneration,
+				ReadTimeout(10*time.Minute), // uploads of up to 512MB outlast the server's ReadTimeout
+				RequestSizeLimit(512<<20),   // OpenAI enforces 512MB per file
+				middleware.RequestIDPropagation,
+			))
+		}
+	}
+
+	// Legacy OpenAI text completions (editor autocomplete, eval harnesses)
+	mux.Handle("POST "+upstream.Path+"/completions", applyMiddlewares(createCompletionsHandler,
 		middleware.Logging(logger),
 		Recovery,
 		middleware.TraceContextExtraction,
+		middleware.ClientIdentity,
 		middleware.RequestIDGeneration,
 		RequestSizeLimit(31<<20), // proxy handles error
 		middleware.RequestIDPropagation,
@@ -150,6 +424,7 @@ func New(ts oauth2.TokenSource, health ReadinessChecker, opts ...Option) (*Proxy
 		middleware.Logging(logger),
 		Recovery,
 		middleware.TraceContextExtraction,
+		middleware.ClientIdentity,
 		middleware.RequestIDGeneration,
 		middleware.RequestIDPropagation,
 	))
@@ -158,7 +433,7 @@ func New(ts oauth2.TokenSource, health ReadinessChecker, opts ...Option) (*Proxy
 	mux.HandleFunc("GET /health/liveness", livenessHandler())
 	mux.HandleFunc("GET /health/readiness", readinessHandler(health))
 
-	return &Proxy{mux: mux}, nil
+	return &Proxy{mux: mux, tlsConfig: cfg.tlsConfig}, nil
 }
 
 // ServeHTTP implements http.Handler interface
@@ -182,6 +457,7 @@ func (p *Proxy) Start(ctx context.Context, address string) (<-chan error, error)
 
 	p.server = &http.Server{
 		Handler:      p,
+		TLSConfig:    p.tlsConfig,
 		ReadTimeout:  30 * time.Second, // Inbound: Read entire client request (DoS protection against slow clients)
 		WriteTimeout: 15 * time.Minute, // Inbound: Write entire response to client (allows long SSE streams, still bounded)
 		IdleTimeout:  90 * time.Second, // Inbound: Keep-alive wait for next request from client
@@ -193,7 +469,13 @@ func (p *Proxy) Start(ctx context.Context, address string) (<-chan error, error)
 	errCh := make(chan error, 1)
 
 	go func() {
-		err := p.server.Serve(listener)
+		var err error
+		if p.tlsConfig != nil {
+			// ServeTLS advertises HTTP/2 via ALPN; handshake failures surface per connection, not at startup
+			err = p.server.ServeTLS(listener, "", "")
+		} else {
+			err = p.server.Serve(listener)
+		}
 		// Only report error if not from graceful shutdown
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
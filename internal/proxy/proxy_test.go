@@ -0,0 +1,1557 @@
+//go:build goexperiment.jsonv2
+
+package proxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/florianilch/claudine-proxy/internal/bedrock"
+	"github.com/florianilch/claudine-proxy/internal/docconvert"
+	"github.com/florianilch/claudine-proxy/internal/filestore"
+	"github.com/florianilch/claudine-proxy/internal/urlfetch"
+)
+
+// capturingTransport records the upstream request and returns a canned JSON response.
+type capturingTransport struct {
+	path         string
+	header       http.Header
+	body         []byte
+	responseBody string
+}
+
+func (c *capturingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.path = req.URL.Path
+	c.header = req.Header
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.body = body
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(c.responseBody)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Request:    req,
+	}, nil
+}
+
+func TestProxyCountTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{
+			name: "anthropic passthrough",
+			path: "/v1/messages/count_tokens",
+			body: `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":"Hello"}]}`,
+		},
+		{
+			name: "openai chat completion body",
+			path: "/v1/chat/completions/count_tokens",
+			body: `{"model":"claude-sonnet-4-0","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hello"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &capturingTransport{responseBody: `{"input_tokens":42}`}
+
+			ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+			proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport))
+			if err != nil {
+				t.Fatalf("Failed to create proxy: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if transport.path != "/v1/messages/count_tokens" {
+				t.Errorf("upstream path: got %q, want %q", transport.path, "/v1/messages/count_tokens")
+			}
+
+			var upstreamReq struct {
+				System []struct {
+					Text string `json:"text"`
+				} `json:"system"`
+			}
+			if err := json.Unmarshal(transport.body, &upstreamReq); err != nil {
+				t.Fatalf("Failed to parse upstream body: %v", err)
+			}
+			if len(upstreamReq.System) == 0 || upstreamReq.System[0].Text != claudeCodeSystemPrompt {
+				t.Errorf("system prompt not injected: %s", transport.body)
+			}
+
+			var count struct {
+				InputTokens int `json:"input_tokens"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &count); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if count.InputTokens != 42 {
+				t.Errorf("input_tokens: got %d, want 42", count.InputTokens)
+			}
+		})
+	}
+}
+
+// routingTransport serves canned responses by upstream path and records request bodies.
+type routingTransport struct {
+	responses map[string]string
+	bodies    map[string][]byte
+}
+
+func (rt *routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		rt.bodies[req.URL.Path] = body
+	}
+
+	response, ok := rt.responses[req.URL.Path]
+	if !ok {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(strings.NewReader(`{"type":"error","error":{"type":"not_found_error","message":"not found"}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Request:    req,
+		}, nil
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(response)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Request:    req,
+	}, nil
+}
+
+func TestProxyBatchesFacade(t *testing.T) {
+	const endedBatch = `{
+		"id": "msgbatch_01abc",
+		"type": "message_batch",
+		"processing_status": "ended",
+		"request_counts": {"processing": 0, "succeeded": 1, "errored": 1, "canceled": 0, "expired": 0},
+		"created_at": "2025-01-01T00:00:00Z",
+		"ended_at": "2025-01-01T01:00:00Z",
+		"expires_at": "2025-01-02T00:00:00Z",
+		"archived_at": null,
+		"cancel_initiated_at": null,
+		"results_url": "https://api.anthropic.com/v1/messages/batches/msgbatch_01abc/results"
+	}`
+
+	transport := &routingTransport{
+		responses: map[string]string{
+			"/v1/messages/batches":                        endedBatch,
+			"/v1/messages/batches/msgbatch_01abc":         endedBatch,
+			"/v1/messages/batches/msgbatch_01abc/results": `{"custom_id":"req-1","result":{"type":"succeeded","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"4"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}}` + "\n" + `{"custom_id":"req-2","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens too large"}}}}` + "\n",
+		},
+		bodies: make(map[string][]byte),
+	}
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		input := `{"custom_id":"req-1","method":"POST","url":"/v1/chat/completions","body":{"model":"claude-sonnet-4-0","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"What is 2+2?"}]}}
+{"custom_id":"req-2","method":"POST","url":"/v1/chat/completions","body":{"model":"claude-sonnet-4-0","max_completion_tokens":999999,"messages":[{"role":"user","content":"Hi"}]}}
+`
+		req := httptest.NewRequest(http.MethodPost, "/v1/batches", strings.NewReader(input))
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var upstreamReq struct {
+			Requests []struct {
+				CustomID string `json:"custom_id"`
+				Params   struct {
+					System []struct {
+						Text string `json:"text"`
+					} `json:"system"`
+				} `json:"params"`
+			} `json:"requests"`
+			System json.RawMessage `json:"system"`
+		}
+		if err := json.Unmarshal(transport.bodies["/v1/messages/batches"], &upstreamReq); err != nil {
+			t.Fatalf("Failed to parse upstream body: %v", err)
+		}
+		if upstreamReq.System != nil {
+			t.Errorf("system prompt injected into batch envelope: %s", upstreamReq.System)
+		}
+		if len(upstreamReq.Requests) != 2 {
+			t.Fatalf("upstream requests: got %d, want 2", len(upstreamReq.Requests))
+		}
+		for _, r := range upstreamReq.Requests {
+			if len(r.Params.System) == 0 || r.Params.System[0].Text != claudeCodeSystemPrompt {
+				t.Errorf("system prompt not injected into %s", r.CustomID)
+			}
+		}
+		if got := upstreamReq.Requests[0].Params.System; len(got) != 2 || got[1].Text != "Be brief." {
+			t.Errorf("hoisted system prompt missing in req-1: %+v", got)
+		}
+
+		var batch struct {
+			ID            string `json:"id"`
+			Object        string `json:"object"`
+			Status        string `json:"status"`
+			OutputFileID  string `json:"output_file_id"`
+			RequestCounts struct {
+				Total     int `json:"total"`
+				Completed int `json:"completed"`
+				Failed    int `json:"failed"`
+			} `json:"request_counts"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if batch.ID != "msgbatch_01abc" || batch.Object != "batch" || batch.Status != "completed" || batch.OutputFileID != "msgbatch_01abc" {
+			t.Errorf("unexpected batch: %s", rec.Body.String())
+		}
+		if batch.RequestCounts.Total != 2 || batch.RequestCounts.Completed != 1 || batch.RequestCounts.Failed != 1 {
+			t.Errorf("unexpected request counts: %+v", batch.RequestCounts)
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		input := `{"custom_id":"req-1","method":"POST","url":"/v1/embeddings","body":{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":"Hi"}]}}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/batches", strings.NewReader(input))
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status: got %d, want %d (body: %s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+	})
+
+	t.Run("output", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/batches/msgbatch_01abc/output", nil)
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("output lines: got %d, want 2:\n%s", len(lines), rec.Body.String())
+		}
+
+		want := []string{
+			`{"id":"batch_req_req-1","custom_id":"req-1","response":{"status_code":200,"request_id":"msg_01","body":{"id":"msg_01","object":"chat.completion","created":0,"model":"claude-sonnet-4-0","service_tier":null,"choices":[{"index":0,"message":{"role":"assistant","content":"4","refusal":null},"finish_reason":"stop","logprobs":null}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11,"completion_tokens_details":{"reasoning_tokens":0}}}},"error":null}`,
+			`{"id":"batch_req_req-2","custom_id":"req-2","response":null,"error":{"code":"invalid_request_error","message":"max_tokens too large"}}`,
+		}
+		for i, line := range lines {
+			if got, want := normalizeJSON(t, line), normalizeJSON(t, want[i]); got != want {
+				t.Errorf("line %d:\ngot:  %s\nwant: %s", i+1, got, want)
+			}
+		}
+	})
+}
+
+// uploadFile uploads content via the Files API and returns the decoded file object.
+func uploadFile(t *testing.T, proxy *Proxy, filename, purpose, content string) (int, map[string]any) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("purpose", purpose); err != nil {
+		t.Fatalf("Failed to write purpose: %v", err)
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("Failed to create file part: %v", err)
+	}
+	if _, err := io.WriteString(part, content); err != nil {
+		t.Fatalf("Failed to write file part: %v", err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatalf("Failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	var file map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &file); err != nil {
+		t.Fatalf("Failed to parse upload response: %v", err)
+	}
+	return rec.Code, file
+}
+
+func TestProxyFiles(t *testing.T) {
+	store, err := filestore.New(t.TempDir(), filestore.WithTTL(time.Hour), filestore.WithQuota(64))
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	transport := &capturingTransport{
+		responseBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Done"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}`,
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithFileStore(store))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	status, file := uploadFile(t, proxy, "notes.txt", "user_data", "Meeting notes: ship it.")
+	if status != http.StatusOK {
+		t.Fatalf("upload status: got %d, want %d (body: %v)", status, http.StatusOK, file)
+	}
+	fileID, _ := file["id"].(string)
+	if !strings.HasPrefix(fileID, "file-") || file["object"] != "file" || file["filename"] != "notes.txt" || file["bytes"] != float64(23) || file["expires_at"] == nil {
+		t.Fatalf("unexpected file object: %v", file)
+	}
+
+	t.Run("chat completion resolves file_id", func(t *testing.T) {
+		body := `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":[{"type":"file","file":{"file_id":"` + fileID + `"}},{"type":"text","text":"Summarize."}]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var upstreamReq struct {
+			Messages []struct {
+				Content []struct {
+					Type   string `json:"type"`
+					Title  string `json:"title"`
+					Source struct {
+						Type string `json:"type"`
+						Data string `json:"data"`
+					} `json:"source"`
+				} `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(transport.body, &upstreamReq); err != nil {
+			t.Fatalf("Failed to parse upstream body: %v", err)
+		}
+		document := upstreamReq.Messages[0].Content[0]
+		if document.Type != "document" || document.Title != "notes.txt" || document.Source.Type != "text" || document.Source.Data != "Meeting notes: ship it." {
+			t.Errorf("unexpected document block: %+v", document)
+		}
+	})
+
+	t.Run("tool result resolves file_id", func(t *testing.T) {
+		body := `{"model":"claude-sonnet-4-0","messages":[` +
+			`{"role":"user","content":"Read my notes."},` +
+			`{"role":"assistant","content":null,"tool_calls":[{"id":"toolu_01","type":"function","function":{"name":"read_notes","arguments":"{}"}}]},` +
+			`{"role":"tool","tool_call_id":"toolu_01","content":[{"type":"file","file":{"file_id":"` + fileID + `"}}]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var upstreamReq struct {
+			Messages []struct {
+				Content []struct {
+					Type    string `json:"type"`
+					Content []struct {
+						Type   string `json:"type"`
+						Title  string `json:"title"`
+						Source struct {
+							Data string `json:"data"`
+						} `json:"source"`
+					} `json:"content"`
+				} `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(transport.body, &upstreamReq); err != nil {
+			t.Fatalf("Failed to parse upstream body: %v", err)
+		}
+		toolResult := upstreamReq.Messages[2].Content[0]
+		if toolResult.Type != "tool_result" || len(toolResult.Content) != 1 {
+			t.Fatalf("unexpected tool result block: %+v", toolResult)
+		}
+		if document := toolResult.Content[0]; document.Type != "document" || document.Title != "notes.txt" || document.Source.Data != "Meeting notes: ship it." {
+			t.Errorf("unexpected document block: %+v", document)
+		}
+	})
+
+	t.Run("chat completion with unknown file_id", func(t *testing.T) {
+		body := `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":[{"type":"file","file":{"file_id":"file-000000000000000000000000"}}]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status: got %d, want %d (body: %s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+	})
+
+	t.Run("list and content", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/files?purpose=user_data", nil))
+
+		var list struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to parse list response: %v", err)
+		}
+		if len(list.Data) != 1 || list.Data[0].ID != fileID {
+			t.Errorf("unexpected file list: %s", rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/files/"+fileID+"/content", nil))
+		if rec.Body.String() != "Meeting notes: ship it." {
+			t.Errorf("content: got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("identical content shares quota", func(t *testing.T) {
+		status, file := uploadFile(t, proxy, "copy.txt", "user_data", "Meeting notes: ship it.")
+		if status != http.StatusOK {
+			t.Fatalf("upload status: got %d, want %d (body: %v)", status, http.StatusOK, file)
+		}
+
+		status, file = uploadFile(t, proxy, "big.txt", "user_data", strings.Repeat("x", 64))
+		if status != http.StatusBadRequest {
+			t.Errorf("upload over quota: got %d, want %d (body: %v)", status, http.StatusBadRequest, file)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/v1/files/"+fileID, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleted":true`) {
+			t.Fatalf("delete: got %d (body: %s)", rec.Code, rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/files/"+fileID, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("retrieve after delete: got %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestProxyBatchesFromInputFile(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	transport := &routingTransport{
+		responses: map[string]string{
+			"/v1/messages/batches":                        `{"id":"msgbatch_01abc","type":"message_batch","processing_status":"in_progress","request_counts":{"processing":1,"succeeded":0,"errored":0,"canceled":0,"expired":0},"created_at":"2025-01-01T00:00:00Z","ended_at":null,"expires_at":"2025-01-02T00:00:00Z","archived_at":null,"cancel_initiated_at":null,"results_url":null}`,
+			"/v1/messages/batches/msgbatch_01abc":         `{"id":"msgbatch_01abc","type":"message_batch","processing_status":"ended","request_counts":{"processing":0,"succeeded":1,"errored":0,"canceled":0,"expired":0},"created_at":"2025-01-01T00:00:00Z","ended_at":"2025-01-01T01:00:00Z","expires_at":"2025-01-02T00:00:00Z","archived_at":null,"cancel_initiated_at":null,"results_url":"https://api.anthropic.com/v1/messages/batches/msgbatch_01abc/results"}`,
+			"/v1/messages/batches/msgbatch_01abc/results": `{"custom_id":"req-1","result":{"type":"succeeded","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"4"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}}` + "\n",
+		},
+		bodies: make(map[string][]byte),
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithFileStore(store))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	status, file := uploadFile(t, proxy, "requests.jsonl", "batch",
+		`{"custom_id":"req-1","method":"POST","url":"/v1/chat/completions","body":{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":"What is 2+2?"}]}}`+"\n")
+	if status != http.StatusOK {
+		t.Fatalf("upload status: got %d, want %d (body: %v)", status, http.StatusOK, file)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/batches", strings.NewReader(
+		`{"input_file_id":"`+file["id"].(string)+`","endpoint":"/v1/chat/completions","completion_window":"24h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if !strings.Contains(string(transport.bodies["/v1/messages/batches"]), `"custom_id":"req-1"`) {
+		t.Errorf("upstream batch missing request: %s", transport.bodies["/v1/messages/batches"])
+	}
+	var batch struct {
+		InputFileID string `json:"input_file_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if batch.InputFileID != file["id"] {
+		t.Errorf("input_file_id: got %q, want %q", batch.InputFileID, file["id"])
+	}
+
+	// Batch output is served as file content of the output_file_id (the batch ID)
+	rec = httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/files/msgbatch_01abc/content", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"custom_id":"req-1"`) {
+		t.Errorf("batch output content: got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProxyURLFetching(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+
+	var downloads, revalidations int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(pngData.Bytes())
+	}))
+	defer server.Close()
+
+	cache, err := urlfetch.NewCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	cidrs, err := urlfetch.ParseCIDRs([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to parse CIDRs: %v", err)
+	}
+	fetcher := urlfetch.New(urlfetch.Policy{AllowedCIDRs: cidrs}, urlfetch.WithCache(cache))
+
+	transport := &capturingTransport{
+		responseBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"A pixel"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`,
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithURLFetcher(fetcher), WithMessagesURLInlining())
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	type upstreamRequest struct {
+		Messages []struct {
+			Content []struct {
+				Type   string `json:"type"`
+				Source struct {
+					Type      string `json:"type"`
+					MediaType string `json:"media_type"`
+					Data      string `json:"data"`
+					URL       string `json:"url"`
+				} `json:"source"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	wantData := base64.StdEncoding.EncodeToString(pngData.Bytes())
+
+	tests := []struct {
+		name       string
+		path       string
+		imageURL   string
+		body       string
+		wantSource string
+	}{
+		{
+			name:       "chat completion inlines allowed url",
+			path:       "/v1/chat/completions",
+			imageURL:   server.URL + "/pixel.png",
+			body:       `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"%s"}}]}]}`,
+			wantSource: "base64",
+		},
+		{
+			name:       "messages inlines allowed url",
+			path:       "/v1/messages",
+			imageURL:   server.URL + "/pixel.png",
+			body:       `{"model":"claude-sonnet-4-0","max_tokens":16,"messages":[{"role":"user","content":[{"type":"image","source":{"type":"url","url":"%s"}}]}]}`,
+			wantSource: "base64",
+		},
+		{
+			name:       "chat completion passes through disallowed url",
+			path:       "/v1/chat/completions",
+			imageURL:   "http://192.0.2.1/pixel.png",
+			body:       `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"%s"}}]}]}`,
+			wantSource: "url",
+		},
+		{
+			name:       "messages passes through disallowed url",
+			path:       "/v1/messages",
+			imageURL:   "http://192.0.2.1/pixel.png",
+			body:       `{"model":"claude-sonnet-4-0","max_tokens":16,"messages":[{"role":"user","content":[{"type":"image","source":{"type":"url","url":"%s"}}]}]}`,
+			wantSource: "url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Replace(tt.body, "%s", tt.imageURL, 1)
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			var upstreamReq upstreamRequest
+			if err := json.Unmarshal(transport.body, &upstreamReq); err != nil {
+				t.Fatalf("Failed to parse upstream body: %v", err)
+			}
+			source := upstreamReq.Messages[0].Content[0].Source
+			if source.Type != tt.wantSource {
+				t.Fatalf("source type: got %q, want %q (body: %s)", source.Type, tt.wantSource, transport.body)
+			}
+			switch tt.wantSource {
+			case "base64":
+				if source.MediaType != "image/png" || source.Data != wantData {
+					t.Errorf("unexpected inlined source: %+v", source)
+				}
+			case "url":
+				if source.URL != tt.imageURL {
+					t.Errorf("url: got %q, want %q", source.URL, tt.imageURL)
+				}
+			}
+		})
+	}
+
+	// The second fetch of the same URL is served from cache after ETag revalidation
+	if downloads != 1 || revalidations != 1 {
+		t.Errorf("downloads/revalidations: got %d/%d, want 1/1", downloads, revalidations)
+	}
+}
+
+func TestProxyDocumentConversion(t *testing.T) {
+	var docx bytes.Buffer
+	zw := zip.NewWriter(&docx)
+	for name, content := range map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/document.xml": `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Quarterly Report</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Revenue grew.</w:t></w:r></w:p>` +
+			`</w:body></w:document>`,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+
+	converter := docconvert.New(docconvert.Policy{
+		Formats:  []docconvert.Format{docconvert.FormatDOCX, docconvert.FormatCSV},
+		MaxBytes: 4096,
+	})
+	transport := &capturingTransport{
+		responseBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Done"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`,
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithDocumentConverter(converter))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		filename   string
+		data       []byte
+		wantStatus int
+		wantText   string
+	}{
+		{
+			name:       "docx",
+			filename:   "report.docx",
+			data:       docx.Bytes(),
+			wantStatus: http.StatusOK,
+			wantText:   "# Quarterly Report\n\nRevenue grew.\n",
+		},
+		{
+			name:       "csv",
+			filename:   "sales.csv",
+			data:       []byte("region;total\nnorth;12\n"),
+			wantStatus: http.StatusOK,
+			wantText:   "| region | total |\n| --- | --- |\n| north | 12 |\n",
+		},
+		{
+			name:       "unknown format is sent as is",
+			filename:   "notes.md",
+			data:       []byte("# Notes\n"),
+			wantStatus: http.StatusOK,
+			wantText:   "# Notes\n",
+		},
+		{
+			name:       "disabled format",
+			filename:   "data.json",
+			data:       []byte(`{"a":1}`),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			filename:   "big.csv",
+			data:       []byte(strings.Repeat("a,b\n", 2048)),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":[{"type":"file","file":{"filename":"` + tt.filename +
+				`","file_data":"` + base64.StdEncoding.EncodeToString(tt.data) + `"}}]}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var upstreamReq struct {
+				Messages []struct {
+					Content []struct {
+						Type   string `json:"type"`
+						Title  string `json:"title"`
+						Source struct {
+							Type string `json:"type"`
+							Data string `json:"data"`
+						} `json:"source"`
+					} `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.Unmarshal(transport.body, &upstreamReq); err != nil {
+				t.Fatalf("Failed to parse upstream body: %v", err)
+			}
+			document := upstreamReq.Messages[0].Content[0]
+			if document.Type != "document" || document.Source.Type != "text" || document.Title != tt.filename {
+				t.Fatalf("unexpected document block: %+v", document)
+			}
+			if document.Source.Data != tt.wantText {
+				t.Errorf("text: got %q, want %q", document.Source.Data, tt.wantText)
+			}
+		})
+	}
+}
+
+// streamingTransport answers streaming requests with the given event stream and
+// non-streaming requests with a canned message, recording the request bodies.
+type streamingTransport struct {
+	events []string
+	bodies [][]byte
+}
+
+func (st *streamingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	st.bodies = append(st.bodies, body)
+
+	var request struct {
+		Stream bool `json:"stream"`
+	}
+	_ = json.Unmarshal(body, &request)
+	if !request.Stream {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Request:    req,
+		}, nil
+	}
+
+	var stream strings.Builder
+	for _, event := range st.events {
+		var data struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal([]byte(event), &data)
+		stream.WriteString("event: " + data.Type + "\ndata: " + event + "\n\n")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(stream.String())),
+		Header:     http.Header{"Content-Type": []string{"text/event-stream; charset=utf-8"}, "Cache-Control": []string{"no-cache"}},
+		Request:    req,
+	}, nil
+}
+
+func TestProxyInternalStreaming(t *testing.T) {
+	messageEvents := []string{
+		`{"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":3}}`,
+		`{"type":"message_stop"}`,
+	}
+	errorEvents := []string{
+		messageEvents[0],
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		events       []string
+		wantStream   bool
+		wantStatus   int
+		wantContent  string
+		wantBody     string
+		wantUpstream string
+	}{
+		{
+			name:       "messages above threshold",
+			path:       "/v1/messages",
+			body:       `{"model":"claude-sonnet-4-0","max_tokens":32000,"messages":[{"role":"user","content":"Hello"}]}`,
+			events:     messageEvents,
+			wantStream: true,
+			wantStatus: http.StatusOK,
+			wantUpstream: `{"model":"claude-sonnet-4-0","max_tokens":32000,"messages":[{"role":"user","content":"Hello"}],"stream":true,` +
+				`"system":[{"text":"You are Claude Code, Anthropic's official CLI for Claude.","type":"text"}]}`,
+			wantBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Hello world"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":3}}`,
+		},
+		{
+			name:       "messages below threshold",
+			path:       "/v1/messages",
+			body:       `{"model":"claude-sonnet-4-0","max_tokens":1024,"messages":[{"role":"user","content":"Hello"}]}`,
+			events:     messageEvents,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`,
+		},
+		{
+			name:       "messages error event",
+			path:       "/v1/messages",
+			body:       `{"model":"claude-sonnet-4-0","max_tokens":32000,"messages":[{"role":"user","content":"Hello"}]}`,
+			events:     errorEvents,
+			wantStream: true,
+			wantStatus: 529,
+			wantBody:   `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		},
+		{
+			name:        "chat completion above threshold",
+			path:        "/v1/chat/completions",
+			body:        `{"model":"claude-sonnet-4-0","max_tokens":32000,"messages":[{"role":"user","content":"Hello"}]}`,
+			events:      messageEvents,
+			wantStream:  true,
+			wantStatus:  http.StatusOK,
+			wantContent: "Hello world",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &streamingTransport{events: tt.events}
+			ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+			proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithInternalStreaming(16384))
+			if err != nil {
+				t.Fatalf("Failed to create proxy: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("content type: got %q, want application/json", contentType)
+			}
+
+			var upstreamReq struct {
+				Stream bool `json:"stream"`
+			}
+			if err := json.Unmarshal(transport.bodies[0], &upstreamReq); err != nil {
+				t.Fatalf("Failed to parse upstream body: %v", err)
+			}
+			if upstreamReq.Stream != tt.wantStream {
+				t.Errorf("upstream stream: got %v, want %v", upstreamReq.Stream, tt.wantStream)
+			}
+
+			if tt.wantUpstream != "" && strings.TrimSpace(string(transport.bodies[0])) != tt.wantUpstream {
+				t.Errorf("upstream body:\ngot  %s\nwant %s", transport.bodies[0], tt.wantUpstream)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("body:\ngot  %s\nwant %s", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantContent != "" {
+				var completion struct {
+					Choices []struct {
+						Message struct {
+							Content string `json:"content"`
+						} `json:"message"`
+					} `json:"choices"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &completion); err != nil || len(completion.Choices) == 0 {
+					t.Fatalf("Failed to parse completion: %v (body: %s)", err, rec.Body.String())
+				}
+				if completion.Choices[0].Message.Content != tt.wantContent {
+					t.Errorf("content: got %q, want %q", completion.Choices[0].Message.Content, tt.wantContent)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyContextManagement(t *testing.T) {
+	transport := &capturingTransport{
+		responseBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"84."}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`,
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithContextManagement(ContextManagement{
+		Strategy:       "drop_oldest",
+		MaxInputTokens: 100,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	long := strings.Repeat("lorem ipsum ", 100)
+	body := `{"model":"claude-sonnet-4-0","messages":[` +
+		`{"role":"user","content":"` + long + `"},` +
+		`{"role":"assistant","content":"` + long + `"},` +
+		`{"role":"user","content":"And doubled?"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got, want := rec.Header().Get("X-Context-Trimmed"), "strategy=drop_oldest; messages=2;"; !strings.HasPrefix(got, want) {
+		t.Errorf("X-Context-Trimmed: got %q, want prefix %q", got, want)
+	}
+
+	var upstreamReq struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(transport.body, &upstreamReq); err != nil {
+		t.Fatalf("Failed to parse upstream body: %v", err)
+	}
+	if len(upstreamReq.Messages) != 1 {
+		t.Errorf("upstream messages: got %d, want 1", len(upstreamReq.Messages))
+	}
+}
+
+func TestProxyHistoryModeStrict(t *testing.T) {
+	transport := &capturingTransport{}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithHistoryMode("strict"))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	body := `{"model":"claude-sonnet-4-0","messages":[` +
+		`{"role":"user","content":"Look it up."},` +
+		`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	var errResp struct {
+		Error struct {
+			Param string `json:"param"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Error.Param != "messages.[1]" {
+		t.Errorf("Expected param messages.[1], got %s", rec.Body.String())
+	}
+	if transport.body != nil {
+		t.Errorf("Expected no upstream request, got %s", transport.body)
+	}
+}
+
+func TestProxyAPIKeyAuth(t *testing.T) {
+	transport := &capturingTransport{
+		responseBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Hi!"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`,
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "sk-ant-api03-test"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithAPIKeyAuth())
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		body string
+	}{
+		{"/v1/messages", `{"model":"claude-sonnet-4-0","max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`},
+		{"/v1/chat/completions", `{"model":"claude-sonnet-4-0","messages":[{"role":"user","content":"Hi"}]}`},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer client-key")
+			req.Header.Set("Anthropic-Beta", "files-api-2025-04-14")
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if got := transport.header.Get("X-Api-Key"); got != "sk-ant-api03-test" {
+				t.Errorf("X-Api-Key: got %q", got)
+			}
+			if got := transport.header.Get("Authorization"); got != "" {
+				t.Errorf("Authorization should be removed, got %q", got)
+			}
+			if got := transport.header.Get("Anthropic-Beta"); strings.Contains(got, "oauth") || strings.Contains(got, "claude-code") {
+				t.Errorf("Anthropic-Beta should not contain OAuth betas, got %q", got)
+			}
+			if got := transport.header.Get("Anthropic-Version"); got != "2023-06-01" {
+				t.Errorf("Anthropic-Version: got %q", got)
+			}
+			if strings.Contains(string(transport.body), "Claude Code") {
+				t.Errorf("System prompt should not be injected: %s", transport.body)
+			}
+		})
+	}
+}
+
+func TestProxyUpstreamRouting(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(pngData.Bytes())
+	}))
+	defer images.Close()
+	imageURL := images.URL + "/pixel.png"
+
+	var upstreamPaths []string
+	var upstreamQuery string
+	var upstreamAuth string
+	var upstreamBody []byte
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPaths = append(upstreamPaths, r.URL.Path)
+		upstreamQuery = r.URL.RawQuery
+		upstreamAuth = r.Header.Get("Authorization")
+		upstreamBody, _ = io.ReadAll(r.Body)
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.Unmarshal(upstreamBody, &req)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, `data: {"id":"chatcmpl-1","choices":[{"delta":{"content":"Hi!"},"finish_reason":"stop"}]}`+"\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hi!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2}}`)
+	}))
+	defer local.Close()
+
+	// Anthropic API key upstream answering every request with an event stream
+	team := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPaths = append(upstreamPaths, r.URL.Path)
+		upstreamAuth = r.Header.Get("X-Api-Key")
+		upstreamBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"message_start","message":{"id":"msg_team","type":"message","role":"assistant","model":"team-1","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi!"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":2}}`,
+			`{"type":"message_stop"}`,
+		} {
+			var data struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(event), &data)
+			_, _ = io.WriteString(w, "event: "+data.Type+"\ndata: "+event+"\n\n")
+		}
+	}))
+	defer team.Close()
+
+	cidrs, err := urlfetch.ParseCIDRs([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to parse CIDRs: %v", err)
+	}
+
+	transport := &capturingTransport{
+		responseBody: `{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-0","content":[{"type":"text","text":"Hi!"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":2}}`,
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{},
+		WithTransport(transport),
+		WithURLFetcher(urlfetch.New(urlfetch.Policy{AllowedCIDRs: cidrs})),
+		WithMessagesURLInlining(),
+		WithInternalStreaming(1000),
+		WithUpstreams(Upstream{
+			Name:        "local",
+			Type:        UpstreamTypeOpenAICompatible,
+			BaseURL:     local.URL + "/v1",
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "local-token"}),
+			Models:      []string{"llama-*"},
+			Transport:   http.DefaultTransport,
+		}, Upstream{
+			Name:        "team",
+			Type:        UpstreamTypeAnthropicAPIKey,
+			BaseURL:     team.URL + "/v1",
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "team-key"}),
+			Models:      []string{"team-*"},
+			Transport:   http.DefaultTransport,
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	imageMessage := `"messages":[{"role":"user","content":[{"type":"image","source":{"type":"url","url":"` + imageURL + `"}}]}]`
+	wantImageData := base64.StdEncoding.EncodeToString(pngData.Bytes())
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		wantUpstream string // Path of the routed upstream request, empty for the default upstream
+		wantQuery    string
+		wantAuth     string
+		wantBody     string
+		wantRequest  []string // Fragments of the upstream request
+	}{
+		{
+			name:         "messages",
+			path:         "/v1/messages",
+			body:         `{"model":"llama-3","max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantUpstream: "/v1/chat/completions",
+			wantAuth:     "Bearer local-token",
+			wantBody:     `"stop_reason":"end_turn"`,
+		},
+		{
+			name:         "messages streaming",
+			path:         "/v1/messages",
+			body:         `{"model":"llama-3","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantUpstream: "/v1/chat/completions",
+			wantAuth:     "Bearer local-token",
+			wantBody:     "event: message_stop",
+		},
+		{
+			name:         "messages with url source",
+			path:         "/v1/messages",
+			body:         `{"model":"llama-3","max_tokens":16,` + imageMessage + `}`,
+			wantUpstream: "/v1/chat/completions",
+			wantAuth:     "Bearer local-token",
+			wantBody:     `"stop_reason":"end_turn"`,
+			wantRequest:  []string{"data:image/png;base64," + wantImageData},
+		},
+		{
+			name:         "chat completions",
+			path:         "/v1/chat/completions",
+			body:         `{"model":"llama-3","messages":[{"role":"user","content":"Hi"}]}`,
+			wantUpstream: "/v1/chat/completions",
+			wantAuth:     "Bearer local-token",
+			wantBody:     `"object":"chat.completion"`,
+		},
+		{
+			name:         "chat completions with query",
+			path:         "/v1/chat/completions?api-version=2024-10-21",
+			body:         `{"model":"llama-3","messages":[{"role":"user","content":"Hi"}]}`,
+			wantUpstream: "/v1/chat/completions",
+			wantQuery:    "api-version=2024-10-21",
+			wantAuth:     "Bearer local-token",
+			wantBody:     `"object":"chat.completion"`,
+		},
+		{
+			name:         "anthropic upstream streams long request",
+			path:         "/v1/messages",
+			body:         `{"model":"team-1","max_tokens":4096,` + imageMessage + `}`,
+			wantUpstream: "/v1/messages",
+			wantAuth:     "team-key",
+			wantBody:     `"id":"msg_team"`,
+			wantRequest:  []string{`"stream":true`, `"data":"` + wantImageData + `"`},
+		},
+		{
+			name:     "default upstream",
+			path:     "/v1/messages",
+			body:     `{"model":"claude-sonnet-4-0","max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantBody: `"id":"msg_01"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamPaths, upstreamQuery, upstreamAuth, upstreamBody = nil, "", "", nil
+			transport.body = nil
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer client-key")
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body to contain %s, got %s", tt.wantBody, rec.Body.String())
+			}
+			if tt.wantUpstream != "" {
+				if len(upstreamPaths) != 1 || upstreamPaths[0] != tt.wantUpstream {
+					t.Errorf("Expected one routed request to %s, got %v", tt.wantUpstream, upstreamPaths)
+				}
+				if upstreamQuery != tt.wantQuery {
+					t.Errorf("Query: got %q, want %q", upstreamQuery, tt.wantQuery)
+				}
+				if upstreamAuth != tt.wantAuth {
+					t.Errorf("Authorization: got %q, want upstream credentials", upstreamAuth)
+				}
+				if transport.body != nil {
+					t.Errorf("Expected no default upstream request, got %s", transport.body)
+				}
+			} else {
+				if len(upstreamPaths) != 0 {
+					t.Errorf("Expected no routed request, got %v", upstreamPaths)
+				}
+				if transport.body == nil {
+					t.Error("Expected default upstream request")
+				}
+			}
+			for _, fragment := range tt.wantRequest {
+				if !strings.Contains(string(upstreamBody), fragment) {
+					t.Errorf("Expected upstream request to contain %s, got %s", fragment, upstreamBody)
+				}
+			}
+			if strings.Contains(string(upstreamBody), imageURL) {
+				t.Errorf("Expected url source to be inlined, got %s", upstreamBody)
+			}
+		})
+	}
+}
+
+// encodeEventStreamMessage encodes an AWS event stream message with string headers.
+func encodeEventStreamMessage(headers map[string]string, payload string) []byte {
+	var h bytes.Buffer
+	for name, value := range headers {
+		h.WriteByte(byte(len(name)))
+		h.WriteString(name)
+		h.WriteByte(7) // string
+		_ = binary.Write(&h, binary.BigEndian, uint16(len(value)))
+		h.WriteString(value)
+	}
+	total := 12 + h.Len() + len(payload) + 4
+	msg := binary.BigEndian.AppendUint32(nil, uint32(total))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(h.Len()))
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+	msg = append(msg, h.Bytes()...)
+	msg = append(msg, payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+// bedrockChunk encodes an Anthropic streaming event as Bedrock chunk.
+func bedrockChunk(event string) []byte {
+	return encodeEventStreamMessage(map[string]string{
+		":message-type": "event",
+		":event-type":   "chunk",
+		":content-type": "application/json",
+	}, `{"bytes":"`+base64.StdEncoding.EncodeToString([]byte(event))+`"}`)
+}
+
+func TestProxyBedrockUpstream(t *testing.T) {
+	const model = "us.anthropic.claude-sonnet-4-20250514-v1:0"
+	creds := bedrock.Credentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "secret", SessionToken: "session"}
+
+	var gotPath string
+	var gotBody map[string]any
+	standIn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		body, _ := io.ReadAll(r.Body)
+		gotBody = nil
+		_ = json.Unmarshal(body, &gotBody)
+
+		// The signature covers the request as received, so nothing changed it after signing;
+		// the signing itself is verified against the AWS test suite in package bedrock
+		signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Errorf("X-Amz-Date: %v", err)
+		}
+		resigned := r.Clone(r.Context())
+		bedrock.Sign(resigned, fmt.Sprintf("%x", sha256.Sum256(body)), creds, "bedrock", "us-east-1", signedAt)
+		if got, want := r.Header.Get("Authorization"), resigned.Header.Get("Authorization"); got != want ||
+			!strings.HasPrefix(got, "AWS4-HMAC-SHA256 Credential=AKIDTEST/"+signedAt.Format("20060102")+"/us-east-1/bedrock/aws4_request, "+
+				"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token, ") {
+			t.Errorf("Authorization:\n got %s\nwant %s", got, want)
+		}
+		if got := r.Header.Get("X-Amz-Security-Token"); got != "session" {
+			t.Errorf("X-Amz-Security-Token: got %q", got)
+		}
+		if got := r.Header.Get("X-Api-Key") + r.Header.Get("Anthropic-Beta"); got != "" {
+			t.Errorf("Expected no Anthropic headers, got %q", got)
+		}
+
+		prompt := fmt.Sprint(gotBody["messages"])
+		switch {
+		case strings.Contains(prompt, "invalid"):
+			w.Header().Set("X-Amzn-Errortype", "ValidationException:http://internal.amazon.com/coral/com.amazon.bedrock/")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"message":"max_tokens exceeds model limit"}`)
+
+		case strings.HasSuffix(r.URL.Path, "/invoke-with-response-stream"):
+			w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+			for _, event := range []string{
+				`{"type":"message_start","message":{"id":"msg_bdrk_01","type":"message","role":"assistant","model":"claude-sonnet-4-20250514","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi from Bedrock!"}}`,
+			} {
+				_, _ = w.Write(bedrockChunk(event))
+			}
+			if strings.Contains(prompt, "throttle") {
+				_, _ = w.Write(encodeEventStreamMessage(map[string]string{
+					":message-type":   "exception",
+					":exception-type": "throttlingException",
+				}, `{"message":"Too many requests"}`))
+				return
+			}
+			for _, event := range []string{
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":5}}`,
+				`{"type":"message_stop","amazon-bedrock-invocationMetrics":{"inputTokenCount":10,"outputTokenCount":5}}`,
+			} {
+				_, _ = w.Write(bedrockChunk(event))
+			}
+
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"id":"msg_bdrk_01","type":"message","role":"assistant","model":"claude-sonnet-4-20250514","content":[{"type":"text","text":"Hi from Bedrock!"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":5}}`)
+		}
+	}))
+	defer standIn.Close()
+
+	transport := &capturingTransport{}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})
+	proxy, err := New(ts, mockReadinessChecker{}, WithTransport(transport), WithUpstreams(Upstream{
+		Name:           "bedrock",
+		Type:           UpstreamTypeBedrock,
+		BaseURL:        standIn.URL,
+		Region:         "us-east-1",
+		AWSCredentials: bedrock.StaticCredentials(creds),
+		Models:         []string{"*anthropic.claude-*"},
+		Transport:      http.DefaultTransport,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	escapedModel := "us.anthropic.claude-sonnet-4-20250514-v1%3A0"
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantPath   string
+		wantBody   []string
+	}{
+		{
+			name:       "messages",
+			path:       "/v1/messages",
+			body:       `{"model":"` + model + `","max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantStatus: http.StatusOK,
+			wantPath:   "/model/" + escapedModel + "/invoke",
+			wantBody:   []string{`"text":"Hi from Bedrock!"`},
+		},
+		{
+			name:       "messages streaming",
+			path:       "/v1/messages",
+			body:       `{"model":"` + model + `","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantStatus: http.StatusOK,
+			wantPath:   "/model/" + escapedModel + "/invoke-with-response-stream",
+			wantBody: []string{
+				"event: message_start\ndata: {\"type\":\"message_start\"",
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi from Bedrock!\"}}\n\n",
+				"event: message_stop\n",
+			},
+		},
+		{
+			name:       "messages stream exception",
+			path:       "/v1/messages",
+			body:       `{"model":"` + model + `","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"throttle"}]}`,
+			wantStatus: http.StatusOK,
+			wantPath:   "/model/" + escapedModel + "/invoke-with-response-stream",
+			wantBody:   []string{"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"rate_limit_error\",\"message\":\"Too many requests\"}}"},
+		},
+		{
+			name:       "messages error",
+			path:       "/v1/messages",
+			body:       `{"model":"` + model + `","max_tokens":16,"messages":[{"role":"user","content":"invalid"}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantPath:   "/model/" + escapedModel + "/invoke",
+			wantBody:   []string{`"type":"invalid_request_error"`, `"message":"max_tokens exceeds model limit"`},
+		},
+		{
+			name:       "chat completions",
+			path:       "/v1/chat/completions",
+			body:       `{"model":"` + model + `","messages":[{"role":"user","content":"Hi"}]}`,
+			wantStatus: http.StatusOK,
+			wantPath:   "/model/" + escapedModel + "/invoke",
+			wantBody:   []string{`"object":"chat.completion"`, `"content":"Hi from Bedrock!"`},
+		},
+		{
+			name:       "chat completions streaming",
+			path:       "/v1/chat/completions",
+			body:       `{"model":"` + model + `","stream":true,"messages":[{"role":"user","content":"Hi"}]}`,
+			wantStatus: http.StatusOK,
+			wantPath:   "/model/" + escapedModel + "/invoke-with-response-stream",
+			wantBody:   []string{`"object":"chat.completion.chunk"`, `"content":"Hi from Bedrock!"`, "data: [DONE]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPath = ""
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer client-key")
+			req.Header.Set("Anthropic-Beta", "interleaved-thinking-2025-05-14")
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("path: got %s, want %s", gotPath, tt.wantPath)
+			}
+			if gotBody["anthropic_version"] != "bedrock-2023-05-31" {
+				t.Errorf("anthropic_version: got %v", gotBody["anthropic_version"])
+			}
+			if _, ok := gotBody["model"]; ok {
+				t.Errorf("Expected model to be removed from body")
+			}
+			if _, ok := gotBody["stream"]; ok {
+				t.Errorf("Expected stream to be removed from body")
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("Expected body to contain %q, got %s", want, rec.Body.String())
+				}
+			}
+			if transport.body != nil {
+				t.Errorf("Expected no default upstream request, got %s", transport.body)
+			}
+		})
+	}
+
+	t.Run("betas", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"`+model+`","max_tokens":16,"messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("Anthropic-Beta", "interleaved-thinking-2025-05-14, context-1m-2025-08-07")
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		got, _ := json.Marshal(gotBody["anthropic_beta"])
+		if string(got) != `["interleaved-thinking-2025-05-14","context-1m-2025-08-07"]` {
+			t.Errorf("anthropic_beta: got %s", got)
+		}
+	})
+}
+
+func TestProxyStartTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeSelfSignedCert(t, certFile, keyFile, "localhost")
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	})
+	p := &Proxy{mux: mux, tlsConfig: &tls.Config{GetCertificate: reloader.GetCertificate, MinVersion: tls.VersionTLS12}}
+
+	// Reserve a free port for the server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := l.Addr().String()
+	_ = l.Close()
+
+	if _, err := p.Start(t.Context(), address); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+
+	for _, tt := range []struct {
+		name      string
+		protocols func(*http.Protocols)
+		want      string
+	}{
+		{name: "HTTP/2 negotiated via ALPN", protocols: func(p *http.Protocols) { p.SetHTTP2(true) }, want: "HTTP/2.0"},
+		{name: "HTTP/1.1", protocols: func(p *http.Protocols) { p.SetHTTP1(true) }, want: "HTTP/1.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			protocols := new(http.Protocols)
+			tt.protocols(protocols)
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // The self-signed certificate has no IP SANs
+				Protocols:       protocols,
+			}}
+			resp, err := client.Get("https://" + address + "/proto")
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("Protocol: got %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
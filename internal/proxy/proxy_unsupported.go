@@ -4,8 +4,15 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
+	"net/http"
 
 	"golang.org/x/oauth2"
+
+	"github.com/florianilch/claudine-proxy/internal/bedrock"
+	"github.com/florianilch/claudine-proxy/internal/docconvert"
+	"github.com/florianilch/claudine-proxy/internal/filestore"
+	"github.com/florianilch/claudine-proxy/internal/urlfetch"
 )
 
 func init() {
@@ -25,6 +32,85 @@ func WithBaseURL(baseURL string) Option {
 	return func(c *config) {}
 }
 
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *config) {}
+}
+
+func DefaultTransport() *http.Transport {
+	return nil
+}
+
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) {}
+}
+
+func WithFileStore(store *filestore.Store) Option {
+	return func(c *config) {}
+}
+
+func WithURLFetcher(fetcher *urlfetch.Fetcher) Option {
+	return func(c *config) {}
+}
+
+func WithMessagesURLInlining() Option {
+	return func(c *config) {}
+}
+
+func WithDocumentConverter(converter *docconvert.Converter) Option {
+	return func(c *config) {}
+}
+
+func WithContinuation(maxRounds int) Option {
+	return func(c *config) {}
+}
+
+func WithInternalStreaming(threshold int) Option {
+	return func(c *config) {}
+}
+
+type ContextManagement struct {
+	Strategy       string
+	SummaryModel   string
+	CountTokens    bool
+	MaxInputTokens int
+}
+
+func WithContextManagement(cfg ContextManagement) Option {
+	return func(c *config) {}
+}
+
+func WithHistoryMode(mode string) Option {
+	return func(c *config) {}
+}
+
+func WithAPIKeyAuth() Option {
+	return func(c *config) {}
+}
+
+type UpstreamType string
+
+const (
+	UpstreamTypeAnthropicOAuth   UpstreamType = "anthropic-oauth"
+	UpstreamTypeAnthropicAPIKey  UpstreamType = "anthropic-apikey"
+	UpstreamTypeOpenAICompatible UpstreamType = "openai-compatible"
+	UpstreamTypeBedrock          UpstreamType = "bedrock"
+)
+
+type Upstream struct {
+	Name           string
+	Type           UpstreamType
+	BaseURL        string
+	TokenSource    oauth2.TokenSource
+	Region         string
+	AWSCredentials bedrock.CredentialsProvider
+	Models         []string
+	Transport      http.RoundTripper
+}
+
+func WithUpstreams(upstreams ...Upstream) Option {
+	return func(c *config) {}
+}
+
 func New(oauth2.TokenSource, ReadinessChecker, ...Option) (*Proxy, error) {
 	return nil, nil
 }
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// modelRoute serves requests for models matching one of patterns (see path.Match).
+type modelRoute struct {
+	patterns []string
+	handler  http.Handler
+}
+
+// matches reports whether model matches one of the route's patterns.
+func (r modelRoute) matches(model string) bool {
+	for _, pattern := range r.patterns {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// routeByModel sends requests to the handler of the first route matching the "model" of
+// the JSON request body. Requests for other models and bodies that aren't valid JSON are
+// passed to next unchanged.
+func routeByModel(routes []modelRoute) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				// Let the handler report read errors, such as size limits, in its API's format
+				r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+			var request struct {
+				Model string `json:"model"`
+			}
+			if json.Unmarshal(body, &request) == nil {
+				for _, route := range routes {
+					if route.matches(request.Model) {
+						route.handler.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errorReader is a reader failing with err.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,209 @@
+//go:build goexperiment.jsonv2
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/json/jsontext"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+)
+
+// StreamLongMessages sends non-streaming Messages API requests with max_tokens of at least
+// threshold to streaming, which must answer them as streaming requests and buffer the
+// response (see bufferMessageStream). Long generations otherwise only receive response
+// headers once complete and run into upstream and ResponseHeaderTimeout limits.
+//
+// Streaming requests, requests below the threshold and bodies that aren't valid JSON are
+// passed to next unchanged.
+func StreamLongMessages(threshold int, streaming http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
+					writeAnthropicError(ctx, w, http.StatusRequestEntityTooLarge, "request_too_large", http.StatusText(http.StatusRequestEntityTooLarge))
+					return
+				}
+				slog.ErrorContext(ctx, "failed to read request body", "error", err)
+				writeAnthropicError(ctx, w, http.StatusBadRequest, "invalid_request_error", "failed to read request body")
+				return
+			}
+
+			handler := next
+			if streamed, ok := streamingMessageRequest(body, threshold); ok {
+				body = streamed
+				handler = streaming
+				// Compressed event streams can't be read back; the transport decompresses
+				// transparently when it negotiates the encoding itself
+				r.Header.Del("Accept-Encoding")
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// streamLongMessages wraps a Messages API reverse proxy with StreamLongMessages, streaming
+// long requests through a copy of proxy that buffers the response. A threshold of 0
+// disables internal streaming and returns proxy unchanged.
+func streamLongMessages(threshold int, proxy *httputil.ReverseProxy) http.Handler {
+	if threshold <= 0 {
+		return proxy
+	}
+	buffering := &httputil.ReverseProxy{
+		Rewrite:        proxy.Rewrite,
+		FlushInterval:  -1,
+		Transport:      proxy.Transport,
+		ModifyResponse: bufferMessageStream,
+		ErrorHandler:   bufferMessageStreamError,
+	}
+	return StreamLongMessages(threshold, buffering)(proxy)
+}
+
+// streamingMessageRequest returns body with streaming enabled if it is a non-streaming
+// request with max_tokens of at least threshold. Only the stream field is spliced into
+// the original bytes, so the request otherwise reaches the upstream unchanged.
+func streamingMessageRequest(body []byte, threshold int) ([]byte, bool) {
+	dec := jsontext.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.ReadToken(); err != nil || tok.Kind() != '{' {
+		return nil, false
+	}
+
+	var (
+		maxTokens     int64
+		hasMaxTokens  bool
+		streamStart   int64 = -1
+		streamEnd     int64
+		lastMemberEnd int64
+	)
+	for dec.PeekKind() != '}' {
+		// Tokens are only valid until the next read
+		keyToken, err := dec.ReadToken()
+		if err != nil {
+			return nil, false
+		}
+		key := keyToken.String()
+		value, err := dec.ReadValue()
+		if err != nil {
+			return nil, false
+		}
+		lastMemberEnd = dec.InputOffset()
+
+		switch key {
+		case "stream":
+			switch value.Kind() {
+			case 't':
+				return nil, false
+			case 'f', 'n':
+				streamStart, streamEnd = lastMemberEnd-int64(len(value)), lastMemberEnd
+			default:
+				return nil, false
+			}
+		case "max_tokens":
+			if err := json.Unmarshal(value, &maxTokens); err != nil {
+				return nil, false
+			}
+			hasMaxTokens = true
+		}
+	}
+	if _, err := dec.ReadToken(); err != nil {
+		return nil, false
+	}
+	if _, err := dec.ReadToken(); !errors.Is(err, io.EOF) {
+		return nil, false
+	}
+	if !hasMaxTokens || maxTokens < int64(threshold) {
+		return nil, false
+	}
+
+	if streamStart >= 0 {
+		return slices.Concat(body[:streamStart], []byte("true"), body[streamEnd:]), true
+	}
+	return slices.Concat(body[:lastMemberEnd], []byte(`,"stream":true`), body[lastMemberEnd:]), true
+}
+
+// bufferMessageStream is a ReverseProxy ModifyResponse hook that replaces a successful
+// Messages API event stream by the equivalent non-streaming response. Error events are
+// returned as Anthropic error responses with the status the upstream would have used.
+func bufferMessageStream(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+
+	status := http.StatusOK
+	body, err := anthropicclaude.ReadMessageStream(resp)
+	if err != nil {
+		errBody, ok := anthropicclaude.StreamErrorBody(err)
+		if !ok {
+			return err
+		}
+		body = []byte(errBody)
+		status = anthropicErrorStatus(errBody)
+	}
+
+	resp.StatusCode = status
+	resp.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Cache-Control")
+	return nil
+}
+
+// bufferMessageStreamError reports streams that failed without an error event as an
+// Anthropic api_error, since the client expects a JSON response.
+func bufferMessageStreamError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	slog.ErrorContext(ctx, "failed to buffer message stream", "error", err)
+	writeAnthropicError(ctx, w, http.StatusBadGateway, "api_error", "failed to read upstream response")
+}
+
+// anthropicErrorStatus returns the HTTP status Anthropic uses for the error type of an
+// error response.
+func anthropicErrorStatus(errBody string) int {
+	var errResp struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal([]byte(errBody), &errResp)
+
+	switch errResp.Error.Type {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "timeout_error":
+		return http.StatusGatewayTimeout
+	case "overloaded_error":
+		return 529
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,73 @@
+//go:build goexperiment.jsonv2
+
+package proxy
+
+import "testing"
+
+func TestStreamingMessageRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		body string
+		want string // Empty if the request isn't streamed
+	}{
+		{
+			name: "appends stream after the last field",
+			body: "{\"model\":\"claude-sonnet-4-0\",\n  \"max_tokens\": 32000, \"messages\":[{\"role\":\"user\",\"content\":\"<b>&\"}]\n}",
+			want: "{\"model\":\"claude-sonnet-4-0\",\n  \"max_tokens\": 32000, \"messages\":[{\"role\":\"user\",\"content\":\"<b>&\"}],\"stream\":true\n}",
+		},
+		{
+			name: "replaces stream false in place",
+			body: `{"stream": false, "max_tokens":16384,"model":"claude-sonnet-4-0","messages":[]}`,
+			want: `{"stream": true, "max_tokens":16384,"model":"claude-sonnet-4-0","messages":[]}`,
+		},
+		{
+			name: "replaces stream null in place",
+			body: `{"model":"claude-sonnet-4-0","stream":null,"max_tokens":20000,"messages":[]}`,
+			want: `{"model":"claude-sonnet-4-0","stream":true,"max_tokens":20000,"messages":[]}`,
+		},
+		{
+			name: "already streaming",
+			body: `{"model":"claude-sonnet-4-0","max_tokens":32000,"stream":true,"messages":[]}`,
+		},
+		{
+			name: "below threshold",
+			body: `{"model":"claude-sonnet-4-0","max_tokens":16383,"messages":[]}`,
+		},
+		{
+			name: "missing max_tokens",
+			body: `{"model":"claude-sonnet-4-0","messages":[]}`,
+		},
+		{
+			name: "invalid stream",
+			body: `{"model":"claude-sonnet-4-0","max_tokens":32000,"stream":"yes","messages":[]}`,
+		},
+		{
+			name: "duplicate fields",
+			body: `{"max_tokens":1,"max_tokens":32000,"messages":[]}`,
+		},
+		{
+			name: "trailing data",
+			body: `{"max_tokens":32000,"messages":[]} {}`,
+		},
+		{
+			name: "invalid JSON",
+			body: `{"max_tokens":32000,`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := streamingMessageRequest([]byte(tt.body), 16384)
+			if ok != (tt.want != "") {
+				t.Fatalf("streamed: got %v, want %v", ok, tt.want != "")
+			}
+			if ok && string(got) != tt.want {
+				t.Errorf("body:\ngot  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateCheckInterval bounds how often certificate files are stat'ed for changes.
+// Handshakes in between reuse the cached certificate without touching the filesystem.
+const certificateCheckInterval = 10 * time.Second
+
+// CertificateReloader serves a TLS certificate loaded from disk and reloads it
+// when the certificate or key file changes. Enables certificate rotation (e.g. by
+// certbot or a secrets operator) without restarting the server.
+// All methods are thread-safe.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu           sync.RWMutex
+	cert         *tls.Certificate
+	certModTime  time.Time
+	keyModTime   time.Time
+	lastCheck    time.Time
+	now          func() time.Time
+	checkEvery   time.Duration
+	reloadFailed bool
+}
+
+// NewCertificateReloader loads the certificate/key pair and returns a reloader.
+// Returns an error if the initial load fails, surfacing misconfiguration at startup.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		now:        time.Now,
+		checkEvery: certificateCheckInterval,
+	}
+
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certModTime, keyModTime); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the files changed.
+// Suitable for tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert := r.cert
+	due := r.now().Sub(r.lastCheck) >= r.checkEvery
+	r.mu.RUnlock()
+
+	if !due {
+		return cert, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Another handshake may have refreshed while waiting for the lock
+	if r.now().Sub(r.lastCheck) < r.checkEvery {
+		return r.cert, nil
+	}
+	r.lastCheck = r.now()
+
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		// Keep serving the last good certificate; files may be mid-rotation
+		slog.Warn("failed to check TLS certificate files", "error", err)
+		return r.cert, nil
+	}
+
+	if certModTime.Equal(r.certModTime) && keyModTime.Equal(r.keyModTime) && !r.reloadFailed {
+		return r.cert, nil
+	}
+
+	if err := r.load(certModTime, keyModTime); err != nil {
+		// Cert and key are often replaced non-atomically; retry on next check
+		r.reloadFailed = true
+		slog.Warn("failed to reload TLS certificate, serving previous certificate", "error", err)
+		return r.cert, nil
+	}
+
+	slog.Info("reloaded TLS certificate", "cert_file", r.certFile)
+	return r.cert, nil
+}
+
+// load reads the certificate pair from disk. Caller must hold the write lock
+// (or have exclusive access during construction).
+func (r *CertificateReloader) load(certModTime, keyModTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	r.lastCheck = r.now()
+	r.reloadFailed = false
+	return nil
+}
+
+// modTimes returns the modification times of the certificate and key files.
+func (r *CertificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("stat certificate file: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("stat key file: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
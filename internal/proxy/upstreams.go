@@ -0,0 +1,215 @@
+//go:build goexperiment.jsonv2
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/florianilch/claudine-proxy/internal/anthropicadapter/openaicompat"
+	"github.com/florianilch/claudine-proxy/internal/bedrock"
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+)
+
+// UpstreamType selects the API and authentication of an upstream.
+type UpstreamType string
+
+const (
+	// UpstreamTypeAnthropicOAuth is Anthropic with an OAuth token, impersonating Claude Code.
+	UpstreamTypeAnthropicOAuth UpstreamType = "anthropic-oauth"
+	// UpstreamTypeAnthropicAPIKey is Anthropic with a Console API key.
+	UpstreamTypeAnthropicAPIKey UpstreamType = "anthropic-apikey"
+	// UpstreamTypeOpenAICompatible is an OpenAI-compatible chat completions server, such as
+	// llama.cpp or vLLM.
+	UpstreamTypeOpenAICompatible UpstreamType = "openai-compatible"
+	// UpstreamTypeBedrock is Anthropic on Amazon Bedrock, authenticated with SigV4.
+	UpstreamTypeBedrock UpstreamType = "bedrock"
+)
+
+// Upstream is an additional backend serving chat completions and Messages API requests
+// for the models it matches. Requests for other models go to the default upstream.
+type Upstream struct {
+	// Name identifies the upstream in errors.
+	Name string
+	Type UpstreamType
+	// BaseURL is the API root, e.g. http://localhost:8080/v1. For Bedrock upstreams it
+	// optionally overrides the runtime endpoint of Region.
+	BaseURL string
+	// TokenSource authenticates requests. Optional for OpenAI-compatible upstreams, which
+	// receive it as Bearer token.
+	TokenSource oauth2.TokenSource
+	// Region is the AWS region of Bedrock upstreams.
+	Region string
+	// AWSCredentials sign requests to Bedrock upstreams. Defaults to the AWS SDKs' default
+	// credentials chain.
+	AWSCredentials bedrock.CredentialsProvider
+	// Models are path.Match patterns of the model IDs served, e.g. "llama-*".
+	Models []string
+	// Transport overrides the transport set with WithTransport.
+	Transport http.RoundTripper
+}
+
+// WithUpstreams routes chat completion and Messages API requests for the models matched by
+// upstreams to them, in order. Other endpoints are served by the default upstream only.
+func WithUpstreams(upstreams ...Upstream) Option {
+	return func(c *config) {
+		c.upstreams = append(c.upstreams, upstreams...)
+	}
+}
+
+// newAnthropicTransport composes the transport chain of an Anthropic upstream
+// (request execution order):
+// oauth2.Transport → ImpersonationTransport → base, or
+// APIKeyTransport → base with API key authentication.
+func newAnthropicTransport(ts oauth2.TokenSource, apiKey bool, base http.RoundTripper) http.RoundTripper {
+	if apiKey {
+		return &APIKeyTransport{
+			Source: ts,
+			Base:   base,
+		}
+	}
+	return &oauth2.Transport{
+		Source: ts,
+		Base: &ImpersonationTransport{
+			Base: base,
+		},
+	}
+}
+
+// newUpstreamRoutes returns the Messages API and chat completion routes of upstreams.
+// pathPrefix is the API root of the proxy's own routes, which is replaced by the path of
+// each upstream's base URL. Messages API upstreams stream long requests internally like
+// the default upstream (see streamLongMessages).
+func newUpstreamRoutes(
+	upstreams []Upstream,
+	defaultTransport http.RoundTripper,
+	chatAdapter *anthropicclaude.CreateChatCompletionAdapter,
+	pathPrefix string,
+	streamThreshold int,
+) (messageRoutes, chatCompletionRoutes []modelRoute, err error) {
+	for _, u := range upstreams {
+		base, err := url.Parse(u.BaseURL)
+		if (u.Type != UpstreamTypeBedrock || u.BaseURL != "") && (err != nil || base.Scheme == "" || base.Host == "") {
+			return nil, nil, fmt.Errorf("upstream %s: invalid base URL %q", u.Name, u.BaseURL)
+		}
+		if len(u.Models) == 0 {
+			return nil, nil, fmt.Errorf("upstream %s: no models", u.Name)
+		}
+
+		rt := u.Transport
+		if rt == nil {
+			rt = defaultTransport
+		}
+
+		var messages, chatCompletions http.Handler
+		switch u.Type {
+		case UpstreamTypeAnthropicOAuth, UpstreamTypeAnthropicAPIKey:
+			if u.TokenSource == nil {
+				return nil, nil, fmt.Errorf("upstream %s: %s requires a token source", u.Name, u.Type)
+			}
+			// Adapters send requests to the SDK's default base URL, so both the reverse proxy
+			// and the adapters are redirected by the transport
+			transport := newAnthropicTransport(u.TokenSource, u.Type == UpstreamTypeAnthropicAPIKey, &baseURLTransport{
+				base:       base,
+				pathPrefix: pathPrefix,
+				next:       rt,
+			})
+			messages = streamLongMessages(streamThreshold, &httputil.ReverseProxy{
+				Rewrite:       func(*httputil.ProxyRequest) {},
+				FlushInterval: -1,
+				Transport:     transport,
+			})
+			chatCompletions = &CreateChatCompletionsHandler{
+				Adapter:   chatAdapter,
+				Transport: transport,
+			}
+
+		case UpstreamTypeOpenAICompatible:
+			var transport http.RoundTripper = rt
+			if u.TokenSource != nil {
+				transport = &oauth2.Transport{Source: u.TokenSource, Base: rt}
+			}
+			messages = &CreateMessagesHandler{
+				Adapter:   openaicompat.NewCreateMessageAdapter(u.BaseURL),
+				Transport: transport,
+			}
+			chatCompletionsURL := base.JoinPath("chat/completions")
+			chatCompletions = &httputil.ReverseProxy{
+				Rewrite: func(pr *httputil.ProxyRequest) {
+					// Query parameters such as api-version are added to those of the base URL
+					u := *chatCompletionsURL
+					if query := pr.In.URL.RawQuery; query != "" {
+						if u.RawQuery != "" {
+							query = u.RawQuery + "&" + query
+						}
+						u.RawQuery = query
+					}
+					pr.Out.URL = &u
+					pr.Out.Host = u.Host
+					// Client credentials are meant for the proxy, not the upstream
+					pr.Out.Header.Del("Authorization")
+					pr.Out.Header.Del("X-Api-Key")
+				},
+				FlushInterval: -1,
+				Transport:     transport,
+			}
+
+		case UpstreamTypeBedrock:
+			if u.Region == "" {
+				return nil, nil, fmt.Errorf("upstream %s: bedrock requires a region", u.Name)
+			}
+			credentials := u.AWSCredentials
+			if credentials == nil {
+				credentials = bedrock.NewDefaultCredentials("")
+			}
+			// Both the reverse proxy and the adapters send Messages API requests, which the
+			// transport rewrites to Bedrock's InvokeModel APIs
+			transport := &bedrock.Transport{
+				Region:      u.Region,
+				Endpoint:    u.BaseURL,
+				Credentials: credentials,
+				Base:        rt,
+			}
+			messages = streamLongMessages(streamThreshold, &httputil.ReverseProxy{
+				Rewrite:       func(*httputil.ProxyRequest) {},
+				FlushInterval: -1,
+				Transport:     transport,
+			})
+			chatCompletions = &CreateChatCompletionsHandler{
+				Adapter:   chatAdapter,
+				Transport: transport,
+			}
+
+		default:
+			return nil, nil, fmt.Errorf("upstream %s: unsupported type %q", u.Name, u.Type)
+		}
+
+		messageRoutes = append(messageRoutes, modelRoute{patterns: u.Models, handler: messages})
+		chatCompletionRoutes = append(chatCompletionRoutes, modelRoute{patterns: u.Models, handler: chatCompletions})
+	}
+	return messageRoutes, chatCompletionRoutes, nil
+}
+
+// baseURLTransport sends requests to base, replacing pathPrefix of their path by the
+// path of base.
+type baseURLTransport struct {
+	base       *url.URL
+	pathPrefix string
+	next       http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	newReq := req.Clone(req.Context())
+	newReq.URL.Scheme = t.base.Scheme
+	newReq.URL.Host = t.base.Host
+	newReq.URL.Path = strings.TrimSuffix(t.base.Path, "/") + strings.TrimPrefix(req.URL.Path, t.pathPrefix)
+	newReq.URL.RawPath = ""
+	newReq.Host = t.base.Host
+	return t.next.RoundTrip(newReq)
+}
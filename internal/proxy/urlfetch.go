@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/florianilch/claudine-proxy/internal/openaiadapter/anthropicclaude"
+	"github.com/florianilch/claudine-proxy/internal/urlfetch"
+)
+
+// newURLFetcher adapts the fetcher to the adapter's remote URL inlining.
+func newURLFetcher(fetcher *urlfetch.Fetcher) anthropicclaude.URLFetcher {
+	return func(ctx context.Context, url string) (string, string, []byte, error) {
+		resource, err := fetcher.Fetch(ctx, url)
+		if err != nil {
+			if errors.Is(err, urlfetch.ErrNotAllowed) {
+				return "", "", nil, fmt.Errorf("%w: %w", anthropicclaude.ErrURLNotAllowed, err)
+			}
+			return "", "", nil, err
+		}
+		return resource.MediaType, resource.Filename, resource.Data, nil
+	}
+}
+
+// InlineURLSources rewrites Anthropic Messages API request bodies, replacing image and
+// document blocks with a "url" source by base64 sources fetched through the given fetcher.
+//
+// URLs outside the fetch policy are left for Anthropic to fetch. Bodies without URL
+// sources are forwarded byte for byte. Fetch failures are reported as Anthropic
+// invalid_request_error, since the upstream couldn't have fetched them either.
+func InlineURLSources(fetcher *urlfetch.Fetcher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					slog.WarnContext(ctx, "request exceeds size limit", "limit_bytes", maxBytesErr.Limit)
+					writeAnthropicError(ctx, w, http.StatusRequestEntityTooLarge, "request_too_large", http.StatusText(http.StatusRequestEntityTooLarge))
+					return
+				}
+				slog.ErrorContext(ctx, "failed to read request body", "error", err)
+				writeAnthropicError(ctx, w, http.StatusBadRequest, "invalid_request_error", "failed to read request body")
+				return
+			}
+
+			rewritten, err := inlineMessageURLSources(ctx, body, fetcher)
+			if err != nil {
+				slog.WarnContext(ctx, "failed to inline url source", "error", err)
+				writeAnthropicError(ctx, w, http.StatusBadRequest, "invalid_request_error", err.Error())
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(rewritten))
+			r.ContentLength = int64(len(rewritten))
+			r.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// inlineMessageURLSources returns body with URL sources of top-level message content
+// blocks inlined. Returns body unchanged if nothing was inlined or it isn't a JSON object,
+// leaving validation to the upstream.
+func inlineMessageURLSources(ctx context.Context, body []byte, fetcher *urlfetch.Fetcher) ([]byte, error) {
+	// Cheap pre-check avoids decoding requests without URL sources
+	if !bytes.Contains(body, []byte(`"url"`)) {
+		return body, nil
+	}
+
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return body, nil
+	}
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(request["messages"], &messages); err != nil {
+		return body, nil
+	}
+
+	changed := false
+	for msgIndex, msg := range messages {
+		var blocks []map[string]json.RawMessage
+		if err := json.Unmarshal(msg["content"], &blocks); err != nil {
+			// String content has no blocks to inline
+			continue
+		}
+
+		blocksChanged := false
+		for blockIndex, block := range blocks {
+			source, err := inlineURLSource(ctx, block, fetcher)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d.content.%d: %w", msgIndex, blockIndex, err)
+			}
+			if source == nil {
+				continue
+			}
+			block["source"] = source
+			blocksChanged = true
+		}
+		if !blocksChanged {
+			continue
+		}
+
+		content, err := json.Marshal(blocks)
+		if err != nil {
+			return nil, err
+		}
+		msg["content"] = content
+		changed = true
+	}
+	if !changed {
+		return body, nil
+	}
+
+	encodedMessages, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	request["messages"] = encodedMessages
+	return json.Marshal(request)
+}
+
+// inlineURLSource fetches the URL source of an image or document block and returns the
+// replacement source. Returns nil if the block has no URL source or the URL isn't allowed.
+func inlineURLSource(ctx context.Context, block map[string]json.RawMessage, fetcher *urlfetch.Fetcher) (json.RawMessage, error) {
+	var blockType string
+	if err := json.Unmarshal(block["type"], &blockType); err != nil || (blockType != "image" && blockType != "document") {
+		return nil, nil
+	}
+	var source struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	}
+	if err := json.Unmarshal(block["source"], &source); err != nil || source.Type != "url" {
+		return nil, nil
+	}
+
+	resource, err := fetcher.Fetch(ctx, source.URL)
+	if err != nil {
+		if errors.Is(err, urlfetch.ErrNotAllowed) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case blockType == "image" && strings.HasPrefix(resource.MediaType, "image/"),
+		blockType == "document" && resource.MediaType == "application/pdf":
+		return json.Marshal(map[string]string{
+			"type":       "base64",
+			"media_type": resource.MediaType,
+			"data":       base64.StdEncoding.EncodeToString(resource.Data),
+		})
+	case blockType == "document" && strings.HasPrefix(resource.MediaType, "text/"):
+		return json.Marshal(map[string]string{
+			"type":       "text",
+			"media_type": "text/plain",
+			"data":       string(resource.Data),
+		})
+	default:
+		return nil, fmt.Errorf("%s: content type %s is not supported for %s blocks", source.URL, resource.MediaType, blockType)
+	}
+}
+
+// writeAnthropicError writes an error in Anthropic's format for Messages API routes.
+func writeAnthropicError(ctx context.Context, w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(ctx, w, map[string]any{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	}, status)
+}
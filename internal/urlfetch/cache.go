@@ -0,0 +1,203 @@
+package urlfetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long unused cache entries are kept before eviction.
+const DefaultCacheTTL = 24 * time.Hour
+
+// Cache stores fetched resources on disk, keyed by URL.
+//
+// Layout:
+//
+//	<dir>/<sha256(url)>.json  validators (ETag, Last-Modified) and media type
+//	<dir>/<sha256(url)>.bin   resource contents
+//
+// Entries not revalidated within the TTL are evicted lazily on write.
+type Cache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+// cacheEntry is the metadata record of a cached resource.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	MediaType    string    `json:"media_type"`
+	StoredAt     time.Time `json:"stored_at"`
+
+	key string
+}
+
+// NewCache creates a Cache rooted at dir, creating it with 0700 permissions if it
+// doesn't exist. A zero ttl uses DefaultCacheTTL.
+func NewCache(dir string, ttl time.Duration) (*Cache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("directory cannot be empty")
+	}
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, ttl: ttl, now: time.Now}, nil
+}
+
+// get returns the entry for rawURL, or nil if not cached, expired or unusable.
+// Only entries with validators are returned, since they are always revalidated.
+func (c *Cache) get(rawURL string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(rawURL)
+	data, err := os.ReadFile(c.metadataPath(key))
+	if err != nil {
+		return nil
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != rawURL {
+		return nil
+	}
+	if entry.ETag == "" && entry.LastModified == "" {
+		return nil
+	}
+	if c.now().Sub(entry.StoredAt) >= c.ttl {
+		return nil
+	}
+	entry.key = key
+	return &entry
+}
+
+// read returns the cached contents of an entry and refreshes its lifetime.
+func (c *Cache) read(entry *cacheEntry) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.contentPath(entry.key))
+	if err != nil {
+		return nil, err
+	}
+
+	// A successful revalidation extends the entry's lifetime
+	refreshed := *entry
+	refreshed.StoredAt = c.now()
+	_ = c.writeMetadataLocked(&refreshed)
+
+	return data, nil
+}
+
+// put stores a resource. Resources without validators are not cached since they
+// could never be revalidated.
+func (c *Cache) put(rawURL, etag, lastModified string, resource *Resource) error {
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.evictLocked(); err != nil {
+		return err
+	}
+
+	key := cacheKey(rawURL)
+	if err := writeFileAtomic(c.dir, c.contentPath(key), resource.Data); err != nil {
+		return err
+	}
+
+	return c.writeMetadataLocked(&cacheEntry{
+		URL:          rawURL,
+		ETag:         etag,
+		LastModified: lastModified,
+		MediaType:    resource.MediaType,
+		StoredAt:     c.now(),
+		key:          key,
+	})
+}
+
+// evictLocked removes entries older than the TTL.
+func (c *Cache) evictLocked() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, dirEntry := range entries {
+		key, ok := strings.CutSuffix(dirEntry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(c.metadataPath(key))
+		if err != nil {
+			continue
+		}
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err == nil && c.now().Sub(entry.StoredAt) < c.ttl {
+			continue
+		}
+		for _, p := range []string{c.metadataPath(key), c.contentPath(key)} {
+			if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Cache) writeMetadataLocked(entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.dir, c.metadataPath(entry.key), data)
+}
+
+func (c *Cache) metadataPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *Cache) contentPath(key string) string {
+	return filepath.Join(c.dir, key+".bin")
+}
+
+// cacheKey derives a file name safe key from a URL.
+func cacheKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data using temp file + rename for crash safety.
+func writeFileAtomic(dir, path string, data []byte) error {
+	tempFile, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	tempName := tempFile.Name()
+	defer func() { _ = os.Remove(tempName) }()
+	defer func() { _ = tempFile.Close() }()
+
+	if _, err := tempFile.Write(data); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempName, path)
+}
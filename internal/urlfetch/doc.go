@@ -0,0 +1,16 @@
+// Package urlfetch downloads remote images and documents so they can be inlined as base64
+// instead of being fetched by the upstream API, which cannot reach intranet URLs.
+//
+// Fetching is governed by a Policy:
+//   - Hosts/CIDRs: a URL is fetched if every address it resolves to lies in an allowed CIDR,
+//     or if its host matches an allowed host pattern and resolves to no loopback, link-local
+//     or metadata address. Addresses are checked at dial time, so redirects and DNS
+//     rebinding cannot escape the policy.
+//   - Size and time: responses above MaxBytes or slower than Timeout are rejected.
+//   - MIME types: the sniffed content type must match the allowlist.
+//
+// URLs outside the policy return ErrNotAllowed so callers can leave them untouched.
+//
+// Responses can be cached on disk keyed by URL. Cached entries are revalidated with
+// If-None-Match (ETag) and If-Modified-Since, so unchanged resources are not downloaded again.
+package urlfetch
@@ -0,0 +1,400 @@
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotAllowed is returned for URLs outside the fetch policy.
+	ErrNotAllowed = errors.New("url not allowed by fetch policy")
+
+	// ErrTooLarge is returned when a resource exceeds the maximum size.
+	ErrTooLarge = errors.New("resource exceeds maximum size")
+
+	// ErrUnsupportedType is returned when a resource's content type is not allowed.
+	ErrUnsupportedType = errors.New("resource content type not allowed")
+)
+
+// Default policy values applied for zero fields.
+const (
+	DefaultMaxBytes = 20 << 20 // 20MB, large enough for Anthropic's image and PDF limits
+	DefaultTimeout  = 10 * time.Second
+)
+
+// DefaultAllowedMIMETypes are the media types Anthropic accepts for image and document blocks.
+var DefaultAllowedMIMETypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain",
+}
+
+// maxRedirects bounds redirect chains; every hop is subject to the policy.
+const maxRedirects = 5
+
+// Policy restricts what a Fetcher downloads.
+type Policy struct {
+	// AllowedHosts are host names that may be fetched. A leading "*." matches any
+	// subdomain, a single "*" matches every host. Hosts resolving to loopback, link-local,
+	// unspecified or cloud metadata addresses are rejected unless AllowedCIDRs covers them.
+	AllowedHosts []string
+
+	// AllowedCIDRs are networks that may be fetched from regardless of host name.
+	AllowedCIDRs []netip.Prefix
+
+	// MaxBytes limits the size of a resource. Defaults to DefaultMaxBytes.
+	MaxBytes int64
+
+	// Timeout bounds the whole download including redirects. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// AllowedMIMETypes are accepted media types; "type/*" matches any subtype.
+	// Defaults to DefaultAllowedMIMETypes.
+	AllowedMIMETypes []string
+}
+
+// Resource is a fetched remote resource.
+type Resource struct {
+	// MediaType is the detected media type without parameters.
+	MediaType string
+
+	// Filename is derived from the URL path, e.g. for document titles.
+	Filename string
+
+	Data []byte
+}
+
+// Fetcher downloads remote resources according to a Policy.
+type Fetcher struct {
+	policy Policy
+	client *http.Client
+	cache  *Cache
+
+	// lookupNetIP resolves host names; replaced in tests.
+	lookupNetIP func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// Option configures the Fetcher.
+type Option func(*Fetcher)
+
+// WithCache enables on-disk caching with ETag revalidation.
+func WithCache(cache *Cache) Option {
+	return func(f *Fetcher) {
+		f.cache = cache
+	}
+}
+
+// New creates a Fetcher enforcing the given policy.
+func New(policy Policy, opts ...Option) *Fetcher {
+	if policy.MaxBytes <= 0 {
+		policy.MaxBytes = DefaultMaxBytes
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = DefaultTimeout
+	}
+	if len(policy.AllowedMIMETypes) == 0 {
+		policy.AllowedMIMETypes = DefaultAllowedMIMETypes
+	}
+
+	f := &Fetcher{
+		policy: policy,
+		lookupNetIP: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+
+	dialer := &net.Dialer{Timeout: policy.Timeout}
+	transport := &http.Transport{
+		// Intranet resources are fetched directly, never through the egress proxy
+		Proxy:                 nil,
+		DialContext:           f.dialContext(dialer),
+		TLSHandshakeTimeout:   policy.Timeout,
+		ResponseHeaderTimeout: policy.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+	f.client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Fetch downloads the resource at rawURL.
+// Returns an error wrapping ErrNotAllowed if the URL is outside the policy.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Resource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrNotAllowed, u.Scheme)
+	}
+	// Cheap pre-check; the dialer enforces the policy for every connection
+	if !f.hostAllowed(u.Hostname()) && len(f.policy.AllowedCIDRs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotAllowed, u.Hostname())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.policy.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached *cacheEntry
+	if f.cache != nil {
+		cached = f.cache.get(rawURL)
+		if cached != nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		data, err := f.cache.read(cached)
+		if err == nil {
+			return &Resource{MediaType: cached.MediaType, Filename: filenameFromURL(u), Data: data}, nil
+		}
+		// Cache content vanished; fall through to an unconditional fetch
+		return f.fetchUncached(ctx, rawURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", rawURL, resp.Status)
+	}
+
+	resource, err := f.readResponse(resp, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.cache != nil {
+		// Caching is best-effort; a failed write only costs a future download
+		_ = f.cache.put(rawURL, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), resource)
+	}
+	return resource, nil
+}
+
+// fetchUncached downloads a resource without conditional headers.
+func (f *Fetcher) fetchUncached(ctx context.Context, rawURL string) (*Resource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", rawURL, resp.Status)
+	}
+	return f.readResponse(resp, u)
+}
+
+// readResponse reads a response body within the size limit and validates its media type.
+func (f *Fetcher) readResponse(resp *http.Response, u *url.URL) (*Resource, error) {
+	if resp.ContentLength > f.policy.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrTooLarge, resp.ContentLength, f.policy.MaxBytes)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.policy.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", u, err)
+	}
+	if int64(len(data)) > f.policy.MaxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.policy.MaxBytes)
+	}
+
+	mediaType := detectMediaType(data, resp.Header.Get("Content-Type"))
+	if !f.mimeAllowed(mediaType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mediaType)
+	}
+
+	return &Resource{MediaType: mediaType, Filename: filenameFromURL(u), Data: data}, nil
+}
+
+// dialContext enforces the host/CIDR policy for every connection, including redirects.
+// Hosts are always resolved here and dialed by checked address, so a second DNS lookup
+// cannot return a different (disallowed) address.
+func (f *Fetcher) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := f.lookupNetIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.checkAddrs(host, addrs); err != nil {
+			return nil, err
+		}
+
+		var dialErr error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+}
+
+// checkAddrs reports whether host may be dialed at all of addrs. Addresses in an allowed
+// CIDR are always allowed. Hosts matching an allowed host pattern may resolve to any
+// other address except restricted ones (see restrictedAddr), so a DNS answer cannot
+// point an allowed host at the proxy itself.
+func (f *Fetcher) checkAddrs(host string, addrs []netip.Addr) error {
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: %s has no addresses", ErrNotAllowed, host)
+	}
+	hostAllowed := f.hostAllowed(host)
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if f.addrAllowed(addr) || (hostAllowed && !restrictedAddr(addr)) {
+			continue
+		}
+		return fmt.Errorf("%w: %s resolves to %s", ErrNotAllowed, host, addr)
+	}
+	return nil
+}
+
+// metadataPrefixes are cloud metadata endpoints outside the link-local ranges.
+var metadataPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("fd00:ec2::254/128"),  // AWS instance metadata (IPv6)
+	netip.MustParsePrefix("100.100.100.200/32"), // Alibaba Cloud metadata
+}
+
+// restrictedAddr reports whether addr is a loopback, link-local, unspecified or cloud
+// metadata address, which host patterns never reach; only AllowedCIDRs do.
+func restrictedAddr(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	return slices.ContainsFunc(metadataPrefixes, func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
+
+// hostAllowed reports whether host matches an allowed host pattern.
+func (f *Fetcher) hostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range f.policy.AllowedHosts {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case host == pattern:
+			return true
+		}
+	}
+	return false
+}
+
+// addrAllowed reports whether addr lies in an allowed CIDR.
+func (f *Fetcher) addrAllowed(addr netip.Addr) bool {
+	return slices.ContainsFunc(f.policy.AllowedCIDRs, func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
+
+// mimeAllowed reports whether mediaType matches the MIME allowlist.
+func (f *Fetcher) mimeAllowed(mediaType string) bool {
+	for _, allowed := range f.policy.AllowedMIMETypes {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// detectMediaType prefers content sniffing over the declared Content-Type, which
+// servers frequently get wrong (e.g. application/octet-stream for images).
+func detectMediaType(data []byte, declared string) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if sniffed != "application/octet-stream" && sniffed != "text/plain" {
+		return sniffed
+	}
+	if declaredType, _, err := mime.ParseMediaType(declared); err == nil && declaredType != "" {
+		return declaredType
+	}
+	return sniffed
+}
+
+// filenameFromURL returns the last path segment of u, if any.
+func filenameFromURL(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// ParseCIDRs parses CIDR strings; bare addresses are treated as single-host prefixes.
+func ParseCIDRs(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", value)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,382 @@
+package urlfetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pngData is a PNG signature followed by padding, enough for content sniffing.
+var pngData = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 24)...)
+
+// newTestFetcher creates a Fetcher that resolves host names from hosts instead of DNS.
+func newTestFetcher(policy Policy, hosts map[string]string, opts ...Option) *Fetcher {
+	f := New(policy, opts...)
+	f.lookupNetIP = func(_ context.Context, host string) ([]netip.Addr, error) {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			return []netip.Addr{addr}, nil
+		}
+		if addr, ok := hosts[host]; ok {
+			return []netip.Addr{netip.MustParseAddr(addr)}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return f
+}
+
+// hostURL returns the URL of server with its address replaced by host.
+func hostURL(t *testing.T, server *httptest.Server, host, path string) string {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+	u.Host = net.JoinHostPort(host, u.Port())
+	u.Path = path
+	return u.String()
+}
+
+func TestCheckAddrs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		host    string
+		addrs   []string
+		allowed bool
+	}{
+		{
+			name:    "allowed host with public address",
+			policy:  Policy{AllowedHosts: []string{"wiki.corp.example"}},
+			host:    "wiki.corp.example",
+			addrs:   []string{"203.0.113.10"},
+			allowed: true,
+		},
+		{
+			name:    "wildcard subdomain with private address",
+			policy:  Policy{AllowedHosts: []string{"*.corp.example"}},
+			host:    "cdn.corp.example",
+			addrs:   []string{"10.1.2.3"},
+			allowed: true,
+		},
+		{
+			name:   "subdomain pattern does not match other hosts",
+			policy: Policy{AllowedHosts: []string{"*.corp.example"}},
+			host:   "corp.example.attacker.test",
+			addrs:  []string{"203.0.113.10"},
+		},
+		{
+			name:   "any host resolving to loopback",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "rebind.attacker.test",
+			addrs:  []string{"127.0.0.1"},
+		},
+		{
+			name:   "any host resolving to IPv6 loopback",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "rebind.attacker.test",
+			addrs:  []string{"::1"},
+		},
+		{
+			name:   "allowed host resolving to instance metadata",
+			policy: Policy{AllowedHosts: []string{"*.corp.example"}},
+			host:   "metadata.corp.example",
+			addrs:  []string{"169.254.169.254"},
+		},
+		{
+			name:   "allowed host resolving to IPv6 instance metadata",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "metadata.attacker.test",
+			addrs:  []string{"fd00:ec2::254"},
+		},
+		{
+			name:   "allowed host resolving to unspecified address",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "zero.attacker.test",
+			addrs:  []string{"0.0.0.0"},
+		},
+		{
+			name:   "allowed host with one restricted address",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "mixed.attacker.test",
+			addrs:  []string{"203.0.113.10", "fe80::1"},
+		},
+		{
+			name:   "IPv4-mapped IPv6 address",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "mapped.attacker.test",
+			addrs:  []string{"::ffff:127.0.0.1"},
+		},
+		{
+			name: "loopback covered by allowed CIDR",
+			policy: Policy{
+				AllowedHosts: []string{"localhost"},
+				AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+			},
+			host:    "localhost",
+			addrs:   []string{"127.0.0.1"},
+			allowed: true,
+		},
+		{
+			name:    "any host in allowed CIDR",
+			policy:  Policy{AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+			host:    "build.internal",
+			addrs:   []string{"10.20.30.40"},
+			allowed: true,
+		},
+		{
+			name:   "host partially outside allowed CIDR",
+			policy: Policy{AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+			host:   "build.internal",
+			addrs:  []string{"10.20.30.40", "192.168.1.1"},
+		},
+		{
+			name:   "host without addresses",
+			policy: Policy{AllowedHosts: []string{"*"}},
+			host:   "empty.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			addrs := make([]netip.Addr, 0, len(tt.addrs))
+			for _, addr := range tt.addrs {
+				addrs = append(addrs, netip.MustParseAddr(addr))
+			}
+
+			err := New(tt.policy).checkAddrs(tt.host, addrs)
+			if tt.allowed && err != nil {
+				t.Fatalf("Expected %s to be allowed, got: %v", tt.host, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrNotAllowed) {
+				t.Fatalf("Expected ErrNotAllowed, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetch_Policy(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			_, _ = w.Write(pngData)
+		case "/redirect-external":
+			http.Redirect(w, r, "http://external.example/image.png", http.StatusFound)
+		case "/redirect-loop":
+			http.Redirect(w, r, "/redirect-loop", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// Every name resolves to the test server's loopback address
+	hosts := map[string]string{
+		"localhost":            "127.0.0.1",
+		"wiki.corp.example":    "127.0.0.1",
+		"rebind.attacker.test": "127.0.0.1",
+		"external.example":     "203.0.113.10",
+	}
+	loopback := []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		host        string
+		path        string
+		wantErr     error
+		wantErrText string
+	}{
+		{
+			name:   "address in allowed CIDR",
+			policy: Policy{AllowedCIDRs: loopback},
+			host:   "127.0.0.1",
+			path:   "/image.png",
+		},
+		{
+			name:   "host name resolving into allowed CIDR",
+			policy: Policy{AllowedCIDRs: loopback},
+			host:   "localhost",
+			path:   "/image.png",
+		},
+		{
+			name:    "any host resolving to loopback",
+			policy:  Policy{AllowedHosts: []string{"*"}},
+			host:    "rebind.attacker.test",
+			path:    "/image.png",
+			wantErr: ErrNotAllowed,
+		},
+		{
+			name:    "allowed host resolving to loopback",
+			policy:  Policy{AllowedHosts: []string{"wiki.corp.example"}},
+			host:    "wiki.corp.example",
+			path:    "/image.png",
+			wantErr: ErrNotAllowed,
+		},
+		{
+			name:    "host outside the policy",
+			policy:  Policy{AllowedHosts: []string{"wiki.corp.example"}},
+			host:    "localhost",
+			path:    "/image.png",
+			wantErr: ErrNotAllowed,
+		},
+		{
+			name:    "redirect leaving allowed CIDR",
+			policy:  Policy{AllowedCIDRs: loopback},
+			host:    "127.0.0.1",
+			path:    "/redirect-external",
+			wantErr: ErrNotAllowed,
+		},
+		{
+			name:        "redirect loop",
+			policy:      Policy{AllowedCIDRs: loopback},
+			host:        "127.0.0.1",
+			path:        "/redirect-loop",
+			wantErrText: "stopped after 5 redirects",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resource, err := newTestFetcher(tt.policy, hosts).Fetch(context.Background(), hostURL(t, server, tt.host, tt.path))
+			switch {
+			case tt.wantErrText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("Expected error containing %q, got: %v", tt.wantErrText, err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got: %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Fatalf("Failed to fetch: %v", err)
+			default:
+				if resource.MediaType != "image/png" || resource.Filename != "image.png" || !bytes.Equal(resource.Data, pngData) {
+					t.Errorf("Unexpected resource: %s %s (%d bytes)", resource.MediaType, resource.Filename, len(resource.Data))
+				}
+			}
+		})
+	}
+}
+
+func TestFetch_Limits(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large-declared":
+			_, _ = w.Write(append(bytes.Clone(pngData), make([]byte, 64)...))
+		case "/large-chunked":
+			// Flushing before the body is complete omits Content-Length
+			_, _ = w.Write(pngData)
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(make([]byte, 64))
+		case "/page.html":
+			_, _ = w.Write([]byte("<!DOCTYPE html><html><body>page</body></html>"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	policy := Policy{
+		AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+		MaxBytes:     int64(len(pngData)) + 32,
+	}
+
+	tests := []struct {
+		path    string
+		wantErr error
+	}{
+		{path: "/large-declared", wantErr: ErrTooLarge},
+		{path: "/large-chunked", wantErr: ErrTooLarge},
+		{path: "/page.html", wantErr: ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newTestFetcher(policy, nil).Fetch(context.Background(), server.URL+tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFetch_CacheRevalidation(t *testing.T) {
+	t.Parallel()
+
+	var downloads, revalidations atomic.Int32
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/uncacheable.png" {
+			downloads.Add(1)
+			_, _ = w.Write(pngData)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		_, _ = w.Write(pngData)
+	}))
+	t.Cleanup(server.Close)
+
+	cache, err := NewCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	fetcher := newTestFetcher(Policy{AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}}, nil, WithCache(cache))
+
+	for range 3 {
+		resource, err := fetcher.Fetch(context.Background(), server.URL+"/image.png")
+		if err != nil {
+			t.Fatalf("Failed to fetch: %v", err)
+		}
+		if resource.MediaType != "image/png" || !bytes.Equal(resource.Data, pngData) {
+			t.Fatalf("Unexpected resource: %s (%d bytes)", resource.MediaType, len(resource.Data))
+		}
+	}
+	if downloads.Load() != 1 || revalidations.Load() != 2 {
+		t.Errorf("Expected 1 download and 2 revalidations, got %d and %d", downloads.Load(), revalidations.Load())
+	}
+
+	// Expired entries are downloaded again
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/image.png"); err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	if downloads.Load() != 2 {
+		t.Errorf("Expected expired entry to be downloaded again, got %d downloads", downloads.Load())
+	}
+
+	// Responses without validators are never cached
+	downloads.Store(0)
+	for range 2 {
+		if _, err := fetcher.Fetch(context.Background(), server.URL+"/uncacheable.png"); err != nil {
+			t.Fatalf("Failed to fetch: %v", err)
+		}
+	}
+	if downloads.Load() != 2 {
+		t.Errorf("Expected uncacheable resource to be downloaded every time, got %d downloads", downloads.Load())
+	}
+}